@@ -19,5 +19,10 @@ const (
 	DatacenterKey    string = "consul.hashicorp.com/source-datacenter"
 	MigrateEntryKey  string = "consul.hashicorp.com/migrate-entry"
 	MigrateEntryTrue string = "true"
+	ServiceNameKey   string = "consul.hashicorp.com/service-name"
 	SourceValue      string = "kubernetes"
+
+	// RevisionSubsetsLabelKey is the annotation on a ServiceResolver naming
+	// the pod label whose values get a subset each.
+	RevisionSubsetsLabelKey string = "consul.hashicorp.com/revision-subsets-label"
 )
@@ -39,7 +39,7 @@ func ValidateConfigEntry(
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 	// On create we need to validate that there isn't already a resource with
-	// the same name in a different namespace if we're need to mapping all Kube
+	// the same Consul name in a different namespace if we're need to mapping all Kube
 	// resources to a single Consul namespace. The only case where we're not
 	// mapping all kube resources to a single Consul namespace is when we
 	// are running Consul enterprise with namespace mirroring.
@@ -52,11 +52,11 @@ func ValidateConfigEntry(
 			return admission.Errored(http.StatusInternalServerError, err)
 		}
 		for _, item := range list {
-			if item.KubernetesName() == cfgEntry.KubernetesName() {
+			if item.ConsulName() == cfgEntry.ConsulName() {
 				return admission.Errored(http.StatusBadRequest,
 					fmt.Errorf("%s resource with name %q is already defined – all %s resources must have unique names across namespaces",
 						cfgEntry.KubeKind(),
-						cfgEntry.KubernetesName(),
+						cfgEntry.ConsulName(),
 						cfgEntry.KubeKind()))
 			}
 		}
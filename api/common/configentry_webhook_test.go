@@ -64,6 +64,35 @@ func TestValidateConfigEntry(t *testing.T) {
 			expAllow:      false,
 			expErrMessage: "mockkind resource with name \"foo\" is already defined – all mockkind resources must have unique names across namespaces",
 		},
+		"duplicate Consul name": {
+			existingResources: []ConfigEntryResource{&mockConfigEntry{
+				MockName:       "foo",
+				MockNamespace:  "default",
+				MockConsulName: "bar",
+			}},
+			newResource: &mockConfigEntry{
+				MockName:       "baz",
+				MockNamespace:  otherNS,
+				MockConsulName: "bar",
+				Valid:          true,
+			},
+			expAllow:      false,
+			expErrMessage: "mockkind resource with name \"bar\" is already defined – all mockkind resources must have unique names across namespaces",
+		},
+		"same name, different Consul names": {
+			existingResources: []ConfigEntryResource{&mockConfigEntry{
+				MockName:       "foo",
+				MockNamespace:  "default",
+				MockConsulName: "bar",
+			}},
+			newResource: &mockConfigEntry{
+				MockName:       "foo",
+				MockNamespace:  otherNS,
+				MockConsulName: "baz",
+				Valid:          true,
+			},
+			expAllow: true,
+		},
 		"duplicate name, namespaces enabled": {
 			existingResources: []ConfigEntryResource{&mockConfigEntry{
 				MockName:      "foo",
@@ -155,9 +184,10 @@ func (in *mockConfigEntryLister) List(_ context.Context) ([]ConfigEntryResource,
 }
 
 type mockConfigEntry struct {
-	MockName      string
-	MockNamespace string
-	Valid         bool
+	MockName       string
+	MockNamespace  string
+	MockConsulName string
+	Valid          bool
 }
 
 func (in *mockConfigEntry) GetNamespace() string {
@@ -301,6 +331,9 @@ func (in *mockConfigEntry) KubeKind() string {
 }
 
 func (in *mockConfigEntry) ConsulName() string {
+	if in.MockConsulName != "" {
+		return in.MockConsulName
+	}
 	return in.MockName
 }
 
@@ -0,0 +1,15 @@
+package common
+
+// IsManagedBy returns true if meta, the meta of a Consul config entry, marks
+// the entry as created from a Kubernetes custom resource by a controller in
+// some datacenter. Entries that aren't managed by Kubernetes must not be
+// overwritten, unless they're being migrated.
+func IsManagedBy(meta map[string]string) bool {
+	return meta[SourceKey] == SourceValue && meta[DatacenterKey] != ""
+}
+
+// EntryDatacenter returns the datacenter whose controller manages the Consul
+// config entry with meta, or an empty string if it isn't managed by one.
+func EntryDatacenter(meta map[string]string) string {
+	return meta[DatacenterKey]
+}
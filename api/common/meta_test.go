@@ -0,0 +1,49 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsManagedBy(t *testing.T) {
+	cases := map[string]struct {
+		meta          map[string]string
+		expManaged    bool
+		expDatacenter string
+	}{
+		"managed": {
+			meta: map[string]string{
+				SourceKey:     SourceValue,
+				DatacenterKey: "dc1",
+			},
+			expManaged:    true,
+			expDatacenter: "dc1",
+		},
+		"other source": {
+			meta: map[string]string{
+				SourceKey:     "terraform",
+				DatacenterKey: "dc1",
+			},
+			expDatacenter: "dc1",
+		},
+		"no datacenter": {
+			meta: map[string]string{
+				SourceKey: SourceValue,
+			},
+		},
+		"unrelated meta": {
+			meta: map[string]string{
+				"foo": "bar",
+			},
+		},
+		"missing meta": {},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.expManaged, IsManagedBy(c.meta))
+			require.Equal(t, c.expDatacenter, EntryDatacenter(c.meta))
+		})
+	}
+}
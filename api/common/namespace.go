@@ -0,0 +1,16 @@
+package common
+
+import (
+	"github.com/hashicorp/consul-k8s/namespaces"
+)
+
+// DefaultNamespace returns namespace, the namespace field of a config entry
+// resource, or if it's empty the Consul namespace that resources in the
+// Kubernetes namespace kubeNS map to. It returns an empty namespace if Consul
+// namespaces aren't enabled because namespace fields can't be set in OSS.
+func DefaultNamespace(namespace, kubeNS string, consulNamespacesEnabled bool, destinationNamespace string, mirroring bool, prefix string) string {
+	if namespace != "" || !consulNamespacesEnabled {
+		return namespace
+	}
+	return namespaces.ConsulNamespace(kubeNS, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
+}
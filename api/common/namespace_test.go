@@ -0,0 +1,58 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultNamespace(t *testing.T) {
+	cases := map[string]struct {
+		namespace            string
+		enabled              bool
+		destinationNamespace string
+		mirroring            bool
+		prefix               string
+		expNamespace         string
+	}{
+		"disabled": {
+			destinationNamespace: "foo",
+			expNamespace:         "",
+		},
+		"disabled with namespace set": {
+			namespace:    "other",
+			expNamespace: "other",
+		},
+		"destinationNS": {
+			enabled:              true,
+			destinationNamespace: "foo",
+			expNamespace:         "foo",
+		},
+		"mirroringEnabledWithoutPrefix": {
+			enabled:              true,
+			destinationNamespace: "foo",
+			mirroring:            true,
+			expNamespace:         "bar",
+		},
+		"mirroringWithPrefix": {
+			enabled:              true,
+			destinationNamespace: "foo",
+			mirroring:            true,
+			prefix:               "ns-",
+			expNamespace:         "ns-bar",
+		},
+		"namespace set": {
+			namespace:    "other",
+			enabled:      true,
+			mirroring:    true,
+			prefix:       "ns-",
+			expNamespace: "other",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.expNamespace, DefaultNamespace(c.namespace, "bar", c.enabled, c.destinationNamespace, c.mirroring, c.prefix))
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/hashicorp/consul-k8s/namespaces"
+	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -31,6 +31,7 @@ func init() {
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type IngressGateway struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -217,8 +218,16 @@ func (in *IngressGateway) Validate(namespacesEnabled bool) error {
 	var errs field.ErrorList
 	path := field.NewPath("spec")
 
+	listenerPorts := make(map[int]int)
 	for i, v := range in.Spec.Listeners {
 		errs = append(errs, v.validate(path.Child("listeners").Index(i))...)
+		if j, ok := listenerPorts[v.Port]; ok {
+			errs = append(errs, field.Invalid(path.Child("listeners").Index(i).Child("port"),
+				v.Port,
+				fmt.Sprintf("port is already used by listener %d, listener ports must be unique", j)))
+			continue
+		}
+		listenerPorts[v.Port] = i
 	}
 
 	errs = append(errs, in.validateNamespaces(namespacesEnabled)...)
@@ -233,19 +242,10 @@ func (in *IngressGateway) Validate(namespacesEnabled bool) error {
 
 // DefaultNamespaceFields sets the namespace field on spec.listeners[].services to their default values if namespaces are enabled.
 func (in *IngressGateway) DefaultNamespaceFields(consulNamespacesEnabled bool, destinationNamespace string, mirroring bool, prefix string) {
-	// If namespaces are enabled we want to set the namespace fields to their
-	// defaults. If namespaces are not enabled (i.e. OSS) we don't set the
-	// namespace fields because this would cause errors
-	// making API calls (because namespace fields can't be set in OSS).
-	if consulNamespacesEnabled {
-		// Default to the current namespace (i.e. the namespace of the config entry).
-		namespace := namespaces.ConsulNamespace(in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
-		for i, listener := range in.Spec.Listeners {
-			for j, service := range listener.Services {
-				if service.Namespace == "" {
-					in.Spec.Listeners[i].Services[j].Namespace = namespace
-				}
-			}
+	// Default to the current namespace (i.e. the namespace of the config entry).
+	for i, listener := range in.Spec.Listeners {
+		for j, service := range listener.Services {
+			in.Spec.Listeners[i].Services[j].Namespace = common.DefaultNamespace(service.Namespace, in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
 		}
 	}
 }
@@ -0,0 +1,103 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestHandleIngressGateway_ListenerPorts(t *testing.T) {
+	cases := map[string]struct {
+		listeners     []IngressListener
+		expAllowed    bool
+		expErrMessage string
+	}{
+		"listeners on different ports": {
+			listeners: []IngressListener{
+				{
+					Port:     8080,
+					Protocol: "tcp",
+					Services: []IngressService{{Name: "foo"}},
+				},
+				{
+					Port:     9090,
+					Protocol: "tcp",
+					Services: []IngressService{{Name: "bar"}},
+				},
+			},
+			expAllowed: true,
+		},
+		"listeners on the same port": {
+			listeners: []IngressListener{
+				{
+					Port:     8080,
+					Protocol: "tcp",
+					Services: []IngressService{{Name: "foo"}},
+				},
+				{
+					Port:     9090,
+					Protocol: "tcp",
+					Services: []IngressService{{Name: "bar"}},
+				},
+				{
+					Port:     8080,
+					Protocol: "tcp",
+					Services: []IngressService{{Name: "baz"}},
+				},
+			},
+			expAllowed:    false,
+			expErrMessage: `ingressgateway.consul.hashicorp.com "foo" is invalid: spec.listeners[2].port: Invalid value: 8080: port is already used by listener 0, listener ports must be unique`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			resource := &IngressGateway{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: IngressGatewaySpec{
+					Listeners: c.listeners,
+				},
+			}
+			marshalledObject, err := json.Marshal(resource)
+			require.NoError(t, err)
+
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &IngressGateway{}, &IngressGatewayList{})
+			client := fake.NewClientBuilder().WithScheme(s).Build()
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &IngressGatewayWebhook{
+				Client:  client,
+				Logger:  logrtest.TestLogger{T: t},
+				decoder: decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:      resource.KubernetesName(),
+					Namespace: resource.Namespace,
+					Operation: admissionv1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllowed, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message)
+			}
+		})
+	}
+}
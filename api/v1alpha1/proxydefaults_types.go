@@ -31,6 +31,7 @@ func init() {
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type ProxyDefaults struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -62,6 +63,10 @@ type ProxyDefaultsSpec struct {
 	MeshGateway MeshGatewayConfig `json:"meshGateway,omitempty"`
 	// Expose controls the default expose path configuration for Envoy.
 	Expose ExposeConfig `json:"expose,omitempty"`
+	// Mode is the default mode proxies are registered with, one of direct or
+	// transparent. It's overridden by the mode of the ServiceDefaults of a
+	// service and by the consul.hashicorp.com/proxy-mode annotation of a pod.
+	Mode ProxyMode `json:"mode,omitempty"`
 }
 
 func (in *ProxyDefaults) GetObjectMeta() metav1.ObjectMeta {
@@ -148,6 +153,7 @@ func (in *ProxyDefaults) ToConsul(datacenter string) capi.ConfigEntry {
 	return &capi.ProxyConfigEntry{
 		Kind:        in.ConsulKind(),
 		Name:        in.ConsulName(),
+		Mode:        in.Spec.Mode.toConsul(),
 		MeshGateway: in.Spec.MeshGateway.toConsul(),
 		Expose:      in.Spec.Expose.toConsul(),
 		Config:      consulConfig,
@@ -174,6 +180,9 @@ func (in *ProxyDefaults) Validate(namespacesEnabled bool) error {
 	if err := in.validateConfig(path.Child("config")); err != nil {
 		allErrs = append(allErrs, err)
 	}
+	if err := in.Spec.Mode.validate(path.Child("mode")); err != nil {
+		allErrs = append(allErrs, err)
+	}
 	allErrs = append(allErrs, in.Spec.Expose.validate(path.Child("expose"))...)
 	if len(allErrs) > 0 {
 		return apierrors.NewInvalid(
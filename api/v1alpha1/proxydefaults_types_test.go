@@ -47,6 +47,7 @@ func TestProxyDefaults_MatchesConsul(t *testing.T) {
 				},
 				Spec: ProxyDefaultsSpec{
 					Config: json.RawMessage(`{"envoy_tracing_json": "{\"http\":{\"name\":\"envoy.zipkin\",\"config\":{\"collector_cluster\":\"zipkin\",\"collector_endpoint\":\"/api/v1/spans\",\"shared_span_context\":false}}}"}`),
+					Mode:   "transparent",
 					MeshGateway: MeshGatewayConfig{
 						Mode: "local",
 					},
@@ -75,6 +76,7 @@ func TestProxyDefaults_MatchesConsul(t *testing.T) {
 				Config: map[string]interface{}{
 					"envoy_tracing_json": "{\"http\":{\"name\":\"envoy.zipkin\",\"config\":{\"collector_cluster\":\"zipkin\",\"collector_endpoint\":\"/api/v1/spans\",\"shared_span_context\":false}}}",
 				},
+				Mode: capi.ProxyModeTransparent,
 				MeshGateway: capi.MeshGatewayConfig{
 					Mode: capi.MeshGatewayModeLocal,
 				},
@@ -147,6 +149,7 @@ func TestProxyDefaults_ToConsul(t *testing.T) {
 				},
 				Spec: ProxyDefaultsSpec{
 					Config: json.RawMessage(`{"envoy_tracing_json": "{\"http\":{\"name\":\"envoy.zipkin\",\"config\":{\"collector_cluster\":\"zipkin\",\"collector_endpoint\":\"/api/v1/spans\",\"shared_span_context\":false}}}"}`),
+					Mode:   "direct",
 					MeshGateway: MeshGatewayConfig{
 						Mode: "remote",
 					},
@@ -176,6 +179,7 @@ func TestProxyDefaults_ToConsul(t *testing.T) {
 				Config: map[string]interface{}{
 					"envoy_tracing_json": "{\"http\":{\"name\":\"envoy.zipkin\",\"config\":{\"collector_cluster\":\"zipkin\",\"collector_endpoint\":\"/api/v1/spans\",\"shared_span_context\":false}}}",
 				},
+				Mode: capi.ProxyModeDirect,
 				MeshGateway: capi.MeshGatewayConfig{
 					Mode: capi.MeshGatewayModeRemote,
 				},
@@ -213,6 +217,68 @@ func TestProxyDefaults_ToConsul(t *testing.T) {
 	}
 }
 
+func TestProxyDefaults_Validate(t *testing.T) {
+	cases := map[string]struct {
+		mode   ProxyMode
+		expose ExposeConfig
+		expErr string
+	}{
+		"no mode": {},
+		"direct mode": {
+			mode: "direct",
+		},
+		"transparent mode": {
+			mode: "transparent",
+		},
+		"invalid mode": {
+			mode:   "magic",
+			expErr: `proxydefaults.consul.hashicorp.com "global" is invalid: spec.mode: Invalid value: "magic": must be one of "direct", "transparent", ""`,
+		},
+		"valid expose path": {
+			expose: ExposeConfig{
+				Paths: []ExposePath{
+					{
+						ListenerPort:  21500,
+						Path:          "/health",
+						LocalPathPort: 8080,
+						Protocol:      "http",
+					},
+				},
+			},
+		},
+		"invalid expose path": {
+			expose: ExposeConfig{
+				Paths: []ExposePath{
+					{
+						Path:          "health",
+						LocalPathPort: 8080,
+					},
+				},
+			},
+			expErr: `proxydefaults.consul.hashicorp.com "global" is invalid: [spec.expose.paths[0].path: Invalid value: "health": must begin with a '/', spec.expose.paths[0].listenerPort: Invalid value: 0: must be between 1 and 65535]`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			proxyDefaults := ProxyDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: common.Global,
+				},
+				Spec: ProxyDefaultsSpec{
+					Mode:   c.mode,
+					Expose: c.expose,
+				},
+			}
+			err := proxyDefaults.Validate(false)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestProxyDefaults_ValidateConfigValid(t *testing.T) {
 	cases := map[string]json.RawMessage{
 		"envoy_tracing_json":                     json.RawMessage(`{"envoy_tracing_json": "{\"http\":{\"name\":\"envoy.zipkin\",\"config\":{\"collector_cluster\":\"zipkin\",\"collector_endpoint\":\"/api/v1/spans\",\"shared_span_context\":false}}}"}`),
@@ -1,8 +1,12 @@
 package v1alpha1
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -26,6 +30,7 @@ func init() {
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type ServiceDefaults struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -55,6 +60,86 @@ type ServiceDefaultsSpec struct {
 	// ExternalSNI is an optional setting that allows for the TLS SNI value
 	// to be changed to a non-connect value when federating with an external system.
 	ExternalSNI string `json:"externalSNI,omitempty"`
+	// Mode is the mode the proxies of this service are registered with, one of
+	// direct or transparent. It overrides the mode of ProxyDefaults and is
+	// overridden by the consul.hashicorp.com/proxy-mode annotation of a pod.
+	Mode ProxyMode `json:"mode,omitempty"`
+	// TransparentProxy controls the configuration of the proxies of this
+	// service when they're in transparent mode.
+	TransparentProxy *TransparentProxy `json:"transparentProxy,omitempty"`
+	// UpstreamConfig controls default configuration settings that apply across all upstreams,
+	// and per-upstream configuration overrides. Note that per-upstream configuration applies
+	// across all federated datacenters to the pairing of source and upstream destination services.
+	UpstreamConfig *Upstreams `json:"upstreamConfig,omitempty"`
+}
+
+type Upstreams struct {
+	// Defaults contains default configuration for all upstreams of a given
+	// service. The name field must be empty.
+	Defaults *Upstream `json:"defaults,omitempty"`
+	// Overrides is a slice of per-service configuration. The name field is
+	// required.
+	Overrides []Upstream `json:"overrides,omitempty"`
+}
+
+type Upstream struct {
+	// Name is only accepted within a service-defaults config entry.
+	Name string `json:"name,omitempty"`
+	// Namespace is only accepted within a service-defaults config entry.
+	Namespace string `json:"namespace,omitempty"`
+	// EnvoyListenerJSON is a complete override ("escape hatch") for the upstream's
+	// listener.
+	// Note: This escape hatch is NOT compatible with the discovery chain and
+	// will be ignored if a discovery chain is active.
+	EnvoyListenerJSON string `json:"envoyListenerJSON,omitempty"`
+	// EnvoyClusterJSON is a complete override ("escape hatch") for the upstream's
+	// cluster. The Connect client TLS certificate and context will be injected
+	// overriding any TLS settings present.
+	// Note: This escape hatch is NOT compatible with the discovery chain and
+	// will be ignored if a discovery chain is active.
+	EnvoyClusterJSON string `json:"envoyClusterJSON,omitempty"`
+	// Protocol describes the upstream's service protocol. Valid values are "tcp",
+	// "http" and "grpc". Anything else is treated as tcp. This enables protocol
+	// aware features like per-request metrics and connection pooling, tracing,
+	// routing etc.
+	Protocol string `json:"protocol,omitempty"`
+	// ConnectTimeoutMs is the number of milliseconds to timeout making a new
+	// connection to this upstream. Defaults to 5000 (5 seconds) if not set.
+	ConnectTimeoutMs int `json:"connectTimeoutMs,omitempty"`
+	// Limits are the set of limits that are applied to the proxy for a specific upstream of a
+	// service instance.
+	Limits *UpstreamLimits `json:"limits,omitempty"`
+	// PassiveHealthCheck configuration determines how upstream proxy instances will
+	// be monitored for removal from the load balancing pool.
+	PassiveHealthCheck *PassiveHealthCheck `json:"passiveHealthCheck,omitempty"`
+	// MeshGatewayConfig controls how Mesh Gateways are configured and used.
+	MeshGateway MeshGatewayConfig `json:"meshGateway,omitempty"`
+}
+
+// UpstreamLimits describes the limits that are associated with a specific
+// upstream of a service instance.
+type UpstreamLimits struct {
+	// MaxConnections is the maximum number of connections the local proxy can
+	// make to the upstream service.
+	MaxConnections *int `json:"maxConnections,omitempty"`
+	// MaxPendingRequests is the maximum number of requests that will be queued
+	// waiting for an available connection. This is mostly applicable to HTTP/1.1
+	// clusters since all HTTP/2 requests are streamed over a single
+	// connection.
+	MaxPendingRequests *int `json:"maxPendingRequests,omitempty"`
+	// MaxConcurrentRequests is the maximum number of in-flight requests that will be allowed
+	// to the upstream cluster at a point in time. This is mostly applicable to HTTP/2
+	// clusters since all HTTP/1.1 requests are limited by MaxConnections.
+	MaxConcurrentRequests *int `json:"maxConcurrentRequests,omitempty"`
+}
+
+type PassiveHealthCheck struct {
+	// Interval between health check analysis sweeps. Each sweep may remove
+	// hosts or return hosts to the pool.
+	Interval time.Duration `json:"interval,omitempty"`
+	// MaxFailures is the count of consecutive failures that results in a host
+	// being removed from the pool.
+	MaxFailures uint32 `json:"maxFailures,omitempty"`
 }
 
 // ExposeConfig describes HTTP paths to expose through Envoy outside of Connect.
@@ -160,13 +245,16 @@ func (in *ServiceDefaults) SyncedConditionStatus() corev1.ConditionStatus {
 // ToConsul converts the entry into it's Consul equivalent struct.
 func (in *ServiceDefaults) ToConsul(datacenter string) capi.ConfigEntry {
 	return &capi.ServiceConfigEntry{
-		Kind:        in.ConsulKind(),
-		Name:        in.ConsulName(),
-		Protocol:    in.Spec.Protocol,
-		MeshGateway: in.Spec.MeshGateway.toConsul(),
-		Expose:      in.Spec.Expose.toConsul(),
-		ExternalSNI: in.Spec.ExternalSNI,
-		Meta:        meta(datacenter),
+		Kind:             in.ConsulKind(),
+		Name:             in.ConsulName(),
+		Protocol:         in.Spec.Protocol,
+		Mode:             in.Spec.Mode.toConsul(),
+		TransparentProxy: in.Spec.TransparentProxy.toConsul(),
+		MeshGateway:      in.Spec.MeshGateway.toConsul(),
+		Expose:           in.Spec.Expose.toConsul(),
+		ExternalSNI:      in.Spec.ExternalSNI,
+		UpstreamConfig:   in.Spec.UpstreamConfig.toConsul(),
+		Meta:             meta(datacenter),
 	}
 }
 
@@ -180,6 +268,18 @@ func (in *ServiceDefaults) Validate(namespacesEnabled bool) error {
 		allErrs = append(allErrs, err)
 	}
 	allErrs = append(allErrs, in.Spec.Expose.validate(path.Child("expose"))...)
+	if err := in.Spec.Mode.validate(path.Child("mode")); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	if err := in.Spec.TransparentProxy.validate(path.Child("transparentProxy")); err != nil {
+		allErrs = append(allErrs, err)
+	}
+	// The transparent proxy config only applies to proxies in transparent mode.
+	if in.Spec.Mode == ProxyMode(capi.ProxyModeDirect) && in.Spec.TransparentProxy != nil {
+		allErrs = append(allErrs, field.Forbidden(path.Child("transparentProxy"),
+			fmt.Sprintf("can't be set if mode is %q", capi.ProxyModeDirect)))
+	}
+	allErrs = append(allErrs, in.Spec.UpstreamConfig.validate(path.Child("upstreamConfig"), namespacesEnabled)...)
 
 	if len(allErrs) > 0 {
 		return apierrors.NewInvalid(
@@ -190,9 +290,15 @@ func (in *ServiceDefaults) Validate(namespacesEnabled bool) error {
 	return nil
 }
 
-// DefaultNamespaceFields has no behaviour here as service-defaults have no namespace specific fields.
-func (in *ServiceDefaults) DefaultNamespaceFields(_ bool, _ string, _ bool, _ string) {
-	return
+// DefaultNamespaceFields sets the namespace of the upstream overrides that
+// don't set one to the Consul namespace of the config entry.
+func (in *ServiceDefaults) DefaultNamespaceFields(consulNamespacesEnabled bool, destinationNamespace string, mirroring bool, prefix string) {
+	if in.Spec.UpstreamConfig == nil {
+		return
+	}
+	for i, override := range in.Spec.UpstreamConfig.Overrides {
+		in.Spec.UpstreamConfig.Overrides[i].Namespace = common.DefaultNamespace(override.Namespace, in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
+	}
 }
 
 // MatchesConsul returns true if entry has the same config as this struct.
@@ -202,7 +308,22 @@ func (in *ServiceDefaults) MatchesConsul(candidate capi.ConfigEntry) bool {
 		return false
 	}
 	// No datacenter is passed to ToConsul as we ignore the Meta field when checking for equality.
-	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ServiceConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty())
+	return cmp.Equal(in.ToConsul(""), configEntry, cmpopts.IgnoreFields(capi.ServiceConfigEntry{}, "Namespace", "Meta", "ModifyIndex", "CreateIndex"), cmpopts.IgnoreUnexported(), cmpopts.EquateEmpty(),
+		cmp.Comparer(transparentProxyEqual))
+}
+
+// transparentProxyEqual returns true if a and b are equal, treating nil as the
+// empty config since Consul returns an empty TransparentProxy for entries
+// written without one.
+func transparentProxyEqual(a, b *capi.TransparentProxyConfig) bool {
+	var empty capi.TransparentProxyConfig
+	if a == nil {
+		a = &empty
+	}
+	if b == nil {
+		b = &empty
+	}
+	return *a == *b
 }
 
 func (in *ServiceDefaults) ConsulGlobalResource() bool {
@@ -226,6 +347,92 @@ func (e ExposeConfig) toConsul() capi.ExposeConfig {
 	}
 }
 
+func (in *Upstreams) toConsul() *capi.UpstreamConfiguration {
+	if in == nil {
+		return nil
+	}
+	var overrides []*capi.UpstreamConfig
+	for _, override := range in.Overrides {
+		overrides = append(overrides, override.toConsul())
+	}
+	var defaults *capi.UpstreamConfig
+	if in.Defaults != nil {
+		defaults = in.Defaults.toConsul()
+	}
+	return &capi.UpstreamConfiguration{
+		Defaults:  defaults,
+		Overrides: overrides,
+	}
+}
+
+func (in *Upstreams) validate(path *field.Path, namespacesEnabled bool) field.ErrorList {
+	if in == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if in.Defaults != nil {
+		defaultsPath := path.Child("defaults")
+		if in.Defaults.Name != "" {
+			errs = append(errs, field.Invalid(defaultsPath.Child("name"), in.Defaults.Name, "name must be empty"))
+		}
+		if in.Defaults.Namespace != "" {
+			errs = append(errs, field.Invalid(defaultsPath.Child("namespace"), in.Defaults.Namespace, "namespace must be empty"))
+		}
+		if err := in.Defaults.MeshGateway.validate(defaultsPath.Child("meshGateway")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for i, override := range in.Overrides {
+		overridePath := path.Child("overrides").Index(i)
+		if override.Name == "" {
+			errs = append(errs, field.Invalid(overridePath.Child("name"), override.Name, "name cannot be empty"))
+		}
+		if !namespacesEnabled && override.Namespace != "" {
+			errs = append(errs, field.Invalid(overridePath.Child("namespace"), override.Namespace,
+				"Consul Enterprise namespaces must be enabled to set upstreamConfig.overrides.namespace"))
+		}
+		if err := override.MeshGateway.validate(overridePath.Child("meshGateway")); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func (in Upstream) toConsul() *capi.UpstreamConfig {
+	return &capi.UpstreamConfig{
+		Name:               in.Name,
+		Namespace:          in.Namespace,
+		EnvoyListenerJSON:  in.EnvoyListenerJSON,
+		EnvoyClusterJSON:   in.EnvoyClusterJSON,
+		Protocol:           in.Protocol,
+		ConnectTimeoutMs:   in.ConnectTimeoutMs,
+		Limits:             in.Limits.toConsul(),
+		PassiveHealthCheck: in.PassiveHealthCheck.toConsul(),
+		MeshGateway:        in.MeshGateway.toConsul(),
+	}
+}
+
+func (in *UpstreamLimits) toConsul() *capi.UpstreamLimits {
+	if in == nil {
+		return nil
+	}
+	return &capi.UpstreamLimits{
+		MaxConnections:        in.MaxConnections,
+		MaxPendingRequests:    in.MaxPendingRequests,
+		MaxConcurrentRequests: in.MaxConcurrentRequests,
+	}
+}
+
+func (in *PassiveHealthCheck) toConsul() *capi.PassiveHealthCheck {
+	if in == nil {
+		return nil
+	}
+	return &capi.PassiveHealthCheck{
+		Interval:    in.Interval,
+		MaxFailures: in.MaxFailures,
+	}
+}
+
 func (e ExposeConfig) validate(path *field.Path) []*field.Error {
 	var errs field.ErrorList
 	protocols := []string{"http", "http2"}
@@ -237,6 +444,18 @@ func (e ExposeConfig) validate(path *field.Path) []*field.Error {
 				pathCfg.Path,
 				`must begin with a '/'`))
 		}
+		if invalidPort(pathCfg.ListenerPort) {
+			errs = append(errs, field.Invalid(
+				indexPath.Child("listenerPort"),
+				pathCfg.ListenerPort,
+				"must be between 1 and 65535"))
+		}
+		if invalidPort(pathCfg.LocalPathPort) {
+			errs = append(errs, field.Invalid(
+				indexPath.Child("localPathPort"),
+				pathCfg.LocalPathPort,
+				"must be between 1 and 65535"))
+		}
 		if pathCfg.Protocol != "" && !sliceContains(protocols, pathCfg.Protocol) {
 			errs = append(errs, field.Invalid(
 				indexPath.Child("protocol"),
@@ -39,6 +39,10 @@ func TestServiceDefaults_ToConsul(t *testing.T) {
 				},
 				Spec: ServiceDefaultsSpec{
 					Protocol: "https",
+					Mode:     "transparent",
+					TransparentProxy: &TransparentProxy{
+						OutboundListenerPort: 15001,
+					},
 					MeshGateway: MeshGatewayConfig{
 						Mode: "local",
 					},
@@ -60,12 +64,42 @@ func TestServiceDefaults_ToConsul(t *testing.T) {
 						},
 					},
 					ExternalSNI: "external-sni",
+					UpstreamConfig: &Upstreams{
+						Defaults: &Upstream{
+							Protocol:         "http",
+							ConnectTimeoutMs: 1000,
+							Limits: &UpstreamLimits{
+								MaxConnections:        intPointer(10),
+								MaxPendingRequests:    intPointer(20),
+								MaxConcurrentRequests: intPointer(30),
+							},
+							PassiveHealthCheck: &PassiveHealthCheck{
+								Interval:    2 * time.Second,
+								MaxFailures: 5,
+							},
+							MeshGateway: MeshGatewayConfig{
+								Mode: "local",
+							},
+						},
+						Overrides: []Upstream{
+							{
+								Name:              "upstream-a",
+								EnvoyListenerJSON: "listener-json",
+								EnvoyClusterJSON:  "cluster-json",
+								Protocol:          "grpc",
+							},
+						},
+					},
 				},
 			},
 			&capi.ServiceConfigEntry{
 				Kind:     capi.ServiceDefaults,
 				Name:     "foo",
 				Protocol: "https",
+				Mode:     capi.ProxyModeTransparent,
+				TransparentProxy: &capi.TransparentProxyConfig{
+					OutboundListenerPort: 15001,
+				},
 				MeshGateway: capi.MeshGatewayConfig{
 					Mode: capi.MeshGatewayModeLocal,
 				},
@@ -87,6 +121,32 @@ func TestServiceDefaults_ToConsul(t *testing.T) {
 					},
 				},
 				ExternalSNI: "external-sni",
+				UpstreamConfig: &capi.UpstreamConfiguration{
+					Defaults: &capi.UpstreamConfig{
+						Protocol:         "http",
+						ConnectTimeoutMs: 1000,
+						Limits: &capi.UpstreamLimits{
+							MaxConnections:        intPointer(10),
+							MaxPendingRequests:    intPointer(20),
+							MaxConcurrentRequests: intPointer(30),
+						},
+						PassiveHealthCheck: &capi.PassiveHealthCheck{
+							Interval:    2 * time.Second,
+							MaxFailures: 5,
+						},
+						MeshGateway: capi.MeshGatewayConfig{
+							Mode: capi.MeshGatewayModeLocal,
+						},
+					},
+					Overrides: []*capi.UpstreamConfig{
+						{
+							Name:              "upstream-a",
+							EnvoyListenerJSON: "listener-json",
+							EnvoyClusterJSON:  "cluster-json",
+							Protocol:          "grpc",
+						},
+					},
+				},
 				Meta: map[string]string{
 					common.SourceKey:     common.SourceValue,
 					common.DatacenterKey: "datacenter",
@@ -136,6 +196,10 @@ func TestServiceDefaults_MatchesConsul(t *testing.T) {
 				},
 				Spec: ServiceDefaultsSpec{
 					Protocol: "http",
+					Mode:     "direct",
+					TransparentProxy: &TransparentProxy{
+						OutboundListenerPort: 15001,
+					},
 					MeshGateway: MeshGatewayConfig{
 						Mode: "remote",
 					},
@@ -156,12 +220,42 @@ func TestServiceDefaults_MatchesConsul(t *testing.T) {
 						},
 					},
 					ExternalSNI: "sni-value",
+					UpstreamConfig: &Upstreams{
+						Defaults: &Upstream{
+							Protocol:         "http",
+							ConnectTimeoutMs: 1000,
+							Limits: &UpstreamLimits{
+								MaxConnections:        intPointer(10),
+								MaxPendingRequests:    intPointer(20),
+								MaxConcurrentRequests: intPointer(30),
+							},
+							PassiveHealthCheck: &PassiveHealthCheck{
+								Interval:    2 * time.Second,
+								MaxFailures: 5,
+							},
+							MeshGateway: MeshGatewayConfig{
+								Mode: "local",
+							},
+						},
+						Overrides: []Upstream{
+							{
+								Name:              "upstream-a",
+								EnvoyListenerJSON: "listener-json",
+								EnvoyClusterJSON:  "cluster-json",
+								Protocol:          "grpc",
+							},
+						},
+					},
 				},
 			},
 			&capi.ServiceConfigEntry{
 				Kind:     capi.ServiceDefaults,
 				Name:     "my-test-service",
 				Protocol: "http",
+				Mode:     capi.ProxyModeDirect,
+				TransparentProxy: &capi.TransparentProxyConfig{
+					OutboundListenerPort: 15001,
+				},
 				MeshGateway: capi.MeshGatewayConfig{
 					Mode: capi.MeshGatewayModeRemote,
 				},
@@ -182,9 +276,65 @@ func TestServiceDefaults_MatchesConsul(t *testing.T) {
 					},
 				},
 				ExternalSNI: "sni-value",
+				UpstreamConfig: &capi.UpstreamConfiguration{
+					Defaults: &capi.UpstreamConfig{
+						Protocol:         "http",
+						ConnectTimeoutMs: 1000,
+						Limits: &capi.UpstreamLimits{
+							MaxConnections:        intPointer(10),
+							MaxPendingRequests:    intPointer(20),
+							MaxConcurrentRequests: intPointer(30),
+						},
+						PassiveHealthCheck: &capi.PassiveHealthCheck{
+							Interval:    2 * time.Second,
+							MaxFailures: 5,
+						},
+						MeshGateway: capi.MeshGatewayConfig{
+							Mode: capi.MeshGatewayModeLocal,
+						},
+					},
+					Overrides: []*capi.UpstreamConfig{
+						{
+							Name:              "upstream-a",
+							EnvoyListenerJSON: "listener-json",
+							EnvoyClusterJSON:  "cluster-json",
+							Protocol:          "grpc",
+						},
+					},
+				},
+			},
+			true,
+		},
+		"empty transparent proxy from consul matches": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-test-service",
+				},
+				Spec: ServiceDefaultsSpec{},
+			},
+			&capi.ServiceConfigEntry{
+				Kind:             capi.ServiceDefaults,
+				Name:             "my-test-service",
+				TransparentProxy: &capi.TransparentProxyConfig{},
 			},
 			true,
 		},
+		"different transparent proxy does not match": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-test-service",
+				},
+				Spec: ServiceDefaultsSpec{},
+			},
+			&capi.ServiceConfigEntry{
+				Kind: capi.ServiceDefaults,
+				Name: "my-test-service",
+				TransparentProxy: &capi.TransparentProxyConfig{
+					OutboundListenerPort: 15001,
+				},
+			},
+			false,
+		},
 		"mismatched types does not match": {
 			&ServiceDefaults{
 				ObjectMeta: metav1.ObjectMeta{
@@ -252,6 +402,75 @@ func TestServiceDefaults_Validate(t *testing.T) {
 			},
 			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.meshGateway.mode: Invalid value: "foobar": must be one of "remote", "local", "none", ""`,
 		},
+		"mode": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Mode: "magic",
+				},
+			},
+			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.mode: Invalid value: "magic": must be one of "direct", "transparent", ""`,
+		},
+		"transparentProxy.outboundListenerPort": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					TransparentProxy: &TransparentProxy{
+						OutboundListenerPort: -1,
+					},
+				},
+			},
+			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.transparentProxy.outboundListenerPort: Invalid value: -1: must not be negative`,
+		},
+		"transparentProxy with mode=direct": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Mode: "direct",
+					TransparentProxy: &TransparentProxy{
+						OutboundListenerPort: 15001,
+					},
+				},
+			},
+			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.transparentProxy: Forbidden: can't be set if mode is "direct"`,
+		},
+		"upstreamConfig": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					UpstreamConfig: &Upstreams{
+						Defaults: &Upstream{
+							Name:      "upstream",
+							Namespace: "ns",
+						},
+						Overrides: []Upstream{
+							{
+								Name: "upstream-a",
+							},
+							{
+								Protocol: "http",
+							},
+							{
+								Name:      "upstream-b",
+								Namespace: "ns",
+								MeshGateway: MeshGatewayConfig{
+									Mode: "foobar",
+								},
+							},
+						},
+					},
+				},
+			},
+			`servicedefaults.consul.hashicorp.com "my-service" is invalid: [spec.upstreamConfig.defaults.name: Invalid value: "upstream": name must be empty, spec.upstreamConfig.defaults.namespace: Invalid value: "ns": namespace must be empty, spec.upstreamConfig.overrides[1].name: Invalid value: "": name cannot be empty, spec.upstreamConfig.overrides[2].namespace: Invalid value: "ns": Consul Enterprise namespaces must be enabled to set upstreamConfig.overrides.namespace, spec.upstreamConfig.overrides[2].meshGateway.mode: Invalid value: "foobar": must be one of "remote", "local", "none", ""]`,
+		},
 		"expose.paths[].protocol": {
 			&ServiceDefaults{
 				ObjectMeta: metav1.ObjectMeta{
@@ -261,8 +480,10 @@ func TestServiceDefaults_Validate(t *testing.T) {
 					Expose: ExposeConfig{
 						Paths: []ExposePath{
 							{
-								Protocol: "invalid-protocol",
-								Path:     "/valid-path",
+								ListenerPort:  21500,
+								LocalPathPort: 8080,
+								Protocol:      "invalid-protocol",
+								Path:          "/valid-path",
 							},
 						},
 					},
@@ -279,8 +500,10 @@ func TestServiceDefaults_Validate(t *testing.T) {
 					Expose: ExposeConfig{
 						Paths: []ExposePath{
 							{
-								Protocol: "http",
-								Path:     "invalid-path",
+								ListenerPort:  21500,
+								LocalPathPort: 8080,
+								Protocol:      "http",
+								Path:          "invalid-path",
 							},
 						},
 					},
@@ -288,6 +511,24 @@ func TestServiceDefaults_Validate(t *testing.T) {
 			},
 			`servicedefaults.consul.hashicorp.com "my-service" is invalid: spec.expose.paths[0].path: Invalid value: "invalid-path": must begin with a '/'`,
 		},
+		"expose.paths[].ports": {
+			&ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					Expose: ExposeConfig{
+						Paths: []ExposePath{
+							{
+								Path:          "/health",
+								LocalPathPort: 65536,
+							},
+						},
+					},
+				},
+			},
+			`servicedefaults.consul.hashicorp.com "my-service" is invalid: [spec.expose.paths[0].listenerPort: Invalid value: 0: must be between 1 and 65535, spec.expose.paths[0].localPathPort: Invalid value: 65536: must be between 1 and 65535]`,
+		},
 		"multi-error": {
 			&ServiceDefaults{
 				ObjectMeta: metav1.ObjectMeta{
@@ -300,8 +541,10 @@ func TestServiceDefaults_Validate(t *testing.T) {
 					Expose: ExposeConfig{
 						Paths: []ExposePath{
 							{
-								Protocol: "invalid-protocol",
-								Path:     "invalid-path",
+								ListenerPort:  21500,
+								LocalPathPort: 8080,
+								Protocol:      "invalid-protocol",
+								Path:          "invalid-path",
 							},
 						},
 					},
@@ -323,6 +566,117 @@ func TestServiceDefaults_Validate(t *testing.T) {
 	}
 }
 
+func TestServiceDefaults_MeshGatewayMode(t *testing.T) {
+	cases := map[string]capi.MeshGatewayMode{
+		"":       capi.MeshGatewayModeDefault,
+		"none":   capi.MeshGatewayModeNone,
+		"local":  capi.MeshGatewayModeLocal,
+		"remote": capi.MeshGatewayModeRemote,
+	}
+	for mode, expMode := range cases {
+		t.Run(mode, func(t *testing.T) {
+			serviceDefaults := &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "my-service",
+				},
+				Spec: ServiceDefaultsSpec{
+					MeshGateway: MeshGatewayConfig{
+						Mode: mode,
+					},
+				},
+			}
+			require.NoError(t, serviceDefaults.Validate(false))
+
+			entry := serviceDefaults.ToConsul("datacenter")
+			require.Equal(t, expMode, entry.(*capi.ServiceConfigEntry).MeshGateway.Mode)
+			require.True(t, serviceDefaults.MatchesConsul(entry))
+		})
+	}
+}
+
+func TestServiceDefaults_DefaultNamespaceFields(t *testing.T) {
+	namespaceConfig := map[string]struct {
+		enabled              bool
+		destinationNamespace string
+		mirroring            bool
+		prefix               string
+		expectedDestination  string
+	}{
+		"disabled": {
+			enabled:              false,
+			destinationNamespace: "",
+			mirroring:            false,
+			prefix:               "",
+			expectedDestination:  "",
+		},
+		"destinationNS": {
+			enabled:              true,
+			destinationNamespace: "foo",
+			mirroring:            false,
+			prefix:               "",
+			expectedDestination:  "foo",
+		},
+		"mirroringEnabledWithoutPrefix": {
+			enabled:              true,
+			destinationNamespace: "",
+			mirroring:            true,
+			prefix:               "",
+			expectedDestination:  "bar",
+		},
+		"mirroringWithPrefix": {
+			enabled:              true,
+			destinationNamespace: "",
+			mirroring:            true,
+			prefix:               "ns-",
+			expectedDestination:  "ns-bar",
+		},
+	}
+
+	for name, s := range namespaceConfig {
+		t.Run(name, func(t *testing.T) {
+			input := &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "bar",
+				},
+				Spec: ServiceDefaultsSpec{
+					UpstreamConfig: &Upstreams{
+						Defaults: &Upstream{
+							ConnectTimeoutMs: 1000,
+						},
+						Overrides: []Upstream{
+							{
+								Name: "upstream-a",
+							},
+							{
+								Name:      "upstream-b",
+								Namespace: "other",
+							},
+						},
+					},
+				},
+			}
+			input.DefaultNamespaceFields(s.enabled, s.destinationNamespace, s.mirroring, s.prefix)
+
+			// The namespace of the defaults must stay empty.
+			require.Equal(t, &Upstream{ConnectTimeoutMs: 1000}, input.Spec.UpstreamConfig.Defaults)
+			require.Equal(t, s.expectedDestination, input.Spec.UpstreamConfig.Overrides[0].Namespace)
+			require.Equal(t, "other", input.Spec.UpstreamConfig.Overrides[1].Namespace)
+		})
+	}
+}
+
+func TestServiceDefaults_DefaultNamespaceFieldsWithoutUpstreamConfig(t *testing.T) {
+	input := &ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "bar",
+		},
+	}
+	input.DefaultNamespaceFields(true, "", true, "")
+	require.Nil(t, input.Spec.UpstreamConfig)
+}
+
 func TestServiceDefaults_AddFinalizer(t *testing.T) {
 	serviceDefaults := &ServiceDefaults{}
 	serviceDefaults.AddFinalizer("finalizer")
@@ -429,3 +783,7 @@ func TestServiceDefaults_ObjectMeta(t *testing.T) {
 	}
 	require.Equal(t, meta, serviceDefaults.GetObjectMeta())
 }
+
+func intPointer(i int) *int {
+	return &i
+}
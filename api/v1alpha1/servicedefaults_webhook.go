@@ -2,11 +2,14 @@ package v1alpha1
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/consul-k8s/api/common"
+	"github.com/hashicorp/consul-k8s/namespaces"
 	capi "github.com/hashicorp/consul/api"
+	admissionv1 "k8s.io/api/admission/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -57,7 +60,7 @@ func (v *ServiceDefaultsWebhook) Handle(ctx context.Context, req admission.Reque
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
-	return common.ValidateConfigEntry(ctx,
+	resp := common.ValidateConfigEntry(ctx,
 		req,
 		v.Logger,
 		v,
@@ -66,6 +69,122 @@ func (v *ServiceDefaultsWebhook) Handle(ctx context.Context, req admission.Reque
 		v.EnableNSMirroring,
 		v.ConsulDestinationNamespace,
 		v.NSMirroringPrefix)
+
+	// Warn, but don't block, if the update changes the protocol in a way that
+	// invalidates existing L7 config entries for this service. This check is
+	// best-effort so errors are only logged.
+	if resp.Allowed && req.Operation == admissionv1.Update {
+		warnings, err := v.protocolDowngradeWarnings(ctx, req, &svcDefaults)
+		if err != nil {
+			v.Logger.Error(err, "failed to check for L7 config entries invalidated by protocol change", "name", svcDefaults.KubernetesName())
+		}
+		resp.Warnings = append(resp.Warnings, warnings...)
+	}
+
+	// Warn, but don't block, if an upstream override references a service
+	// that isn't known, e.g. because of a typo. This check is best-effort so
+	// errors are only logged.
+	if resp.Allowed {
+		warnings, err := v.unknownUpstreamOverrideWarnings(ctx, &svcDefaults)
+		if err != nil {
+			v.Logger.Error(err, "failed to check for upstream overrides of unknown services", "name", svcDefaults.KubernetesName())
+		}
+		resp.Warnings = append(resp.Warnings, warnings...)
+	}
+	return resp
+}
+
+// unknownUpstreamOverrideWarnings returns a warning for each upstream
+// override of svcDefaults whose service is neither the name of a
+// ServiceDefaults resource nor, if there's a Consul client, registered in
+// the Consul namespace of the override.
+func (v *ServiceDefaultsWebhook) unknownUpstreamOverrideWarnings(ctx context.Context, svcDefaults *ServiceDefaults) ([]string, error) {
+	if svcDefaults.Spec.UpstreamConfig == nil || len(svcDefaults.Spec.UpstreamConfig.Overrides) == 0 {
+		return nil, nil
+	}
+
+	known := make(map[string]bool)
+	var svcDefaultsList ServiceDefaultsList
+	if err := v.Client.List(ctx, &svcDefaultsList); err != nil {
+		return nil, err
+	}
+	for _, item := range svcDefaultsList.Items {
+		known[item.ConsulName()] = true
+	}
+
+	// registered caches the services registered in each Consul namespace.
+	registered := make(map[string]map[string][]string)
+	var warnings []string
+	for i, override := range svcDefaults.Spec.UpstreamConfig.Overrides {
+		if override.Name == "" || known[override.Name] {
+			continue
+		}
+		if v.ConsulClient != nil {
+			ns := override.Namespace
+			if ns == "" {
+				ns = namespaces.ConsulNamespace(svcDefaults.Namespace, v.EnableConsulNamespaces, v.ConsulDestinationNamespace, v.EnableNSMirroring, v.NSMirroringPrefix)
+			}
+			services, ok := registered[ns]
+			if !ok {
+				var err error
+				services, _, err = v.ConsulClient.Catalog().Services(&capi.QueryOptions{Namespace: ns})
+				if err != nil {
+					return warnings, err
+				}
+				registered[ns] = services
+			}
+			if _, ok := services[override.Name]; ok {
+				continue
+			}
+		}
+		warnings = append(warnings, fmt.Sprintf("spec.upstreamConfig.overrides[%d] references service %q, which has no servicedefaults resource and isn't registered in Consul",
+			i, override.Name))
+	}
+	return warnings, nil
+}
+
+// protocolDowngradeWarnings returns a warning for each ServiceRouter and
+// ServiceSplitter for this service that would be invalidated by changing its
+// protocol from an L7 protocol to a non-L7 protocol.
+func (v *ServiceDefaultsWebhook) protocolDowngradeWarnings(ctx context.Context, req admission.Request, svcDefaults *ServiceDefaults) ([]string, error) {
+	var oldSvcDefaults ServiceDefaults
+	if err := v.decoder.DecodeRaw(req.OldObject, &oldSvcDefaults); err != nil {
+		return nil, err
+	}
+	if !isL7Protocol(oldSvcDefaults.Spec.Protocol) || isL7Protocol(svcDefaults.Spec.Protocol) {
+		return nil, nil
+	}
+
+	var dependents []common.ConfigEntryResource
+	var routers ServiceRouterList
+	if err := v.Client.List(ctx, &routers); err != nil {
+		return nil, err
+	}
+	for i := range routers.Items {
+		dependents = append(dependents, &routers.Items[i])
+	}
+	var splitters ServiceSplitterList
+	if err := v.Client.List(ctx, &splitters); err != nil {
+		return nil, err
+	}
+	for i := range splitters.Items {
+		dependents = append(dependents, &splitters.Items[i])
+	}
+
+	var warnings []string
+	for _, entry := range dependents {
+		if entry.ConsulName() != svcDefaults.ConsulName() {
+			continue
+		}
+		// With namespace mirroring, config entries only apply to the service
+		// in their own namespace.
+		if v.EnableConsulNamespaces && v.EnableNSMirroring && entry.GetNamespace() != svcDefaults.Namespace {
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("changing protocol from %q to %q invalidates %s %q in namespace %q which requires an L7 protocol",
+			oldSvcDefaults.Spec.Protocol, svcDefaults.Spec.Protocol, entry.KubeKind(), entry.KubernetesName(), entry.GetNamespace()))
+	}
+	return warnings, nil
 }
 
 func (v *ServiceDefaultsWebhook) List(ctx context.Context) ([]common.ConfigEntryResource, error) {
@@ -0,0 +1,281 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestHandleServiceDefaults_ProtocolDowngradeWarning(t *testing.T) {
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		oldProtocol       string
+		newProtocol       string
+		mirroring         bool
+		expWarnings       []string
+	}{
+		"http to tcp with router and splitter": {
+			existingResources: []runtime.Object{
+				&ServiceRouter{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+				},
+				&ServiceSplitter{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+				},
+			},
+			oldProtocol: "http",
+			newProtocol: "tcp",
+			expWarnings: []string{
+				`changing protocol from "http" to "tcp" invalidates servicerouter "foo" in namespace "default" which requires an L7 protocol`,
+				`changing protocol from "http" to "tcp" invalidates servicesplitter "foo" in namespace "default" which requires an L7 protocol`,
+			},
+		},
+		"grpc to empty protocol with router": {
+			existingResources: []runtime.Object{
+				&ServiceRouter{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+				},
+			},
+			oldProtocol: "grpc",
+			newProtocol: "",
+			expWarnings: []string{
+				`changing protocol from "grpc" to "" invalidates servicerouter "foo" in namespace "default" which requires an L7 protocol`,
+			},
+		},
+		"http to tcp with router for a different service": {
+			existingResources: []runtime.Object{
+				&ServiceRouter{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "bar",
+						Namespace: "default",
+					},
+				},
+			},
+			oldProtocol: "http",
+			newProtocol: "tcp",
+			expWarnings: nil,
+		},
+		"http to tcp with router in a different namespace and mirroring": {
+			existingResources: []runtime.Object{
+				&ServiceRouter{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "other",
+					},
+				},
+			},
+			oldProtocol: "http",
+			newProtocol: "tcp",
+			mirroring:   true,
+			expWarnings: nil,
+		},
+		"http to grpc with router": {
+			existingResources: []runtime.Object{
+				&ServiceRouter{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo",
+						Namespace: "default",
+					},
+				},
+			},
+			oldProtocol: "http",
+			newProtocol: "grpc",
+			expWarnings: nil,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			oldResource := &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: ServiceDefaultsSpec{
+					Protocol: c.oldProtocol,
+				},
+			}
+			newResource := oldResource.DeepCopy()
+			newResource.Spec.Protocol = c.newProtocol
+
+			marshalledOldObject, err := json.Marshal(oldResource)
+			require.NoError(t, err)
+			marshalledNewObject, err := json.Marshal(newResource)
+			require.NoError(t, err)
+
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceDefaults{}, &ServiceDefaultsList{}, &ServiceRouter{}, &ServiceRouterList{}, &ServiceSplitter{}, &ServiceSplitterList{})
+			client := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(c.existingResources...).Build()
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			validator := &ServiceDefaultsWebhook{
+				Client:                 client,
+				ConsulClient:           nil,
+				Logger:                 logrtest.TestLogger{T: t},
+				EnableConsulNamespaces: c.mirroring,
+				EnableNSMirroring:      c.mirroring,
+				decoder:                decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:      newResource.KubernetesName(),
+					Namespace: newResource.Namespace,
+					Operation: admissionv1.Update,
+					Object: runtime.RawExtension{
+						Raw: marshalledNewObject,
+					},
+					OldObject: runtime.RawExtension{
+						Raw: marshalledOldObject,
+					},
+				},
+			})
+
+			// Protocol changes are never blocked.
+			require.True(t, response.Allowed)
+			require.ElementsMatch(t, c.expWarnings, response.Warnings)
+		})
+	}
+}
+
+func TestHandleServiceDefaults_UpstreamOverrides(t *testing.T) {
+	cases := map[string]struct {
+		existingResources []runtime.Object
+		consulServices    []string
+		overrides         []Upstream
+		expAllowed        bool
+		expErrMessage     string
+		expWarnings       []string
+	}{
+		"override without a name": {
+			overrides: []Upstream{
+				{
+					Protocol: "http",
+				},
+			},
+			expAllowed:    false,
+			expErrMessage: `servicedefaults.consul.hashicorp.com "foo" is invalid: spec.upstreamConfig.overrides[0].name: Invalid value: "": name cannot be empty`,
+		},
+		"override of an unknown service": {
+			overrides: []Upstream{
+				{
+					Name: "bar",
+				},
+			},
+			expAllowed: true,
+			expWarnings: []string{
+				`spec.upstreamConfig.overrides[0] references service "bar", which has no servicedefaults resource and isn't registered in Consul`,
+			},
+		},
+		"override of a service with servicedefaults": {
+			existingResources: []runtime.Object{
+				&ServiceDefaults{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "bar",
+						Namespace: "default",
+					},
+				},
+			},
+			overrides: []Upstream{
+				{
+					Name: "bar",
+				},
+			},
+			expAllowed: true,
+		},
+		"override of a service registered in Consul": {
+			consulServices: []string{"bar"},
+			overrides: []Upstream{
+				{
+					Name: "bar",
+				},
+				{
+					Name: "baz",
+				},
+			},
+			expAllowed: true,
+			expWarnings: []string{
+				`spec.upstreamConfig.overrides[1] references service "baz", which has no servicedefaults resource and isn't registered in Consul`,
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			resource := &ServiceDefaults{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: ServiceDefaultsSpec{
+					UpstreamConfig: &Upstreams{
+						Overrides: c.overrides,
+					},
+				},
+			}
+			marshalledObject, err := json.Marshal(resource)
+			require.NoError(t, err)
+
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceDefaults{}, &ServiceDefaultsList{})
+			client := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(c.existingResources...).Build()
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			var consulClient *capi.Client
+			if c.consulServices != nil {
+				consul, err := testutil.NewTestServerConfigT(t, nil)
+				require.NoError(t, err)
+				defer consul.Stop()
+				consul.WaitForLeader(t)
+				consulClient, err = capi.NewClient(&capi.Config{Address: consul.HTTPAddr})
+				require.NoError(t, err)
+				for _, service := range c.consulServices {
+					require.NoError(t, consulClient.Agent().ServiceRegister(&capi.AgentServiceRegistration{Name: service}))
+				}
+			}
+
+			validator := &ServiceDefaultsWebhook{
+				Client:       client,
+				ConsulClient: consulClient,
+				Logger:       logrtest.TestLogger{T: t},
+				decoder:      decoder,
+			}
+			response := validator.Handle(ctx, admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Name:      resource.KubernetesName(),
+					Namespace: resource.Namespace,
+					Operation: admissionv1.Create,
+					Object: runtime.RawExtension{
+						Raw: marshalledObject,
+					},
+				},
+			})
+
+			require.Equal(t, c.expAllowed, response.Allowed)
+			if c.expErrMessage != "" {
+				require.Equal(t, c.expErrMessage, response.Result.Message)
+			}
+			require.ElementsMatch(t, c.expWarnings, response.Warnings)
+		})
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/consul-k8s/api/common"
-	"github.com/hashicorp/consul-k8s/namespaces"
 	"github.com/hashicorp/consul/api"
 	capi "github.com/hashicorp/consul/api"
 	corev1 "k8s.io/api/core/v1"
@@ -18,6 +17,10 @@ import (
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
+// sourceDescriptionMaxLength is the maximum length of a source's description
+// accepted by Consul.
+const sourceDescriptionMaxLength = 512
+
 func init() {
 	SchemeBuilder.Register(&ServiceIntentions{}, &ServiceIntentionsList{})
 }
@@ -29,6 +32,7 @@ func init() {
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type ServiceIntentions struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -264,6 +268,9 @@ func (in *ServiceIntentions) Validate(namespacesEnabled bool) error {
 		} else {
 			errs = append(errs, source.Permissions.validate(path.Child("sources").Index(i))...)
 		}
+		if len(source.Description) > sourceDescriptionMaxLength {
+			errs = append(errs, field.TooLong(path.Child("sources").Index(i).Child("description"), source.Description, sourceDescriptionMaxLength))
+		}
 	}
 
 	errs = append(errs, in.validateNamespaces(namespacesEnabled)...)
@@ -278,17 +285,8 @@ func (in *ServiceIntentions) Validate(namespacesEnabled bool) error {
 
 // DefaultNamespaceFields sets the namespace field on spec.destination to their default values if namespaces are enabled.
 func (in *ServiceIntentions) DefaultNamespaceFields(consulNamespacesEnabled bool, destinationNamespace string, mirroring bool, prefix string) {
-	// If namespaces are enabled we want to set the destination namespace field to it's
-	// default. If namespaces are not enabled (i.e. OSS) we don't set the
-	// namespace fields because this would cause errors
-	// making API calls (because namespace fields can't be set in OSS).
-	if consulNamespacesEnabled {
-		// Default to the current namespace (i.e. the namespace of the config entry).
-		namespace := namespaces.ConsulNamespace(in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
-		if in.Spec.Destination.Namespace == "" {
-			in.Spec.Destination.Namespace = namespace
-		}
-	}
+	// Default to the current namespace (i.e. the namespace of the config entry).
+	in.Spec.Destination.Namespace = common.DefaultNamespace(in.Spec.Destination.Namespace, in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
 }
 
 func (in SourceIntentions) toConsul() []*capi.SourceIntention {
@@ -1,6 +1,7 @@
 package v1alpha1
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -147,6 +148,51 @@ func TestServiceIntentions_MatchesConsul(t *testing.T) {
 			},
 			Matches: true,
 		},
+		"different HTTP permissions does not match": {
+			Ours: ServiceIntentions{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "svc-name",
+				},
+				Spec: ServiceIntentionsSpec{
+					Destination: Destination{
+						Name: "svc-name",
+					},
+					Sources: SourceIntentions{
+						{
+							Name: "svc-2",
+							Permissions: IntentionPermissions{
+								{
+									Action: "allow",
+									HTTP: &IntentionHTTPPermission{
+										PathPrefix: "/foo",
+										Methods:    []string{"GET"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			Theirs: &capi.ServiceIntentionsConfigEntry{
+				Kind: capi.ServiceIntentions,
+				Name: "svc-name",
+				Sources: []*capi.SourceIntention{
+					{
+						Name: "svc-2",
+						Permissions: []*capi.IntentionPermission{
+							{
+								Action: "allow",
+								HTTP: &capi.IntentionHTTPPermission{
+									PathPrefix: "/foo",
+									Methods:    []string{"GET", "POST"},
+								},
+							},
+						},
+					},
+				},
+			},
+			Matches: false,
+		},
 		"different types does not match": {
 			Ours: ServiceIntentions{
 				ObjectMeta: metav1.ObjectMeta{
@@ -206,6 +252,82 @@ func TestServiceIntentions_MatchesConsul(t *testing.T) {
 			},
 			Matches: true,
 		},
+		"different order of sources with descriptions matches": {
+			Ours: ServiceIntentions{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "name",
+				},
+				Spec: ServiceIntentionsSpec{
+					Destination: Destination{
+						Name: "bar",
+					},
+					Sources: SourceIntentions{
+						{
+							Name:        "*",
+							Action:      "deny",
+							Description: "deny everything else",
+						},
+						{
+							Name:        "foo",
+							Action:      "allow",
+							Description: "allow foo",
+						},
+					},
+				},
+			},
+			Theirs: &capi.ServiceIntentionsConfigEntry{
+				Name:        "bar",
+				Kind:        capi.ServiceIntentions,
+				CreateIndex: 1,
+				ModifyIndex: 2,
+				Sources: []*capi.SourceIntention{
+					{
+						Name:        "foo",
+						Action:      "allow",
+						Description: "allow foo",
+						Precedence:  9,
+					},
+					{
+						Name:        "*",
+						Action:      "deny",
+						Description: "deny everything else",
+						Precedence:  8,
+					},
+				},
+			},
+			Matches: true,
+		},
+		"different descriptions does not match": {
+			Ours: ServiceIntentions{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "name",
+				},
+				Spec: ServiceIntentionsSpec{
+					Destination: Destination{
+						Name: "bar",
+					},
+					Sources: SourceIntentions{
+						{
+							Name:        "foo",
+							Action:      "allow",
+							Description: "allow foo",
+						},
+					},
+				},
+			},
+			Theirs: &capi.ServiceIntentionsConfigEntry{
+				Name: "bar",
+				Kind: capi.ServiceIntentions,
+				Sources: []*capi.SourceIntention{
+					{
+						Name:        "foo",
+						Action:      "allow",
+						Description: "edited in Consul",
+					},
+				},
+			},
+			Matches: false,
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -345,6 +467,50 @@ func TestServiceIntentions_ToConsul(t *testing.T) {
 				},
 			},
 		},
+		"sources keep the order they're defined in": {
+			Ours: ServiceIntentions{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "name",
+				},
+				Spec: ServiceIntentionsSpec{
+					Destination: Destination{
+						Name: "svc-name",
+					},
+					Sources: []*SourceIntention{
+						{
+							Name:        "*",
+							Action:      "deny",
+							Description: "deny everything else",
+						},
+						{
+							Name:        "svc1",
+							Action:      "allow",
+							Description: "allow access from svc1",
+						},
+					},
+				},
+			},
+			Exp: &capi.ServiceIntentionsConfigEntry{
+				Kind: capi.ServiceIntentions,
+				Name: "svc-name",
+				Sources: []*capi.SourceIntention{
+					{
+						Name:        "*",
+						Action:      "deny",
+						Description: "deny everything else",
+					},
+					{
+						Name:        "svc1",
+						Action:      "allow",
+						Description: "allow access from svc1",
+					},
+				},
+				Meta: map[string]string{
+					common.SourceKey:     common.SourceValue,
+					common.DatacenterKey: "datacenter",
+				},
+			},
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -1162,6 +1328,34 @@ func TestServiceIntentions_Validate(t *testing.T) {
 				`spec.sources[2].namespace: Invalid value: "namespace-d": Consul Enterprise namespaces must be enabled to set source.namespace`,
 			},
 		},
+		"description too long": {
+			input: &ServiceIntentions{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "does-not-matter",
+				},
+				Spec: ServiceIntentionsSpec{
+					Destination: Destination{
+						Name: "dest-service",
+					},
+					Sources: SourceIntentions{
+						{
+							Name:        "web",
+							Action:      "allow",
+							Description: strings.Repeat("a", 512),
+						},
+						{
+							Name:        "db",
+							Action:      "deny",
+							Description: strings.Repeat("a", 513),
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.sources[1].description: Too long: must have at most 512 bytes`,
+			},
+		},
 	}
 	for name, testCase := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -27,6 +27,7 @@ func init() {
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type ServiceResolver struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -123,6 +124,7 @@ type ServiceResolverFailover struct {
 
 type LoadBalancer struct {
 	// Policy is the load balancing policy used to select a host.
+	// Must be one of "random", "round_robin", "least_request", "ring_hash" or "maglev".
 	Policy string `json:"policy,omitempty"`
 
 	// RingHashConfig contains configuration for the "ringHash" policy type.
@@ -225,8 +227,11 @@ func (in *ServiceResolver) Finalizers() []string {
 	return in.ObjectMeta.Finalizers
 }
 
+// ConsulName returns the name of the Consul service this resource configures,
+// which may differ from the name of the resource if it's annotated with
+// consul.hashicorp.com/service-name.
 func (in *ServiceResolver) ConsulName() string {
-	return in.ObjectMeta.Name
+	return consulServiceName(in.ObjectMeta)
 }
 
 func (in *ServiceResolver) SetSyncedCondition(status corev1.ConditionStatus, reason string, message string) {
@@ -294,13 +299,15 @@ func (in *ServiceResolver) Validate(namespacesEnabled bool) error {
 	path := field.NewPath("spec")
 
 	for k, v := range in.Spec.Failover {
-		if err := v.validate(path.Child("failover").Key(k)); err != nil {
-			errs = append(errs, err)
-		}
+		errs = append(errs, v.validate(path.Child("failover").Key(k), in.ConsulName(), k)...)
 	}
 
 	errs = append(errs, in.Spec.LoadBalancer.validate(path.Child("loadBalancer"))...)
 
+	if err := validateConsulServiceName(in.ObjectMeta); err != nil {
+		errs = append(errs, err)
+	}
+
 	errs = append(errs, in.validateNamespaces(namespacesEnabled)...)
 
 	if len(errs) > 0 {
@@ -455,14 +462,31 @@ func (in *ServiceResolver) validateNamespaces(namespacesEnabled bool) field.Erro
 	return errs
 }
 
-func (in *ServiceResolverFailover) validate(path *field.Path) *field.Error {
+// validate validates the failover of the subset of the service serviceName.
+// The subset is "*" for the failover of every subset.
+func (in *ServiceResolverFailover) validate(path *field.Path, serviceName, subset string) field.ErrorList {
 	if in.Service == "" && in.ServiceSubset == "" && in.Namespace == "" && len(in.Datacenters) == 0 {
 		// NOTE: We're passing "{}" here as our value because we know that the
 		// error is we have an empty object.
-		return field.Invalid(path, "{}",
-			"service, serviceSubset, namespace and datacenters cannot all be empty at once")
+		return field.ErrorList{field.Invalid(path, "{}",
+			"service, serviceSubset, namespace and datacenters cannot all be empty at once")}
 	}
-	return nil
+
+	var errs field.ErrorList
+	for i, dc := range in.Datacenters {
+		if dc == "" {
+			errs = append(errs, field.Invalid(path.Child("datacenters").Index(i), dc, "datacenter cannot be empty"))
+		}
+	}
+	// Naming the resolved service and subset again only fails over somewhere else
+	// if other datacenters are tried.
+	targetsSubset := in.ServiceSubset == subset || (subset == "*" && in.ServiceSubset == "")
+	if in.Service == serviceName && targetsSubset && in.Namespace == "" && len(in.Datacenters) == 0 {
+		asJSON, _ := json.Marshal(in)
+		errs = append(errs, field.Invalid(path, string(asJSON),
+			"service cannot be the service being resolved unless serviceSubset, namespace or datacenters route elsewhere"))
+	}
+	return errs
 }
 
 func (in *LoadBalancer) validate(path *field.Path) field.ErrorList {
@@ -470,6 +494,13 @@ func (in *LoadBalancer) validate(path *field.Path) field.ErrorList {
 		return nil
 	}
 	var errs field.ErrorList
+	if in.Policy != "" {
+		validPolicies := []string{"random", "round_robin", "least_request", "ring_hash", "maglev"}
+		if !sliceContains(validPolicies, in.Policy) {
+			errs = append(errs, field.Invalid(path.Child("policy"), in.Policy,
+				notInSliceMessage(validPolicies)))
+		}
+	}
 	for i, p := range in.HashPolicies {
 		errs = append(errs, p.validate(path.Child("hashPolicies").Index(i))...)
 	}
@@ -493,6 +524,9 @@ func (in HashPolicy) validate(path *field.Path) field.ErrorList {
 			errs = append(errs, field.Invalid(path.Child("fieldValue"), in.FieldValue,
 				"fieldValue cannot be empty if field is set"))
 		}
+	} else if in.FieldValue != "" {
+		errs = append(errs, field.Invalid(path.Child("field"), in.Field,
+			"field cannot be empty if fieldValue is set"))
 	}
 
 	if err := in.CookieConfig.validate(path.Child("cookieConfig")); err != nil {
@@ -177,6 +177,34 @@ func TestServiceResolver_MatchesConsul(t *testing.T) {
 			},
 			Matches: false,
 		},
+		"annotated with a Consul service name matches": {
+			Ours: ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "name",
+					Annotations: map[string]string{common.ServiceNameKey: "consul-name"},
+				},
+				Spec: ServiceResolverSpec{},
+			},
+			Theirs: &capi.ServiceResolverConfigEntry{
+				Name: "consul-name",
+				Kind: capi.ServiceResolver,
+			},
+			Matches: true,
+		},
+		"annotated with a Consul service name does not match the Kubernetes name": {
+			Ours: ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "name",
+					Annotations: map[string]string{common.ServiceNameKey: "consul-name"},
+				},
+				Spec: ServiceResolverSpec{},
+			},
+			Theirs: &capi.ServiceResolverConfigEntry{
+				Name: "name",
+				Kind: capi.ServiceResolver,
+			},
+			Matches: false,
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -428,6 +456,13 @@ func TestServiceResolver_ConsulName(t *testing.T) {
 	require.Equal(t, "foo", (&ServiceResolver{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).ConsulName())
 }
 
+func TestServiceResolver_ConsulNameFromAnnotation(t *testing.T) {
+	require.Equal(t, "bar", (&ServiceResolver{ObjectMeta: metav1.ObjectMeta{
+		Name:        "foo",
+		Annotations: map[string]string{common.ServiceNameKey: "bar"},
+	}}).ConsulName())
+}
+
 func TestServiceResolver_KubernetesName(t *testing.T) {
 	require.Equal(t, "foo", (&ServiceResolver{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).KubernetesName())
 }
@@ -525,6 +560,129 @@ func TestServiceResolver_Validate(t *testing.T) {
 				"spec.failover[failB]: Invalid value: \"{}\": service, serviceSubset, namespace and datacenters cannot all be empty at once",
 			},
 		},
+		"failover datacenters contain an empty datacenter": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					Failover: map[string]ServiceResolverFailover{
+						"*": {
+							Datacenters: []string{"dc2", ""},
+						},
+					},
+				},
+			},
+			expectedErrMsgs: []string{
+				"spec.failover[*].datacenters[1]: Invalid value: \"\": datacenter cannot be empty",
+			},
+		},
+		"failover to the service being resolved": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					Failover: map[string]ServiceResolverFailover{
+						"*": {
+							Service: "foo",
+						},
+						"v1": {
+							Service:       "foo",
+							ServiceSubset: "v1",
+						},
+					},
+				},
+			},
+			expectedErrMsgs: []string{
+				"spec.failover[*]: Invalid value: \"{\\\"service\\\":\\\"foo\\\"}\": service cannot be the service being resolved unless serviceSubset, namespace or datacenters route elsewhere",
+				"spec.failover[v1]: Invalid value: \"{\\\"service\\\":\\\"foo\\\",\\\"serviceSubset\\\":\\\"v1\\\"}\": service cannot be the service being resolved unless serviceSubset, namespace or datacenters route elsewhere",
+			},
+		},
+		"failover to the service being resolved in other datacenters": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					Failover: map[string]ServiceResolverFailover{
+						"*": {
+							Service:     "foo",
+							Datacenters: []string{"dc2"},
+						},
+						"v1": {
+							Service:       "foo",
+							ServiceSubset: "v2",
+						},
+					},
+				},
+			},
+			expectedErrMsgs: nil,
+		},
+		"loadBalancer ring hash on a header is valid": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						Policy: "ring_hash",
+						RingHashConfig: &RingHashConfig{
+							MinimumRingSize: 1024,
+							MaximumRingSize: 8192,
+						},
+						HashPolicies: []HashPolicy{
+							{
+								Field:      "header",
+								FieldValue: "x-user-id",
+								Terminal:   true,
+							},
+							{
+								SourceIP: true,
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   nil,
+		},
+		"loadBalancer.policy invalid": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						Policy: "sticky",
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`serviceresolver.consul.hashicorp.com "foo" is invalid: spec.loadBalancer.policy: Invalid value: "sticky": must be one of "random", "round_robin", "least_request", "ring_hash", "maglev"`,
+			},
+		},
+		"hashPolicy.fieldValue without field": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceResolverSpec{
+					LoadBalancer: &LoadBalancer{
+						HashPolicies: []HashPolicy{
+							{
+								FieldValue: "x-user-id",
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`serviceresolver.consul.hashicorp.com "foo" is invalid: spec.loadBalancer.hashPolicies[0].field: Invalid value: "": field cannot be empty if fieldValue is set`,
+			},
+		},
 		"hashPolicy.field invalid": {
 			input: &ServiceResolver{
 				ObjectMeta: metav1.ObjectMeta{
@@ -702,6 +860,18 @@ func TestServiceResolver_Validate(t *testing.T) {
 				"spec.failover[failB].namespace: Invalid value: \"namespace-b\": Consul Enterprise namespaces must be enabled to set failover.namespace",
 			},
 		},
+		"empty Consul service name annotation": {
+			input: &ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Annotations: map[string]string{common.ServiceNameKey: ""},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`serviceresolver.consul.hashicorp.com "foo" is invalid: metadata.annotations[consul.hashicorp.com/service-name]: Invalid value: "": must not be empty`,
+			},
+		},
 	}
 	for name, testCase := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -7,6 +7,7 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
+	admissionv1 "k8s.io/api/admission/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -57,6 +58,16 @@ func (v *ServiceResolverWebhook) Handle(ctx context.Context, req admission.Reque
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
+	if req.Operation == admissionv1.Update {
+		var prev ServiceResolver
+		if err := v.decoder.DecodeRaw(req.OldObject, &prev); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if err := validateConsulServiceNameUnchanged(prev.ObjectMeta, svcResolver.ObjectMeta); err != nil {
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+	}
+
 	return common.ValidateConfigEntry(ctx,
 		req,
 		v.Logger,
@@ -0,0 +1,111 @@
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/hashicorp/consul-k8s/api/common"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// Test that the Consul service name of ServiceResolvers, ServiceRouters and
+// ServiceSplitters can't be changed by an update.
+func TestHandle_ConsulServiceNameUpdate(t *testing.T) {
+	cases := map[string]struct {
+		oldAnnotations map[string]string
+		newAnnotations map[string]string
+		expAllow       bool
+		expErrMessage  string
+	}{
+		"unchanged annotation": {
+			oldAnnotations: map[string]string{common.ServiceNameKey: "bar"},
+			newAnnotations: map[string]string{common.ServiceNameKey: "bar"},
+			expAllow:       true,
+		},
+		"annotation set to the resource name": {
+			newAnnotations: map[string]string{common.ServiceNameKey: "foo"},
+			expAllow:       true,
+		},
+		"annotation added": {
+			newAnnotations: map[string]string{common.ServiceNameKey: "bar"},
+			expAllow:       false,
+			expErrMessage:  `the consul.hashicorp.com/service-name annotation is immutable: the Consul service name cannot change from "foo" to "bar"`,
+		},
+		"annotation changed": {
+			oldAnnotations: map[string]string{common.ServiceNameKey: "bar"},
+			newAnnotations: map[string]string{common.ServiceNameKey: "baz"},
+			expAllow:       false,
+			expErrMessage:  `the consul.hashicorp.com/service-name annotation is immutable: the Consul service name cannot change from "bar" to "baz"`,
+		},
+		"annotation removed": {
+			oldAnnotations: map[string]string{common.ServiceNameKey: "bar"},
+			expAllow:       false,
+			expErrMessage:  `the consul.hashicorp.com/service-name annotation is immutable: the Consul service name cannot change from "bar" to "foo"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := runtime.NewScheme()
+			s.AddKnownTypes(GroupVersion, &ServiceResolver{}, &ServiceResolverList{}, &ServiceRouter{}, &ServiceRouterList{}, &ServiceSplitter{}, &ServiceSplitterList{})
+			client := fake.NewClientBuilder().WithScheme(s).Build()
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			objectMeta := func(annotations map[string]string) metav1.ObjectMeta {
+				return metav1.ObjectMeta{Name: "foo", Namespace: "default", Annotations: annotations}
+			}
+			webhooks := map[string]struct {
+				handler admission.Handler
+				old     runtime.Object
+				new     runtime.Object
+			}{
+				"ServiceResolver": {
+					handler: &ServiceResolverWebhook{Client: client, Logger: logrtest.TestLogger{T: t}, decoder: decoder},
+					old:     &ServiceResolver{ObjectMeta: objectMeta(c.oldAnnotations)},
+					new:     &ServiceResolver{ObjectMeta: objectMeta(c.newAnnotations)},
+				},
+				"ServiceRouter": {
+					handler: &ServiceRouterWebhook{Client: client, Logger: logrtest.TestLogger{T: t}, decoder: decoder},
+					old:     &ServiceRouter{ObjectMeta: objectMeta(c.oldAnnotations)},
+					new:     &ServiceRouter{ObjectMeta: objectMeta(c.newAnnotations)},
+				},
+				"ServiceSplitter": {
+					handler: &ServiceSplitterWebhook{Client: client, Logger: logrtest.TestLogger{T: t}, decoder: decoder},
+					old:     &ServiceSplitter{ObjectMeta: objectMeta(c.oldAnnotations), Spec: ServiceSplitterSpec{Splits: []ServiceSplit{{Weight: 100}}}},
+					new:     &ServiceSplitter{ObjectMeta: objectMeta(c.newAnnotations), Spec: ServiceSplitterSpec{Splits: []ServiceSplit{{Weight: 100}}}},
+				},
+			}
+			for kind, w := range webhooks {
+				marshalledOldObject, err := json.Marshal(w.old)
+				require.NoError(t, err)
+				marshalledNewObject, err := json.Marshal(w.new)
+				require.NoError(t, err)
+
+				response := w.handler.Handle(context.Background(), admission.Request{
+					AdmissionRequest: admissionv1.AdmissionRequest{
+						Name:      "foo",
+						Namespace: "default",
+						Operation: admissionv1.Update,
+						Object: runtime.RawExtension{
+							Raw: marshalledNewObject,
+						},
+						OldObject: runtime.RawExtension{
+							Raw: marshalledOldObject,
+						},
+					},
+				})
+				require.Equal(t, c.expAllow, response.Allowed, kind)
+				if c.expErrMessage != "" {
+					require.Equal(t, c.expErrMessage, response.AdmissionResponse.Result.Message, kind)
+				}
+			}
+		})
+	}
+}
@@ -6,7 +6,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
-	"github.com/hashicorp/consul-k8s/namespaces"
+	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -30,6 +30,7 @@ const (
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type ServiceRouter struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -137,6 +138,7 @@ type ServiceRouteDestination struct {
 	// downstream request (and retries) to be processed.
 	RequestTimeout time.Duration `json:"requestTimeout,omitempty"`
 	// NumRetries is the number of times to retry the request when a retryable result occurs
+	// +kubebuilder:validation:Minimum=0
 	NumRetries uint32 `json:"numRetries,omitempty"`
 	// RetryOnConnectFailure allows for connection failure errors to trigger a retry.
 	RetryOnConnectFailure bool `json:"retryOnConnectFailure,omitempty"`
@@ -178,8 +180,11 @@ func (in *ServiceRouter) KubeKind() string {
 	return ServiceRouterKubeKind
 }
 
+// ConsulName returns the name of the Consul service this resource configures,
+// which may differ from the name of the resource if it's annotated with
+// consul.hashicorp.com/service-name.
 func (in *ServiceRouter) ConsulName() string {
-	return in.ObjectMeta.Name
+	return consulServiceName(in.ObjectMeta)
 }
 
 func (in *ServiceRouter) KubernetesName() string {
@@ -251,6 +256,10 @@ func (in *ServiceRouter) Validate(namespacesEnabled bool) error {
 		errs = append(errs, r.validate(path.Child("routes").Index(i))...)
 	}
 
+	if err := validateConsulServiceName(in.ObjectMeta); err != nil {
+		errs = append(errs, err)
+	}
+
 	errs = append(errs, in.validateNamespaces(namespacesEnabled)...)
 
 	if len(errs) > 0 {
@@ -263,19 +272,10 @@ func (in *ServiceRouter) Validate(namespacesEnabled bool) error {
 
 // DefaultNamespaceFields sets the namespace field on spec.routes[].destination to their default values if namespaces are enabled.
 func (in *ServiceRouter) DefaultNamespaceFields(consulNamespacesEnabled bool, destinationNamespace string, mirroring bool, prefix string) {
-	// If namespaces are enabled we want to set the namespace fields to their
-	// defaults. If namespaces are not enabled (i.e. OSS) we don't set the
-	// namespace fields because this would cause errors
-	// making API calls (because namespace fields can't be set in OSS).
-	if consulNamespacesEnabled {
-		// Default to the current namespace (i.e. the namespace of the config entry).
-		namespace := namespaces.ConsulNamespace(in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
-		for i, r := range in.Spec.Routes {
-			if r.Destination != nil {
-				if r.Destination.Namespace == "" {
-					in.Spec.Routes[i].Destination.Namespace = namespace
-				}
-			}
+	// Default to the current namespace (i.e. the namespace of the config entry).
+	for _, r := range in.Spec.Routes {
+		if r.Destination != nil {
+			r.Destination.Namespace = common.DefaultNamespace(r.Destination.Namespace, in.Namespace, consulNamespacesEnabled, destinationNamespace, mirroring, prefix)
 		}
 	}
 }
@@ -357,7 +357,24 @@ func (in ServiceRoute) validate(path *field.Path) field.ErrorList {
 		}
 	}
 	errs = append(errs, in.Match.validate(path.Child("match"))...)
+	errs = append(errs, in.Destination.validate(path.Child("destination"))...)
+
+	return errs
+}
 
+func (in *ServiceRouteDestination) validate(path *field.Path) field.ErrorList {
+	if in == nil {
+		return nil
+	}
+	var errs field.ErrorList
+	if in.RequestTimeout < 0 {
+		errs = append(errs, field.Invalid(path.Child("requestTimeout"), in.RequestTimeout, "must not be negative"))
+	}
+	for i, code := range in.RetryOnStatusCodes {
+		if code < 100 || code > 599 {
+			errs = append(errs, field.Invalid(path.Child("retryOnStatusCodes").Index(i), int(code), "must be an HTTP status code between 100 and 599"))
+		}
+	}
 	return errs
 }
 
@@ -151,6 +151,34 @@ func TestServiceRouter_MatchesConsul(t *testing.T) {
 			},
 			Matches: false,
 		},
+		"annotated with a Consul service name matches": {
+			Ours: ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "name",
+					Annotations: map[string]string{common.ServiceNameKey: "consul-name"},
+				},
+				Spec: ServiceRouterSpec{},
+			},
+			Theirs: &capi.ServiceRouterConfigEntry{
+				Name: "consul-name",
+				Kind: capi.ServiceRouter,
+			},
+			Matches: true,
+		},
+		"annotated with a Consul service name does not match the Kubernetes name": {
+			Ours: ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "name",
+					Annotations: map[string]string{common.ServiceNameKey: "consul-name"},
+				},
+				Spec: ServiceRouterSpec{},
+			},
+			Theirs: &capi.ServiceRouterConfigEntry{
+				Name: "name",
+				Kind: capi.ServiceRouter,
+			},
+			Matches: false,
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -374,6 +402,13 @@ func TestServiceRouter_ConsulName(t *testing.T) {
 	require.Equal(t, "foo", (&ServiceRouter{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).ConsulName())
 }
 
+func TestServiceRouter_ConsulNameFromAnnotation(t *testing.T) {
+	require.Equal(t, "bar", (&ServiceRouter{ObjectMeta: metav1.ObjectMeta{
+		Name:        "foo",
+		Annotations: map[string]string{common.ServiceNameKey: "bar"},
+	}}).ConsulName())
+}
+
 func TestServiceRouter_KubernetesName(t *testing.T) {
 	require.Equal(t, "foo", (&ServiceRouter{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).KubernetesName())
 }
@@ -546,6 +581,50 @@ func TestServiceRouter_Validate(t *testing.T) {
 				`servicerouter.consul.hashicorp.com "foo" is invalid: spec.routes[0]: Invalid value: "{\"match\":{\"http\":{}},\"destination\":{\"prefixRewrite\":\"prefixRewrite\"}}": destination.prefixRewrite requires that either match.http.pathPrefix or match.http.pathExact be configured on this route`,
 			},
 		},
+		"destination retries and timeout": {
+			input: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Destination: &ServiceRouteDestination{
+								RequestTimeout:        5 * time.Second,
+								NumRetries:            3,
+								RetryOnConnectFailure: true,
+								RetryOnStatusCodes:    []uint32{503, 504},
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   nil,
+		},
+		"destination invalid retries and timeout": {
+			input: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceRouterSpec{
+					Routes: []ServiceRoute{
+						{
+							Destination: &ServiceRouteDestination{
+								RequestTimeout:     -1 * time.Second,
+								RetryOnStatusCodes: []uint32{503, 0, 600},
+							},
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`spec.routes[0].destination.requestTimeout: Invalid value: -1s: must not be negative`,
+				`spec.routes[0].destination.retryOnStatusCodes[1]: Invalid value: 0: must be an HTTP status code between 100 and 599`,
+				`spec.routes[0].destination.retryOnStatusCodes[2]: Invalid value: 600: must be an HTTP status code between 100 and 599`,
+			},
+		},
 		"namespaces disabled: single destination namespace specified": {
 			input: &ServiceRouter{
 				ObjectMeta: metav1.ObjectMeta{
@@ -592,6 +671,18 @@ func TestServiceRouter_Validate(t *testing.T) {
 				"spec.routes[1].destination.namespace: Invalid value: \"namespace-b\": Consul Enterprise namespaces must be enabled to set destination.namespace",
 			},
 		},
+		"empty Consul service name annotation": {
+			input: &ServiceRouter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Annotations: map[string]string{common.ServiceNameKey: ""},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`servicerouter.consul.hashicorp.com "foo" is invalid: metadata.annotations[consul.hashicorp.com/service-name]: Invalid value: "": must not be empty`,
+			},
+		},
 	}
 	for name, testCase := range cases {
 		t.Run(name, func(t *testing.T) {
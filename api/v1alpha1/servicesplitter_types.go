@@ -3,6 +3,7 @@ package v1alpha1
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
@@ -26,6 +27,7 @@ func init() {
 // +kubebuilder:printcolumn:name="Synced",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].status",description="The sync status of the resource with Consul"
 // +kubebuilder:printcolumn:name="Last Synced",type="date",JSONPath=".status.lastSyncedTime",description="The last successful synced time of the resource with Consul"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="The age of the resource"
+// +kubebuilder:printcolumn:name="Error",type="string",JSONPath=".status.conditions[?(@.type==\"Synced\")].message",description="The error syncing the resource with Consul, if any",priority=1
 type ServiceSplitter struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
@@ -100,8 +102,11 @@ func (in *ServiceSplitter) KubeKind() string {
 	return common.ServiceSplitter
 }
 
+// ConsulName returns the name of the Consul service this resource configures,
+// which may differ from the name of the resource if it's annotated with
+// consul.hashicorp.com/service-name.
 func (in *ServiceSplitter) ConsulName() string {
-	return in.ObjectMeta.Name
+	return consulServiceName(in.ObjectMeta)
 }
 
 func (in *ServiceSplitter) SetSyncedCondition(status corev1.ConditionStatus, reason, message string) {
@@ -165,6 +170,10 @@ func (in *ServiceSplitter) MatchesConsul(candidate capi.ConfigEntry) bool {
 func (in *ServiceSplitter) Validate(namespacesEnabled bool) error {
 	errs := in.Spec.Splits.validate(field.NewPath("spec").Child("splits"))
 
+	if err := validateConsulServiceName(in.ObjectMeta); err != nil {
+		errs = append(errs, err)
+	}
+
 	errs = append(errs, in.validateNamespaces(namespacesEnabled)...)
 
 	if len(errs) > 0 {
@@ -215,8 +224,12 @@ func (in *ServiceSplitter) validateNamespaces(namespacesEnabled bool) field.Erro
 func (in ServiceSplits) validate(path *field.Path) field.ErrorList {
 	var errs field.ErrorList
 
-	// The sum of weights across all splits must add up to 100.
+	// The sum of weights across all splits must add up to 100. Like Consul,
+	// weights are summed in units of the smallest representable weight so
+	// that float32 rounding errors, e.g. 86.12 + 7.4 + 6.48 adding up to
+	// 100.00001, don't make valid splits invalid.
 	sumOfWeights := float32(0)
+	scaledSumOfWeights := 0
 	for i, split := range in {
 		// First, validate each split.
 		if err := split.validate(path.Index(i).Child("weight")); err != nil {
@@ -225,9 +238,10 @@ func (in ServiceSplits) validate(path *field.Path) field.ErrorList {
 
 		// If valid, add its weight to sumOfWeights.
 		sumOfWeights += split.Weight
+		scaledSumOfWeights += scaleWeight(split.Weight)
 	}
 
-	if sumOfWeights != 100 {
+	if scaledSumOfWeights != 10000 {
 		asJSON, _ := json.Marshal(in)
 		errs = append(errs, field.Invalid(path, string(asJSON),
 			fmt.Sprintf("the sum of weights across all splits must add up to 100 percent, but adds up to %f", sumOfWeights)))
@@ -236,6 +250,11 @@ func (in ServiceSplits) validate(path *field.Path) field.ErrorList {
 	return errs
 }
 
+// scaleWeight returns weight in units of 1/10000, the smallest representable weight.
+func scaleWeight(weight float32) int {
+	return int(math.Round(float64(weight * 100)))
+}
+
 func (in ServiceSplit) validate(path *field.Path) *field.Error {
 	// Validate that the weight value is between 0.01 and 100 but allow a weight to be 0.
 	if in.Weight != 0 && (in.Weight > 100 || in.Weight < 0.01) {
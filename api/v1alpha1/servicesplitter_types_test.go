@@ -84,6 +84,34 @@ func TestServiceSplitter_MatchesConsul(t *testing.T) {
 			},
 			Matches: false,
 		},
+		"annotated with a Consul service name matches": {
+			Ours: ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "name",
+					Annotations: map[string]string{common.ServiceNameKey: "consul-name"},
+				},
+				Spec: ServiceSplitterSpec{},
+			},
+			Theirs: &capi.ServiceSplitterConfigEntry{
+				Name: "consul-name",
+				Kind: capi.ServiceSplitter,
+			},
+			Matches: true,
+		},
+		"annotated with a Consul service name does not match the Kubernetes name": {
+			Ours: ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "name",
+					Annotations: map[string]string{common.ServiceNameKey: "consul-name"},
+				},
+				Spec: ServiceSplitterSpec{},
+			},
+			Theirs: &capi.ServiceSplitterConfigEntry{
+				Name: "name",
+				Kind: capi.ServiceSplitter,
+			},
+			Matches: false,
+		},
 	}
 	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
@@ -241,6 +269,13 @@ func TestServiceSplitter_ConsulName(t *testing.T) {
 	require.Equal(t, "foo", (&ServiceSplitter{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).ConsulName())
 }
 
+func TestServiceSplitter_ConsulNameFromAnnotation(t *testing.T) {
+	require.Equal(t, "bar", (&ServiceSplitter{ObjectMeta: metav1.ObjectMeta{
+		Name:        "foo",
+		Annotations: map[string]string{common.ServiceNameKey: "bar"},
+	}}).ConsulName())
+}
+
 func TestServiceSplitter_KubernetesName(t *testing.T) {
 	require.Equal(t, "foo", (&ServiceSplitter{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}).KubernetesName())
 }
@@ -334,6 +369,28 @@ func TestServiceSplitter_Validate(t *testing.T) {
 			namespacesEnabled: false,
 			expectedErrMsgs:   []string{},
 		},
+		"sum of weights is 100 despite float32 rounding: valid": {
+			input: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "foo",
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight: 86.12,
+						},
+						{
+							Weight: 7.4,
+						},
+						{
+							Weight: 6.48,
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs:   []string{},
+		},
 		"sum of weights must be 100": {
 			input: &ServiceSplitter{
 				ObjectMeta: metav1.ObjectMeta{
@@ -421,6 +478,25 @@ func TestServiceSplitter_Validate(t *testing.T) {
 				"spec.splits[1].namespace: Invalid value: \"namespace-b\": Consul Enterprise namespaces must be enabled to set split.namespace",
 			},
 		},
+		"empty Consul service name annotation": {
+			input: &ServiceSplitter{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Annotations: map[string]string{common.ServiceNameKey: ""},
+				},
+				Spec: ServiceSplitterSpec{
+					Splits: []ServiceSplit{
+						{
+							Weight: 100,
+						},
+					},
+				},
+			},
+			namespacesEnabled: false,
+			expectedErrMsgs: []string{
+				`servicesplitter.consul.hashicorp.com "foo" is invalid: metadata.annotations[consul.hashicorp.com/service-name]: Invalid value: "": must not be empty`,
+			},
+		},
 	}
 	for name, testCase := range cases {
 		t.Run(name, func(t *testing.T) {
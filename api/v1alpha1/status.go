@@ -88,3 +88,28 @@ func (s *Status) GetCondition(t ConditionType) *Condition {
 	}
 	return nil
 }
+
+// SetCondition sets the condition of type t, adding it if there is none and
+// leaving conditions of other types untouched. Its LastTransitionTime is only
+// updated if its status changes.
+func (s *Status) SetCondition(t ConditionType, status corev1.ConditionStatus, reason, message string) {
+	for i, cond := range s.Conditions {
+		if cond.Type != t {
+			continue
+		}
+		if cond.Status != status {
+			s.Conditions[i].LastTransitionTime = metav1.Now()
+		}
+		s.Conditions[i].Status = status
+		s.Conditions[i].Reason = reason
+		s.Conditions[i].Message = message
+		return
+	}
+	s.Conditions = append(s.Conditions, Condition{
+		Type:               t,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
@@ -0,0 +1,53 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const conditionValidated ConditionType = "Validated"
+
+func TestStatus_SetCondition(t *testing.T) {
+	var s Status
+	s.SetCondition(ConditionSynced, corev1.ConditionFalse, "ConsulAgentError", "error")
+	s.SetCondition(conditionValidated, corev1.ConditionTrue, "", "")
+	require.Len(t, s.Conditions, 2)
+
+	synced := s.GetCondition(ConditionSynced)
+	require.True(t, synced.IsFalse())
+	require.Equal(t, "ConsulAgentError", synced.Reason)
+	require.Equal(t, "error", synced.Message)
+	require.True(t, s.GetCondition(conditionValidated).IsTrue())
+
+	// Updating a condition in place leaves the others untouched.
+	transitionTime := metav1.Unix(1, 0)
+	s.Conditions[0].LastTransitionTime = transitionTime
+	s.SetCondition(ConditionSynced, corev1.ConditionFalse, "ConsulAgentError", "other error")
+	require.Len(t, s.Conditions, 2)
+	synced = s.GetCondition(ConditionSynced)
+	require.Equal(t, "other error", synced.Message)
+	// The status didn't change so neither did the transition time.
+	require.Equal(t, transitionTime, synced.LastTransitionTime)
+	require.True(t, s.GetCondition(conditionValidated).IsTrue())
+
+	s.SetCondition(ConditionSynced, corev1.ConditionTrue, "", "")
+	synced = s.GetCondition(ConditionSynced)
+	require.True(t, synced.IsTrue())
+	require.Empty(t, synced.Reason)
+	require.Empty(t, synced.Message)
+	require.NotEqual(t, transitionTime, synced.LastTransitionTime)
+	require.True(t, s.GetCondition(conditionValidated).IsTrue())
+}
+
+// Test that SetSyncedCondition still replaces all conditions.
+func TestServiceDefaults_SetSyncedConditionReplacesConditions(t *testing.T) {
+	var in ServiceDefaults
+	in.SetCondition(conditionValidated, corev1.ConditionTrue, "", "")
+	in.SetSyncedCondition(corev1.ConditionTrue, "", "")
+	require.Len(t, in.Conditions, 1)
+	require.Nil(t, in.GetCondition(conditionValidated))
+	require.True(t, in.GetCondition(ConditionSynced).IsTrue())
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/hashicorp/consul-k8s/api/common"
 	capi "github.com/hashicorp/consul/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 )
 
@@ -61,6 +62,48 @@ func (m MeshGatewayConfig) validate(path *field.Path) *field.Error {
 	return nil
 }
 
+// ProxyMode is the mode Connect proxies are registered with.
+// One of direct or transparent. If empty, the mode is inherited from a
+// broader config entry, or the default of the proxy registration.
+type ProxyMode string
+
+// toConsul returns the Consul proxy mode.
+func (m ProxyMode) toConsul() capi.ProxyMode {
+	return capi.ProxyMode(m)
+}
+
+func (m ProxyMode) validate(path *field.Path) *field.Error {
+	modes := []string{string(capi.ProxyModeDirect), string(capi.ProxyModeTransparent), ""}
+	if !sliceContains(modes, string(m)) {
+		return field.Invalid(path, m, notInSliceMessage(modes))
+	}
+	return nil
+}
+
+// TransparentProxy controls the configuration of proxies in transparent mode.
+type TransparentProxy struct {
+	// OutboundListenerPort is the port of the listener where outbound
+	// application traffic is redirected to.
+	OutboundListenerPort int `json:"outboundListenerPort,omitempty"`
+}
+
+// toConsul returns the Consul transparent proxy config.
+func (in *TransparentProxy) toConsul() *capi.TransparentProxyConfig {
+	if in == nil {
+		return nil
+	}
+	return &capi.TransparentProxyConfig{
+		OutboundListenerPort: in.OutboundListenerPort,
+	}
+}
+
+func (in *TransparentProxy) validate(path *field.Path) *field.Error {
+	if in != nil && in.OutboundListenerPort < 0 {
+		return field.Invalid(path.Child("outboundListenerPort"), in.OutboundListenerPort, "must not be negative")
+	}
+	return nil
+}
+
 func notInSliceMessage(slice []string) string {
 	return fmt.Sprintf(`must be one of "%s"`, strings.Join(slice, `", "`))
 }
@@ -74,10 +117,51 @@ func sliceContains(slice []string, entry string) bool {
 	return false
 }
 
+// isL7Protocol returns true if protocol is one of the protocols that
+// service-router and service-splitter config entries require.
+func isL7Protocol(protocol string) bool {
+	return sliceContains([]string{"http", "http2", "grpc"}, protocol)
+}
+
 func invalidPathPrefix(path string) bool {
 	return path != "" && !strings.HasPrefix(path, "/")
 }
 
+func invalidPort(port int) bool {
+	return port < 1 || port > 65535
+}
+
+// consulServiceName returns the name of the Consul service configured by a ServiceResolver,
+// ServiceRouter or ServiceSplitter. It defaults to the name of the resource and can be
+// overridden with the consul.hashicorp.com/service-name annotation for services whose
+// pods register under a different name with the consul.hashicorp.com/connect-service annotation.
+func consulServiceName(meta metav1.ObjectMeta) string {
+	if name := meta.Annotations[common.ServiceNameKey]; name != "" {
+		return name
+	}
+	return meta.Name
+}
+
+// validateConsulServiceName returns an error if the consul.hashicorp.com/service-name
+// annotation is set but empty.
+func validateConsulServiceName(meta metav1.ObjectMeta) *field.Error {
+	if name, ok := meta.Annotations[common.ServiceNameKey]; ok && strings.TrimSpace(name) == "" {
+		return field.Invalid(field.NewPath("metadata").Child("annotations").Key(common.ServiceNameKey), name, "must not be empty")
+	}
+	return nil
+}
+
+// validateConsulServiceNameUnchanged returns an error if an update changes the name of the
+// Consul service configured by a ServiceResolver, ServiceRouter or ServiceSplitter from prev
+// to updated, since the config entry of the previous service would be left in Consul.
+func validateConsulServiceNameUnchanged(prev, updated metav1.ObjectMeta) error {
+	if prevName, name := consulServiceName(prev), consulServiceName(updated); prevName != name {
+		return fmt.Errorf("the %s annotation is immutable: the Consul service name cannot change from %q to %q",
+			common.ServiceNameKey, prevName, name)
+	}
+	return nil
+}
+
 func meta(datacenter string) map[string]string {
 	return map[string]string{
 		common.SourceKey:     common.SourceValue,
@@ -451,6 +451,21 @@ func (in *MeshGatewayConfig) DeepCopy() *MeshGatewayConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PassiveHealthCheck) DeepCopyInto(out *PassiveHealthCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PassiveHealthCheck.
+func (in *PassiveHealthCheck) DeepCopy() *PassiveHealthCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(PassiveHealthCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ProxyDefaults) DeepCopyInto(out *ProxyDefaults) {
 	*out = *in
@@ -611,6 +626,16 @@ func (in *ServiceDefaultsSpec) DeepCopyInto(out *ServiceDefaultsSpec) {
 	*out = *in
 	out.MeshGateway = in.MeshGateway
 	in.Expose.DeepCopyInto(&out.Expose)
+	if in.TransparentProxy != nil {
+		in, out := &in.TransparentProxy, &out.TransparentProxy
+		*out = new(TransparentProxy)
+		**out = **in
+	}
+	if in.UpstreamConfig != nil {
+		in, out := &in.UpstreamConfig, &out.UpstreamConfig
+		*out = new(Upstreams)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ServiceDefaultsSpec.
@@ -1373,3 +1398,101 @@ func (in *TerminatingGatewaySpec) DeepCopy() *TerminatingGatewaySpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TransparentProxy) DeepCopyInto(out *TransparentProxy) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TransparentProxy.
+func (in *TransparentProxy) DeepCopy() *TransparentProxy {
+	if in == nil {
+		return nil
+	}
+	out := new(TransparentProxy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Upstream) DeepCopyInto(out *Upstream) {
+	*out = *in
+	if in.Limits != nil {
+		in, out := &in.Limits, &out.Limits
+		*out = new(UpstreamLimits)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PassiveHealthCheck != nil {
+		in, out := &in.PassiveHealthCheck, &out.PassiveHealthCheck
+		*out = new(PassiveHealthCheck)
+		**out = **in
+	}
+	out.MeshGateway = in.MeshGateway
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Upstream.
+func (in *Upstream) DeepCopy() *Upstream {
+	if in == nil {
+		return nil
+	}
+	out := new(Upstream)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UpstreamLimits) DeepCopyInto(out *UpstreamLimits) {
+	*out = *in
+	if in.MaxConnections != nil {
+		in, out := &in.MaxConnections, &out.MaxConnections
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxPendingRequests != nil {
+		in, out := &in.MaxPendingRequests, &out.MaxPendingRequests
+		*out = new(int)
+		**out = **in
+	}
+	if in.MaxConcurrentRequests != nil {
+		in, out := &in.MaxConcurrentRequests, &out.MaxConcurrentRequests
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UpstreamLimits.
+func (in *UpstreamLimits) DeepCopy() *UpstreamLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(UpstreamLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Upstreams) DeepCopyInto(out *Upstreams) {
+	*out = *in
+	if in.Defaults != nil {
+		in, out := &in.Defaults, &out.Defaults
+		*out = new(Upstream)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Overrides != nil {
+		in, out := &in.Overrides, &out.Overrides
+		*out = make([]Upstream, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Upstreams.
+func (in *Upstreams) DeepCopy() *Upstreams {
+	if in == nil {
+		return nil
+	}
+	out := new(Upstreams)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -4,11 +4,13 @@ import (
 	"os"
 
 	cmdACLInit "github.com/hashicorp/consul-k8s/subcommand/acl-init"
+	cmdConfigEntryStatus "github.com/hashicorp/consul-k8s/subcommand/config-entry-status"
 	cmdConnectInit "github.com/hashicorp/consul-k8s/subcommand/connect-init"
 	cmdConsulSidecar "github.com/hashicorp/consul-k8s/subcommand/consul-sidecar"
 	cmdController "github.com/hashicorp/consul-k8s/subcommand/controller"
 	cmdCreateFederationSecret "github.com/hashicorp/consul-k8s/subcommand/create-federation-secret"
 	cmdDeleteCompletedJob "github.com/hashicorp/consul-k8s/subcommand/delete-completed-job"
+	cmdEnvoyLifecycle "github.com/hashicorp/consul-k8s/subcommand/envoy-lifecycle"
 	cmdGetConsulClientCA "github.com/hashicorp/consul-k8s/subcommand/get-consul-client-ca"
 	cmdInjectConnect "github.com/hashicorp/consul-k8s/subcommand/inject-connect"
 	cmdServerACLInit "github.com/hashicorp/consul-k8s/subcommand/server-acl-init"
@@ -76,6 +78,10 @@ func init() {
 			return &cmdController.Command{UI: ui}, nil
 		},
 
+		"config-entry-status": func() (cli.Command, error) {
+			return &cmdConfigEntryStatus.Command{UI: ui}, nil
+		},
+
 		"webhook-cert-manager": func() (cli.Command, error) {
 			return &webhookCertManager.Command{UI: ui}, nil
 		},
@@ -83,6 +89,10 @@ func init() {
 		"tls-init": func() (cli.Command, error) {
 			return &cmdTLSInit.Command{UI: ui}, nil
 		},
+
+		"envoy-lifecycle": func() (cli.Command, error) {
+			return &cmdEnvoyLifecycle.Command{UI: ui}, nil
+		},
 	}
 }
 
@@ -1,6 +1,10 @@
 package connectinject
 
 const (
+	// annotationPrefix is the prefix of the keys of all the annotations
+	// read by connect-inject.
+	annotationPrefix = "consul.hashicorp.com/"
+
 	// keyInjectStatus is the key of the annotation that is added to
 	// a pod after an injection is done.
 	keyInjectStatus = "consul.hashicorp.com/connect-inject-status"
@@ -11,7 +15,8 @@ const (
 	annotationInject = "consul.hashicorp.com/connect-inject"
 
 	// annotationService is the name of the service to proxy. This defaults
-	// to the name of the first container.
+	// to the name of the first container. It may be a template referencing
+	// the pod's labels and annotations, e.g. "{{ .Labels.app }}".
 	annotationService = "consul.hashicorp.com/connect-service"
 
 	// annotationPort is the name or value of the port to proxy incoming
@@ -29,9 +34,22 @@ const (
 	// proxy in the format of `<service-name>:<local-port>,...`. The
 	// service name should map to a Consul service namd and the local port
 	// is the local port in the pod that the listener will bind to. It can
-	// be a named port.
+	// be a named port. Instead of a Consul service name, the upstream may also
+	// reference a Kubernetes Service by its DNS name in the form
+	// `<service>.<namespace>.svc:<local-port>`. `<service>.svc:<local-port>`
+	// still references the service in the Consul namespace `svc`.
 	annotationUpstreams = "consul.hashicorp.com/connect-service-upstreams"
 
+	// annotationUpstreamsWeights splits the traffic of the listeners of the
+	// upstreams it lists between those upstreams, which must be declared in
+	// annotationUpstreams, in the format `<upstream>=<weight>,...`, e.g.
+	// `web-v1=90,web-v2=10`. The weights must sum to 100 and the upstreams must
+	// be in the local datacenter and use an L7 protocol. The endpoints
+	// controller writes a ServiceSplitter for the split that each listener
+	// points at, and leaves it unchanged while the pods of the service
+	// disagree on the weights.
+	annotationUpstreamsWeights = "consul.hashicorp.com/connect-service-upstreams-weights"
+
 	// annotationTags is a list of tags to register with the service
 	// this is specified as a comma separated list e.g. abc,123
 	annotationTags = "consul.hashicorp.com/service-tags"
@@ -63,6 +81,40 @@ const (
 	annotationSidecarProxyMemoryLimit   = "consul.hashicorp.com/sidecar-proxy-memory-limit"
 	annotationSidecarProxyMemoryRequest = "consul.hashicorp.com/sidecar-proxy-memory-request"
 
+	// annotationSidecarProxyPort overrides the port that the sidecar proxy's
+	// public listener is registered and bound on. Defaults to the value of the
+	// -default-sidecar-proxy-port flag, 20000 unless set.
+	annotationSidecarProxyPort = "consul.hashicorp.com/sidecar-proxy-port"
+
+	// annotationSidecarProxyVolumeMounts is a comma-separated list of names of the pod's
+	// volumes to mount into the sidecar proxy container, e.g. a CA bundle or a socket.
+	// Each volume is mounted at /consul/sidecar-proxy-volumes/<volume name>.
+	annotationSidecarProxyVolumeMounts = "consul.hashicorp.com/sidecar-proxy-volume-mounts"
+
+	// annotationEnableSidecarProxyLifecycle overrides whether the sidecar proxy gets a preStop
+	// hook that drains its listeners before it's stopped. annotationSidecarProxyDrainTime is how
+	// long, as a Go duration, the hook waits for connections to drain. Defaults to 10s.
+	annotationEnableSidecarProxyLifecycle = "consul.hashicorp.com/enable-sidecar-proxy-lifecycle"
+	annotationSidecarProxyDrainTime       = "consul.hashicorp.com/sidecar-proxy-drain-time"
+
+	// annotationEnvoyReadinessWait is how long, as a Go duration, the application
+	// containers are held for until Envoy is ready when dependency checks are enabled.
+	// Defaults to 1m.
+	annotationEnvoyReadinessWait = "consul.hashicorp.com/consul-envoy-readiness-wait"
+
+	// annotationSidecarProxyBindAddress overrides the address that the sidecar
+	// proxy's public listener binds to. Defaults to 0.0.0.0.
+	annotationSidecarProxyBindAddress = "consul.hashicorp.com/sidecar-proxy-bind-address"
+
+	// annotationEnvoyAdminBind overrides the IP address that the Envoy admin
+	// API binds to, e.g. 0.0.0.0 so that other containers can reach it on the
+	// pod IP. Defaults to 127.0.0.1.
+	annotationEnvoyAdminBind = "consul.hashicorp.com/envoy-admin-bind"
+
+	// annotationEnvoyAdminPort overrides the port that the Envoy admin API
+	// binds to. Defaults to 19000.
+	annotationEnvoyAdminPort = "consul.hashicorp.com/envoy-admin-port"
+
 	// annotations for metrics to configure where Prometheus scrapes
 	// metrics from, whether to run a merged metrics endpoint on the consul
 	// sidecar, and configure the connect service metrics.
@@ -74,6 +126,18 @@ const (
 	annotationServiceMetricsPort   = "consul.hashicorp.com/service-metrics-port"
 	annotationServiceMetricsPath   = "consul.hashicorp.com/service-metrics-path"
 
+	// annotationPrometheusScrapeScheme is the scheme, http or https,
+	// Prometheus uses to scrape metrics.
+	annotationPrometheusScrapeScheme = "consul.hashicorp.com/prometheus-scrape-scheme"
+
+	// annotationPrometheusService and annotationPrometheusConsulNamespace are
+	// set on pods with metrics enabled to the name of the Consul service, if
+	// it's set with annotationService, and to the Consul namespace of the
+	// service, if namespaces are enabled. Prometheus relabeling rules can use
+	// them to identify the service whose metrics are scraped.
+	annotationPrometheusService         = "consul.hashicorp.com/service"
+	annotationPrometheusConsulNamespace = "consul.hashicorp.com/service-namespace"
+
 	// annotationEnvoyExtraArgs is a space-separated list of arguments to be passed to the
 	// envoy binary. See list of args here: https://www.envoyproxy.io/docs/envoy/latest/operations/cli
 	// e.g. consul.hashicorp.com/envoy-extra-args: "--log-level debug --disable-hot-restart"
@@ -82,12 +146,91 @@ const (
 	annotationEnvoyExtraArgs = "consul.hashicorp.com/envoy-extra-args"
 
 	// annotationConsulNamespace is the Consul namespace the service is registered into.
+	// If set on a pod, it overrides the namespace derived from the pod's Kubernetes
+	// namespace, e.g. by namespace mirroring. It only applies if Consul namespaces
+	// are enabled.
 	annotationConsulNamespace = "consul.hashicorp.com/consul-namespace"
 
+	// annotationMeshGatewayAddress is the address of the mesh gateway that
+	// the pod's services reach services in other datacenters through. It's
+	// only added if the handler is configured with a mesh gateway address.
+	annotationMeshGatewayAddress = "consul.hashicorp.com/mesh-gateway-address"
+
+	// annotationGRPCCheckPort is the port of the gRPC health checking service of
+	// the application. If set, a gRPC health check against this port is added to
+	// the service registration. It can be a named port.
+	annotationGRPCCheckPort = "consul.hashicorp.com/service-grpc-check-port"
+
+	// annotationGRPCCheckUseTLS enables TLS for the gRPC health check.
+	// This annotation takes a boolean value (true/false).
+	annotationGRPCCheckUseTLS = "consul.hashicorp.com/service-grpc-check-use-tls"
+
+	// annotationGRPCCheckTLSServerName is the server name used to verify the
+	// certificate of the application when the gRPC health check uses TLS.
+	annotationGRPCCheckTLSServerName = "consul.hashicorp.com/service-grpc-check-tls-server-name"
+
+	// annotationEnableHealthCheck enables or disables the registration of the
+	// Kubernetes health check, the TTL check that's updated from the readiness
+	// of the pod, for a given pod's service. Defaults to true. This annotation
+	// takes a boolean value (true/false).
+	annotationEnableHealthCheck = "consul.hashicorp.com/enable-health-check"
+
+	// annotationHTTPSCheckPort is the port of the application's HTTPS health
+	// endpoint. If set, an HTTPS health check against this port and
+	// annotationHTTPSCheckPath (defaults to "/") is added to the service
+	// registration. It can be a named port.
+	annotationHTTPSCheckPort = "consul.hashicorp.com/service-https-check-port"
+	annotationHTTPSCheckPath = "consul.hashicorp.com/service-https-check-path"
+
+	// annotationHTTPSCheckTLSServerName is the server name used to verify the
+	// certificate of the application in the HTTPS health check.
+	annotationHTTPSCheckTLSServerName = "consul.hashicorp.com/service-https-check-tls-server-name"
+
+	// annotationHTTPSCheckTLSSkipVerify disables verification of the certificate
+	// of the application in the HTTPS health check. It can't be combined with
+	// annotationHTTPSCheckTLSServerName. This annotation takes a boolean value
+	// (true/false).
+	annotationHTTPSCheckTLSSkipVerify = "consul.hashicorp.com/service-https-check-tls-skip-verify"
+
+	// annotationSidecarProxyChecks is a JSON list of additional checks to register
+	// on the sidecar proxy, in the format of the Consul agent API's check definitions,
+	// e.g. `[{"Name": "Admin", "HTTP": "http://127.0.0.1:19000/ready", "Interval": "10s"}]`.
+	// If annotationSidecarProxyChecksReplaceDefaults is true, they replace the
+	// default public listener and alias checks instead. That annotation takes a
+	// boolean value (true/false).
+	annotationSidecarProxyChecks                = "consul.hashicorp.com/sidecar-proxy-checks"
+	annotationSidecarProxyChecksReplaceDefaults = "consul.hashicorp.com/sidecar-proxy-checks-replace-defaults"
+
+	// annotationWaitForUpstreams is a list of upstream services and the minimum
+	// number of passing instances each of them must have before the init
+	// container completes, in the format `<service>=<n>,...`.
+	annotationWaitForUpstreams = "consul.hashicorp.com/connect-wait-for-upstreams"
+
+	// annotationPreregister is set on a Kubernetes Service to register a critical
+	// placeholder instance for it in Consul while it has no injected pods. This
+	// lets intentions and config entries refer to services that scale from zero.
+	// This annotation takes a boolean value (true/false).
+	annotationPreregister = "consul.hashicorp.com/service-preregister"
+
+	// annotationConnectNative marks a pod as running a Connect-native application
+	// that talks to the service mesh itself. Its service is registered as
+	// Connect-native and the pod gets neither a sidecar proxy nor traffic
+	// redirection. This annotation takes a boolean value (true/false).
+	annotationConnectNative = "consul.hashicorp.com/connect-inject-native"
+
 	// annotationTransparentProxy enables or disables transparent proxy mode for a given pod.
 	// This annotation takes a boolean value (true/false).
 	annotationTransparentProxy = "consul.hashicorp.com/transparent-proxy"
 
+	// annotationProxyMode overrides the mode the sidecar proxy is registered with
+	// in Consul, independently of whether the init container redirects the pod's
+	// traffic. This annotation takes a value of "direct" or "transparent", the
+	// latter only if transparent proxy is enabled with the -enable-transparent-proxy flag.
+	// It takes precedence over the mode of the service's ServiceDefaults, which takes
+	// precedence over the mode of the global ProxyDefaults. If none of them set a mode,
+	// the proxy is registered in transparent mode if the pod's traffic is redirected.
+	annotationProxyMode = "consul.hashicorp.com/proxy-mode"
+
 	// injected is used as the annotation value for annotationInjected.
 	injected = "injected"
 )
@@ -97,4 +240,5 @@ const (
 	annotationPrometheusScrape = "prometheus.io/scrape"
 	annotationPrometheusPath   = "prometheus.io/path"
 	annotationPrometheusPort   = "prometheus.io/port"
+	annotationPrometheusScheme = "prometheus.io/scheme"
 )
@@ -6,6 +6,9 @@ import (
 	corev1 "k8s.io/api/core/v1"
 )
 
+// consulSidecarContainerName is the name of the injected consul-sidecar container.
+const consulSidecarContainerName = "consul-sidecar"
+
 // consulSidecar starts the consul-sidecar command to only run
 // the metrics merging server when metrics merging feature is enabled.
 // It always disables service registration because for connect we no longer
@@ -27,7 +30,7 @@ func (h *Handler) consulSidecar(pod corev1.Pod) (corev1.Container, error) {
 	}
 
 	return corev1.Container{
-		Name:  "consul-sidecar",
+		Name:  consulSidecarContainerName,
 		Image: h.ImageConsulK8S,
 		VolumeMounts: []corev1.VolumeMount{
 			{
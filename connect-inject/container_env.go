@@ -20,6 +20,9 @@ func (h *Handler) containerEnvVars(pod corev1.Pod) []corev1.EnvVar {
 		port, _ := portValue(pod, strings.TrimSpace(parts[1]))
 		if port > 0 {
 			name := strings.TrimSpace(parts[0])
+			if k8sSvcName, _, ok, err := parseK8sServiceUpstream(name); ok && err == nil {
+				name = k8sSvcName
+			}
 			name = strings.ToUpper(strings.Replace(name, "-", "_", -1))
 			portStr := strconv.Itoa(int(port))
 
@@ -22,6 +22,10 @@ func TestContainerEnvVars(t *testing.T) {
 			"Upstream without datacenter",
 			"static-server:7890",
 		},
+		{
+			"Kubernetes Service upstream",
+			"static-server.default.svc:7890",
+		},
 	}
 
 	for _, tt := range cases {
@@ -2,10 +2,14 @@ package connectinject
 
 import (
 	"bytes"
+	"fmt"
+	"net"
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
+	"github.com/hashicorp/consul/api"
 	corev1 "k8s.io/api/core/v1"
 )
 
@@ -16,12 +20,27 @@ const (
 	envoyUserAndGroupID         = 5995
 	copyContainerUserAndGroupID = 5996
 	netAdminCapability          = "NET_ADMIN"
+
+	// consulK8SCopyPath is where the init container copies the consul-k8s
+	// binary to when the Envoy sidecar's lifecycle hooks need it.
+	consulK8SCopyPath = "/consul/connect-inject/consul-k8s"
+
+	// The default HTTP, HTTPS and gRPC ports of Consul clients.
+	defaultConsulHTTPPort  = 8500
+	defaultConsulHTTPSPort = 8501
+	defaultConsulGRPCPort  = 8502
 )
 
 type initContainerCommandData struct {
 	ServiceName        string
 	ServiceAccountName string
 	AuthMethod         string
+	// ACLLoginRetries is the number of times connect-init retries logging in
+	// with the auth method. If 0, the connect-init default is used.
+	ACLLoginRetries uint64
+	// ACLLoginTimeout is how long connect-init keeps retrying logging in with
+	// the auth method for. If 0, there is no timeout.
+	ACLLoginTimeout time.Duration
 	// ConsulNamespace is the Consul namespace to register the service
 	// and proxy in. An empty string indicates namespaces are not
 	// enabled in Consul (necessary for OSS).
@@ -31,6 +50,18 @@ type initContainerCommandData struct {
 	// The PEM-encoded CA certificate to use when
 	// communicating with Consul clients
 	ConsulCACert string
+	// ConsulCACertFile is the path of the mounted CA certificate to use
+	// when communicating with Consul clients. It takes precedence over
+	// ConsulCACert.
+	ConsulCACertFile string
+	// The PEM-encoded CA certificate to use when only the gRPC
+	// connection to Consul clients uses TLS.
+	ConsulGRPCCACert string
+	// ConsulHTTPPort, ConsulHTTPSPort and ConsulGRPCPort are the HTTP,
+	// HTTPS and gRPC ports of Consul clients.
+	ConsulHTTPPort  int
+	ConsulHTTPSPort int
+	ConsulGRPCPort  int
 	// EnableMetrics adds a listener to Envoy where Prometheus will scrape
 	// metrics from.
 	EnableMetrics bool
@@ -46,6 +77,23 @@ type initContainerCommandData struct {
 	// i.e. run consul connect redirect-traffic command and add the required privileges to the
 	// container to do that.
 	EnableTransparentProxy bool
+
+	// EnvoyAdminBind is the host:port the Envoy admin API binds to if it's
+	// overridden for the pod.
+	EnvoyAdminBind string
+
+	// ConnectNative skips bootstrapping Envoy because Connect-native pods
+	// don't have a sidecar proxy.
+	ConnectNative bool
+
+	// ConsulK8SCopyPath is where the consul-k8s binary is copied to in the
+	// shared volume so that the lifecycle hooks of the Envoy sidecar can run
+	// it. If empty, the binary isn't copied.
+	ConsulK8SCopyPath string
+
+	// WaitForUpstreams is the list of upstreams, in the form <service>=<n>, that must have
+	// at least n passing instances before the init container completes.
+	WaitForUpstreams []string
 }
 
 // containerInitCopyContainer returns the init container spec for the copy container which places
@@ -53,9 +101,13 @@ type initContainerCommandData struct {
 func (h *Handler) containerInitCopyContainer() corev1.Container {
 	// Copy the Consul binary from the image to the shared volume.
 	cmd := "cp /bin/consul /consul/connect-inject/consul"
+	image := h.ImageConsul
+	if h.ImageConsulCopy != "" {
+		image = h.ImageConsulCopy
+	}
 	return corev1.Container{
 		Name:      InjectInitCopyContainerName,
-		Image:     h.ImageConsul,
+		Image:     image,
 		Resources: h.InitContainerResources,
 		VolumeMounts: []corev1.VolumeMount{
 			{
@@ -82,19 +134,65 @@ func (h *Handler) containerInit(pod corev1.Pod, k8sNamespace string) (corev1.Con
 	if err != nil {
 		return corev1.Container{}, err
 	}
+	// Connect-native pods have no proxy to redirect their traffic to.
+	native, err := connectNativeEnabled(pod)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+	if native {
+		tproxyEnabled = false
+	}
 
 	data := initContainerCommandData{
 		AuthMethod:                h.AuthMethod,
-		ConsulNamespace:           h.consulNamespace(k8sNamespace),
+		ConsulNamespace:           h.podConsulNamespace(pod, k8sNamespace),
 		NamespaceMirroringEnabled: h.EnableK8SNSMirroring,
 		ConsulCACert:              h.ConsulCACert,
+		ConsulGRPCCACert:          h.ConsulGRPCCACert,
 		EnableTransparentProxy:    tproxyEnabled,
+		ConnectNative:             native,
 		EnvoyUID:                  envoyUserAndGroupID,
+		ConsulHTTPPort:            h.ConsulHTTPPort,
+		ConsulHTTPSPort:           h.ConsulHTTPSPort,
+		ConsulGRPCPort:            h.ConsulGRPCPort,
+	}
+	if data.ConsulHTTPPort == 0 {
+		data.ConsulHTTPPort = defaultConsulHTTPPort
+	}
+	if data.ConsulHTTPSPort == 0 {
+		data.ConsulHTTPSPort = defaultConsulHTTPSPort
+	}
+	if data.ConsulGRPCPort == 0 {
+		data.ConsulGRPCPort = defaultConsulGRPCPort
+	}
+
+	if h.ConsulCACertSecretName != "" {
+		data.ConsulCACertFile = caCertFile
 	}
 
 	if data.AuthMethod != "" {
 		data.ServiceAccountName = pod.Spec.ServiceAccountName
 		data.ServiceName = pod.Annotations[annotationService]
+		data.ACLLoginRetries = h.ACLLoginRetries
+		data.ACLLoginTimeout = h.ACLLoginTimeout
+	}
+
+	data.WaitForUpstreams, err = waitForUpstreams(pod)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+
+	if !native {
+		lifecycle, err := h.envoySidecarLifecycle(pod)
+		if err != nil {
+			return corev1.Container{}, err
+		}
+		// When dependency checks are enabled, the sidecar's postStart hook runs the copied binary to
+		// wait for Envoy to be ready. The wait can't be a poll in this script because Kubernetes only
+		// starts the Envoy sidecar once every init container has completed, so Envoy would never be up.
+		if lifecycle != nil {
+			data.ConsulK8SCopyPath = consulK8SCopyPath
+		}
 	}
 
 	// This determines how to configure the consul connect envoy command: what
@@ -114,6 +212,16 @@ func (h *Handler) containerInit(pod corev1.Pod, k8sNamespace string) (corev1.Con
 		data.PrometheusBackendPort = mergedMetricsPort
 	}
 
+	_, adminBindOverridden := pod.Annotations[annotationEnvoyAdminBind]
+	_, adminPortOverridden := pod.Annotations[annotationEnvoyAdminPort]
+	if adminBindOverridden || adminPortOverridden {
+		address, port, err := envoyAdminBind(pod)
+		if err != nil {
+			return corev1.Container{}, err
+		}
+		data.EnvoyAdminBind = net.JoinHostPort(address, strconv.Itoa(port))
+	}
+
 	// Create expected volume mounts
 	volMounts := []corev1.VolumeMount{
 		{
@@ -122,6 +230,14 @@ func (h *Handler) containerInit(pod corev1.Pod, k8sNamespace string) (corev1.Con
 		},
 	}
 
+	if h.ConsulCACertSecretName != "" {
+		volMounts = append(volMounts, corev1.VolumeMount{
+			Name:      caCertVolumeName,
+			MountPath: caCertMountPath,
+			ReadOnly:  true,
+		})
+	}
+
 	if h.AuthMethod != "" {
 		// Extract the service account token's volume mount
 		saTokenVolumeMount, err := findServiceAccountVolumeMount(pod)
@@ -188,11 +304,38 @@ func (h *Handler) containerInit(pod corev1.Pod, k8sNamespace string) (corev1.Con
 				Add: []corev1.Capability{netAdminCapability},
 			},
 		}
+	} else if h.InitContainerRunAsUser > 0 {
+		container.SecurityContext = &corev1.SecurityContext{
+			RunAsUser:    pointerToInt64(h.InitContainerRunAsUser),
+			RunAsNonRoot: pointerToBool(true),
+		}
 	}
 
 	return container, nil
 }
 
+// waitForUpstreams returns the upstreams set in the wait-for-upstreams annotation, in the form
+// <service>=<n>, after validating that n is a positive integer.
+func waitForUpstreams(pod corev1.Pod) ([]string, error) {
+	raw, ok := pod.Annotations[annotationWaitForUpstreams]
+	if !ok || raw == "" {
+		return nil, nil
+	}
+	var upstreams []string
+	for _, upstream := range strings.Split(raw, ",") {
+		upstream = strings.TrimSpace(upstream)
+		parts := strings.SplitN(upstream, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%s annotation value of %q is invalid: must be in the form <service>=<n>", annotationWaitForUpstreams, upstream)
+		}
+		if n, err := strconv.Atoi(parts[1]); err != nil || n < 1 {
+			return nil, fmt.Errorf("%s annotation value of %q is invalid: the number of instances must be a positive integer", annotationWaitForUpstreams, upstream)
+		}
+		upstreams = append(upstreams, upstream)
+	}
+	return upstreams, nil
+}
+
 // transparentProxyEnabled returns true if transparent proxy should be enabled for this pod.
 // It returns an error when the annotation value cannot be parsed by strconv.ParseBool.
 func transparentProxyEnabled(pod corev1.Pod, globalEnabled bool) (bool, error) {
@@ -203,6 +346,50 @@ func transparentProxyEnabled(pod corev1.Pod, globalEnabled bool) (bool, error) {
 	return globalEnabled, nil
 }
 
+// connectNativeEnabled returns true if the pod runs a Connect-native application.
+// It returns an error when the annotation value cannot be parsed by strconv.ParseBool.
+func connectNativeEnabled(pod corev1.Pod) (bool, error) {
+	if raw, ok := pod.Annotations[annotationConnectNative]; ok {
+		enabled, err := strconv.ParseBool(raw)
+		if err != nil {
+			return false, fmt.Errorf("%s annotation value of %s is not a valid boolean", annotationConnectNative, raw)
+		}
+		return enabled, nil
+	}
+	return false, nil
+}
+
+// proxyModeOverride returns the proxy mode set by the proxy mode annotation, or
+// an empty mode if the annotation isn't set. The transparent mode may only be set
+// if transparent proxy is enabled globally.
+func proxyModeOverride(pod corev1.Pod, globalEnabled bool) (api.ProxyMode, error) {
+	raw, ok := pod.Annotations[annotationProxyMode]
+	if !ok {
+		return api.ProxyModeDefault, nil
+	}
+	mode := api.ProxyMode(raw)
+	if err := validateProxyMode(mode, globalEnabled, fmt.Sprintf("%s annotation", annotationProxyMode)); err != nil {
+		return "", err
+	}
+	return mode, nil
+}
+
+// validateProxyMode returns an error if mode, set by source, isn't a proxy mode that proxies
+// can be registered in. The transparent mode is only valid if transparent proxy is enabled globally.
+func validateProxyMode(mode api.ProxyMode, globalEnabled bool, source string) error {
+	switch mode {
+	case api.ProxyModeDirect:
+		return nil
+	case api.ProxyModeTransparent:
+		if !globalEnabled {
+			return fmt.Errorf("%s cannot be %q when transparent proxy is disabled", source, mode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s value of %q must be %q or %q", source, mode, api.ProxyModeDirect, api.ProxyModeTransparent)
+	}
+}
+
 // pointerToInt64 takes an int64 and returns a pointer to it.
 func pointerToInt64(i int64) *int64 {
 	return &i
@@ -216,22 +403,39 @@ func pointerToBool(b bool) *bool {
 // initContainerCommandTpl is the template for the command executed by
 // the init container.
 const initContainerCommandTpl = `
-{{- if .ConsulCACert}}
-export CONSUL_HTTP_ADDR="https://${HOST_IP}:8501"
-export CONSUL_GRPC_ADDR="https://${HOST_IP}:8502"
+{{- if .ConsulCACertFile}}
+export CONSUL_HTTP_ADDR="https://${HOST_IP}:{{ .ConsulHTTPSPort }}"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:{{ .ConsulGRPCPort }}"
+export CONSUL_CACERT={{ .ConsulCACertFile }}
+{{- else if .ConsulCACert}}
+export CONSUL_HTTP_ADDR="https://${HOST_IP}:{{ .ConsulHTTPSPort }}"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:{{ .ConsulGRPCPort }}"
 export CONSUL_CACERT=/consul/connect-inject/consul-ca.pem
 cat <<EOF >/consul/connect-inject/consul-ca.pem
 {{ .ConsulCACert }}
 EOF
+{{- else if .ConsulGRPCCACert}}
+export CONSUL_HTTP_ADDR="${HOST_IP}:{{ .ConsulHTTPPort }}"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:{{ .ConsulGRPCPort }}"
+export CONSUL_CACERT=/consul/connect-inject/consul-ca.pem
+cat <<EOF >/consul/connect-inject/consul-ca.pem
+{{ .ConsulGRPCCACert }}
+EOF
 {{- else}}
-export CONSUL_HTTP_ADDR="${HOST_IP}:8500"
-export CONSUL_GRPC_ADDR="${HOST_IP}:8502"
+export CONSUL_HTTP_ADDR="${HOST_IP}:{{ .ConsulHTTPPort }}"
+export CONSUL_GRPC_ADDR="${HOST_IP}:{{ .ConsulGRPCPort }}"
 {{- end}}
 consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
   {{- if .AuthMethod }}
   -acl-auth-method="{{ .AuthMethod }}" \
   -service-account-name="{{ .ServiceAccountName }}" \
   -service-name="{{ .ServiceName }}" \
+  {{- if .ACLLoginRetries }}
+  -acl-auth-method-login-retries={{ .ACLLoginRetries }} \
+  {{- end }}
+  {{- if .ACLLoginTimeout }}
+  -login-timeout={{ .ACLLoginTimeout }} \
+  {{- end }}
   {{- if .ConsulNamespace }}
   {{- if .NamespaceMirroringEnabled }}
   {{- /* If namespace mirroring is enabled, the auth method is
@@ -245,6 +449,15 @@ consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
   {{- if .ConsulNamespace }}
   -consul-service-namespace="{{ .ConsulNamespace }}" \
   {{- end }}
+  {{- range .WaitForUpstreams }}
+  -wait-for-upstream="{{ . }}" \
+  {{- end }}
+{{- if .ConsulK8SCopyPath }}
+
+# Copy consul-k8s for the lifecycle hooks of the Envoy sidecar
+cp /bin/consul-k8s {{ .ConsulK8SCopyPath }}
+{{- end }}
+{{- if not .ConnectNative }}
 
 # Generate the envoy bootstrap code
 /consul/connect-inject/consul connect envoy \
@@ -255,6 +468,9 @@ consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
   {{- if .PrometheusBackendPort }}
   -prometheus-backend-port="{{ .PrometheusBackendPort }}" \
   {{- end }}
+  {{- if .EnvoyAdminBind }}
+  -admin-bind="{{ .EnvoyAdminBind }}" \
+  {{- end }}
   {{- if .AuthMethod }}
   -token-file="/consul/connect-inject/acl-token" \
   {{- end }}
@@ -262,6 +478,7 @@ consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
   -namespace="{{ .ConsulNamespace }}" \
   {{- end }}
   -bootstrap > /consul/connect-inject/envoy-bootstrap.yaml
+{{- end }}
 
 {{- if .EnableTransparentProxy }}
 {{- /* The newline below is intentional to allow extra space
@@ -4,6 +4,7 @@ import (
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -95,6 +96,43 @@ consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
 `,
 			"",
 		},
+		{
+			"When auth method is set with login retries and timeout, they are passed in",
+			func(pod *corev1.Pod) *corev1.Pod {
+				pod.Annotations[annotationService] = "web"
+				pod.Spec.ServiceAccountName = "a-service-account-name"
+				pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+					{
+						Name:      "sa",
+						MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+					},
+				}
+				return pod
+			},
+			Handler{
+				AuthMethod:      "an-auth-method",
+				ACLLoginRetries: 10,
+				ACLLoginTimeout: 2 * time.Minute,
+			},
+			`  -service-name="web" \
+  -acl-auth-method-login-retries=10 \
+  -login-timeout=2m0s \
+`,
+			"",
+		},
+		{
+			"When auth method is not set, login retries and timeout are not passed in",
+			func(pod *corev1.Pod) *corev1.Pod {
+				pod.Annotations[annotationService] = "web"
+				return pod
+			},
+			Handler{
+				ACLLoginRetries: 10,
+				ACLLoginTimeout: 2 * time.Minute,
+			},
+			"",
+			"-acl-auth-method-login-retries",
+		},
 		{
 			"When running the merged metrics server, configures consul connect envoy command",
 			func(pod *corev1.Pod) *corev1.Pod {
@@ -122,6 +160,20 @@ consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
   -bootstrap > /consul/connect-inject/envoy-bootstrap.yaml`,
 			"",
 		},
+		{
+			"When upstreams to wait for are set, -wait-for-upstream is passed in for each of them",
+			func(pod *corev1.Pod) *corev1.Pod {
+				pod.Annotations[annotationService] = "web"
+				pod.Annotations[annotationWaitForUpstreams] = "db=2, cache=1"
+				return pod
+			},
+			Handler{},
+			`consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
+  -wait-for-upstream="db=2" \
+  -wait-for-upstream="cache=1" \
+`,
+			"",
+		},
 	}
 
 	for _, tt := range cases {
@@ -141,6 +193,31 @@ consul-k8s connect-init -pod-name=${POD_NAME} -pod-namespace=${POD_NAMESPACE} \
 	}
 }
 
+func TestHandlerContainerInit_invalidWaitForUpstreams(t *testing.T) {
+	cases := map[string]string{
+		"db":    `consul.hashicorp.com/connect-wait-for-upstreams annotation value of "db" is invalid: must be in the form <service>=<n>`,
+		"=2":    `consul.hashicorp.com/connect-wait-for-upstreams annotation value of "=2" is invalid: must be in the form <service>=<n>`,
+		"db=0":  `consul.hashicorp.com/connect-wait-for-upstreams annotation value of "db=0" is invalid: the number of instances must be a positive integer`,
+		"db=a":  `consul.hashicorp.com/connect-wait-for-upstreams annotation value of "db=a" is invalid: the number of instances must be a positive integer`,
+		"db=1,": `consul.hashicorp.com/connect-wait-for-upstreams annotation value of "" is invalid: must be in the form <service>=<n>`,
+	}
+	for annotation, expErr := range cases {
+		t.Run(annotation, func(t *testing.T) {
+			h := Handler{}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationService:          "web",
+						annotationWaitForUpstreams: annotation,
+					},
+				},
+			}
+			_, err := h.containerInit(pod, k8sNamespace)
+			require.EqualError(t, err, expErr)
+		})
+	}
+}
+
 func TestHandlerContainerInit_transparentProxy(t *testing.T) {
 	cases := map[string]struct {
 		globalEnabled     bool
@@ -212,6 +289,190 @@ func TestHandlerContainerInit_transparentProxy(t *testing.T) {
 	}
 }
 
+func TestHandlerContainerInit_runAsUser(t *testing.T) {
+	cases := map[string]struct {
+		runAsUser          int64
+		tproxyEnabled      bool
+		expSecurityContext *corev1.SecurityContext
+	}{
+		"unset": {},
+		"set": {
+			runAsUser: 5997,
+			expSecurityContext: &corev1.SecurityContext{
+				RunAsUser:    pointerToInt64(5997),
+				RunAsNonRoot: pointerToBool(true),
+			},
+		},
+		"set with transparent proxy": {
+			runAsUser:     5997,
+			tproxyEnabled: true,
+			expSecurityContext: &corev1.SecurityContext{
+				RunAsUser:  pointerToInt64(0),
+				RunAsGroup: pointerToInt64(0),
+				Capabilities: &corev1.Capabilities{
+					Add: []corev1.Capability{netAdminCapability},
+				},
+				RunAsNonRoot: pointerToBool(false),
+			},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler{
+				EnableTransparentProxy: c.tproxyEnabled,
+				InitContainerRunAsUser: c.runAsUser,
+			}
+			container, err := h.containerInit(*minimal(), k8sNamespace)
+			require.NoError(t, err)
+			require.Equal(t, c.expSecurityContext, container.SecurityContext)
+		})
+	}
+}
+
+// Test that the Envoy admin bind annotations are passed to the Envoy bootstrap generation.
+func TestHandlerContainerInit_envoyAdminBind(t *testing.T) {
+	cases := map[string]struct {
+		annotations map[string]string
+		expArg      string
+	}{
+		"no annotations": {},
+		"address": {
+			annotations: map[string]string{annotationEnvoyAdminBind: "0.0.0.0"},
+			expArg:      `-admin-bind="0.0.0.0:19000"`,
+		},
+		"port": {
+			annotations: map[string]string{annotationEnvoyAdminPort: "19100"},
+			expArg:      `-admin-bind="127.0.0.1:19100"`,
+		},
+		"IPv6 address and port": {
+			annotations: map[string]string{annotationEnvoyAdminBind: "::", annotationEnvoyAdminPort: "19100"},
+			expArg:      `-admin-bind="[::]:19100"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := minimal()
+			for k, v := range c.annotations {
+				pod.Annotations[k] = v
+			}
+			h := Handler{}
+			container, err := h.containerInit(*pod, k8sNamespace)
+			require.NoError(t, err)
+			actual := strings.Join(container.Command, " ")
+			if c.expArg == "" {
+				require.NotContains(t, actual, "-admin-bind")
+				return
+			}
+			require.Contains(t, actual, c.expArg+` \
+  -bootstrap > /consul/connect-inject/envoy-bootstrap.yaml`)
+		})
+	}
+}
+
+// Test that the init container copies the consul-k8s binary into the shared volume
+// only if the lifecycle hooks of the Envoy sidecar run it.
+func TestHandlerContainerInit_copyConsulK8S(t *testing.T) {
+	cases := map[string]struct {
+		handler     Handler
+		annotations map[string]string
+		expCopy     bool
+	}{
+		"no lifecycle hooks": {},
+		"proxy lifecycle enabled": {
+			handler: Handler{EnableProxyLifecycle: true},
+			expCopy: true,
+		},
+		"proxy lifecycle enabled via annotation": {
+			annotations: map[string]string{annotationEnableSidecarProxyLifecycle: "true"},
+			expCopy:     true,
+		},
+		"dependency checks enabled": {
+			handler: Handler{EnableDependencyChecks: true},
+			expCopy: true,
+		},
+		"Connect-native pod": {
+			handler:     Handler{EnableProxyLifecycle: true},
+			annotations: map[string]string{annotationConnectNative: "true"},
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := minimal()
+			for k, v := range c.annotations {
+				pod.Annotations[k] = v
+			}
+			container, err := c.handler.containerInit(*pod, k8sNamespace)
+			require.NoError(t, err)
+			actual := strings.Join(container.Command, " ")
+			if c.expCopy {
+				require.Contains(t, actual, "cp /bin/consul-k8s /consul/connect-inject/consul-k8s")
+			} else {
+				require.NotContains(t, actual, "cp /bin/consul-k8s")
+			}
+		})
+	}
+}
+
+// Test that with dependency checks enabled the init container doesn't wait for
+// Envoy itself, since the sidecar only starts once it has completed, and
+// instead copies consul-k8s for the sidecar's postStart hook to wait with.
+func TestHandlerContainerInit_dependencyChecks(t *testing.T) {
+	pod := minimal()
+	pod.Annotations[annotationEnvoyReadinessWait] = "30s"
+	h := Handler{EnableDependencyChecks: true}
+	container, err := h.containerInit(*pod, k8sNamespace)
+	require.NoError(t, err)
+	actual := strings.Join(container.Command, " ")
+	require.Contains(t, actual, "cp /bin/consul-k8s /consul/connect-inject/consul-k8s")
+	require.NotContains(t, actual, "/ready")
+	require.NotContains(t, actual, "19000")
+
+	lifecycle, err := h.envoySidecarLifecycle(*pod)
+	require.NoError(t, err)
+	require.NotNil(t, lifecycle.PostStart)
+	require.Equal(t, []string{
+		"/consul/connect-inject/consul-k8s", "envoy-lifecycle",
+		"-wait-ready",
+		"-admin-addr=127.0.0.1:19000",
+		"-ready-timeout=30s",
+	}, lifecycle.PostStart.Exec.Command)
+}
+
+// Test that the init container of a Connect-native pod runs connect-init but
+// doesn't bootstrap Envoy or redirect traffic, even if transparent proxy is enabled.
+func TestHandlerContainerInit_connectNative(t *testing.T) {
+	pod := minimal()
+	pod.Annotations[annotationConnectNative] = "true"
+	h := Handler{EnableTransparentProxy: true}
+	container, err := h.containerInit(*pod, k8sNamespace)
+	require.NoError(t, err)
+	actual := strings.Join(container.Command, " ")
+	require.Contains(t, actual, "consul-k8s connect-init")
+	require.NotContains(t, actual, "consul connect envoy")
+	require.NotContains(t, actual, "consul connect redirect-traffic")
+	require.Nil(t, container.SecurityContext)
+
+	// connect-init still logs in with the auth method to provision the ACL token.
+	pod.Spec.ServiceAccountName = "web"
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{
+		{
+			Name:      "sa",
+			MountPath: "/var/run/secrets/kubernetes.io/serviceaccount",
+		},
+	}
+	h.AuthMethod = "an-auth-method"
+	container, err = h.containerInit(*pod, k8sNamespace)
+	require.NoError(t, err)
+	actual = strings.Join(container.Command, " ")
+	require.Contains(t, actual, `-acl-auth-method="an-auth-method"`)
+	require.Contains(t, actual, `-service-account-name="web"`)
+	require.NotContains(t, actual, "consul connect envoy")
+
+	pod.Annotations[annotationConnectNative] = "yes please"
+	_, err = h.containerInit(*pod, k8sNamespace)
+	require.EqualError(t, err, "consul.hashicorp.com/connect-inject-native annotation value of yes please is not a valid boolean")
+}
+
 func TestHandlerContainerInit_namespacesEnabled(t *testing.T) {
 	minimal := func() *corev1.Pod {
 		return &corev1.Pod{
@@ -542,6 +803,196 @@ EOF`)
 	require.NotContains(actual, `
 export CONSUL_HTTP_ADDR="${HOST_IP}:8500"
 export CONSUL_GRPC_ADDR="${HOST_IP}:8502"`)
+
+	// The gRPC address uses TLS on a non-default port too.
+	h.ConsulGRPCPort = 9502
+	container, err = h.containerInit(*pod, k8sNamespace)
+	require.NoError(err)
+	actual = strings.Join(container.Command, " ")
+	require.Contains(actual, `
+export CONSUL_HTTP_ADDR="https://${HOST_IP}:8501"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:9502"
+export CONSUL_CACERT=/consul/connect-inject/consul-ca.pem`)
+	require.NotContains(actual, ":8502")
+}
+
+// If the Consul CA cert is mounted from a Secret, the init container should
+// point CONSUL_CACERT at the mounted file rather than write the cert inline.
+func TestHandlerContainerInit_WithTLSFromSecret(t *testing.T) {
+	require := require.New(t)
+	h := Handler{
+		ConsulCACert:           "consul-ca-cert",
+		ConsulCACertSecretName: "consul-ca-cert",
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationService: "foo",
+			},
+		},
+
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "web",
+				},
+			},
+		},
+	}
+	container, err := h.containerInit(*pod, k8sNamespace)
+	require.NoError(err)
+	actual := strings.Join(container.Command, " ")
+	require.Contains(actual, `
+export CONSUL_HTTP_ADDR="https://${HOST_IP}:8501"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:8502"
+export CONSUL_CACERT=/consul/tls/ca/tls.crt
+consul-k8s connect-init`)
+	require.NotContains(actual, "<<EOF")
+	require.Contains(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "consul-ca-cert",
+		MountPath: "/consul/tls/ca",
+		ReadOnly:  true,
+	})
+
+	require.Equal(corev1.Volume{
+		Name: "consul-ca-cert",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: "consul-ca-cert",
+				Items:      []corev1.KeyToPath{{Key: "tls.crt", Path: "tls.crt"}},
+			},
+		},
+	}, h.caCertVolume())
+	h.ConsulCACertSecretKey = "ca.crt"
+	require.Equal([]corev1.KeyToPath{{Key: "ca.crt", Path: "tls.crt"}}, h.caCertVolume().Secret.Items)
+}
+
+// If only the Consul gRPC CA cert is set,
+// the HTTP address should not use HTTPS but the gRPC address should,
+// with the CA cert set as env variable.
+func TestHandlerContainerInit_WithGRPCTLS(t *testing.T) {
+	cases := map[string]struct {
+		handler Handler
+		expCmd  string
+	}{
+		"gRPC TLS only": {
+			handler: Handler{
+				ConsulGRPCCACert: "consul-grpc-ca-cert",
+			},
+			expCmd: `
+export CONSUL_HTTP_ADDR="${HOST_IP}:8500"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:8502"
+export CONSUL_CACERT=/consul/connect-inject/consul-ca.pem
+cat <<EOF >/consul/connect-inject/consul-ca.pem
+consul-grpc-ca-cert
+EOF`,
+		},
+		"HTTP TLS takes precedence over gRPC TLS": {
+			handler: Handler{
+				ConsulCACert:     "consul-ca-cert",
+				ConsulGRPCCACert: "consul-grpc-ca-cert",
+			},
+			expCmd: `
+export CONSUL_HTTP_ADDR="https://${HOST_IP}:8501"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:8502"
+export CONSUL_CACERT=/consul/connect-inject/consul-ca.pem
+cat <<EOF >/consul/connect-inject/consul-ca.pem
+consul-ca-cert
+EOF`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationService: "foo",
+					},
+				},
+
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "web",
+						},
+					},
+				},
+			}
+			container, err := c.handler.containerInit(*pod, k8sNamespace)
+			require.NoError(t, err)
+			actual := strings.Join(container.Command, " ")
+			require.Contains(t, actual, c.expCmd)
+			require.NotContains(t, actual, `export CONSUL_GRPC_ADDR="${HOST_IP}:8502"`)
+		})
+	}
+}
+
+func TestHandlerContainerInit_CustomPorts(t *testing.T) {
+	cases := map[string]struct {
+		handler Handler
+		expCmd  string
+	}{
+		"without TLS": {
+			handler: Handler{
+				ConsulHTTPPort:  9500,
+				ConsulHTTPSPort: 9501,
+				ConsulGRPCPort:  9502,
+			},
+			expCmd: `
+export CONSUL_HTTP_ADDR="${HOST_IP}:9500"
+export CONSUL_GRPC_ADDR="${HOST_IP}:9502"`,
+		},
+		"with TLS": {
+			handler: Handler{
+				ConsulCACert:    "consul-ca-cert",
+				ConsulHTTPPort:  9500,
+				ConsulHTTPSPort: 9501,
+				ConsulGRPCPort:  9502,
+			},
+			expCmd: `
+export CONSUL_HTTP_ADDR="https://${HOST_IP}:9501"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:9502"`,
+		},
+		"with gRPC TLS only": {
+			handler: Handler{
+				ConsulGRPCCACert: "consul-grpc-ca-cert",
+				ConsulHTTPPort:   9500,
+				ConsulHTTPSPort:  9501,
+				ConsulGRPCPort:   9502,
+			},
+			expCmd: `
+export CONSUL_HTTP_ADDR="${HOST_IP}:9500"
+export CONSUL_GRPC_ADDR="https://${HOST_IP}:9502"`,
+		},
+		"defaults": {
+			expCmd: `
+export CONSUL_HTTP_ADDR="${HOST_IP}:8500"
+export CONSUL_GRPC_ADDR="${HOST_IP}:8502"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationService: "foo",
+					},
+				},
+
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "web",
+						},
+					},
+				},
+			}
+			container, err := c.handler.containerInit(*pod, k8sNamespace)
+			require.NoError(t, err)
+			actual := strings.Join(container.Command, " ")
+			require.Contains(t, actual, c.expCmd)
+		})
+	}
 }
 
 func TestHandlerContainerInit_Resources(t *testing.T) {
@@ -602,3 +1053,32 @@ func TestHandlerContainerInitCopyContainer(t *testing.T) {
 	actual := strings.Join(container.Command, " ")
 	require.Contains(actual, `cp /bin/consul /consul/connect-inject/consul`)
 }
+
+// Test that the init copy container uses the copy image if it's set and the
+// Consul image otherwise.
+func TestHandlerContainerInitCopyContainer_image(t *testing.T) {
+	cases := map[string]struct {
+		imageConsulCopy string
+		expImage        string
+	}{
+		"unset": {
+			expImage: "hashicorp/consul:latest",
+		},
+		"set": {
+			imageConsulCopy: "mirror.example.com/hashicorp/consul:latest",
+			expImage:        "mirror.example.com/hashicorp/consul:latest",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler{
+				ImageConsul:     "hashicorp/consul:latest",
+				ImageConsulCopy: c.imageConsulCopy,
+			}
+			container := h.containerInitCopyContainer()
+			require.Equal(t, c.expImage, container.Image)
+			require.Equal(t, []string{"/bin/sh", "-ec", "cp /bin/consul /consul/connect-inject/consul"}, container.Command)
+			require.Equal(t, pointerToInt64(copyContainerUserAndGroupID), container.SecurityContext.RunAsUser)
+		})
+	}
+}
@@ -8,6 +8,18 @@ import (
 // Consul Connect injection data.
 const volumeName = "consul-connect-inject-data"
 
+const (
+	// caCertVolumeName is the name of the volume the ConsulCACertSecretName
+	// Secret is mounted from.
+	caCertVolumeName = "consul-ca-cert"
+	// caCertMountPath is where caCertVolumeName is mounted and caCertFile is
+	// the path of the CA certificate in it.
+	caCertMountPath = "/consul/tls/ca"
+	caCertFile      = caCertMountPath + "/tls.crt"
+
+	defaultConsulCACertSecretKey = "tls.crt"
+)
+
 // containerVolume returns the volume data to add to the pod. This volume
 // is used for shared data between containers.
 func (h *Handler) containerVolume() corev1.Volume {
@@ -18,3 +30,26 @@ func (h *Handler) containerVolume() corev1.Volume {
 		},
 	}
 }
+
+// caCertVolume returns the volume of the Secret holding Consul's CA
+// certificate, which is projected to caCertFile when mounted.
+func (h *Handler) caCertVolume() corev1.Volume {
+	key := h.ConsulCACertSecretKey
+	if key == "" {
+		key = defaultConsulCACertSecretKey
+	}
+	return corev1.Volume{
+		Name: caCertVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{
+				SecretName: h.ConsulCACertSecretName,
+				Items: []corev1.KeyToPath{
+					{
+						Key:  key,
+						Path: "tls.crt",
+					},
+				},
+			},
+		},
+	}
+}
@@ -2,9 +2,16 @@ package connectinject
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/deckarep/golang-set"
 	"github.com/go-logr/logr"
@@ -12,14 +19,18 @@ import (
 	"github.com/hashicorp/consul-k8s/namespaces"
 	"github.com/hashicorp/consul/api"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -30,9 +41,61 @@ const (
 	MetaKeyPodName             = "pod-name"
 	MetaKeyKubeServiceName     = "k8s-service-name"
 	MetaKeyKubeNS              = "k8s-namespace"
+	MetaKeyPlaceholder         = "placeholder"
+	MetaKeyKubeCluster         = "k8s-cluster"
+	MetaKeyProxyType           = "proxy-type"
+	proxyTypeSidecar           = "sidecar"
+	proxyTypeNative            = "native"
 	kubernetesSuccessReasonMsg = "Kubernetes health checks passing"
 	envoyPrometheusBindAddr    = "envoy_prometheus_bind_addr"
+	envoyBindAddress           = "bind_address"
 	clusterIPTaggedAddressName = "virtual"
+
+	// placeholderNodeName is the Consul node that placeholder service instances are registered on in the
+	// catalog. It isn't the node of any agent so that the placeholders don't depend on where the
+	// connect-inject deployment runs and aren't removed by anti-entropy.
+	placeholderNodeName = "k8s-placeholders"
+
+	// reasonConsulNamespaceNotAllowed is the event reason used when a pod
+	// isn't registered because it overrides its Consul namespace with one
+	// that pods aren't allowed to register into.
+	reasonConsulNamespaceNotAllowed = "ConsulNamespaceNotAllowed"
+
+	// reasonGatewayNameConflict is the event reason used when a service
+	// isn't registered because a gateway is already registered in Consul
+	// under the same name.
+	reasonGatewayNameConflict = "GatewayNameConflict"
+
+	// reasonRegistrationTimedOut is the event reason used when only some of
+	// the service instances of an Endpoints object were registered before
+	// the registration timeout.
+	reasonRegistrationTimedOut = "RegistrationTimedOut"
+
+	// reasonServiceRegistered and reasonServiceDeregistered are the event
+	// reasons used when service instances are registered with or
+	// deregistered from Consul.
+	reasonServiceRegistered   = "ServiceRegistered"
+	reasonServiceDeregistered = "ServiceDeregistered"
+
+	// reasonRegistrationFailed and reasonDeregistrationFailed are the event
+	// reasons used when Consul fails to register or deregister a service
+	// instance, or to update its health check.
+	reasonRegistrationFailed   = "RegistrationFailed"
+	reasonDeregistrationFailed = "DeregistrationFailed"
+
+	// reasonHealthCheckDeregistered is the event reason used when the
+	// Kubernetes health check of a service instance is deregistered because
+	// its pod disabled it.
+	reasonHealthCheckDeregistered = "HealthCheckDeregistered"
+
+	// reasonUpstreamWeightsConflict is the event reason used when the pods
+	// of a service weight their upstreams differently, so the ServiceSplitter
+	// of the weighted upstreams isn't changed.
+	reasonUpstreamWeightsConflict = "UpstreamWeightsConflict"
+
+	// defaultProxyPublicListenerPort is the port the sidecar proxy's public
+	// listener is registered on unless overridden.
+	defaultProxyPublicListenerPort = 20000
 )
 
 type EndpointsController struct {
@@ -65,6 +128,9 @@ type EndpointsController struct {
 	// then the k8s `default` namespace will be mirrored in Consul's
 	// `k8s-default` namespace.
 	NSMirroringPrefix string
+	// NSMirroringSeparator is added between NSMirroringPrefix and the k8s
+	// namespace. It's ignored if the prefix is empty.
+	NSMirroringSeparator string
 	// CrossNSACLPolicy is the name of the ACL policy to attach to
 	// any created Consul namespaces to allow cross namespace service discovery.
 	// Only necessary if ACLs are enabled.
@@ -76,31 +142,117 @@ type EndpointsController struct {
 	// EnableTransparentProxy controls whether transparent proxy should be enabled
 	// for all proxy service registrations.
 	EnableTransparentProxy bool
+	// ProxyDriftCheckPeriod, if non-zero, enables re-registering proxy service
+	// instances whose registration in Consul no longer matches the one the
+	// controller would create, e.g. after an upgrade changed how proxies are
+	// registered. Endpoints are also re-reconciled at this interval so that
+	// drift is corrected even if they don't change.
+	ProxyDriftCheckPeriod time.Duration
+	// ClusterName, if set, identifies the Kubernetes cluster the controller runs in.
+	// It's added to the metadata of every registered service instance so that
+	// instances can be told apart in federated setups.
+	ClusterName string
+	// UseEndpointSlices makes the controller read the addresses of services from
+	// their EndpointSlices rather than their Endpoints object, which Kubernetes
+	// truncates for services with a large number of pods.
+	UseEndpointSlices bool
+	// RegistrationTimeout, if non-zero, limits how long a single reconcile
+	// spends registering the service instances of an Endpoints object. Once
+	// it's exceeded, the reconcile is requeued and the requeued reconcile only
+	// registers the instances that weren't registered yet.
+	RegistrationTimeout time.Duration
+	// ConsulServiceNamePrefix and ConsulServiceNameSuffix are added to the
+	// Consul name of every service the controller registers, including names
+	// set with the connect-service annotation, so that the services of clusters
+	// registering into the same Consul datacenter don't collide. Sidecar proxies
+	// and upstreams referencing Kubernetes Services use the resulting names.
+	// Not supported with ACLs since service accounts must match service names.
+	ConsulServiceNamePrefix string
+	ConsulServiceNameSuffix string
+	// ReconcileOnPodChanges makes the controller also reconcile the Endpoints
+	// of injected pods whose labels or annotations change, since such changes,
+	// e.g. to the service meta annotations, don't update the Endpoints.
+	ReconcileOnPodChanges bool
+	// ConsistentReads makes the controller's reads from the Consul servers,
+	// i.e. of the catalog and of config entries, consistent so that they
+	// reflect writes made just before. Which service instances to register
+	// or deregister is always decided from the agents' local state, which
+	// isn't affected by stale catalog reads.
+	ConsistentReads bool
+	// AllowConsulNamespaceOverridesSet is the set of Consul namespaces that
+	// pods may register their service instances in with the consul-namespace
+	// annotation. It supports the special character `*` which allows any
+	// namespace. The instances of pods overriding their namespace with one
+	// that isn't allowed aren't registered, and are deregistered if they
+	// were registered before. It must be the handler's set.
+	AllowConsulNamespaceOverridesSet mapset.Set
+	// PodLabelSelector, if set, limits the pods whose service instances are
+	// registered to those matching it. The instances of injected pods that
+	// don't match it are deregistered. It complements the namespace allow
+	// and deny sets and must be the handler's PodLabelSelector so that pods
+	// that don't match it aren't injected in the first place. Label changes
+	// of injected pods are watched while it's set.
+	PodLabelSelector labels.Selector
+
+	// Recorder is used to emit Kubernetes events for the Endpoints being
+	// reconciled. Events are attached to the Service owning the Endpoints.
+	// If nil, no events are emitted.
+	Recorder record.EventRecorder
+
+	// AuditLog, if set, records every service registration, deregistration
+	// and TTL check update the controller makes with Consul agents.
+	AuditLog *AuditLogger
 
 	MetricsConfig MetricsConfig
 	Log           logr.Logger
 	Scheme        *runtime.Scheme
 
+	// registrationProgress tracks the pods registered by reconciles that
+	// exceeded the RegistrationTimeout.
+	registrationProgress registrationProgress
+
 	context.Context
 }
 
 func (r *EndpointsController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	result, err := r.reconcile(ctx, req)
+	if err != nil {
+		reconcileErrors.WithLabelValues(r.consulNamespace(req.Namespace)).Inc()
+	}
+	return result, err
+}
+
+// reconcile registers the service instances of the pods backing the Endpoints req and deregisters those no longer
+// backing them.
+func (r *EndpointsController) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	var serviceEndpoints corev1.Endpoints
 
 	if shouldIgnore(req.Namespace, r.DenyK8sNamespacesSet, r.AllowK8sNamespacesSet) {
 		return ctrl.Result{}, nil
 	}
 
-	err := r.Client.Get(ctx, req.NamespacedName, &serviceEndpoints)
+	var err error
+	if r.UseEndpointSlices {
+		serviceEndpoints, err = r.endpointsFromEndpointSlices(ctx, req.NamespacedName)
+	} else {
+		err = r.Client.Get(ctx, req.NamespacedName, &serviceEndpoints)
+	}
 
 	// If the endpoints object has been deleted (and we get an IsNotFound
 	// error), we need to deregister all instances in Consul for that service.
 	if k8serrors.IsNotFound(err) {
+		r.registrationProgress.forget(req.NamespacedName)
 		// Deregister all instances in Consul for this service. The function deregisterServiceOnAllAgents handles
 		// the case where the Consul service name is different from the Kubernetes service name.
 		if err = r.deregisterServiceOnAllAgents(ctx, req.Name, req.Namespace, nil); err != nil {
 			return ctrl.Result{}, err
 		}
+		if err = r.deregisterPlaceholders(req.Name, req.Namespace, nil); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err = r.reconcileUpstreamsSplitters(req.Name, req.Namespace, nil); err != nil {
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	} else if err != nil {
 		r.Log.Error(err, "failed to get Endpoints", "name", req.Name, "ns", req.Namespace)
@@ -109,9 +261,28 @@ func (r *EndpointsController) Reconcile(ctx context.Context, req ctrl.Request) (
 
 	r.Log.Info("retrieved", "name", serviceEndpoints.Name, "ns", serviceEndpoints.Namespace)
 
-	// endpointAddressMap stores every IP that corresponds to a Pod in the Endpoints object. It is used to compare
-	// against service instances in Consul to deregister them if they are not in the map.
-	endpointAddressMap := map[string]bool{}
+	// endpointAddressMap stores every IP that corresponds to a Pod in the Endpoints object, mapped to the IP of
+	// the node the Pod is running on. It is used to compare against service instances in Consul to deregister
+	// them if they are not in the map or if they're registered with an agent on a different node.
+	endpointAddressMap := map[string]string{}
+
+	// registrationDeadline is when registering instances stops if the RegistrationTimeout is set.
+	// totalInstances and registeredInstances count the injected pods and those registered so far
+	// to report progress if the deadline is exceeded.
+	registrationDeadline := time.Now().Add(r.RegistrationTimeout)
+	// newInstances counts the pods whose service instance wasn't registered with their agent before this reconcile.
+	var totalInstances, registeredInstances, newInstances int
+	timedOut := false
+
+	// splitters are the ServiceSplitters of the weighted upstreams of the pods, keyed by their namespace and name.
+	// A nil splitter marks one whose pods disagree on the weights.
+	splitters := make(map[types.NamespacedName]*api.ServiceSplitterConfigEntry)
+	// proxyModes caches the proxy modes set by config entries for the Consul services of the pods, keyed by
+	// their namespace and name, so that the config entries are only read once per service.
+	proxyModes := make(map[types.NamespacedName]api.ProxyMode)
+	// gatewayConflicts caches whether a gateway is registered under the Consul service names of the pods, keyed
+	// by their namespace and name, so that each service is only checked once.
+	gatewayConflicts := make(map[types.NamespacedName]bool)
 
 	// Register all addresses of this Endpoints object as service instances in Consul.
 	for _, subset := range serviceEndpoints.Subsets {
@@ -128,60 +299,237 @@ func (r *EndpointsController) Reconcile(ctx context.Context, req ctrl.Request) (
 					return ctrl.Result{}, err
 				}
 
+				// The injector sets the inject status annotation and label together, so a pod that has only
+				// one of them was injected and has since been edited to opt out. It's left out of
+				// endpointAddressMap so that its instances are deregistered below rather than lingering in Consul.
+				if noLongerInjected(pod) {
+					r.Log.Info("pod is no longer injected, deregistering its service instances", "name", pod.Name, "ns", pod.Namespace)
+					continue
+				}
+				// Pods not matching the pod label selector are left out of endpointAddressMap so that any
+				// instances registered for them are deregistered below.
+				if hasBeenInjected(pod) && !r.podLabelSelectorMatches(pod) {
+					r.Log.Info("skipping pod that doesn't match the pod label selector", "name", pod.Name, "ns", pod.Namespace)
+					continue
+				}
+				if hasBeenInjected(pod) && !r.podConsulNamespaceAllowed(pod) {
+					r.Log.Info("skipping pod whose Consul namespace isn't allowed", "name", pod.Name, "ns", pod.Namespace,
+						"consul-ns", r.podConsulNamespace(pod))
+					r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonConsulNamespaceNotAllowed,
+						fmt.Sprintf("pod %q was not registered because pods aren't allowed to register into Consul namespace %q",
+							pod.Name, r.podConsulNamespace(pod)))
+					continue
+				}
+
 				if hasBeenInjected(pod) {
 					// Build the endpointAddressMap up for deregistering service instances later.
-					endpointAddressMap[pod.Status.PodIP] = true
+					// Pods using the host network share the node's IP, so they're also keyed by their name.
+					if pod.Spec.HostNetwork {
+						endpointAddressMap[hostNetworkAddressKey(pod.Status.PodIP, pod.Name)] = pod.Status.HostIP
+					} else {
+						endpointAddressMap[pod.Status.PodIP] = pod.Status.HostIP
+					}
+					totalInstances++
+
+					podSplitters, err := r.upstreamsSplitters(pod, r.podServiceName(pod, serviceEndpoints.Name), serviceEndpoints.Name)
+					if err != nil {
+						r.Log.Error(err, "failed to get the weighted upstreams of pod", "name", pod.Name)
+						return ctrl.Result{}, err
+					}
+					for _, splitter := range podSplitters {
+						key := types.NamespacedName{Name: splitter.Name, Namespace: splitter.Namespace}
+						// Pods that disagree on the weights, e.g. during a rollout changing them, don't get to
+						// overwrite each other's splits. The splitter is left as it is until they agree.
+						if current, ok := splitters[key]; ok && (current == nil || !reflect.DeepEqual(current.Splits, splitter.Splits)) {
+							if current != nil {
+								r.Log.Info("pods weight their upstreams differently, leaving the ServiceSplitter as it is",
+									"name", splitter.Name, "pod", pod.Name)
+								r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonUpstreamWeightsConflict,
+									fmt.Sprintf("pod %q weights its upstreams differently from other pods of the service, so ServiceSplitter %q isn't changed until they agree",
+										pod.Name, splitter.Name))
+							}
+							splitters[key] = nil
+							continue
+						}
+						splitters[key] = splitter
+					}
+
+					// Pods registered by an earlier reconcile that timed out aren't registered again, unless their
+					// proxy registration was lost since, e.g. because their agent restarted. Every other reconcile
+					// registers the service and proxy of every pod so missing proxies are always recreated.
+					if r.registrationProgress.registered(req.NamespacedName, pod) {
+						missing, err := r.proxyRegistrationMissing(pod, serviceEndpoints.Name)
+						if err != nil {
+							r.Log.Error(err, "failed to check for the proxy service of pod", "name", pod.Name)
+							return ctrl.Result{}, err
+						}
+						if !missing {
+							registeredInstances++
+							continue
+						}
+						r.Log.Info("re-registering pod whose proxy service is no longer registered", "name", pod.Name, "ns", pod.Namespace)
+					}
+					if r.RegistrationTimeout > 0 && time.Now().After(registrationDeadline) {
+						timedOut = true
+						continue
+					}
+
 					// Create client for Consul agent local to the pod.
-					client, err := r.remoteConsulClient(pod.Status.HostIP, r.consulNamespace(pod.Namespace))
+					client, err := r.remoteConsulClient(pod.Status.HostIP, r.podConsulNamespace(pod))
 					if err != nil {
 						r.Log.Error(err, "failed to create a new Consul client", "address", pod.Status.HostIP)
 						return ctrl.Result{}, err
 					}
 
 					// Get information from the pod to create service instance registrations.
-					serviceRegistration, proxyServiceRegistration, err := r.createServiceRegistrations(pod, serviceEndpoints)
+					serviceRegistration, proxyServiceRegistration, err := r.createServiceRegistrations(pod, serviceEndpoints, proxyModes)
 					if err != nil {
 						r.Log.Error(err, "failed to create service registrations for endpoints", "name", serviceEndpoints.Name, "ns", serviceEndpoints.Namespace)
 						return ctrl.Result{}, err
 					}
 
+					// Refuse to register the service if a gateway is already registered under the
+					// same name since registering it would corrupt the gateway's registration.
+					serviceKey := types.NamespacedName{Name: serviceRegistration.Name, Namespace: serviceRegistration.Namespace}
+					conflict, checked := gatewayConflicts[serviceKey]
+					if !checked {
+						conflict, err = r.gatewayNameConflict(serviceRegistration.Name, serviceRegistration.Namespace)
+						if err != nil {
+							r.Log.Error(err, "failed to check for conflicting gateways", "name", serviceRegistration.Name)
+							return ctrl.Result{}, err
+						}
+						gatewayConflicts[serviceKey] = conflict
+						if conflict {
+							r.Log.Info("refusing to register service because a gateway with the same name is registered in Consul",
+								"name", serviceRegistration.Name, "ns", serviceRegistration.Namespace)
+							r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonGatewayNameConflict,
+								fmt.Sprintf("service %q was not registered because a gateway with the same name is registered in Consul", serviceRegistration.Name))
+						}
+					}
+					if conflict {
+						continue
+					}
+
+					// Instances registered by an earlier reconcile are registered again, but not reported as new.
+					_, _, err = client.Agent().Service(serviceRegistration.ID, nil)
+					if err != nil && !isNotFoundErr(err) {
+						r.Log.Error(err, "failed to get service", "name", serviceRegistration.Name)
+						return ctrl.Result{}, err
+					}
+					isNew := isNotFoundErr(err)
+
 					// Register the service instance with the local agent.
 					// Note: the order of how we register services is important,
 					// and the connect-proxy service should come after the "main" service
 					// because its alias health check depends on the main service existing.
 					r.Log.Info("registering service with Consul", "name", serviceRegistration.Name)
 					err = client.Agent().ServiceRegister(serviceRegistration)
+					r.audit(auditRegistration(auditOperationRegister, serviceRegistration), err)
 					if err != nil {
 						r.Log.Error(err, "failed to register service", "name", serviceRegistration.Name)
+						r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonRegistrationFailed,
+							fmt.Sprintf("failed to register service instance %q with Consul: %s", serviceRegistration.ID, err))
 						return ctrl.Result{}, err
 					}
+					servicesRegistered.WithLabelValues(r.consulNamespace(req.Namespace)).Inc()
+
+					// Connect-native services don't have a proxy service to register.
+					if proxyServiceRegistration != nil {
+						// Drifted proxies are deregistered before being registered again so that nothing
+						// from the stale registration carries over.
+						if r.ProxyDriftCheckPeriod > 0 {
+							if err = r.deregisterDriftedProxy(client, proxyServiceRegistration); err != nil {
+								r.Log.Error(err, "failed to deregister drifted proxy service", "name", proxyServiceRegistration.Name)
+								return ctrl.Result{}, err
+							}
+						}
 
-					// Register the proxy service instance with the local agent.
-					r.Log.Info("registering proxy service with Consul", "name", proxyServiceRegistration.Name)
-					err = client.Agent().ServiceRegister(proxyServiceRegistration)
-					if err != nil {
-						r.Log.Error(err, "failed to register proxy service", "name", proxyServiceRegistration.Name)
-						return ctrl.Result{}, err
+						// Register the proxy service instance with the local agent.
+						r.Log.Info("registering proxy service with Consul", "name", proxyServiceRegistration.Name)
+						err = client.Agent().ServiceRegister(proxyServiceRegistration)
+						r.audit(auditRegistration(auditOperationRegister, proxyServiceRegistration), err)
+						if err != nil {
+							r.Log.Error(err, "failed to register proxy service", "name", proxyServiceRegistration.Name)
+							r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonRegistrationFailed,
+								fmt.Sprintf("failed to register proxy service instance %q with Consul: %s", proxyServiceRegistration.ID, err))
+							return ctrl.Result{}, err
+						}
+						servicesRegistered.WithLabelValues(r.consulNamespace(req.Namespace)).Inc()
 					}
 
-					// Update the TTL health check for the service.
+					// Update the TTL health check for the service unless it was disabled for the pod.
 					// This is required because ServiceRegister() does not update the TTL if the service already exists.
-					status, reason, err := getReadyStatusAndReason(pod)
-					if err != nil {
-						r.Log.Error(err, "failed to get status and reason from pod", "name", serviceRegistration.Name)
-						return ctrl.Result{}, err
+					if serviceRegistration.Check != nil {
+						status, reason, err := getReadyStatusAndReason(pod)
+						if err != nil {
+							r.Log.Error(err, "failed to get status and reason from pod", "name", serviceRegistration.Name)
+							return ctrl.Result{}, err
+						}
+						r.Log.Info("updating TTL health check for service", "name", serviceRegistration.Name, "reason", reason, "status", status)
+						err = client.Agent().UpdateTTL(getConsulHealthCheckID(pod, serviceRegistration.ID), reason, status)
+						ttlEntry := auditRegistration(auditOperationUpdateTTL, serviceRegistration)
+						ttlEntry.CheckID = getConsulHealthCheckID(pod, serviceRegistration.ID)
+						r.audit(ttlEntry, err)
+						if err != nil {
+							r.Log.Error(err, "failed to update TTL health check", "name", serviceRegistration.Name)
+							r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonRegistrationFailed,
+								fmt.Sprintf("failed to update the health check of service instance %q in Consul: %s", serviceRegistration.ID, err))
+							return ctrl.Result{}, err
+						}
+					} else {
+						deregistered, err := r.deregisterKubernetesHealthCheck(client, pod, serviceRegistration)
+						if err != nil {
+							r.Log.Error(err, "failed to deregister TTL health check", "name", serviceRegistration.Name)
+							r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonDeregistrationFailed,
+								fmt.Sprintf("failed to deregister the health check of service instance %q from Consul: %s", serviceRegistration.ID, err))
+							return ctrl.Result{}, err
+						}
+						if deregistered {
+							r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeNormal, reasonHealthCheckDeregistered,
+								fmt.Sprintf("deregistered the health check of service instance %q from Consul because pod %q disabled it", serviceRegistration.ID, pod.Name))
+						}
 					}
-					r.Log.Info("updating TTL health check for service", "name", serviceRegistration.Name, "reason", reason, "status", status)
-					err = client.Agent().UpdateTTL(getConsulHealthCheckID(pod, serviceRegistration.ID), reason, status)
-					if err != nil {
-						r.Log.Error(err, "failed to update TTL health check", "name", serviceRegistration.Name)
-						return ctrl.Result{}, err
+					registeredInstances++
+					if isNew {
+						newInstances++
+					}
+					if r.RegistrationTimeout > 0 {
+						r.registrationProgress.setRegistered(req.NamespacedName, pod)
 					}
 				}
 			}
 		}
 	}
 
+	// A single event summarizes the instances registered for the first time rather than an event per pod.
+	if newInstances > 0 {
+		r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeNormal, reasonServiceRegistered,
+			fmt.Sprintf("registered %d service instance(s) with Consul", newInstances))
+	}
+
+	// Instances can only be deregistered once every pod has been registered, so the rest of the reconcile
+	// happens once the requeued reconciles have registered the remaining pods.
+	if timedOut {
+		msg := fmt.Sprintf("registered %d of %d service instances before the registration timeout of %s, the remaining instances will be registered when the endpoints are requeued",
+			registeredInstances, totalInstances, r.RegistrationTimeout)
+		r.Log.Info(msg, "name", serviceEndpoints.Name, "ns", serviceEndpoints.Namespace)
+		r.recordEvent(ctx, req.NamespacedName, corev1.EventTypeWarning, reasonRegistrationTimedOut, msg)
+		return ctrl.Result{Requeue: true}, nil
+	}
+	r.registrationProgress.forget(req.NamespacedName)
+
+	// If the service has no injected pods yet, keep a placeholder instance registered when the Service
+	// asks for it. Otherwise, make sure the placeholder is removed.
+	if err = r.reconcilePlaceholder(ctx, serviceEndpoints, len(endpointAddressMap) > 0); err != nil {
+		r.Log.Error(err, "failed to reconcile placeholder service", "name", serviceEndpoints.Name, "ns", serviceEndpoints.Namespace)
+		return ctrl.Result{}, err
+	}
+
+	if err = r.reconcileUpstreamsSplitters(serviceEndpoints.Name, serviceEndpoints.Namespace, splitters); err != nil {
+		r.Log.Error(err, "failed to reconcile the ServiceSplitters of weighted upstreams", "name", serviceEndpoints.Name, "ns", serviceEndpoints.Namespace)
+		return ctrl.Result{}, err
+	}
+
 	// Compare service instances in Consul with addresses in Endpoints. If an address is not in Endpoints, deregister
 	// from Consul. This uses endpointAddressMap which is populated with the addresses in the Endpoints object during
 	// the registration codepath.
@@ -190,7 +538,7 @@ func (r *EndpointsController) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.ProxyDriftCheckPeriod}, nil
 }
 
 func (r *EndpointsController) Logger(name types.NamespacedName) logr.Logger {
@@ -198,18 +546,46 @@ func (r *EndpointsController) Logger(name types.NamespacedName) logr.Logger {
 }
 
 func (r *EndpointsController) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.Endpoints{}).
-		Watches(
+	b := ctrl.NewControllerManagedBy(mgr)
+	if r.UseEndpointSlices {
+		// A service can have many EndpointSlices so they're mapped back to the
+		// service they belong to, which is what gets reconciled.
+		b = b.For(&corev1.Service{}).
+			Watches(
+				&source.Kind{Type: &discoveryv1beta1.EndpointSlice{}},
+				handler.EnqueueRequestsFromMapFunc(requestForEndpointSlice),
+			)
+	} else {
+		b = b.For(&corev1.Endpoints{})
+	}
+	b = b.Watches(
+		&source.Kind{Type: &corev1.Pod{}},
+		handler.EnqueueRequestsFromMapFunc(r.requestsForRunningAgentPods),
+		builder.WithPredicates(predicate.NewPredicateFuncs(r.filterAgentPods)),
+	)
+	// Relabelled pods don't update their Endpoints, so they're also watched
+	// when the pod label selector decides which pods are registered.
+	if r.ReconcileOnPodChanges || r.PodLabelSelector != nil {
+		// Pods being created, deleted or changing readiness already update
+		// their Endpoints, so only other updates of injected pods are watched
+		// to avoid reconciling the same change twice.
+		b = b.Watches(
 			&source.Kind{Type: &corev1.Pod{}},
-			handler.EnqueueRequestsFromMapFunc(r.requestsForRunningAgentPods),
-			builder.WithPredicates(predicate.NewPredicateFuncs(r.filterAgentPods)),
-		).Complete(r)
+			handler.EnqueueRequestsFromMapFunc(r.requestsForInjectedPod),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc:  func(event.CreateEvent) bool { return false },
+				DeleteFunc:  func(event.DeleteEvent) bool { return false },
+				GenericFunc: func(event.GenericEvent) bool { return false },
+				UpdateFunc:  injectedPodMetadataChanged,
+			}),
+		)
+	}
+	return b.Complete(r)
 }
 
 // createServiceRegistrations creates the service and proxy service instance registrations with the information from the
-// Pod.
-func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, serviceEndpoints corev1.Endpoints) (*api.AgentServiceRegistration, *api.AgentServiceRegistration, error) {
+// Pod. proxyModes caches the proxy modes set by config entries across calls, if it isn't nil.
+func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, serviceEndpoints corev1.Endpoints, proxyModes map[types.NamespacedName]api.ProxyMode) (*api.AgentServiceRegistration, *api.AgentServiceRegistration, error) {
 	// If a port is specified, then we determine the value of that port
 	// and register that port for the host service.
 	var servicePort int
@@ -227,10 +603,7 @@ func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, service
 	// Otherwise, the Consul service name should equal the Kubernetes Service name.
 	// The service name in Consul defaults to the Endpoints object name, and is overridden by the pod
 	// annotation consul.hashicorp.com/connect-service..
-	serviceName := serviceEndpoints.Name
-	if serviceNameFromAnnotation, ok := pod.Annotations[annotationService]; ok && serviceNameFromAnnotation != "" {
-		serviceName = serviceNameFromAnnotation
-	}
+	serviceName := r.podServiceName(pod, serviceEndpoints.Name)
 
 	serviceID := fmt.Sprintf("%s-%s", pod.Name, serviceName)
 
@@ -244,6 +617,17 @@ func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, service
 			meta[strings.TrimPrefix(k, annotationMeta)] = v
 		}
 	}
+	if r.ClusterName != "" {
+		meta[MetaKeyKubeCluster] = r.ClusterName
+	}
+	native, err := connectNativeEnabled(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	meta[MetaKeyProxyType] = proxyTypeSidecar
+	if native {
+		meta[MetaKeyProxyType] = proxyTypeNative
+	}
 
 	var tags []string
 	if raw, ok := pod.Annotations[annotationTags]; ok && raw != "" {
@@ -268,20 +652,47 @@ func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, service
 		Port:      servicePort,
 		Address:   pod.Status.PodIP,
 		Meta:      meta,
-		Namespace: r.consulNamespace(pod.Namespace),
-		Check: &api.AgentServiceCheck{
+		Namespace: r.podConsulNamespace(pod),
+	}
+	healthCheckEnabled, err := kubernetesHealthCheckEnabled(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if healthCheckEnabled {
+		service.Check = &api.AgentServiceCheck{
 			CheckID:                getConsulHealthCheckID(pod, serviceID),
 			Name:                   "Kubernetes Health Check",
 			TTL:                    "100000h",
 			Status:                 status,
 			SuccessBeforePassing:   1,
 			FailuresBeforeCritical: 1,
-		},
+		}
 	}
 	if len(tags) > 0 {
 		service.Tags = tags
 	}
 
+	grpcCheck, err := grpcHealthCheck(pod, serviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if grpcCheck != nil {
+		service.Checks = api.AgentServiceChecks{grpcCheck}
+	}
+	httpsCheck, err := httpsHealthCheck(pod, serviceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if httpsCheck != nil {
+		service.Checks = append(service.Checks, httpsCheck)
+	}
+
+	// Connect-native services talk to the mesh themselves, so they're registered without a proxy.
+	if native {
+		service.Connect = &api.AgentServiceConnect{Native: true}
+		return service, nil, nil
+	}
+
 	proxyServiceName := fmt.Sprintf("%s-sidecar-proxy", serviceName)
 	proxyServiceID := fmt.Sprintf("%s-%s", pod.Name, proxyServiceName)
 	proxyConfig := &api.AgentServiceConnectProxyConfig{
@@ -308,38 +719,54 @@ func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, service
 		proxyConfig.Config[envoyPrometheusBindAddr] = prometheusScrapeListener
 	}
 
+	// The public listener port and bind address are read by Envoy from this
+	// registration when it is bootstrapped, so overriding them here is
+	// enough to keep the registration and the listener consistent.
+	proxyPort, proxyBindAddress, err := proxyPublicListener(pod)
+	if err != nil {
+		return nil, nil, err
+	}
+	if proxyBindAddress != "" {
+		proxyConfig.Config[envoyBindAddress] = proxyBindAddress
+	}
+
 	if servicePort > 0 {
 		proxyConfig.LocalServiceAddress = "127.0.0.1"
 		proxyConfig.LocalServicePort = servicePort
 	}
 
-	upstreams, err := r.processUpstreams(pod)
+	upstreams, err := r.processUpstreams(pod, serviceName)
 	if err != nil {
 		return nil, nil, err
 	}
 	proxyConfig.Upstreams = upstreams
 
+	proxyChecks, err := sidecarProxyChecks(pod, api.AgentServiceChecks{
+		{
+			Name:                           "Proxy Public Listener",
+			TCP:                            fmt.Sprintf("%s:%d", pod.Status.PodIP, proxyPort),
+			Interval:                       "10s",
+			DeregisterCriticalServiceAfter: "10m",
+		},
+		{
+			Name:         "Destination Alias",
+			AliasService: serviceID,
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
 	proxyService := &api.AgentServiceRegistration{
 		Kind:      api.ServiceKindConnectProxy,
 		ID:        proxyServiceID,
 		Name:      proxyServiceName,
-		Port:      20000,
+		Port:      proxyPort,
 		Address:   pod.Status.PodIP,
 		Meta:      meta,
-		Namespace: r.consulNamespace(pod.Namespace),
+		Namespace: r.podConsulNamespace(pod),
 		Proxy:     proxyConfig,
-		Checks: api.AgentServiceChecks{
-			{
-				Name:                           "Proxy Public Listener",
-				TCP:                            fmt.Sprintf("%s:20000", pod.Status.PodIP),
-				Interval:                       "10s",
-				DeregisterCriticalServiceAfter: "10m",
-			},
-			{
-				Name:         "Destination Alias",
-				AliasService: serviceID,
-			},
-		},
+		Checks:    proxyChecks,
 	}
 	if len(tags) > 0 {
 		proxyService.Tags = tags
@@ -349,8 +776,22 @@ func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, service
 	if err != nil {
 		return nil, nil, err
 	}
+	// The proxy mode set by the pod's annotation takes precedence over the mode of the service's
+	// ServiceDefaults, then the mode of the global ProxyDefaults and finally the handler's default.
+	mode, err := proxyModeOverride(pod, r.EnableTransparentProxy)
+	if err != nil {
+		return nil, nil, err
+	}
+	if mode == api.ProxyModeDefault {
+		mode, err = r.configEntryProxyMode(serviceName, r.podConsulNamespace(pod), proxyModes)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
 
-	if tproxyEnabled {
+	// The service's cluster IP is registered if the pod's traffic is redirected or if the proxy is
+	// explicitly registered in transparent mode, so that downstreams in transparent mode can reach it.
+	if tproxyEnabled || mode == api.ProxyModeTransparent {
 		var k8sService corev1.Service
 
 		err := r.Client.Get(r.Context, types.NamespacedName{Name: serviceEndpoints.Name, Namespace: serviceEndpoints.Namespace}, &k8sService)
@@ -382,19 +823,517 @@ func (r *EndpointsController) createServiceRegistrations(pod corev1.Pod, service
 			r.Log.Info("skipping syncing service cluster IP to Consul", "name", k8sService.Name, "ns", k8sService.Namespace, "ip", k8sService.Spec.ClusterIP)
 		}
 	}
+	if mode == api.ProxyModeDirect {
+		proxyService.Proxy.Mode = api.ProxyModeDirect
+	}
 
 	return service, proxyService, nil
 }
 
+// podServiceName returns the Consul service name of pod for the Kubernetes service k8sSvcName.
+// It defaults to k8sSvcName and is overridden by the pod's service annotation.
+func (r *EndpointsController) podServiceName(pod corev1.Pod, k8sSvcName string) string {
+	return PodServiceName(pod, k8sSvcName, r.ConsulServiceNamePrefix, r.ConsulServiceNameSuffix)
+}
+
+// PodServiceName returns the Consul service name that an endpoints controller with the
+// given ConsulServiceNamePrefix and ConsulServiceNameSuffix registers the injected pod as
+// for the Kubernetes service k8sSvcName. It's exported so that other controllers can match
+// pods to the Consul services they're registered as.
+func PodServiceName(pod corev1.Pod, k8sSvcName, prefix, suffix string) string {
+	serviceName := k8sSvcName
+	if serviceNameFromAnnotation, ok := pod.Annotations[annotationService]; ok && serviceNameFromAnnotation != "" {
+		serviceName = serviceNameFromAnnotation
+	}
+	return prefix + serviceName + suffix
+}
+
+// IsInjected returns true if pod has been injected, i.e. its service instances are
+// registered by the endpoints controller.
+func IsInjected(pod corev1.Pod) bool {
+	return hasBeenInjected(pod) && !noLongerInjected(pod)
+}
+
+// configEntryProxyMode returns the proxy mode set by the ServiceDefaults of the Consul service serviceName
+// in namespace or, if it doesn't set one, by the global ProxyDefaults. It returns the default mode if neither
+// sets one, in which case the handler's default applies. Config entries are only looked up if the controller
+// has a Consul client, and only once per service if cache isn't nil.
+func (r *EndpointsController) configEntryProxyMode(serviceName, namespace string, cache map[types.NamespacedName]api.ProxyMode) (api.ProxyMode, error) {
+	if r.ConsulClient == nil {
+		return api.ProxyModeDefault, nil
+	}
+	key := types.NamespacedName{Name: serviceName, Namespace: namespace}
+	if mode, ok := cache[key]; ok {
+		return mode, nil
+	}
+
+	entry, _, err := r.ConsulClient.ConfigEntries().Get(api.ServiceDefaults, serviceName, r.serverQueryOptions(namespace))
+	if err != nil && !isNotFoundErr(err) {
+		return "", fmt.Errorf("unable to get the ServiceDefaults of %q: %s", serviceName, err)
+	}
+	mode := api.ProxyModeDefault
+	source := fmt.Sprintf("mode of the ServiceDefaults of %q", serviceName)
+	if serviceDefaults, ok := entry.(*api.ServiceConfigEntry); ok {
+		mode = serviceDefaults.Mode
+	}
+
+	if mode == api.ProxyModeDefault {
+		entry, _, err = r.ConsulClient.ConfigEntries().Get(api.ProxyDefaults, api.ProxyConfigGlobal, r.serverQueryOptions(""))
+		if err != nil && !isNotFoundErr(err) {
+			return "", fmt.Errorf("unable to get the global ProxyDefaults: %s", err)
+		}
+		source = "mode of the global ProxyDefaults"
+		if proxyDefaults, ok := entry.(*api.ProxyConfigEntry); ok {
+			mode = proxyDefaults.Mode
+		}
+	}
+
+	if mode != api.ProxyModeDefault {
+		if err := validateProxyMode(mode, r.EnableTransparentProxy, source); err != nil {
+			return "", err
+		}
+	}
+	if cache != nil {
+		cache[key] = mode
+	}
+	return mode, nil
+}
+
+// proxyRegistrationMissing returns true if the agent local to pod has no proxy service instance registered for pod
+// and the Kubernetes service k8sSvcName. Connect-native pods never miss one since they have no proxy.
+func (r *EndpointsController) proxyRegistrationMissing(pod corev1.Pod, k8sSvcName string) (bool, error) {
+	if native, err := connectNativeEnabled(pod); err != nil || native {
+		return false, err
+	}
+	client, err := r.remoteConsulClient(pod.Status.HostIP, r.podConsulNamespace(pod))
+	if err != nil {
+		return false, err
+	}
+	svcs, err := client.Agent().ServicesWithFilter(fmt.Sprintf(`Kind == %q and Meta[%q] == %q and Meta[%q] == %q and Meta[%q] == %q`,
+		api.ServiceKindConnectProxy, MetaKeyKubeServiceName, k8sSvcName, MetaKeyKubeNS, pod.Namespace, MetaKeyPodName, pod.Name))
+	if err != nil {
+		return false, err
+	}
+	return len(svcs) == 0, nil
+}
+
+// deregisterDriftedProxy deregisters the proxy service instance registered with the agent under the ID of
+// desired if its registration differs from desired. It's a no-op if no such instance is registered.
+func (r *EndpointsController) deregisterDriftedProxy(client *api.Client, desired *api.AgentServiceRegistration) error {
+	svcs, err := client.Agent().ServicesWithFilter(fmt.Sprintf("ID == %q", desired.ID))
+	if err != nil {
+		return err
+	}
+	existing, ok := svcs[desired.ID]
+	if !ok || !proxyRegistrationDrifted(existing, desired) {
+		return nil
+	}
+	r.Log.Info("deregistering drifted proxy service from consul", "svc", desired.ID)
+	err = client.Agent().ServiceDeregister(desired.ID)
+	r.audit(auditService(auditOperationDeregister, existing), err)
+	return err
+}
+
+// proxyRegistrationDrifted returns true if the fields of the existing proxy registration that are set by
+// createServiceRegistrations differ from desired.
+func proxyRegistrationDrifted(existing *api.AgentService, desired *api.AgentServiceRegistration) bool {
+	if existing.Port != desired.Port || existing.Address != desired.Address {
+		return true
+	}
+	if len(existing.Meta) != len(desired.Meta) || (len(desired.Meta) > 0 && !reflect.DeepEqual(existing.Meta, desired.Meta)) {
+		return true
+	}
+	if existing.Proxy == nil || desired.Proxy == nil {
+		return existing.Proxy != desired.Proxy
+	}
+	if existing.Proxy.DestinationServiceName != desired.Proxy.DestinationServiceName ||
+		existing.Proxy.DestinationServiceID != desired.Proxy.DestinationServiceID ||
+		existing.Proxy.LocalServiceAddress != desired.Proxy.LocalServiceAddress ||
+		existing.Proxy.LocalServicePort != desired.Proxy.LocalServicePort ||
+		proxyMode(existing.Proxy.Mode) != proxyMode(desired.Proxy.Mode) {
+		return true
+	}
+	// Config values are decoded from JSON when read back from the agent, so
+	// they're compared by their string representation.
+	if len(existing.Proxy.Config) != len(desired.Proxy.Config) {
+		return true
+	}
+	for k, v := range desired.Proxy.Config {
+		existingValue, ok := existing.Proxy.Config[k]
+		if !ok || fmt.Sprint(existingValue) != fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyMode returns mode, treating the unset mode as the default direct mode.
+func proxyMode(mode api.ProxyMode) api.ProxyMode {
+	if mode == "" {
+		return api.ProxyModeDirect
+	}
+	return mode
+}
+
+// reconcilePlaceholder registers a critical placeholder service instance in the catalog if the Kubernetes
+// Service is annotated for preregistration and none of its pods have been registered. Any other placeholder
+// instance of the Kubernetes Service is deregistered.
+func (r *EndpointsController) reconcilePlaceholder(ctx context.Context, serviceEndpoints corev1.Endpoints, hasInstances bool) error {
+	preregister := false
+	if !hasInstances {
+		var k8sService corev1.Service
+		err := r.Client.Get(ctx, types.NamespacedName{Name: serviceEndpoints.Name, Namespace: serviceEndpoints.Namespace}, &k8sService)
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return err
+		}
+		preregister = err == nil && k8sService.Annotations[annotationPreregister] == "true"
+	}
+
+	var placeholder *api.CatalogRegistration
+	if preregister {
+		placeholder = placeholderServiceRegistration(serviceEndpoints, r.consulServiceName(serviceEndpoints.Name), r.consulNamespace(serviceEndpoints.Namespace))
+		r.Log.Info("registering placeholder service with Consul", "name", placeholder.Service.Service)
+		_, err := r.ConsulClient.Catalog().Register(placeholder, nil)
+		r.audit(auditService(auditOperationRegister, placeholder.Service), err)
+		if err != nil {
+			return err
+		}
+	}
+	return r.deregisterPlaceholders(serviceEndpoints.Name, serviceEndpoints.Namespace, placeholder)
+}
+
+// deregisterPlaceholders deregisters the placeholder service instances of the Kubernetes Service k8sSvcName in
+// k8sSvcNamespace from the catalog, except for keep if it isn't nil. The placeholders are looked up by their meta
+// so that they're found even if their Consul service name or namespace has changed.
+func (r *EndpointsController) deregisterPlaceholders(k8sSvcName, k8sSvcNamespace string, keep *api.CatalogRegistration) error {
+	namespace := ""
+	if r.EnableConsulNamespaces {
+		namespace = namespaces.WildcardNamespace
+	}
+	opts := r.serverQueryOptions(namespace)
+	opts.Filter = fmt.Sprintf(`Meta[%q] == %q and Meta[%q] == %q and Meta[%q] == "true"`,
+		MetaKeyKubeServiceName, k8sSvcName, MetaKeyKubeNS, k8sSvcNamespace, MetaKeyPlaceholder)
+	list, _, err := r.ConsulClient.Catalog().NodeServiceList(placeholderNodeName, opts)
+	if err != nil {
+		return err
+	}
+	if list == nil {
+		return nil
+	}
+	for _, svc := range list.Services {
+		if keep != nil && svc.ID == keep.Service.ID && svc.Service == keep.Service.Service && svc.Namespace == keep.Service.Namespace {
+			continue
+		}
+		r.Log.Info("deregistering placeholder service from consul", "svc", svc.ID)
+		_, err = r.ConsulClient.Catalog().Deregister(&api.CatalogDeregistration{
+			Node:      placeholderNodeName,
+			ServiceID: svc.ID,
+			Namespace: svc.Namespace,
+		}, nil)
+		r.audit(auditService(auditOperationDeregister, svc), err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholderServiceRegistration creates the catalog registration for the placeholder service instance of the
+// Kubernetes Service backing serviceEndpoints, registered in Consul as serviceName. Its health check is always
+// critical so that it never receives traffic.
+func placeholderServiceRegistration(serviceEndpoints corev1.Endpoints, serviceName, namespace string) *api.CatalogRegistration {
+	serviceID := fmt.Sprintf("%s-%s-placeholder", serviceEndpoints.Namespace, serviceEndpoints.Name)
+	return &api.CatalogRegistration{
+		Node:           placeholderNodeName,
+		Address:        "127.0.0.1",
+		SkipNodeUpdate: true,
+		Service: &api.AgentService{
+			ID:      serviceID,
+			Service: serviceName,
+			Meta: map[string]string{
+				MetaKeyKubeServiceName: serviceEndpoints.Name,
+				MetaKeyKubeNS:          serviceEndpoints.Namespace,
+				MetaKeyPlaceholder:     "true",
+			},
+			Namespace: namespace,
+		},
+		Check: &api.AgentCheck{
+			Node:      placeholderNodeName,
+			CheckID:   fmt.Sprintf("%s/kubernetes-health-check", serviceID),
+			Name:      "Kubernetes Health Check",
+			Status:    api.HealthCritical,
+			Notes:     "No Kubernetes pods have been registered for this service yet",
+			ServiceID: serviceID,
+			Namespace: namespace,
+		},
+	}
+}
+
+// gatewayNameConflict returns true if a mesh, terminating or ingress gateway is
+// registered in Consul with the name serviceName in the given Consul namespace.
+func (r *EndpointsController) gatewayNameConflict(serviceName, namespace string) (bool, error) {
+	entries, _, err := r.ConsulClient.Health().Service(serviceName, "", false, r.serverQueryOptions(namespace))
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		switch entry.Service.Kind {
+		case api.ServiceKindMeshGateway, api.ServiceKindTerminatingGateway, api.ServiceKindIngressGateway:
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// podLabelSelectorMatches returns true if pod matches the PodLabelSelector or no selector is set.
+func (r *EndpointsController) podLabelSelectorMatches(pod corev1.Pod) bool {
+	return r.PodLabelSelector == nil || r.PodLabelSelector.Matches(labels.Set(pod.Labels))
+}
+
+// serverQueryOptions returns the options of queries served by the Consul servers in the given Consul namespace.
+// The queries are consistent if ConsistentReads is set.
+func (r *EndpointsController) serverQueryOptions(namespace string) *api.QueryOptions {
+	return &api.QueryOptions{Namespace: namespace, RequireConsistent: r.ConsistentReads}
+}
+
+// recordEvent records an event for the Service named svcName if an event recorder has been configured. If the
+// Service can't be retrieved, e.g. because it has been deleted, the event is attached to a reference to it instead.
+func (r *EndpointsController) recordEvent(ctx context.Context, svcName types.NamespacedName, eventType, reason, message string) {
+	if r.Recorder == nil {
+		return
+	}
+	var object runtime.Object
+	var svc corev1.Service
+	if err := r.Client.Get(ctx, svcName, &svc); err == nil {
+		object = &svc
+	} else {
+		object = &corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Service",
+			Name:       svcName.Name,
+			Namespace:  svcName.Namespace,
+		}
+	}
+	r.Recorder.Event(object, eventType, reason, message)
+}
+
 // getConsulHealthCheckID deterministically generates a health check ID that will be unique to the Agent
 // where the health check is registered and deregistered.
 func getConsulHealthCheckID(pod corev1.Pod, serviceID string) string {
 	return fmt.Sprintf("%s/%s/kubernetes-health-check", pod.Namespace, serviceID)
 }
 
+// deregisterKubernetesHealthCheck deregisters the Kubernetes health check of the service instance registered with
+// reg for pod from the agent if it's registered, e.g. because the pod disabled it after its service was registered.
+// It returns true if the check was deregistered.
+func (r *EndpointsController) deregisterKubernetesHealthCheck(client *api.Client, pod corev1.Pod, reg *api.AgentServiceRegistration) (bool, error) {
+	checkID := getConsulHealthCheckID(pod, reg.ID)
+	checks, err := client.Agent().ChecksWithFilter(fmt.Sprintf("CheckID == %q", checkID))
+	if err != nil {
+		return false, err
+	}
+	if _, ok := checks[checkID]; !ok {
+		return false, nil
+	}
+	r.Log.Info("deregistering TTL health check", "id", checkID)
+	err = client.Agent().CheckDeregister(checkID)
+	entry := auditRegistration(auditOperationDeregisterCheck, reg)
+	entry.CheckID = checkID
+	r.audit(entry, err)
+	return err == nil, err
+}
+
+// kubernetesHealthCheckEnabled returns whether the Kubernetes health check should be registered for the
+// service of the pod. It's enabled unless the enable-health-check annotation is false, and an empty value
+// is treated as if the annotation wasn't set.
+func kubernetesHealthCheckEnabled(pod corev1.Pod) (bool, error) {
+	raw := pod.Annotations[annotationEnableHealthCheck]
+	if raw == "" {
+		return true, nil
+	}
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("%s annotation value of %s is not a valid boolean", annotationEnableHealthCheck, raw)
+	}
+	return enabled, nil
+}
+
+// grpcHealthCheck returns the gRPC health check for the service instance serviceID of the pod
+// if the gRPC check port annotation is set. It returns nil if it isn't set.
+func grpcHealthCheck(pod corev1.Pod, serviceID string) (*api.AgentServiceCheck, error) {
+	rawPort, ok := pod.Annotations[annotationGRPCCheckPort]
+	if !ok || rawPort == "" {
+		for _, annotation := range []string{annotationGRPCCheckUseTLS, annotationGRPCCheckTLSServerName} {
+			if _, ok := pod.Annotations[annotation]; ok {
+				return nil, fmt.Errorf("%s annotation can only be set if the %s annotation is set", annotation, annotationGRPCCheckPort)
+			}
+		}
+		return nil, nil
+	}
+	port, err := portValue(pod, rawPort)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("%s annotation value of %s is not a valid port", annotationGRPCCheckPort, rawPort)
+	}
+
+	useTLS := false
+	if raw, ok := pod.Annotations[annotationGRPCCheckUseTLS]; ok {
+		useTLS, err = strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation value of %s is not a valid boolean", annotationGRPCCheckUseTLS, raw)
+		}
+	}
+	serverName := pod.Annotations[annotationGRPCCheckTLSServerName]
+	if serverName != "" {
+		if !useTLS {
+			return nil, fmt.Errorf("%s annotation can only be set if the %s annotation is true", annotationGRPCCheckTLSServerName, annotationGRPCCheckUseTLS)
+		}
+		if errs := validation.IsDNS1123Subdomain(serverName); len(errs) > 0 {
+			return nil, fmt.Errorf("%s annotation value of %s is not a valid server name: %s", annotationGRPCCheckTLSServerName, serverName, strings.Join(errs, ", "))
+		}
+	}
+
+	return &api.AgentServiceCheck{
+		CheckID:       fmt.Sprintf("%s/%s/grpc-health-check", pod.Namespace, serviceID),
+		Name:          "gRPC Health Check",
+		GRPC:          fmt.Sprintf("%s:%d", pod.Status.PodIP, port),
+		GRPCUseTLS:    useTLS,
+		TLSServerName: serverName,
+		Interval:      "10s",
+	}, nil
+}
+
+// httpsHealthCheck returns the HTTPS health check for the service instance serviceID of the pod
+// if the HTTPS check port annotation is set. It returns nil if it isn't set.
+func httpsHealthCheck(pod corev1.Pod, serviceID string) (*api.AgentServiceCheck, error) {
+	rawPort, ok := pod.Annotations[annotationHTTPSCheckPort]
+	if !ok || rawPort == "" {
+		for _, annotation := range []string{annotationHTTPSCheckPath, annotationHTTPSCheckTLSServerName, annotationHTTPSCheckTLSSkipVerify} {
+			if _, ok := pod.Annotations[annotation]; ok {
+				return nil, fmt.Errorf("%s annotation can only be set if the %s annotation is set", annotation, annotationHTTPSCheckPort)
+			}
+		}
+		return nil, nil
+	}
+	port, err := portValue(pod, rawPort)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("%s annotation value of %s is not a valid port", annotationHTTPSCheckPort, rawPort)
+	}
+
+	path := "/"
+	if raw, ok := pod.Annotations[annotationHTTPSCheckPath]; ok {
+		if !strings.HasPrefix(raw, "/") {
+			return nil, fmt.Errorf("%s annotation value of %s must start with /", annotationHTTPSCheckPath, raw)
+		}
+		path = raw
+	}
+
+	skipVerify := false
+	if raw, ok := pod.Annotations[annotationHTTPSCheckTLSSkipVerify]; ok {
+		skipVerify, err = strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation value of %s is not a valid boolean", annotationHTTPSCheckTLSSkipVerify, raw)
+		}
+	}
+	serverName := pod.Annotations[annotationHTTPSCheckTLSServerName]
+	if serverName != "" {
+		// The server name is only used to verify the certificate.
+		if skipVerify {
+			return nil, fmt.Errorf("%s annotation can't be set if the %s annotation is true", annotationHTTPSCheckTLSServerName, annotationHTTPSCheckTLSSkipVerify)
+		}
+		if errs := validation.IsDNS1123Subdomain(serverName); len(errs) > 0 {
+			return nil, fmt.Errorf("%s annotation value of %s is not a valid server name: %s", annotationHTTPSCheckTLSServerName, serverName, strings.Join(errs, ", "))
+		}
+	}
+
+	return &api.AgentServiceCheck{
+		CheckID:       fmt.Sprintf("%s/%s/https-health-check", pod.Namespace, serviceID),
+		Name:          "HTTPS Health Check",
+		HTTP:          fmt.Sprintf("https://%s:%d%s", pod.Status.PodIP, port, path),
+		TLSServerName: serverName,
+		TLSSkipVerify: skipVerify,
+		Interval:      "10s",
+	}, nil
+}
+
+// sidecarProxyChecks returns the checks to register on the sidecar proxy of the pod. These are the defaultChecks
+// followed by the checks from the sidecar proxy checks annotation, or only the latter if the annotation to replace
+// the default checks is true. It returns an error if any of the annotated checks is invalid.
+func sidecarProxyChecks(pod corev1.Pod, defaultChecks api.AgentServiceChecks) (api.AgentServiceChecks, error) {
+	raw, ok := pod.Annotations[annotationSidecarProxyChecks]
+	if !ok || raw == "" {
+		if _, ok := pod.Annotations[annotationSidecarProxyChecksReplaceDefaults]; ok {
+			return nil, fmt.Errorf("%s annotation can only be set if the %s annotation is set", annotationSidecarProxyChecksReplaceDefaults, annotationSidecarProxyChecks)
+		}
+		return defaultChecks, nil
+	}
+
+	var checks api.AgentServiceChecks
+	if err := json.Unmarshal([]byte(raw), &checks); err != nil {
+		return nil, fmt.Errorf("%s annotation value is not a valid JSON list of checks: %s", annotationSidecarProxyChecks, err)
+	}
+	for i, check := range checks {
+		if err := validateSidecarProxyCheck(check); err != nil {
+			return nil, fmt.Errorf("%s annotation check %d is invalid: %s", annotationSidecarProxyChecks, i, err)
+		}
+	}
+
+	replaceDefaults := false
+	if rawReplace, ok := pod.Annotations[annotationSidecarProxyChecksReplaceDefaults]; ok {
+		var err error
+		replaceDefaults, err = strconv.ParseBool(rawReplace)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation value of %s is not a valid boolean", annotationSidecarProxyChecksReplaceDefaults, rawReplace)
+		}
+	}
+	if replaceDefaults {
+		return checks, nil
+	}
+	return append(defaultChecks, checks...), nil
+}
+
+// validateSidecarProxyCheck returns an error if check doesn't have a name, isn't exactly one of the supported kinds of
+// checks or has invalid durations.
+func validateSidecarProxyCheck(check *api.AgentServiceCheck) error {
+	if check == nil {
+		return errors.New("check must not be null")
+	}
+	if check.Name == "" {
+		return errors.New("a Name must be set")
+	}
+
+	kinds := 0
+	for _, set := range []bool{check.HTTP != "", check.TCP != "", check.GRPC != "", check.TTL != "", check.AliasService != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.New("exactly one of HTTP, TCP, GRPC, TTL or AliasService must be set")
+	}
+	if (check.HTTP != "" || check.TCP != "" || check.GRPC != "") && check.Interval == "" {
+		return errors.New("an Interval must be set for HTTP, TCP and GRPC checks")
+	}
+
+	for _, d := range []struct{ field, value string }{
+		{"Interval", check.Interval},
+		{"Timeout", check.Timeout},
+		{"TTL", check.TTL},
+		{"DeregisterCriticalServiceAfter", check.DeregisterCriticalServiceAfter},
+	} {
+		if d.value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(d.value); err != nil {
+			return fmt.Errorf("value of %s for %s is not a valid duration", d.value, d.field)
+		}
+	}
+	return nil
+}
+
 // getReadyStatusAndReason returns the formatted status string to pass to Consul based on the
 // ready state of the pod along with the reason message which will be passed into the Notes
-// field of the Consul health check.
+// field of the Consul health check. If the pod is ready but any of its readiness gates
+// are not passing, the status is critical and the reason names the failing gate.
 func getReadyStatusAndReason(pod corev1.Pod) (string, string, error) {
 	for _, cond := range pod.Status.Conditions {
 		var consulStatus, reason string
@@ -402,6 +1341,9 @@ func getReadyStatusAndReason(pod corev1.Pod) (string, string, error) {
 			if cond.Status != corev1.ConditionTrue {
 				consulStatus = api.HealthCritical
 				reason = cond.Message
+			} else if gate, ok := failingReadinessGate(pod); ok {
+				consulStatus = api.HealthCritical
+				reason = fmt.Sprintf("Kubernetes readiness gate %q is not passing", gate)
 			} else {
 				consulStatus = api.HealthPassing
 				reason = kubernetesSuccessReasonMsg
@@ -412,6 +1354,24 @@ func getReadyStatusAndReason(pod corev1.Pod) (string, string, error) {
 	return "", "", fmt.Errorf("no ready status for pod: %s", pod.Name)
 }
 
+// failingReadinessGate returns the condition type of the first readiness gate of the pod
+// whose condition is not True. A readiness gate without a condition is considered failing.
+func failingReadinessGate(pod corev1.Pod) (corev1.PodConditionType, bool) {
+	for _, gate := range pod.Spec.ReadinessGates {
+		passing := false
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == gate.ConditionType {
+				passing = cond.Status == corev1.ConditionTrue
+				break
+			}
+		}
+		if !passing {
+			return gate.ConditionType, true
+		}
+	}
+	return "", false
+}
+
 // deregisterServiceOnAllAgents queries all agents for service instances that have the metadata
 // "k8s-service-name"=k8sSvcName and "k8s-namespace"=k8sSvcNamespace. The k8s service name may or may not match the
 // consul service name, but the k8s service name will always match the metadata on the Consul service
@@ -421,8 +1381,9 @@ func getReadyStatusAndReason(pod corev1.Pod) (string, string, error) {
 // associated proxy service instances.
 // The argument endpointsAddressesMap decides whether to deregister *all* service instances or selectively deregister
 // them only if they are not in endpointsAddressesMap. If the map is nil, it will deregister all instances. If the map
-// has addresses, it will only deregister instances not in the map.
-func (r *EndpointsController) deregisterServiceOnAllAgents(ctx context.Context, k8sSvcName, k8sSvcNamespace string, endpointsAddressesMap map[string]bool) error {
+// has addresses, it will only deregister instances not in the map or whose address maps to the IP of a different node
+// than the agent's.
+func (r *EndpointsController) deregisterServiceOnAllAgents(ctx context.Context, k8sSvcName, k8sSvcNamespace string, endpointsAddressesMap map[string]string) error {
 	// Get all agents by getting pods with label component=client, app=consul and release=<ReleaseName>
 	agents := corev1.PodList{}
 	listOptions := client.ListOptions{
@@ -438,9 +1399,18 @@ func (r *EndpointsController) deregisterServiceOnAllAgents(ctx context.Context,
 		return err
 	}
 
+	// Pods can override the Consul namespace their services are registered in, so with Consul Namespaces
+	// enabled the services are looked up in every namespace and deregistered from their own namespace.
+	namespace := r.consulNamespace(k8sSvcNamespace)
+	if r.EnableConsulNamespaces {
+		namespace = namespaces.WildcardNamespace
+	}
+
+	svcName := types.NamespacedName{Name: k8sSvcName, Namespace: k8sSvcNamespace}
+
 	// On each agent, we need to get services matching "k8s-service-name" and "k8s-namespace" metadata.
 	for _, agent := range agents.Items {
-		client, err := r.remoteConsulClient(agent.Status.PodIP, r.consulNamespace(k8sSvcNamespace))
+		client, err := r.remoteConsulClient(agent.Status.PodIP, namespace)
 		if err != nil {
 			r.Log.Error(err, "failed to create a new Consul client", "address", agent.Status.PodIP)
 			return err
@@ -454,30 +1424,74 @@ func (r *EndpointsController) deregisterServiceOnAllAgents(ctx context.Context,
 		}
 
 		// Deregister each service instance that matches the metadata.
-		for svcID, serviceRegistration := range svcs {
+		for _, svcID := range deregistrationOrder(svcs) {
+			serviceRegistration := svcs[svcID]
 			// If we selectively deregister, only deregister if the address is not in the map. Otherwise, deregister
 			// every service instance.
 			if endpointsAddressesMap != nil {
-				if _, ok := endpointsAddressesMap[serviceRegistration.Address]; !ok {
-					// If the service address is not in the Endpoints addresses, deregister it.
+				hostIP, ok := endpointsAddressesMap[serviceRegistration.Address]
+				if !ok {
+					hostIP, ok = endpointsAddressesMap[hostNetworkAddressKey(serviceRegistration.Address, serviceRegistration.Meta[MetaKeyPodName])]
+				}
+				// If the service address is not in the Endpoints addresses, deregister it. If the pod has been
+				// rescheduled to another node, it's been registered with that node's agent, so deregister it here.
+				if !ok || hostIP != agent.Status.HostIP {
 					r.Log.Info("deregistering service from consul", "svc", svcID)
-					if err = client.Agent().ServiceDeregister(svcID); err != nil {
+					err = client.Agent().ServiceDeregisterOpts(svcID, &api.QueryOptions{Namespace: serviceRegistration.Namespace})
+					r.audit(auditService(auditOperationDeregister, serviceRegistration), err)
+					if err != nil {
 						r.Log.Error(err, "failed to deregister service instance", "id", svcID)
+						r.recordEvent(ctx, svcName, corev1.EventTypeWarning, reasonDeregistrationFailed,
+							fmt.Sprintf("failed to deregister service instance %q from Consul: %s", svcID, err))
 						return err
 					}
+					servicesDeregistered.WithLabelValues(r.consulNamespace(k8sSvcNamespace)).Inc()
+					r.recordEvent(ctx, svcName, corev1.EventTypeNormal, reasonServiceDeregistered,
+						fmt.Sprintf("deregistered service instance %q from Consul", svcID))
 				}
 			} else {
 				r.Log.Info("deregistering service from consul", "svc", svcID)
-				if err = client.Agent().ServiceDeregister(svcID); err != nil {
+				err = client.Agent().ServiceDeregisterOpts(svcID, &api.QueryOptions{Namespace: serviceRegistration.Namespace})
+				r.audit(auditService(auditOperationDeregister, serviceRegistration), err)
+				if err != nil {
 					r.Log.Error(err, "failed to deregister service instance", "id", svcID)
+					r.recordEvent(ctx, svcName, corev1.EventTypeWarning, reasonDeregistrationFailed,
+						fmt.Sprintf("failed to deregister service instance %q from Consul: %s", svcID, err))
 					return err
 				}
+				servicesDeregistered.WithLabelValues(r.consulNamespace(k8sSvcNamespace)).Inc()
+				r.recordEvent(ctx, svcName, corev1.EventTypeNormal, reasonServiceDeregistered,
+					fmt.Sprintf("deregistered service instance %q from Consul", svcID))
 			}
 		}
 	}
 	return nil
 }
 
+// deregistrationOrder returns the IDs of svcs in the order they should be deregistered in. Sidecar proxies are
+// deregistered before any other service so that a proxy is never left registered without the service it proxies.
+func deregistrationOrder(svcs map[string]*api.AgentService) []string {
+	ids := make([]string, 0, len(svcs))
+	for id := range svcs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		iProxy := svcs[ids[i]].Kind == api.ServiceKindConnectProxy
+		jProxy := svcs[ids[j]].Kind == api.ServiceKindConnectProxy
+		if iProxy != jProxy {
+			return iProxy
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// hostNetworkAddressKey returns the key of a pod using the host network in the map of Endpoints addresses.
+// Since these pods share the IP of their node, the IP alone doesn't identify a single service instance.
+func hostNetworkAddressKey(address, podName string) string {
+	return fmt.Sprintf("%s/%s", address, podName)
+}
+
 // serviceInstancesForK8SServiceNameAndNamespace calls Consul's ServicesWithFilter to get the list
 // of services instances that have the provided k8sServiceName and k8sServiceNamespace in their metadata.
 func serviceInstancesForK8SServiceNameAndNamespace(k8sServiceName, k8sServiceNamespace string, client *api.Client) (map[string]*api.AgentService, error) {
@@ -487,9 +1501,29 @@ func serviceInstancesForK8SServiceNameAndNamespace(k8sServiceName, k8sServiceNam
 }
 
 // processUpstreams reads the list of upstreams from the Pod annotation and converts them into a list of api.Upstream
-// objects.
-func (r *EndpointsController) processUpstreams(pod corev1.Pod) ([]api.Upstream, error) {
-	var upstreams []api.Upstream
+// objects. If the pod weights its upstreams, each weighted upstream points at a virtual service whose
+// ServiceSplitter, managed by reconcileUpstreamsSplitters, splits its traffic between the weighted upstreams of
+// the Consul service serviceName.
+func (r *EndpointsController) processUpstreams(pod corev1.Pod, serviceName string) ([]api.Upstream, error) {
+	upstreams, indexes, err := r.parseUpstreams(pod)
+	if err != nil {
+		return []api.Upstream{}, err
+	}
+	weights, err := weightedUpstreams(pod, upstreams, indexes)
+	if err != nil {
+		return []api.Upstream{}, err
+	}
+	for _, w := range weights {
+		split := &upstreams[indexes[w.upstream]]
+		split.DestinationName = weightedUpstreamsServiceName(serviceName, split.DestinationName)
+	}
+	return upstreams, nil
+}
+
+// parseUpstreams parses the upstreams annotation of pod. indexes maps the service of each upstream in the annotation
+// to its index in upstreams.
+func (r *EndpointsController) parseUpstreams(pod corev1.Pod) (upstreams []api.Upstream, indexes map[string]int, err error) {
+	indexes = make(map[string]int)
 	if raw, ok := pod.Annotations[annotationUpstreams]; ok && raw != "" {
 		for _, raw := range strings.Split(raw, ",") {
 			parts := strings.SplitN(raw, ":", 3)
@@ -502,9 +1536,18 @@ func (r *EndpointsController) processUpstreams(pod corev1.Pod) ([]api.Upstream,
 			} else {
 				port, _ = portValue(pod, strings.TrimSpace(parts[1]))
 
-				// If Consul Namespaces are enabled, attempt to parse the
-				// upstream for a namespace.
-				if r.EnableConsulNamespaces {
+				// If the upstream references a Kubernetes Service, the Consul
+				// service name is the Kubernetes service name and the Consul
+				// namespace is derived from its Kubernetes namespace.
+				// Otherwise, if Consul Namespaces are enabled, attempt to parse
+				// the upstream for a namespace.
+				if k8sSvcName, k8sSvcNS, ok, err := parseK8sServiceUpstream(strings.TrimSpace(parts[0])); ok {
+					if err != nil {
+						return []api.Upstream{}, nil, err
+					}
+					serviceName = r.consulServiceName(k8sSvcName)
+					namespace = r.consulNamespace(k8sSvcNS)
+				} else if r.EnableConsulNamespaces {
 					pieces := strings.SplitN(parts[0], ".", 2)
 					serviceName = strings.TrimSpace(pieces[0])
 					if len(pieces) > 1 {
@@ -525,11 +1568,11 @@ func (r *EndpointsController) processUpstreams(pod corev1.Pod) ([]api.Upstream,
 					// routing.
 					entry, _, err := r.ConsulClient.ConfigEntries().Get(api.ProxyDefaults, api.ProxyConfigGlobal, nil)
 					if err != nil && strings.Contains(err.Error(), "Unexpected response code: 404") {
-						return []api.Upstream{}, fmt.Errorf("upstream %q is invalid: there is no ProxyDefaults config to set mesh gateway mode", raw)
+						return []api.Upstream{}, nil, fmt.Errorf("upstream %q is invalid: there is no ProxyDefaults config to set mesh gateway mode", raw)
 					} else if err == nil {
 						mode := entry.(*api.ProxyConfigEntry).MeshGateway.Mode
 						if mode != api.MeshGatewayModeLocal && mode != api.MeshGatewayModeRemote {
-							return []api.Upstream{}, fmt.Errorf("upstream %q is invalid: ProxyDefaults mesh gateway mode is neither %q nor %q", raw, api.MeshGatewayModeLocal, api.MeshGatewayModeRemote)
+							return []api.Upstream{}, nil, fmt.Errorf("upstream %q is invalid: ProxyDefaults mesh gateway mode is neither %q nor %q", raw, api.MeshGatewayModeLocal, api.MeshGatewayModeRemote)
 						}
 					}
 					// NOTE: If we can't reach Consul we don't error out because
@@ -550,6 +1593,8 @@ func (r *EndpointsController) processUpstreams(pod corev1.Pod) ([]api.Upstream,
 				if preparedQuery != "" {
 					upstream.DestinationType = api.UpstreamDestTypePreparedQuery
 					upstream.DestinationName = preparedQuery
+				} else {
+					indexes[strings.TrimSpace(parts[0])] = len(upstreams)
 				}
 
 				upstreams = append(upstreams, upstream)
@@ -557,7 +1602,233 @@ func (r *EndpointsController) processUpstreams(pod corev1.Pod) ([]api.Upstream,
 		}
 	}
 
-	return upstreams, nil
+	return upstreams, indexes, nil
+}
+
+// weightedUpstreams returns the weights annotation of pod, or nil if it doesn't weight its upstreams. It errors
+// if a weighted upstream isn't one of upstreams, whose indexes are mapped by the services of the upstreams
+// annotation, or is in another datacenter since ServiceSplitters can't split traffic between datacenters.
+func weightedUpstreams(pod corev1.Pod, upstreams []api.Upstream, indexes map[string]int) ([]upstreamWeight, error) {
+	raw, ok := pod.Annotations[annotationUpstreamsWeights]
+	if !ok {
+		return nil, nil
+	}
+	weights, err := parseUpstreamWeights(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range weights {
+		i, ok := indexes[w.upstream]
+		if !ok {
+			return nil, fmt.Errorf("%s annotation upstream %q is not declared in the %s annotation",
+				annotationUpstreamsWeights, w.upstream, annotationUpstreams)
+		}
+		if upstreams[i].Datacenter != "" {
+			return nil, fmt.Errorf("%s annotation upstream %q is in another datacenter", annotationUpstreamsWeights, w.upstream)
+		}
+	}
+	return weights, nil
+}
+
+// weightedUpstreamsServiceName returns the name of the virtual Consul service that the weighted upstream of the
+// Consul service upstream of the Consul service serviceName points at.
+func weightedUpstreamsServiceName(serviceName, upstream string) string {
+	return fmt.Sprintf("%s-%s-weighted", serviceName, upstream)
+}
+
+// upstreamsSplitters returns the ServiceSplitters that split the traffic of the weighted upstreams of pod,
+// registered as the Consul service serviceName of the Kubernetes service k8sSvcName, or nil if pod doesn't weight
+// its upstreams. Each weighted upstream points at a virtual service of its own, since a proxy can't have two
+// upstreams of the same service, and each virtual service's splitter has the same splits.
+func (r *EndpointsController) upstreamsSplitters(pod corev1.Pod, serviceName, k8sSvcName string) ([]*api.ServiceSplitterConfigEntry, error) {
+	if _, ok := pod.Annotations[annotationUpstreamsWeights]; !ok {
+		return nil, nil
+	}
+	upstreams, indexes, err := r.parseUpstreams(pod)
+	if err != nil {
+		return nil, err
+	}
+	weights, err := weightedUpstreams(pod, upstreams, indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Upstreams without a namespace are in the namespace of the pod's services.
+	upstreamNamespace := func(upstream api.Upstream) string {
+		if upstream.DestinationNamespace == "" {
+			return r.podConsulNamespace(pod)
+		}
+		return upstream.DestinationNamespace
+	}
+	var splits []api.ServiceSplit
+	for _, w := range weights {
+		upstream := upstreams[indexes[w.upstream]]
+		splits = append(splits, api.ServiceSplit{
+			Weight:    float32(w.weight),
+			Service:   upstream.DestinationName,
+			Namespace: upstreamNamespace(upstream),
+		})
+	}
+	var splitters []*api.ServiceSplitterConfigEntry
+	for _, w := range weights {
+		upstream := upstreams[indexes[w.upstream]]
+		splitters = append(splitters, &api.ServiceSplitterConfigEntry{
+			Kind:      api.ServiceSplitter,
+			Name:      weightedUpstreamsServiceName(serviceName, upstream.DestinationName),
+			Namespace: upstreamNamespace(upstream),
+			Meta: map[string]string{
+				MetaKeyKubeServiceName: k8sSvcName,
+				MetaKeyKubeNS:          pod.Namespace,
+			},
+			Splits: splits,
+		})
+	}
+	return splitters, nil
+}
+
+// reconcileUpstreamsSplitters writes the desired ServiceSplitters of the weighted upstreams of the pods of the
+// Kubernetes service k8sSvcName in k8sSvcNamespace, keyed by their namespace and name, along with the
+// ServiceDefaults that set the protocol of their virtual services. A nil splitter marks one whose pods disagree
+// on the weights, which is left as it is. Splitters written for the service that are no longer desired are
+// deleted along with their ServiceDefaults.
+func (r *EndpointsController) reconcileUpstreamsSplitters(k8sSvcName, k8sSvcNamespace string, desired map[types.NamespacedName]*api.ServiceSplitterConfigEntry) error {
+	existing, err := r.upstreamsConfigEntries(api.ServiceSplitter, k8sSvcName, k8sSvcNamespace)
+	if err != nil {
+		return err
+	}
+	for key := range existing {
+		if _, ok := desired[key]; !ok {
+			r.Log.Info("deleting ServiceSplitter of weighted upstreams from consul", "name", key.Name)
+			if err = r.deleteConfigEntry(api.ServiceSplitter, key); err != nil {
+				return err
+			}
+		}
+	}
+	// The ServiceDefaults are deleted after the splitters so that a failed delete never leaves a splitter without
+	// the protocol it relies on. They're listed on their own so that any left behind by a failed delete are found
+	// again.
+	serviceDefaults, err := r.upstreamsConfigEntries(api.ServiceDefaults, k8sSvcName, k8sSvcNamespace)
+	if err != nil {
+		return err
+	}
+	for key := range serviceDefaults {
+		if _, ok := desired[key]; !ok {
+			r.Log.Info("deleting ServiceDefaults of weighted upstreams from consul", "name", key.Name)
+			if err = r.deleteConfigEntry(api.ServiceDefaults, key); err != nil {
+				return err
+			}
+		}
+	}
+
+	for key, splitter := range desired {
+		if splitter == nil {
+			continue
+		}
+		if current, ok := existing[key].(*api.ServiceSplitterConfigEntry); ok && reflect.DeepEqual(current.Splits, splitter.Splits) {
+			if _, ok := serviceDefaults[key]; ok {
+				continue
+			}
+		}
+
+		// Splitters need the virtual service to have the protocol of the upstreams they split between.
+		protocol, err := r.serviceProtocol(splitter.Splits[0].Service, splitter.Splits[0].Namespace)
+		if err != nil {
+			return err
+		}
+		switch protocol {
+		case "http", "http2", "grpc":
+		default:
+			return fmt.Errorf("upstreams of service %q can only be weighted if they use the http, http2 or grpc protocol, but %q uses %q",
+				k8sSvcName, splitter.Splits[0].Service, protocol)
+		}
+
+		r.Log.Info("writing ServiceSplitter of weighted upstreams to consul", "name", splitter.Name)
+		err = r.writeConfigEntry(&api.ServiceConfigEntry{
+			Kind:      api.ServiceDefaults,
+			Name:      splitter.Name,
+			Namespace: splitter.Namespace,
+			Protocol:  protocol,
+			Meta:      splitter.Meta,
+		})
+		if err != nil {
+			return err
+		}
+		if err = r.writeConfigEntry(splitter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upstreamsConfigEntries returns the config entries of kind written for the weighted upstreams of the pods of the
+// Kubernetes service k8sSvcName in k8sSvcNamespace, keyed by their namespace and name.
+func (r *EndpointsController) upstreamsConfigEntries(kind, k8sSvcName, k8sSvcNamespace string) (map[types.NamespacedName]api.ConfigEntry, error) {
+	// Weighted upstreams can be in any namespace, so with Consul Namespaces enabled the entries are looked
+	// up in every namespace.
+	namespace := r.consulNamespace(k8sSvcNamespace)
+	if r.EnableConsulNamespaces {
+		namespace = namespaces.WildcardNamespace
+	}
+	entries, _, err := r.ConsulClient.ConfigEntries().List(kind, r.serverQueryOptions(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list %s config entries: %s", kind, err)
+	}
+	owned := make(map[types.NamespacedName]api.ConfigEntry)
+	for _, entry := range entries {
+		if meta := entry.GetMeta(); meta[MetaKeyKubeServiceName] == k8sSvcName && meta[MetaKeyKubeNS] == k8sSvcNamespace {
+			owned[types.NamespacedName{Name: entry.GetName(), Namespace: entry.GetNamespace()}] = entry
+		}
+	}
+	return owned, nil
+}
+
+// writeConfigEntry writes entry to Consul and records the write in the audit log.
+func (r *EndpointsController) writeConfigEntry(entry api.ConfigEntry) error {
+	_, _, err := r.ConsulClient.ConfigEntries().Set(entry, &api.WriteOptions{Namespace: entry.GetNamespace()})
+	r.audit(auditConfigEntry(auditOperationWriteConfig, entry.GetKind(), entry.GetName(), entry.GetNamespace()), err)
+	if err != nil {
+		return fmt.Errorf("unable to write %s config entry %q: %s", entry.GetKind(), entry.GetName(), err)
+	}
+	return nil
+}
+
+// deleteConfigEntry deletes the config entry of kind with the namespace and name of key from Consul and records
+// the delete in the audit log.
+func (r *EndpointsController) deleteConfigEntry(kind string, key types.NamespacedName) error {
+	_, err := r.ConsulClient.ConfigEntries().Delete(kind, key.Name, &api.WriteOptions{Namespace: key.Namespace})
+	r.audit(auditConfigEntry(auditOperationDeleteConfig, kind, key.Name, key.Namespace), err)
+	if err != nil {
+		return fmt.Errorf("unable to delete %s config entry %q: %s", kind, key.Name, err)
+	}
+	return nil
+}
+
+// serviceProtocol returns the protocol of the Consul service serviceName in namespace, set by its ServiceDefaults
+// or else by the global ProxyDefaults. It defaults to tcp.
+func (r *EndpointsController) serviceProtocol(serviceName, namespace string) (string, error) {
+	entry, _, err := r.ConsulClient.ConfigEntries().Get(api.ServiceDefaults, serviceName, r.serverQueryOptions(namespace))
+	if err != nil && !isNotFoundErr(err) {
+		return "", fmt.Errorf("unable to get the ServiceDefaults of %q: %s", serviceName, err)
+	}
+	if serviceDefaults, ok := entry.(*api.ServiceConfigEntry); ok && serviceDefaults.Protocol != "" {
+		return serviceDefaults.Protocol, nil
+	}
+
+	entry, _, err = r.ConsulClient.ConfigEntries().Get(api.ProxyDefaults, api.ProxyConfigGlobal, r.serverQueryOptions(""))
+	if err != nil && !isNotFoundErr(err) {
+		return "", fmt.Errorf("unable to get the global ProxyDefaults: %s", err)
+	}
+	if proxyDefaults, ok := entry.(*api.ProxyConfigEntry); ok {
+		if protocol, ok := proxyDefaults.Config["protocol"].(string); ok && protocol != "" {
+			return protocol, nil
+		}
+	}
+	return "tcp", nil
+}
+
+// isNotFoundErr returns true if err is because Consul has no such resource.
+func isNotFoundErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Unexpected response code: 404")
 }
 
 // remoteConsulClient returns an *api.Client that points at the consul agent local to the pod for a provided namespace.
@@ -653,7 +1924,11 @@ func (r *EndpointsController) requestsForRunningAgentPods(object client.Object)
 
 	// Get the list of all endpoints.
 	var endpointsList corev1.EndpointsList
-	err = r.Client.List(r.Context, &endpointsList)
+	if r.UseEndpointSlices {
+		endpointsList, err = r.endpointsListFromEndpointSlices(r.Context)
+	} else {
+		err = r.Client.List(r.Context, &endpointsList)
+	}
 	if err != nil {
 		r.Log.Error(err, "failed to list endpoints")
 		return []ctrl.Request{}
@@ -677,10 +1952,210 @@ func (r *EndpointsController) requestsForRunningAgentPods(object client.Object)
 	return requests
 }
 
+// injectedPodMetadataChanged returns true if the update is of an injected pod whose labels or annotations changed.
+func injectedPodMetadataChanged(e event.UpdateEvent) bool {
+	if e.ObjectNew.GetAnnotations()[keyInjectStatus] != injected {
+		return false
+	}
+	return !reflect.DeepEqual(e.ObjectOld.GetAnnotations(), e.ObjectNew.GetAnnotations()) ||
+		!reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+}
+
+// requestsForInjectedPod maps an injected pod to requests for the Endpoints that have it as one of their addresses.
+func (r *EndpointsController) requestsForInjectedPod(object client.Object) []ctrl.Request {
+	var endpointsList corev1.EndpointsList
+	var err error
+	if r.UseEndpointSlices {
+		endpointsList, err = r.endpointsListFromEndpointSlices(r.Context, client.InNamespace(object.GetNamespace()))
+	} else {
+		err = r.Client.List(r.Context, &endpointsList, client.InNamespace(object.GetNamespace()))
+	}
+	if err != nil {
+		r.Log.Error(err, "failed to list endpoints", "namespace", object.GetNamespace())
+		return []ctrl.Request{}
+	}
+
+	requests := []ctrl.Request{}
+	for _, ep := range endpointsList.Items {
+		if endpointsReferencePod(ep, object.GetName()) {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{Name: ep.Name, Namespace: ep.Namespace}})
+		}
+	}
+	return requests
+}
+
+// endpointsReferencePod returns true if one of the ready or not ready addresses of the Endpoints targets the pod.
+func endpointsReferencePod(endpoints corev1.Endpoints, podName string) bool {
+	for _, subset := range endpoints.Subsets {
+		for _, address := range append(subset.Addresses, subset.NotReadyAddresses...) {
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" && address.TargetRef.Name == podName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endpointsFromEndpointSlices returns the addresses of all EndpointSlices of the service name
+// as a single Endpoints object so that they're reconciled the same way as Endpoints.
+// It returns a NotFound error if the service has no EndpointSlices left, which happens once it is deleted.
+func (r *EndpointsController) endpointsFromEndpointSlices(ctx context.Context, name types.NamespacedName) (corev1.Endpoints, error) {
+	var sliceList discoveryv1beta1.EndpointSliceList
+	err := r.Client.List(ctx, &sliceList,
+		client.InNamespace(name.Namespace),
+		client.MatchingLabels{discoveryv1beta1.LabelServiceName: name.Name})
+	if err != nil {
+		return corev1.Endpoints{}, err
+	}
+	if len(sliceList.Items) == 0 {
+		return corev1.Endpoints{}, k8serrors.NewNotFound(discoveryv1beta1.Resource("endpointslices"), name.Name)
+	}
+	return endpointsFromSlices(name, sliceList.Items), nil
+}
+
+// endpointsListFromEndpointSlices returns the EndpointSlices of all services in the cluster, or those matching opts,
+// aggregated into one Endpoints object per service.
+func (r *EndpointsController) endpointsListFromEndpointSlices(ctx context.Context, opts ...client.ListOption) (corev1.EndpointsList, error) {
+	var sliceList discoveryv1beta1.EndpointSliceList
+	if err := r.Client.List(ctx, &sliceList, opts...); err != nil {
+		return corev1.EndpointsList{}, err
+	}
+
+	slicesByService := make(map[types.NamespacedName][]discoveryv1beta1.EndpointSlice)
+	for _, slice := range sliceList.Items {
+		serviceName, ok := slice.Labels[discoveryv1beta1.LabelServiceName]
+		if !ok || serviceName == "" {
+			continue
+		}
+		name := types.NamespacedName{Name: serviceName, Namespace: slice.Namespace}
+		slicesByService[name] = append(slicesByService[name], slice)
+	}
+
+	var endpointsList corev1.EndpointsList
+	for name, slices := range slicesByService {
+		endpointsList.Items = append(endpointsList.Items, endpointsFromSlices(name, slices))
+	}
+	return endpointsList, nil
+}
+
+// endpointsFromSlices converts the EndpointSlices of the service name into an Endpoints object
+// with one subset per slice. Endpoints whose readiness is unknown are considered ready,
+// as recommended by the EndpointSlice API.
+func endpointsFromSlices(name types.NamespacedName, slices []discoveryv1beta1.EndpointSlice) corev1.Endpoints {
+	endpoints := corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name.Name,
+			Namespace: name.Namespace,
+		},
+	}
+	for _, slice := range slices {
+		// Only IP addresses can belong to pods.
+		if slice.AddressType == discoveryv1beta1.AddressTypeFQDN {
+			continue
+		}
+		var subset corev1.EndpointSubset
+		for _, endpoint := range slice.Endpoints {
+			nodeName := endpoint.NodeName
+			if nodeName == nil {
+				// NodeName is behind a feature gate in v1beta1, so fall back to the node's hostname in the topology.
+				if hostname, ok := endpoint.Topology[corev1.LabelHostname]; ok {
+					nodeName = &hostname
+				}
+			}
+			ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			for _, ip := range endpoint.Addresses {
+				address := corev1.EndpointAddress{
+					IP:        ip,
+					NodeName:  nodeName,
+					TargetRef: endpoint.TargetRef,
+				}
+				if ready {
+					subset.Addresses = append(subset.Addresses, address)
+				} else {
+					subset.NotReadyAddresses = append(subset.NotReadyAddresses, address)
+				}
+			}
+		}
+		endpoints.Subsets = append(endpoints.Subsets, subset)
+	}
+	return endpoints
+}
+
+// requestForEndpointSlice maps an EndpointSlice to a request for the service it belongs to.
+func requestForEndpointSlice(object client.Object) []ctrl.Request {
+	serviceName, ok := object.GetLabels()[discoveryv1beta1.LabelServiceName]
+	if !ok || serviceName == "" {
+		return []ctrl.Request{}
+	}
+	return []ctrl.Request{{NamespacedName: types.NamespacedName{Name: serviceName, Namespace: object.GetNamespace()}}}
+}
+
+// registrationProgress records which pods of each Endpoints object have been registered by reconciles that exceeded
+// the registration timeout. Pods are recorded with their resource version so that pods that changed since they were
+// registered are registered again.
+type registrationProgress struct {
+	mutex sync.Mutex
+	pods  map[types.NamespacedName]map[string]bool
+}
+
+func registrationProgressKey(pod corev1.Pod) string {
+	return fmt.Sprintf("%s/%s@%s", pod.Namespace, pod.Name, pod.ResourceVersion)
+}
+
+// registered returns true if pod has been registered for the Endpoints endpoints.
+func (p *registrationProgress) registered(endpoints types.NamespacedName, pod corev1.Pod) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.pods[endpoints][registrationProgressKey(pod)]
+}
+
+// setRegistered records that pod has been registered for the Endpoints endpoints.
+func (p *registrationProgress) setRegistered(endpoints types.NamespacedName, pod corev1.Pod) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.pods == nil {
+		p.pods = make(map[types.NamespacedName]map[string]bool)
+	}
+	if p.pods[endpoints] == nil {
+		p.pods[endpoints] = make(map[string]bool)
+	}
+	p.pods[endpoints][registrationProgressKey(pod)] = true
+}
+
+// forget removes the pods recorded for the Endpoints endpoints.
+func (p *registrationProgress) forget(endpoints types.NamespacedName) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.pods, endpoints)
+}
+
+// consulServiceName returns the Consul name of the service name, i.e. name with the configured prefix and suffix.
+func (r *EndpointsController) consulServiceName(name string) string {
+	return r.ConsulServiceNamePrefix + name + r.ConsulServiceNameSuffix
+}
+
 // consulNamespace returns the Consul destination namespace for a provided Kubernetes namespace
 // depending on Consul Namespaces being enabled and the value of namespace mirroring.
 func (r *EndpointsController) consulNamespace(namespace string) string {
-	return namespaces.ConsulNamespace(namespace, r.EnableConsulNamespaces, r.ConsulDestinationNamespace, r.EnableNSMirroring, r.NSMirroringPrefix)
+	return namespaces.ConsulNamespace(namespace, r.EnableConsulNamespaces, r.ConsulDestinationNamespace, r.EnableNSMirroring,
+		namespaces.MirroringPrefix(r.NSMirroringPrefix, r.NSMirroringSeparator))
+}
+
+// podConsulNamespace returns the Consul namespace the services of pod are registered in: the namespace set by
+// the pod's consul-namespace annotation if Consul Namespaces are enabled, or else the destination namespace of
+// the pod's Kubernetes namespace.
+func (r *EndpointsController) podConsulNamespace(pod corev1.Pod) string {
+	if ns := pod.Annotations[annotationConsulNamespace]; ns != "" && r.EnableConsulNamespaces {
+		return ns
+	}
+	return r.consulNamespace(pod.Namespace)
+}
+
+// podConsulNamespaceAllowed returns true unless pod overrides the Consul namespace of its services with a
+// namespace that isn't in the AllowConsulNamespaceOverridesSet.
+func (r *EndpointsController) podConsulNamespaceAllowed(pod corev1.Pod) bool {
+	ns := r.podConsulNamespace(pod)
+	return ns == r.consulNamespace(pod.Namespace) || consulNamespaceOverrideAllowed(r.AllowConsulNamespaceOverridesSet, ns)
 }
 
 // hasBeenInjected checks the value of the status annotation and returns true if the Pod has been injected.
@@ -692,3 +2167,9 @@ func hasBeenInjected(pod corev1.Pod) bool {
 	}
 	return false
 }
+
+// noLongerInjected returns true if the Pod has only one of the inject status annotation and label, which
+// the injector always sets together.
+func noLongerInjected(pod corev1.Pod) bool {
+	return hasBeenInjected(pod) != (pod.Labels[keyInjectStatus] == injected)
+}
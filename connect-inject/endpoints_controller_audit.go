@@ -0,0 +1,137 @@
+package connectinject
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+)
+
+const (
+	auditOperationRegister        = "register"
+	auditOperationDeregister      = "deregister"
+	auditOperationUpdateTTL       = "update-ttl"
+	auditOperationDeregisterCheck = "deregister-check"
+	auditOperationWriteConfig     = "write-config-entry"
+	auditOperationDeleteConfig    = "delete-config-entry"
+
+	auditResultSuccess = "success"
+	auditResultFailure = "failure"
+)
+
+// AuditEntry records a single change the endpoints controller made to the
+// services or checks registered with a Consul agent, or to the config entries
+// it writes for weighted upstreams.
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Operation is one of "register", "deregister", "update-ttl",
+	// "deregister-check", "write-config-entry" or "delete-config-entry".
+	Operation string `json:"operation"`
+	// Pod is the namespace/name of the pod the service instance belongs to.
+	// It's empty for placeholder instances, which don't belong to a pod.
+	Pod         string `json:"pod,omitempty"`
+	ServiceName string `json:"serviceName"`
+	ServiceID   string `json:"serviceID"`
+	// CheckID is only set for "update-ttl" and "deregister-check".
+	CheckID string `json:"checkID,omitempty"`
+	// ConfigEntryKind is only set for "write-config-entry" and
+	// "delete-config-entry", whose ServiceName is the name of the config
+	// entry and whose ServiceID is empty.
+	ConfigEntryKind string `json:"configEntryKind,omitempty"`
+	// Namespace is the Consul namespace of the service instance or config entry.
+	Namespace string `json:"namespace,omitempty"`
+	// Result is "success" or "failure". Error is set on failure.
+	Result string `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// AuditLogger writes an AuditEntry per line as JSON to its sink. A nil
+// *AuditLogger discards entries.
+type AuditLogger struct {
+	mu   sync.Mutex
+	sink io.Writer
+}
+
+// NewAuditLogger returns an AuditLogger writing to sink.
+func NewAuditLogger(sink io.Writer) *AuditLogger {
+	return &AuditLogger{sink: sink}
+}
+
+// auditRegistration returns the audit entry of operation on the service
+// instance registered with reg.
+func auditRegistration(operation string, reg *api.AgentServiceRegistration) AuditEntry {
+	return AuditEntry{
+		Operation:   operation,
+		Pod:         auditPod(reg.Meta),
+		ServiceName: reg.Name,
+		ServiceID:   reg.ID,
+		Namespace:   reg.Namespace,
+	}
+}
+
+// auditService returns the audit entry of operation on the registered
+// service instance svc.
+func auditService(operation string, svc *api.AgentService) AuditEntry {
+	return AuditEntry{
+		Operation:   operation,
+		Pod:         auditPod(svc.Meta),
+		ServiceName: svc.Service,
+		ServiceID:   svc.ID,
+		Namespace:   svc.Namespace,
+	}
+}
+
+// auditConfigEntry returns the audit entry of operation on the config entry
+// of kind named name in namespace.
+func auditConfigEntry(operation, kind, name, namespace string) AuditEntry {
+	return AuditEntry{
+		Operation:       operation,
+		ServiceName:     name,
+		ConfigEntryKind: kind,
+		Namespace:       namespace,
+	}
+}
+
+// auditPod returns the namespace/name of the pod a service instance with meta
+// belongs to, or an empty string if it doesn't belong to a pod.
+func auditPod(meta map[string]string) string {
+	if meta[MetaKeyPodName] == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s", meta[MetaKeyKubeNS], meta[MetaKeyPodName])
+}
+
+// audit records entry in the controller's audit log. Failures to write it
+// are logged rather than failing the reconcile.
+func (r *EndpointsController) audit(entry AuditEntry, err error) {
+	if auditErr := r.AuditLog.record(entry, err); auditErr != nil {
+		r.Log.Error(auditErr, "failed to write audit log entry", "operation", entry.Operation, "id", entry.ServiceID)
+	}
+}
+
+// record writes entry with its time and result set from err. Errors writing
+// to the sink are returned so that callers can log them, but they don't fail
+// the operation that was audited.
+func (l *AuditLogger) record(entry AuditEntry, err error) error {
+	if l == nil {
+		return nil
+	}
+	entry.Time = time.Now().UTC()
+	entry.Result = auditResultSuccess
+	if err != nil {
+		entry.Result = auditResultFailure
+		entry.Error = err.Error()
+	}
+	line, marshalErr := json.Marshal(entry)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, writeErr := l.sink.Write(append(line, '\n'))
+	return writeErr
+}
@@ -5,24 +5,19 @@ package connectinject
 import (
 	"context"
 	"fmt"
-	"strings"
 	"testing"
 
 	"github.com/deckarep/golang-set"
-	logrtest "github.com/go-logr/logr/testing"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hashicorp/consul-k8s/namespaces"
-	"github.com/hashicorp/consul-k8s/subcommand/common"
 	"github.com/hashicorp/consul/api"
-	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
 
 // TestReconcileCreateEndpoint tests the logic to create service instances in Consul from the addresses in the Endpoints
@@ -129,7 +124,7 @@ func TestReconcileCreateEndpointWithNamespaces(t *testing.T) {
 					ServiceID:      "pod1-service-created",
 					ServiceName:    "service-created",
 					ServiceAddress: "1.2.3.4",
-					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS},
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS, MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags:    []string{},
 					Namespace:      test.ExpConsulNS,
 				},
@@ -137,7 +132,7 @@ func TestReconcileCreateEndpointWithNamespaces(t *testing.T) {
 					ServiceID:      "pod2-service-created",
 					ServiceName:    "service-created",
 					ServiceAddress: "2.2.3.4",
-					ServiceMeta:    map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS},
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS, MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags:    []string{},
 					Namespace:      test.ExpConsulNS,
 				},
@@ -152,7 +147,7 @@ func TestReconcileCreateEndpointWithNamespaces(t *testing.T) {
 						DestinationServiceName: "service-created",
 						DestinationServiceID:   "pod1-service-created",
 					},
-					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS, MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags: []string{},
 					Namespace:   test.ExpConsulNS,
 				},
@@ -165,7 +160,7 @@ func TestReconcileCreateEndpointWithNamespaces(t *testing.T) {
 						DestinationServiceName: "service-created",
 						DestinationServiceID:   "pod2-service-created",
 					},
-					ServiceMeta: map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: test.SourceKubeNS, MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags: []string{},
 					Namespace:   test.ExpConsulNS,
 				},
@@ -194,33 +189,15 @@ func TestReconcileCreateEndpointWithNamespaces(t *testing.T) {
 			},
 		}
 		t.Run(name, func(t *testing.T) {
-			// The agent pod needs to have the address 127.0.0.1 so when the
-			// code gets the agent pods via the label component=client, and
-			// makes requests against the agent API, it will actually hit the
-			// test server we have on localhost.
-			fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
-			fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
-
-			// Create fake k8s client.
-			k8sObjects := append(setup.k8sObjects(), fakeClientPod)
-			fakeClient := fake.NewClientBuilder().WithRuntimeObjects(k8sObjects...).Build()
-
-			// Create test Consul server.
-			consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
-				c.NodeName = nodeName
-			})
-			require.NoError(t, err)
-			defer consul.Stop()
-			consul.WaitForLeader(t)
-
-			cfg := &api.Config{
-				Address:   consul.HTTPAddr,
-				Namespace: test.ExpConsulNS,
-			}
-			consulClient, err := api.NewClient(cfg)
+			ep, _ := newTestEndpointsController(t, setup.k8sObjects()...)
+			ep.ConsulClientCfg.Namespace = test.ExpConsulNS
+			consulClient, err := api.NewClient(ep.ConsulClientCfg)
 			require.NoError(t, err)
-			addr := strings.Split(consul.HTTPAddr, ":")
-			consulPort := addr[1]
+			ep.ConsulClient = consulClient
+			ep.EnableConsulNamespaces = true
+			ep.ConsulDestinationNamespace = test.DestConsulNS
+			ep.EnableNSMirroring = test.Mirror
+			ep.NSMirroringPrefix = test.MirrorPrefix
 
 			_, err = namespaces.EnsureExists(consulClient, test.ExpConsulNS, "")
 			require.NoError(t, err)
@@ -230,24 +207,6 @@ func TestReconcileCreateEndpointWithNamespaces(t *testing.T) {
 				err = consulClient.Agent().ServiceRegister(svc)
 				require.NoError(t, err)
 			}
-
-			// Create the endpoints controller.
-			ep := &EndpointsController{
-				Client:                     fakeClient,
-				Log:                        logrtest.TestLogger{T: t},
-				ConsulClient:               consulClient,
-				ConsulPort:                 consulPort,
-				ConsulScheme:               "http",
-				AllowK8sNamespacesSet:      mapset.NewSetWith("*"),
-				DenyK8sNamespacesSet:       mapset.NewSetWith(),
-				ReleaseName:                "consul",
-				ReleaseNamespace:           "default",
-				ConsulClientCfg:            cfg,
-				EnableConsulNamespaces:     true,
-				ConsulDestinationNamespace: test.DestConsulNS,
-				EnableNSMirroring:          test.Mirror,
-				NSMirroringPrefix:          test.MirrorPrefix,
-			}
 			namespacedName := types.NamespacedName{
 				Namespace: test.SourceKubeNS,
 				Name:      "service-created",
@@ -906,52 +865,15 @@ func TestReconcileUpdateEndpointWithNamespaces(t *testing.T) {
 		for _, secure := range []bool{true, false} {
 			for _, tt := range cases {
 				t.Run(fmt.Sprintf("%s: %s - secure: %v", name, tt.name, secure), func(t *testing.T) {
-					// The agent pod needs to have the address 127.0.0.1 so when the
-					// code gets the agent pods via the label component=client, and
-					// makes requests against the agent API, it will actually hit the
-					// test server we have on localhost.
-					fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
-					fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
-
-					// Create fake k8s client.
-					k8sObjects := append(tt.k8sObjects(), fakeClientPod)
-					fakeClient := fake.NewClientBuilder().WithRuntimeObjects(k8sObjects...).Build()
-
-					masterToken := "b78d37c7-0ca7-5f4d-99ee-6d9975ce4586"
-					caFile, certFile, keyFile := common.GenerateServerCerts(t)
-					// Create test consul server, with ACLs+TLS if necessary.
-					consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
-						if secure {
-							c.ACL.Enabled = true
-							c.ACL.DefaultPolicy = "deny"
-							c.ACL.Tokens.Master = masterToken
-							c.CAFile = caFile
-							c.CertFile = certFile
-							c.KeyFile = keyFile
-						}
-						c.NodeName = nodeName
-					})
+					ep, _ := newSecureTestEndpointsController(t, secure, tt.k8sObjects()...)
+					ep.ConsulClientCfg.Namespace = ts.ExpConsulNS
+					consulClient, err := api.NewClient(ep.ConsulClientCfg)
 					require.NoError(t, err)
-					defer consul.Stop()
-					consul.WaitForSerfCheck(t)
-
-					cfg := &api.Config{
-						Scheme:    "http",
-						Address:   consul.HTTPAddr,
-						Namespace: ts.ExpConsulNS,
-					}
-					if secure {
-						cfg.Address = consul.HTTPSAddr
-						cfg.Scheme = "https"
-						cfg.TLSConfig = api.TLSConfig{
-							CAFile: caFile,
-						}
-						cfg.Token = masterToken
-					}
-					consulClient, err := api.NewClient(cfg)
-					require.NoError(t, err)
-					addr := strings.Split(cfg.Address, ":")
-					consulPort := addr[1]
+					ep.ConsulClient = consulClient
+					ep.EnableConsulNamespaces = true
+					ep.EnableNSMirroring = ts.Mirror
+					ep.NSMirroringPrefix = ts.MirrorPrefix
+					ep.ConsulDestinationNamespace = ts.DestConsulNS
 
 					_, err = namespaces.EnsureExists(consulClient, ts.ExpConsulNS, "")
 					require.NoError(t, err)
@@ -961,24 +883,6 @@ func TestReconcileUpdateEndpointWithNamespaces(t *testing.T) {
 						err = consulClient.Agent().ServiceRegister(svc)
 						require.NoError(t, err)
 					}
-
-					// Create the endpoints controller.
-					ep := &EndpointsController{
-						Client:                     fakeClient,
-						Log:                        logrtest.TestLogger{T: t},
-						ConsulClient:               consulClient,
-						ConsulPort:                 consulPort,
-						ConsulScheme:               cfg.Scheme,
-						AllowK8sNamespacesSet:      mapset.NewSetWith("*"),
-						DenyK8sNamespacesSet:       mapset.NewSetWith(),
-						ReleaseName:                "consul",
-						ReleaseNamespace:           "default",
-						ConsulClientCfg:            cfg,
-						EnableConsulNamespaces:     true,
-						EnableNSMirroring:          ts.Mirror,
-						NSMirroringPrefix:          ts.MirrorPrefix,
-						ConsulDestinationNamespace: ts.DestConsulNS,
-					}
 					namespacedName := types.NamespacedName{
 						Namespace: ts.SourceKubeNS,
 						Name:      "service-updated",
@@ -1015,7 +919,6 @@ func TestReconcileUpdateEndpointWithNamespaces(t *testing.T) {
 // This test covers EndpointsController.deregisterServiceOnAllAgents when the map is nil (not selectively deregistered).
 func TestReconcileDeleteEndpointWithNamespaces(t *testing.T) {
 	t.Parallel()
-	nodeName := "test-node"
 	cases := map[string]struct {
 		Mirror       bool
 		MirrorPrefix string
@@ -1123,60 +1026,25 @@ func TestReconcileDeleteEndpointWithNamespaces(t *testing.T) {
 		}
 		for _, tt := range cases {
 			t.Run(fmt.Sprintf("%s:%s", name, tt.name), func(t *testing.T) {
-				// The agent pod needs to have the address 127.0.0.1 so when the
-				// code gets the agent pods via the label component=client, and
-				// makes requests against the agent API, it will actually hit the
-				// test server we have on localhost.
-				fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
-				fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
-
-				// Create fake k8s client.
-				fakeClient := fake.NewClientBuilder().WithRuntimeObjects(fakeClientPod).Build()
-
-				// Create test Consul server.
-				consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
-					c.NodeName = nodeName
-				})
-				require.NoError(t, err)
-				defer consul.Stop()
-
-				consul.WaitForLeader(t)
-				cfg := &api.Config{
-					Address:   consul.HTTPAddr,
-					Namespace: ts.ExpConsulNS,
-				}
-				consulClient, err := api.NewClient(cfg)
+				ep, _ := newTestEndpointsController(t)
+				ep.ConsulClientCfg.Namespace = ts.ExpConsulNS
+				consulClient, err := api.NewClient(ep.ConsulClientCfg)
 				require.NoError(t, err)
-				addr := strings.Split(consul.HTTPAddr, ":")
-				consulPort := addr[1]
+				ep.ConsulClient = consulClient
+				ep.EnableConsulNamespaces = true
+				ep.EnableNSMirroring = ts.Mirror
+				ep.NSMirroringPrefix = ts.MirrorPrefix
+				ep.ConsulDestinationNamespace = ts.DestConsulNS
 
 				_, err = namespaces.EnsureExists(consulClient, ts.ExpConsulNS, "")
 				require.NoError(t, err)
 
-				// Register service and proxy in consul.
+				// Register service and proxy in Consul.
 				for _, svc := range tt.initialConsulSvcs {
 					err = consulClient.Agent().ServiceRegister(svc)
 					require.NoError(t, err)
 				}
 
-				// Create the endpoints controller.
-				ep := &EndpointsController{
-					Client:                     fakeClient,
-					Log:                        logrtest.TestLogger{T: t},
-					ConsulClient:               consulClient,
-					ConsulPort:                 consulPort,
-					ConsulScheme:               "http",
-					AllowK8sNamespacesSet:      mapset.NewSetWith("*"),
-					DenyK8sNamespacesSet:       mapset.NewSetWith(),
-					ReleaseName:                "consul",
-					ReleaseNamespace:           "default",
-					ConsulClientCfg:            cfg,
-					EnableConsulNamespaces:     true,
-					EnableNSMirroring:          ts.Mirror,
-					NSMirroringPrefix:          ts.MirrorPrefix,
-					ConsulDestinationNamespace: ts.DestConsulNS,
-				}
-
 				// Set up the Endpoint that will be reconciled, and reconcile.
 				namespacedName := types.NamespacedName{
 					Namespace: ts.SourceKubeNS,
@@ -1201,6 +1069,92 @@ func TestReconcileDeleteEndpointWithNamespaces(t *testing.T) {
 	}
 }
 
+// TestReconcileEndpointWithConsulNamespaceOverride tests that the services of a pod that overrides its Consul
+// namespace with the consul-namespace annotation are registered in that namespace rather than in the mirrored
+// namespace, and that they're deregistered from it once the pod is gone.
+func TestReconcileEndpointWithConsulNamespaceOverride(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	pod1 := createPodWithNamespace("pod1", "ns1", "1.2.3.4", true)
+	pod1.Annotations[annotationConsulNamespace] = "shared"
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "ns1",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP:       "1.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "ns1",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	ep.EnableConsulNamespaces = true
+	ep.ConsulDestinationNamespace = "default"
+	ep.EnableNSMirroring = true
+
+	for _, ns := range []string{"shared", "ns1"} {
+		_, err := namespaces.EnsureExists(consulClient, ns, "")
+		require.NoError(t, err)
+	}
+	namespacedName := types.NamespacedName{
+		Namespace: "ns1",
+		Name:      "service-created",
+	}
+
+	// Pods can't register into namespaces that aren't allowed.
+	resp, err := ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	require.NoError(t, err)
+	for _, ns := range []string{"shared", "ns1"} {
+		serviceInstances, _, err := consulClient.Catalog().Service("service-created", "", &api.QueryOptions{Namespace: ns})
+		require.NoError(t, err)
+		require.Empty(t, serviceInstances)
+	}
+
+	ep.AllowConsulNamespaceOverridesSet = mapset.NewSetWith("shared")
+	resp, err = ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.Requeue)
+
+	for _, svcName := range []string{"service-created", "service-created-sidecar-proxy"} {
+		serviceInstances, _, err := consulClient.Catalog().Service(svcName, "", &api.QueryOptions{Namespace: "shared"})
+		require.NoError(t, err)
+		require.Len(t, serviceInstances, 1)
+		require.Equal(t, "shared", serviceInstances[0].Namespace)
+
+		serviceInstances, _, err = consulClient.Catalog().Service(svcName, "", &api.QueryOptions{Namespace: "ns1"})
+		require.NoError(t, err)
+		require.Empty(t, serviceInstances)
+	}
+
+	// Once the endpoints are deleted, the services are deregistered from the overridden namespace.
+	require.NoError(t, ep.Client.Delete(context.Background(), endpoint))
+	resp, err = ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	require.NoError(t, err)
+	require.False(t, resp.Requeue)
+	for _, svcName := range []string{"service-created", "service-created-sidecar-proxy"} {
+		serviceInstances, _, err := consulClient.Catalog().Service(svcName, "", &api.QueryOptions{Namespace: "shared"})
+		require.NoError(t, err)
+		require.Empty(t, serviceInstances)
+	}
+}
+
 func createPodWithNamespace(name, namespace, ip string, inject bool) *corev1.Pod {
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
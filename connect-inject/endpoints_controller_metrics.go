@@ -0,0 +1,39 @@
+package connectinject
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// metricLabelConsulNamespace is the label of the endpoints controller metrics
+// holding the Consul namespace of the Kubernetes namespace of the reconciled
+// Endpoints. Pods' consul-namespace overrides aren't taken into account so that
+// the registrations, deregistrations and reconcile errors of a service are all
+// counted under the same label. It is empty unless Consul namespaces are enabled.
+const metricLabelConsulNamespace = "consul_namespace"
+
+var (
+	// servicesRegistered counts the service instances, including sidecar proxies,
+	// registered with Consul agents by the endpoints controller.
+	servicesRegistered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_k8s_endpoints_services_registered_total",
+		Help: "Total number of service instances registered with Consul by the endpoints controller.",
+	}, []string{metricLabelConsulNamespace})
+
+	// servicesDeregistered counts the service instances, including sidecar proxies,
+	// deregistered from Consul agents by the endpoints controller.
+	servicesDeregistered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_k8s_endpoints_services_deregistered_total",
+		Help: "Total number of service instances deregistered from Consul by the endpoints controller.",
+	}, []string{metricLabelConsulNamespace})
+
+	// reconcileErrors counts the reconciles of the endpoints controller that failed.
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "consul_k8s_endpoints_reconcile_errors_total",
+		Help: "Total number of failed reconciles of the endpoints controller.",
+	}, []string{metricLabelConsulNamespace})
+)
+
+func init() {
+	metrics.Registry.MustRegister(servicesRegistered, servicesDeregistered, reconcileErrors)
+}
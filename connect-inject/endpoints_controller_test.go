@@ -2,10 +2,17 @@ package connectinject
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/deckarep/golang-set"
 	logrtest "github.com/go-logr/logr/testing"
@@ -14,14 +21,20 @@ import (
 	"github.com/hashicorp/consul-k8s/subcommand/common"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const (
@@ -169,7 +182,7 @@ func TestProcessUpstreamsTLSandACLs(t *testing.T) {
 	pod := createPod("pod1", "1.2.3.4", true)
 	pod.Annotations[annotationUpstreams] = "upstream1:1234:dc1"
 
-	upstreams, err := ep.processUpstreams(*pod)
+	upstreams, err := ep.processUpstreams(*pod, "web")
 	require.NoError(t, err)
 
 	expected := []api.Upstream{
@@ -183,6 +196,59 @@ func TestProcessUpstreamsTLSandACLs(t *testing.T) {
 	require.Equal(t, expected, upstreams)
 }
 
+func TestProcessUpstreams_Weights(t *testing.T) {
+	t.Parallel()
+	pod := createPod("pod1", "1.2.3.4", true)
+	pod.Annotations[annotationUpstreams] = "web-v1:1234, web-v2:2345, db:3456"
+	pod.Annotations[annotationUpstreamsWeights] = "web-v1=90, web-v2=10"
+
+	ep := &EndpointsController{Log: logrtest.TestLogger{T: t}}
+	upstreams, err := ep.processUpstreams(*pod, "frontend")
+	require.NoError(t, err)
+	require.Equal(t, []api.Upstream{
+		{
+			DestinationType: api.UpstreamDestTypeService,
+			DestinationName: "frontend-web-v1-weighted",
+			LocalBindPort:   1234,
+		},
+		{
+			DestinationType: api.UpstreamDestTypeService,
+			DestinationName: "frontend-web-v2-weighted",
+			LocalBindPort:   2345,
+		},
+		{
+			DestinationType: api.UpstreamDestTypeService,
+			DestinationName: "db",
+			LocalBindPort:   3456,
+		},
+	}, upstreams)
+
+	splitters, err := ep.upstreamsSplitters(*pod, "frontend", "frontend-k8s")
+	require.NoError(t, err)
+	meta := map[string]string{
+		MetaKeyKubeServiceName: "frontend-k8s",
+		MetaKeyKubeNS:          "default",
+	}
+	splits := []api.ServiceSplit{
+		{Weight: 90, Service: "web-v1"},
+		{Weight: 10, Service: "web-v2"},
+	}
+	require.Equal(t, []*api.ServiceSplitterConfigEntry{
+		{
+			Kind:   api.ServiceSplitter,
+			Name:   "frontend-web-v1-weighted",
+			Meta:   meta,
+			Splits: splits,
+		},
+		{
+			Kind:   api.ServiceSplitter,
+			Name:   "frontend-web-v2-weighted",
+			Meta:   meta,
+			Splits: splits,
+		},
+	}, splitters)
+}
+
 func TestProcessUpstreams(t *testing.T) {
 	t.Parallel()
 	nodeName := "test-node"
@@ -194,6 +260,7 @@ func TestProcessUpstreams(t *testing.T) {
 		configEntry             func() api.ConfigEntry
 		consulUnavailable       bool
 		consulNamespacesEnabled bool
+		consulServiceNamePrefix string
 	}{
 		{
 			name: "upstream with datacenter without ProxyDefaults",
@@ -205,6 +272,70 @@ func TestProcessUpstreams(t *testing.T) {
 			expErr:                  "upstream \"upstream1:1234:dc1\" is invalid: there is no ProxyDefaults config to set mesh gateway mode",
 			consulNamespacesEnabled: false,
 		},
+		{
+			name: "kubernetes service upstream with namespaces disabled",
+			pod: func() *corev1.Pod {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Annotations[annotationUpstreams] = "upstream1.other.svc:1234"
+				return pod1
+			},
+			expected: []api.Upstream{
+				{
+					DestinationType: api.UpstreamDestTypeService,
+					DestinationName: "upstream1",
+					LocalBindPort:   1234,
+				},
+			},
+			consulNamespacesEnabled: false,
+		},
+		{
+			name: "kubernetes service upstream with service name prefix",
+			pod: func() *corev1.Pod {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Annotations[annotationUpstreams] = "upstream1.other.svc:1234,upstream2:1235"
+				return pod1
+			},
+			expected: []api.Upstream{
+				{
+					DestinationType: api.UpstreamDestTypeService,
+					DestinationName: "east-upstream1",
+					LocalBindPort:   1234,
+				},
+				{
+					DestinationType: api.UpstreamDestTypeService,
+					DestinationName: "upstream2",
+					LocalBindPort:   1235,
+				},
+			},
+			consulServiceNamePrefix: "east-",
+		},
+		{
+			name: "malformed kubernetes service upstream",
+			pod: func() *corev1.Pod {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Annotations[annotationUpstreams] = ".other.svc:1234"
+				return pod1
+			},
+			expErr:                  "upstream \".other.svc\" is invalid: Kubernetes Service upstreams must be in the form <service>.<namespace>.svc",
+			consulNamespacesEnabled: false,
+		},
+		{
+			name: "upstream in a consul namespace named svc",
+			pod: func() *corev1.Pod {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Annotations[annotationUpstreams] = "upstream1.svc:1234"
+				return pod1
+			},
+			expected: []api.Upstream{
+				{
+					DestinationType:      api.UpstreamDestTypeService,
+					DestinationName:      "upstream1",
+					DestinationNamespace: "svc",
+					LocalBindPort:        1234,
+				},
+			},
+			consulNamespacesEnabled: true,
+		},
 		{
 			name: "upstream with datacenter with ProxyDefaults whose mesh gateway mode is not local or remote",
 			pod: func() *corev1.Pod {
@@ -449,16 +580,17 @@ func TestProcessUpstreams(t *testing.T) {
 			}
 
 			ep := &EndpointsController{
-				Log:                    logrtest.TestLogger{T: t},
-				ConsulClient:           consulClient,
-				ConsulPort:             consulPort,
-				ConsulScheme:           "http",
-				AllowK8sNamespacesSet:  mapset.NewSetWith("*"),
-				DenyK8sNamespacesSet:   mapset.NewSetWith(),
-				EnableConsulNamespaces: tt.consulNamespacesEnabled,
+				Log:                     logrtest.TestLogger{T: t},
+				ConsulClient:            consulClient,
+				ConsulPort:              consulPort,
+				ConsulScheme:            "http",
+				AllowK8sNamespacesSet:   mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:    mapset.NewSetWith(),
+				EnableConsulNamespaces:  tt.consulNamespacesEnabled,
+				ConsulServiceNamePrefix: tt.consulServiceNamePrefix,
 			}
 
-			upstreams, err := ep.processUpstreams(*tt.pod())
+			upstreams, err := ep.processUpstreams(*tt.pod(), "web")
 			if tt.expErr != "" {
 				require.EqualError(t, err, tt.expErr)
 			} else {
@@ -545,7 +677,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 					ServiceName:    "service-created",
 					ServiceAddress: "1.2.3.4",
 					ServicePort:    0,
-					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default"},
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags:    []string{},
 				},
 			},
@@ -561,7 +693,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 						LocalServiceAddress:    "",
 						LocalServicePort:       0,
 					},
-					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default"},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags: []string{},
 				},
 			},
@@ -623,7 +755,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 					ServiceName:    "service-created",
 					ServiceAddress: "1.2.3.4",
 					ServicePort:    0,
-					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default"},
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags:    []string{},
 				},
 				{
@@ -631,7 +763,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 					ServiceName:    "service-created",
 					ServiceAddress: "2.2.3.4",
 					ServicePort:    0,
-					ServiceMeta:    map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default"},
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags:    []string{},
 				},
 			},
@@ -647,7 +779,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 						LocalServiceAddress:    "",
 						LocalServicePort:       0,
 					},
-					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default"},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags: []string{},
 				},
 				{
@@ -661,7 +793,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 						LocalServiceAddress:    "",
 						LocalServicePort:       0,
 					},
-					ServiceMeta: map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default"},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod2", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
 					ServiceTags: []string{},
 				},
 			},
@@ -737,6 +869,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 						MetaKeyPodName:         "pod1",
 						MetaKeyKubeServiceName: "service-created",
 						MetaKeyKubeNS:          "default",
+						MetaKeyProxyType:       proxyTypeSidecar,
 					},
 					ServiceTags: []string{"abc", "123", "def", "456"},
 				},
@@ -769,6 +902,7 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 						MetaKeyPodName:         "pod1",
 						MetaKeyKubeServiceName: "service-created",
 						MetaKeyKubeNS:          "default",
+						MetaKeyProxyType:       proxyTypeSidecar,
 					},
 					ServiceTags: []string{"abc", "123", "def", "456"},
 				},
@@ -785,55 +919,169 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:          "Ready pod with a failing readiness gate",
+			consulSvcName: "service-created",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Spec.ReadinessGates = []corev1.PodReadinessGate{{ConditionType: "example.com/load-balancer-ready"}}
+				pod1.Status.Conditions = []corev1.PodCondition{
+					{
+						Type:   corev1.PodReady,
+						Status: corev1.ConditionTrue,
+					},
+					{
+						Type:   "example.com/load-balancer-ready",
+						Status: corev1.ConditionFalse,
+					},
+				}
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-created",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs:       []*api.AgentServiceRegistration{},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-created",
+					ServiceName:    "service-created",
+					ServiceAddress: "1.2.3.4",
+					ServicePort:    0,
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
+					ServiceTags:    []string{},
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-created-sidecar-proxy",
+					ServiceName:    "service-created-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+					ServicePort:    20000,
+					ServiceProxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-created",
+						DestinationServiceID:   "pod1-service-created",
+						LocalServiceAddress:    "",
+						LocalServicePort:       0,
+					},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
+					ServiceTags: []string{},
+				},
+			},
+			expectedAgentHealthChecks: []*api.AgentCheck{
+				{
+					CheckID:     "default/pod1-service-created/kubernetes-health-check",
+					ServiceName: "service-created",
+					ServiceID:   "pod1-service-created",
+					Name:        "Kubernetes Health Check",
+					Status:      api.HealthCritical,
+					Output:      "Kubernetes readiness gate \"example.com/load-balancer-ready\" is not passing",
+					Type:        ttl,
+				},
+			},
+		},
+		{
+			name:          "Overridden sidecar proxy port and bind address",
+			consulSvcName: "service-created",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Annotations[annotationSidecarProxyPort] = "21000"
+				pod1.Annotations[annotationSidecarProxyBindAddress] = "127.0.0.1"
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-created",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs:       []*api.AgentServiceRegistration{},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-created",
+					ServiceName:    "service-created",
+					ServiceAddress: "1.2.3.4",
+					ServicePort:    0,
+					ServiceMeta:    map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
+					ServiceTags:    []string{},
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-created-sidecar-proxy",
+					ServiceName:    "service-created-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+					ServicePort:    21000,
+					ServiceProxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-created",
+						DestinationServiceID:   "pod1-service-created",
+						LocalServiceAddress:    "",
+						LocalServicePort:       0,
+						Config: map[string]interface{}{
+							"bind_address": "127.0.0.1",
+						},
+					},
+					ServiceMeta: map[string]string{MetaKeyPodName: "pod1", MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyProxyType: proxyTypeSidecar},
+					ServiceTags: []string{},
+				},
+			},
+			expectedAgentHealthChecks: []*api.AgentCheck{
+				{
+					CheckID:     "default/pod1-service-created/kubernetes-health-check",
+					ServiceName: "service-created",
+					ServiceID:   "pod1-service-created",
+					Name:        "Kubernetes Health Check",
+					Status:      api.HealthCritical,
+					Output:      testFailureMessage,
+					Type:        ttl,
+				},
+			},
+		},
 	}
 	for _, tt := range cases {
 		t.Run(tt.name, func(t *testing.T) {
-			// The agent pod needs to have the address 127.0.0.1 so when the
-			// code gets the agent pods via the label component=client, and
-			// makes requests against the agent API, it will actually hit the
-			// test server we have on localhost.
-			fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
-			fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
-
-			// Create fake k8s client
-			k8sObjects := append(tt.k8sObjects(), fakeClientPod)
-			fakeClient := fake.NewClientBuilder().WithRuntimeObjects(k8sObjects...).Build()
-
-			// Create test consul server
-			consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
-				c.NodeName = nodeName
-			})
-			require.NoError(t, err)
-			defer consul.Stop()
-			consul.WaitForServiceIntentions(t)
-
-			cfg := &api.Config{
-				Address: consul.HTTPAddr,
-			}
-			consulClient, err := api.NewClient(cfg)
-			require.NoError(t, err)
-			addr := strings.Split(consul.HTTPAddr, ":")
-			consulPort := addr[1]
+			ep, consulClient := newTestEndpointsController(t, tt.k8sObjects()...)
 
 			// Register service and proxy in consul
 			for _, svc := range tt.initialConsulSvcs {
-				err = consulClient.Agent().ServiceRegister(svc)
+				err := consulClient.Agent().ServiceRegister(svc)
 				require.NoError(t, err)
 			}
 
-			// Create the endpoints controller
-			ep := &EndpointsController{
-				Client:                fakeClient,
-				Log:                   logrtest.TestLogger{T: t},
-				ConsulClient:          consulClient,
-				ConsulPort:            consulPort,
-				ConsulScheme:          "http",
-				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
-				DenyK8sNamespacesSet:  mapset.NewSetWith(),
-				ReleaseName:           "consul",
-				ReleaseNamespace:      "default",
-				ConsulClientCfg:       cfg,
-			}
 			namespacedName := types.NamespacedName{
 				Namespace: "default",
 				Name:      "service-created",
@@ -896,63 +1144,1541 @@ func TestReconcileCreateEndpoint(t *testing.T) {
 	}
 }
 
-// Tests updating an Endpoints object.
-//   - Tests updates via the register codepath:
-//     - When an address in an Endpoint is updated, that the corresponding service instance in Consul is updated.
-//     - When an address is added to an Endpoint, an additional service instance in Consul is registered.
-//     - When an address in an Endpoint is updated - via health check change - the corresponding service instance is updated.
-//   - Tests updates via the deregister codepath:
-//     - When an address is removed from an Endpoint, the corresponding service instance in Consul is deregistered.
-//     - When an address is removed from an Endpoint *and there are no addresses left in the Endpoint*, the
-//     corresponding service instance in Consul is deregistered.
-// For the register and deregister codepath, this also tests that they work when the Consul service name is different
-// from the K8s service name.
-// This test covers EndpointsController.deregisterServiceOnAllAgents when services should be selectively deregistered
-// since the map will not be nil. This test also runs each test with ACLs+TLS enabled and disabled, since it covers all the cases where a Consul client is created.
-func TestReconcileUpdateEndpoint(t *testing.T) {
+// TestReconcile_HealthCheckDisabled tests that the Kubernetes health check is deregistered once
+// a pod disables it with the enable-health-check annotation.
+func TestReconcile_HealthCheckDisabled(t *testing.T) {
 	t.Parallel()
 	nodeName := "test-node"
-	cases := []struct {
-		name                       string
-		consulSvcName              string
-		k8sObjects                 func() []runtime.Object
-		initialConsulSvcs          []*api.AgentServiceRegistration
-		expectedNumSvcInstances    int
-		expectedConsulSvcInstances []*api.CatalogService
-		expectedProxySvcInstances  []*api.CatalogService
-		expectedAgentHealthChecks  []*api.AgentCheck
-	}{
-		{
-			name:          "Endpoints has an updated address because health check changes from unhealthy to healthy",
-			consulSvcName: "service-updated",
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	// An empty value is the same as not setting the annotation.
+	pod1.Annotations[annotationEnableHealthCheck] = ""
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP:       "1.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	namespacedName := types.NamespacedName{
+		Namespace: "default",
+		Name:      "service-created",
+	}
+	resp, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.False(t, resp.Requeue)
+
+	checks, err := consulClient.Agent().ChecksWithFilter("ServiceID == `pod1-service-created`")
+	require.NoError(t, err)
+	require.Len(t, checks, 1)
+
+	var auditBuf strings.Builder
+	ep.AuditLog = NewAuditLogger(&auditBuf)
+	pod1.Annotations[annotationEnableHealthCheck] = "false"
+	require.NoError(t, ep.Client.Update(context.Background(), pod1))
+	resp, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.False(t, resp.Requeue)
+
+	// The service and its proxy are registered, but the service has no checks.
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created")
+
+	checks, err = consulClient.Agent().ChecksWithFilter("ServiceID == `pod1-service-created`")
+	require.NoError(t, err)
+	require.Empty(t, checks)
+
+	// Deregistering the check is audited like registering it.
+	var deregistered []AuditEntry
+	for _, line := range strings.Split(strings.TrimSpace(auditBuf.String()), "\n") {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry))
+		if entry.Operation == auditOperationDeregisterCheck {
+			entry.Time = time.Time{}
+			deregistered = append(deregistered, entry)
+		}
+	}
+	require.Equal(t, []AuditEntry{
+		{
+			Operation:   auditOperationDeregisterCheck,
+			Pod:         "default/pod1",
+			ServiceName: "service-created",
+			ServiceID:   "pod1-service-created",
+			CheckID:     "default/pod1-service-created/kubernetes-health-check",
+			Result:      auditResultSuccess,
+		},
+	}, deregistered)
+}
+
+// TestReconcile_ConnectNative tests that a Connect-native pod registers its service as
+// Connect-native without a proxy service.
+func TestReconcile_ConnectNative(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	pod1.Annotations[annotationConnectNative] = "true"
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP:       "1.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	resp, err := ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{
+			Namespace: "default",
+			Name:      "service-created",
+		},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.Requeue)
+
+	serviceInstances, _, err := consulClient.Catalog().Service("service-created", "", nil)
+	require.NoError(t, err)
+	require.Len(t, serviceInstances, 1)
+	require.Equal(t, map[string]string{
+		MetaKeyPodName:         "pod1",
+		MetaKeyKubeServiceName: "service-created",
+		MetaKeyKubeNS:          "default",
+		MetaKeyProxyType:       proxyTypeNative,
+	}, serviceInstances[0].ServiceMeta)
+	svc, _, err := consulClient.Agent().Service("pod1-service-created", nil)
+	require.NoError(t, err)
+	require.NotNil(t, svc.Connect)
+	require.True(t, svc.Connect.Native)
+
+	proxyServices, err := consulClient.Agent().ServicesWithFilter(fmt.Sprintf("Kind == %q", api.ServiceKindConnectProxy))
+	require.NoError(t, err)
+	require.Empty(t, proxyServices)
+}
+
+// TestReconcile_GatewayNameConflict tests that a service is not registered when a gateway
+// with the same name is already registered in Consul, and that a single warning event is emitted instead.
+func TestReconcile_GatewayNameConflict(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	pod2 := createPod("pod2", "2.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP:       "1.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+					{
+						IP:       "2.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod2",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, pod2, endpoint)
+
+	// Register a gateway with the same name as the service.
+	err := consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		Kind: api.ServiceKindTerminatingGateway,
+		ID:   "terminating-gateway",
+		Name: "service-created",
+		Port: 8443,
+	})
+	require.NoError(t, err)
+
+	recorder := record.NewFakeRecorder(10)
+	ep.Recorder = recorder
+
+	resp, err := ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "service-created"},
+	})
+	require.NoError(t, err)
+	require.False(t, resp.Requeue)
+
+	// The gateway should be the only instance registered under the service name.
+	entries, _, err := consulClient.Health().Service("service-created", "", false, nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "terminating-gateway", entries[0].Service.ID)
+	require.Equal(t, api.ServiceKindTerminatingGateway, entries[0].Service.Kind)
+
+	// No sidecar proxy should have been registered either.
+	proxyInstances, _, err := consulClient.Catalog().Service("service-created-sidecar-proxy", "", nil)
+	require.NoError(t, err)
+	require.Len(t, proxyInstances, 0)
+
+	require.Len(t, recorder.Events, 1)
+	require.Equal(t, "Warning GatewayNameConflict service \"service-created\" was not registered because a gateway with the same name is registered in Consul", <-recorder.Events)
+}
+
+// TestReconcile_PodLabelSelector tests that only the pods matching the PodLabelSelector are registered
+// and that the instances of pods that no longer match it are deregistered.
+func TestReconcile_PodLabelSelector(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	pod1.Labels["mesh"] = "enabled"
+	pod2 := createPod("pod2", "2.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP:       "1.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+					{
+						IP:       "2.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod2",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, pod2, endpoint)
+	reconcileAndCheck := func(expectedIDs ...string) {
+		_, err := ep.Reconcile(context.Background(), ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: "default", Name: "service-created"},
+		})
+		require.NoError(t, err)
+		requireServiceInstances(t, consulClient, "service-created", expectedIDs...)
+	}
+
+	// Without a selector, both pods are registered.
+	reconcileAndCheck("pod1-service-created", "pod2-service-created")
+
+	// Once the selector is set, only the matching pod stays registered.
+	ep.PodLabelSelector = labels.SelectorFromSet(labels.Set{"mesh": "enabled"})
+	reconcileAndCheck("pod1-service-created")
+}
+
+// TestReconcile_Events tests that the (de)registrations and Consul errors of a reconcile are recorded
+// as events on the Service.
+func TestReconcile_Events(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP:       "1.2.3.4",
+						NodeName: &nodeName,
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+	}
+	newController := func(t *testing.T) (*EndpointsController, *record.FakeRecorder) {
+		ep, _ := newTestEndpointsController(t, pod1, endpoint, svc)
+		recorder := record.NewFakeRecorder(10)
+		recorder.IncludeObject = true
+		ep.Recorder = recorder
+		return ep, recorder
+	}
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+	involvedService := " involvedObject{kind=Service,apiVersion=v1}"
+
+	t.Run("registration and deregistration", func(t *testing.T) {
+		ep, recorder := newController(t)
+
+		_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		require.Len(t, recorder.Events, 1)
+		require.Equal(t, "Normal ServiceRegistered registered 1 service instance(s) with Consul"+involvedService, <-recorder.Events)
+
+		// Registering the instance again doesn't record another event.
+		_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		require.Len(t, recorder.Events, 0)
+
+		// Once the Service and its Endpoints are deleted, the events are attached to a reference to the Service.
+		require.NoError(t, ep.Client.Delete(context.Background(), endpoint.DeepCopy()))
+		require.NoError(t, ep.Client.Delete(context.Background(), svc.DeepCopy()))
+		_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		require.Len(t, recorder.Events, 2)
+		require.Equal(t, `Normal ServiceDeregistered deregistered service instance "pod1-service-created-sidecar-proxy" from Consul`+involvedService, <-recorder.Events)
+		require.Equal(t, `Normal ServiceDeregistered deregistered service instance "pod1-service-created" from Consul`+involvedService, <-recorder.Events)
+	})
+
+	t.Run("health check disabled", func(t *testing.T) {
+		ep, recorder := newController(t)
+
+		_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		require.Len(t, recorder.Events, 1)
+		<-recorder.Events
+
+		// Disabling the health check of a registered instance deregisters it once.
+		pod := pod1.DeepCopy()
+		pod.Annotations[annotationEnableHealthCheck] = "false"
+		require.NoError(t, ep.Client.Update(context.Background(), pod))
+		_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		require.Len(t, recorder.Events, 1)
+		require.Equal(t, `Normal HealthCheckDeregistered deregistered the health check of service instance "pod1-service-created" from Consul because pod "pod1" disabled it`+involvedService, <-recorder.Events)
+
+		_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		require.Len(t, recorder.Events, 0)
+	})
+
+	t.Run("registration failure", func(t *testing.T) {
+		// The agent local to the pod has no services registered and fails every registration.
+		agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1/agent/service/") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("boom"))
+		}))
+		defer agent.Close()
+		ep, recorder := newController(t)
+		ep.ConsulPort = strings.Split(agent.URL, ":")[2]
+
+		_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+		require.Error(t, err)
+		require.Len(t, recorder.Events, 1)
+		require.Equal(t, `Warning RegistrationFailed failed to register service instance "pod1-service-created" with Consul: Unexpected response code: 500 (boom)`+involvedService, <-recorder.Events)
+	})
+}
+
+// TestReconcile_HostNetworkPods tests that pods using the host network on the same node, and so with
+// the same IP, are registered as distinct service instances and that removing one of them from the
+// Endpoints only deregisters its own instances.
+func TestReconcile_HostNetworkPods(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	pod1 := createPod("pod1", "10.0.0.1", true)
+	pod1.Spec.HostNetwork = true
+	pod1.Annotations[annotationSidecarProxyPort] = "21000"
+	pod2 := createPod("pod2", "10.0.0.1", true)
+	pod2.Spec.HostNetwork = true
+	pod2.Annotations[annotationSidecarProxyPort] = "21001"
+	address := func(podName string) corev1.EndpointAddress {
+		return corev1.EndpointAddress{
+			IP:       "10.0.0.1",
+			NodeName: &nodeName,
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Name:      podName,
+				Namespace: "default",
+			},
+		}
+	}
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{address("pod1"), address("pod2")},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, pod2, endpoint)
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+
+	instances := requireServiceInstances(t, consulClient, "service-created", "pod1-service-created", "pod2-service-created")
+	proxyPorts := map[string]int{}
+	for _, instance := range instances {
+		require.Equal(t, "10.0.0.1", instance.ServiceAddress)
+		if strings.HasSuffix(instance.ServiceID, "-sidecar-proxy") {
+			proxyPorts[instance.ServiceID] = instance.ServicePort
+		}
+	}
+	require.Equal(t, map[string]int{
+		"pod1-service-created-sidecar-proxy": 21000,
+		"pod2-service-created-sidecar-proxy": 21001,
+	}, proxyPorts)
+
+	// Removing pod2 from the Endpoints deregisters its instances even though pod1 has the same IP.
+	endpoint.Subsets[0].Addresses = []corev1.EndpointAddress{address("pod1")}
+	require.NoError(t, ep.Client.Update(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created")
+}
+
+// TestReconcile_PodRescheduledToNewNode tests that when a pod moves to another node while keeping its IP,
+// its service instances are registered with the new node's agent and deregistered from the old node's agent.
+func TestReconcile_PodRescheduledToNewNode(t *testing.T) {
+	t.Parallel()
+	oldNodeIP, newNodeIP := "127.0.0.1", "127.0.0.2"
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	// Each node runs a Consul client agent.
+	oldAgentPod := createPod("consul-client-old", oldNodeIP, false)
+	oldAgentPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
+	newAgentPod := createPod("consul-client-new", newNodeIP, false)
+	newAgentPod.Status.HostIP = newNodeIP
+	newAgentPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
+	fakeClient := fake.NewClientBuilder().WithRuntimeObjects(pod1, endpoint, oldAgentPod, newAgentPod).Build()
+
+	oldConsul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.NodeName = "old-node"
+	})
+	require.NoError(t, err)
+	defer oldConsul.Stop()
+	oldConsul.WaitForServiceIntentions(t)
+	consulPort := strings.Split(oldConsul.HTTPAddr, ":")[1]
+
+	// The controller talks to every agent on the same port, so the new node's agent
+	// listens on the same port as the old one but on a different IP.
+	newConsul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		c.NodeName = "new-node"
+		c.Bind = newNodeIP
+		c.Addresses.HTTP = newNodeIP
+		c.Ports.HTTP = oldConsul.Config.Ports.HTTP
+	})
+	require.NoError(t, err)
+	defer newConsul.Stop()
+
+	oldCfg := &api.Config{Address: oldConsul.HTTPAddr}
+	oldClient, err := api.NewClient(oldCfg)
+	require.NoError(t, err)
+	newClient, err := api.NewClient(&api.Config{Address: fmt.Sprintf("%s:%s", newNodeIP, consulPort)})
+	require.NoError(t, err)
+	retry.Run(t, func(r *retry.R) {
+		leader, err := newClient.Status().Leader()
+		require.NoError(r, err)
+		require.NotEmpty(r, leader)
+	})
+
+	ep := &EndpointsController{
+		Client:                fakeClient,
+		Log:                   logrtest.TestLogger{T: t},
+		ConsulClient:          oldClient,
+		ConsulPort:            consulPort,
+		ConsulScheme:          "http",
+		AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+		DenyK8sNamespacesSet:  mapset.NewSetWith(),
+		ReleaseName:           "consul",
+		ReleaseNamespace:      "default",
+		ConsulClientCfg:       oldCfg,
+	}
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+	expServiceIDs := []string{"pod1-service-created", "pod1-service-created-sidecar-proxy"}
+	serviceIDs := func(client *api.Client) []string {
+		services, err := client.Agent().Services()
+		require.NoError(t, err)
+		var ids []string
+		for id := range services {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.ElementsMatch(t, expServiceIDs, serviceIDs(oldClient))
+	require.Empty(t, serviceIDs(newClient))
+
+	// Move the pod to the new node.
+	pod1.Status.HostIP = newNodeIP
+	require.NoError(t, fakeClient.Update(context.Background(), pod1))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Empty(t, serviceIDs(oldClient))
+	require.ElementsMatch(t, expServiceIDs, serviceIDs(newClient))
+}
+
+// TestReconcile_ProxyDrift tests that proxy service instances whose registration differs from the one the
+// controller would create are re-registered when drift checks are enabled.
+func TestReconcile_ProxyDrift(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+
+	// Seed the registrations an older version of the controller would have made, with the proxy
+	// listening on a different port and carrying stale metadata.
+	require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		ID:      "pod1-service-created",
+		Name:    "service-created",
+		Port:    0,
+		Address: "1.2.3.4",
+		Meta:    map[string]string{MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyPodName: "pod1"},
+	}))
+	require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+		Kind:    api.ServiceKindConnectProxy,
+		ID:      "pod1-service-created-sidecar-proxy",
+		Name:    "service-created-sidecar-proxy",
+		Port:    21000,
+		Address: "1.2.3.4",
+		Meta: map[string]string{
+			MetaKeyKubeServiceName: "service-created",
+			MetaKeyKubeNS:          "default",
+			MetaKeyPodName:         "pod1",
+			"stale":                "true",
+		},
+		Proxy: &api.AgentServiceConnectProxyConfig{
+			DestinationServiceName: "service-created",
+			DestinationServiceID:   "pod1-service-created",
+		},
+	}))
+	ep.ProxyDriftCheckPeriod = time.Minute
+	resp, err := ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "service-created"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, resp.RequeueAfter)
+
+	proxy, _, err := consulClient.Agent().Service("pod1-service-created-sidecar-proxy", nil)
+	require.NoError(t, err)
+	require.Equal(t, defaultProxyPublicListenerPort, proxy.Port)
+	require.NotContains(t, proxy.Meta, "stale")
+	require.Equal(t, "service-created", proxy.Proxy.DestinationServiceName)
+	require.Equal(t, "pod1-service-created", proxy.Proxy.DestinationServiceID)
+}
+
+// TestReconcile_RecreatesMissingProxy tests that the proxy service instance of a service instance registered
+// without it, e.g. because the agent lost it on restart, is registered again.
+func TestReconcile_RecreatesMissingProxy(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		// registeredBeforeTimeout marks the pod as registered by an earlier reconcile that timed out.
+		registeredBeforeTimeout bool
+	}{
+		"service instance without proxy":                        {},
+		"pod registered by an earlier reconcile that timed out": {registeredBeforeTimeout: true},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod1 := createPod("pod1", "1.2.3.4", true)
+			endpoint := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "service-created",
+					Namespace: "default",
+				},
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "1.2.3.4",
+								TargetRef: &corev1.ObjectReference{
+									Kind:      "Pod",
+									Name:      "pod1",
+									Namespace: "default",
+								},
+							},
+						},
+					},
+				},
+			}
+			ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+
+			// Seed the service instance without its proxy.
+			require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+				ID:      "pod1-service-created",
+				Name:    "service-created",
+				Port:    0,
+				Address: "1.2.3.4",
+				Meta:    map[string]string{MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyPodName: "pod1"},
+			}))
+			namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+			if c.registeredBeforeTimeout {
+				ep.RegistrationTimeout = time.Minute
+				ep.registrationProgress.setRegistered(namespacedName, *pod1)
+			}
+
+			_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+
+			proxy, _, err := consulClient.Agent().Service("pod1-service-created-sidecar-proxy", nil)
+			require.NoError(t, err)
+			require.Equal(t, api.ServiceKindConnectProxy, proxy.Kind)
+			require.Equal(t, "pod1-service-created", proxy.Proxy.DestinationServiceID)
+		})
+	}
+}
+
+// Tests that registering and deregistering a pod's service instances is
+// recorded in the audit log.
+func TestReconcile_AuditLog(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
+						},
+					},
+				},
+			},
+		},
+	}
+	ep, _ := newTestEndpointsController(t, pod1, endpoint)
+
+	var auditBuf strings.Builder
+	ep.AuditLog = NewAuditLogger(&auditBuf)
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+	auditEntries := func() []AuditEntry {
+		var entries []AuditEntry
+		for _, line := range strings.Split(strings.TrimSpace(auditBuf.String()), "\n") {
+			var entry AuditEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			require.False(t, entry.Time.IsZero())
+			entry.Time = time.Time{}
+			entries = append(entries, entry)
+		}
+		auditBuf.Reset()
+		return entries
+	}
+
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, []AuditEntry{
+		{
+			Operation:   auditOperationRegister,
+			Pod:         "default/pod1",
+			ServiceName: "service-created",
+			ServiceID:   "pod1-service-created",
+			Result:      auditResultSuccess,
+		},
+		{
+			Operation:   auditOperationRegister,
+			Pod:         "default/pod1",
+			ServiceName: "service-created-sidecar-proxy",
+			ServiceID:   "pod1-service-created-sidecar-proxy",
+			Result:      auditResultSuccess,
+		},
+		{
+			Operation:   auditOperationUpdateTTL,
+			Pod:         "default/pod1",
+			ServiceName: "service-created",
+			ServiceID:   "pod1-service-created",
+			CheckID:     "default/pod1-service-created/kubernetes-health-check",
+			Result:      auditResultSuccess,
+		},
+	}, auditEntries())
+
+	// Remove the pod from the Endpoints so that its service instances are deregistered.
+	endpoint.Subsets = nil
+	require.NoError(t, ep.Client.Update(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, []AuditEntry{
+		{
+			Operation:   auditOperationDeregister,
+			Pod:         "default/pod1",
+			ServiceName: "service-created-sidecar-proxy",
+			ServiceID:   "pod1-service-created-sidecar-proxy",
+			Result:      auditResultSuccess,
+		},
+		{
+			Operation:   auditOperationDeregister,
+			Pod:         "default/pod1",
+			ServiceName: "service-created",
+			ServiceID:   "pod1-service-created",
+			Result:      auditResultSuccess,
+		},
+	}, auditEntries())
+}
+
+func TestProxyRegistrationDrifted(t *testing.T) {
+	desired := func() *api.AgentServiceRegistration {
+		return &api.AgentServiceRegistration{
+			Port:    20000,
+			Address: "1.2.3.4",
+			Meta:    map[string]string{MetaKeyPodName: "pod1"},
+			Proxy: &api.AgentServiceConnectProxyConfig{
+				DestinationServiceName: "service",
+				LocalServicePort:       8080,
+				Config:                 map[string]interface{}{envoyPrometheusBindAddr: "0.0.0.0:20200"},
+			},
+		}
+	}
+	existing := func() *api.AgentService {
+		return &api.AgentService{
+			Port:    20000,
+			Address: "1.2.3.4",
+			Meta:    map[string]string{MetaKeyPodName: "pod1"},
+			Proxy: &api.AgentServiceConnectProxyConfig{
+				DestinationServiceName: "service",
+				LocalServicePort:       8080,
+				Mode:                   api.ProxyModeDirect,
+				Config:                 map[string]interface{}{envoyPrometheusBindAddr: "0.0.0.0:20200"},
+			},
+		}
+	}
+	cases := map[string]struct {
+		modify  func(*api.AgentService)
+		drifted bool
+	}{
+		"unchanged": {
+			modify:  func(*api.AgentService) {},
+			drifted: false,
+		},
+		"different port": {
+			modify:  func(s *api.AgentService) { s.Port = 21000 },
+			drifted: true,
+		},
+		"different meta": {
+			modify:  func(s *api.AgentService) { s.Meta["stale"] = "true" },
+			drifted: true,
+		},
+		"different local service port": {
+			modify:  func(s *api.AgentService) { s.Proxy.LocalServicePort = 9090 },
+			drifted: true,
+		},
+		"different mode": {
+			modify:  func(s *api.AgentService) { s.Proxy.Mode = api.ProxyModeTransparent },
+			drifted: true,
+		},
+		"missing config": {
+			modify:  func(s *api.AgentService) { s.Proxy.Config = nil },
+			drifted: true,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			svc := existing()
+			c.modify(svc)
+			require.Equal(t, c.drifted, proxyRegistrationDrifted(svc, desired()))
+		})
+	}
+}
+
+// TestReconcile_PreregisterPlaceholder tests the lifecycle of the placeholder service instance
+// registered for Kubernetes Services annotated for preregistration.
+func TestReconcile_PreregisterPlaceholder(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	for name, annotated := range map[string]bool{
+		"annotated service":     true,
+		"not annotated service": false,
+	} {
+		t.Run(name, func(t *testing.T) {
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "service-created",
+					Namespace: "default",
+				},
+			}
+			if annotated {
+				service.Annotations = map[string]string{annotationPreregister: "true"}
+			}
+			endpoint := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "service-created",
+					Namespace: "default",
+				},
+			}
+			pod1 := createPod("pod1", "1.2.3.4", true)
+			ep, consulClient := newTestEndpointsController(t, service, endpoint, pod1)
+			namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+
+			// A placeholder registered with the agent by an earlier version is deregistered.
+			err := consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+				ID:   "default-service-created-placeholder",
+				Name: "service-created",
+				Meta: map[string]string{MetaKeyKubeServiceName: "service-created", MetaKeyKubeNS: "default", MetaKeyPlaceholder: "true"},
+			})
+			require.NoError(t, err)
+
+			// With no pods, the placeholder is only registered if the service is annotated.
+			// Reconciling twice checks that the placeholder isn't removed by the deregistration codepath.
+			for i := 0; i < 2; i++ {
+				_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+				require.NoError(t, err)
+			}
+			entries, _, err := consulClient.Health().Service("service-created", "", false, nil)
+			require.NoError(t, err)
+			if annotated {
+				require.Len(t, entries, 1)
+				require.Equal(t, "default-service-created-placeholder", entries[0].Service.ID)
+				require.Equal(t, "true", entries[0].Service.Meta[MetaKeyPlaceholder])
+				require.Equal(t, placeholderNodeName, entries[0].Node.Node)
+				require.Len(t, entries[0].Checks, 1)
+				require.Equal(t, api.HealthCritical, entries[0].Checks.AggregatedStatus())
+
+				// The placeholder is found by its meta, so it's replaced if the Consul service name changes.
+				ep.ConsulServiceNamePrefix = "prefix-"
+				_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+				require.NoError(t, err)
+				entries, _, err = consulClient.Health().Service("service-created", "", false, nil)
+				require.NoError(t, err)
+				require.Len(t, entries, 0)
+				entries, _, err = consulClient.Health().Service("prefix-service-created", "", false, nil)
+				require.NoError(t, err)
+				require.Len(t, entries, 1)
+				ep.ConsulServiceNamePrefix = ""
+				_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+				require.NoError(t, err)
+				entries, _, err = consulClient.Health().Service("prefix-service-created", "", false, nil)
+				require.NoError(t, err)
+				require.Len(t, entries, 0)
+			} else {
+				require.Len(t, entries, 0)
+			}
+
+			// Once a pod is added to the endpoints, the placeholder is replaced by the real instance.
+			endpoint.Subsets = []corev1.EndpointSubset{
+				{
+					Addresses: []corev1.EndpointAddress{
+						{
+							IP:       "1.2.3.4",
+							NodeName: &nodeName,
+							TargetRef: &corev1.ObjectReference{
+								Kind:      "Pod",
+								Name:      "pod1",
+								Namespace: "default",
+							},
+						},
+					},
+				},
+			}
+			require.NoError(t, ep.Client.Update(context.Background(), endpoint))
+			_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+			entries, _, err = consulClient.Health().Service("service-created", "", false, nil)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			require.Equal(t, "pod1-service-created", entries[0].Service.ID)
+
+			// When the pod is removed again, the placeholder is registered again.
+			endpoint.Subsets = nil
+			require.NoError(t, ep.Client.Update(context.Background(), endpoint))
+			_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+			entries, _, err = consulClient.Health().Service("service-created", "", false, nil)
+			require.NoError(t, err)
+			if annotated {
+				require.Len(t, entries, 1)
+				require.Equal(t, "default-service-created-placeholder", entries[0].Service.ID)
+			} else {
+				require.Len(t, entries, 0)
+			}
+
+			// Deleting the endpoints removes the placeholder.
+			require.NoError(t, ep.Client.Delete(context.Background(), endpoint))
+			_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+			entries, _, err = consulClient.Health().Service("service-created", "", false, nil)
+			require.NoError(t, err)
+			require.Len(t, entries, 0)
+		})
+	}
+}
+
+// Tests updating an Endpoints object.
+//   - Tests updates via the register codepath:
+//     - When an address in an Endpoint is updated, that the corresponding service instance in Consul is updated.
+//     - When an address is added to an Endpoint, an additional service instance in Consul is registered.
+//     - When an address in an Endpoint is updated - via health check change - the corresponding service instance is updated.
+//   - Tests updates via the deregister codepath:
+//     - When an address is removed from an Endpoint, the corresponding service instance in Consul is deregistered.
+//     - When an address is removed from an Endpoint *and there are no addresses left in the Endpoint*, the
+//     corresponding service instance in Consul is deregistered.
+// For the register and deregister codepath, this also tests that they work when the Consul service name is different
+// from the K8s service name.
+// This test covers EndpointsController.deregisterServiceOnAllAgents when services should be selectively deregistered
+// since the map will not be nil. This test also runs each test with ACLs+TLS enabled and disabled, since it covers all the cases where a Consul client is created.
+func TestReconcileUpdateEndpoint(t *testing.T) {
+	t.Parallel()
+	nodeName := "test-node"
+	cases := []struct {
+		name                       string
+		consulSvcName              string
+		k8sObjects                 func() []runtime.Object
+		initialConsulSvcs          []*api.AgentServiceRegistration
+		expectedNumSvcInstances    int
+		expectedConsulSvcInstances []*api.CatalogService
+		expectedProxySvcInstances  []*api.CatalogService
+		expectedAgentHealthChecks  []*api.AgentCheck
+	}{
+		{
+			name:          "Endpoints has an updated address because health check changes from unhealthy to healthy",
+			consulSvcName: "service-updated",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Status.Conditions = []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				}}
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "1.2.3.4",
+					Check: &api.AgentServiceCheck{
+						CheckID:                "default/pod1-service-updated/kubernetes-health-check",
+						Name:                   "Kubernetes Health Check",
+						TTL:                    "100000h",
+						Status:                 "passing",
+						SuccessBeforePassing:   1,
+						FailuresBeforeCritical: 1,
+					},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod1-service-updated",
+					},
+				},
+			},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+			expectedAgentHealthChecks: []*api.AgentCheck{
+				{
+					CheckID:     "default/pod1-service-updated/kubernetes-health-check",
+					ServiceName: "service-updated",
+					ServiceID:   "pod1-service-updated",
+					Name:        "Kubernetes Health Check",
+					Status:      api.HealthPassing,
+					Output:      kubernetesSuccessReasonMsg,
+					Type:        ttl,
+				},
+			},
+		},
+		{
+			name:          "Endpoints has an updated address because health check changes from healthy to unhealthy",
+			consulSvcName: "service-updated",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "1.2.3.4",
+					Check: &api.AgentServiceCheck{
+						CheckID:                "default/pod1-service-updated/kubernetes-health-check",
+						Name:                   "Kubernetes Health Check",
+						TTL:                    "100000h",
+						Status:                 "passing",
+						SuccessBeforePassing:   1,
+						FailuresBeforeCritical: 1,
+					},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod1-service-updated",
+					},
+				},
+			},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+			expectedAgentHealthChecks: []*api.AgentCheck{
+				{
+					CheckID:     "default/pod1-service-updated/kubernetes-health-check",
+					ServiceName: "service-updated",
+					ServiceID:   "pod1-service-updated",
+					Name:        "Kubernetes Health Check",
+					Status:      api.HealthCritical,
+					Output:      testFailureMessage,
+					Type:        ttl,
+				},
+			},
+		},
+		{
+			name:          "Endpoints has an updated address (pod IP change).",
+			consulSvcName: "service-updated",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "4.4.4.4", true)
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "4.4.4.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "1.2.3.4",
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod1-service-updated",
+					},
+				},
+			},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated",
+					ServiceAddress: "4.4.4.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated-sidecar-proxy",
+					ServiceAddress: "4.4.4.4",
+				},
+			},
+		},
+		{
+			name:          "Different Consul service name: Endpoints has an updated address (pod IP change).",
+			consulSvcName: "different-consul-svc-name",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "4.4.4.4", true)
+				pod1.Annotations[annotationService] = "different-consul-svc-name"
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "4.4.4.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-different-consul-svc-name",
+					Name:    "different-consul-svc-name",
+					Port:    80,
+					Address: "1.2.3.4",
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
+					Name:    "different-consul-svc-name-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "different-consul-svc-name",
+						DestinationServiceID:   "pod1-different-consul-svc-name",
+					},
+				},
+			},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-different-consul-svc-name",
+					ServiceAddress: "4.4.4.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-different-consul-svc-name-sidecar-proxy",
+					ServiceAddress: "4.4.4.4",
+				},
+			},
+		},
+		{
+			name:          "Endpoints has additional address not in Consul.",
+			consulSvcName: "service-updated",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod2 := createPod("pod2", "2.2.3.4", true)
+				endpointWithTwoAddresses := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+								{
+									IP:       "2.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod2",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, pod2, endpointWithTwoAddresses}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "1.2.3.4",
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod1-service-updated",
+					},
+				},
+			},
+			expectedNumSvcInstances: 2,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated",
+					ServiceAddress: "1.2.3.4",
+				},
+				{
+					ServiceID:      "pod2-service-updated",
+					ServiceAddress: "2.2.3.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+				},
+				{
+					ServiceID:      "pod2-service-updated-sidecar-proxy",
+					ServiceAddress: "2.2.3.4",
+				},
+			},
+			expectedAgentHealthChecks: []*api.AgentCheck{
+				{
+					CheckID:     "default/pod1-service-updated/kubernetes-health-check",
+					ServiceName: "service-updated",
+					ServiceID:   "pod1-service-updated",
+					Name:        "Kubernetes Health Check",
+					Status:      api.HealthCritical,
+					Output:      testFailureMessage,
+					Type:        ttl,
+				},
+				{
+					CheckID:     "default/pod2-service-updated/kubernetes-health-check",
+					ServiceName: "service-updated",
+					ServiceID:   "pod2-service-updated",
+					Name:        "Kubernetes Health Check",
+					Status:      api.HealthCritical,
+					Output:      testFailureMessage,
+					Type:        ttl,
+				},
+			},
+		},
+		{
+			name:          "Consul has instances that are not in the Endpoints addresses.",
+			consulSvcName: "service-updated",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "1.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod1-service-updated",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					ID:      "pod2-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "2.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod2-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "2.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod2-service-updated",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+			},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-service-updated-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+		},
+		{
+			name:          "Different Consul service name: Consul has instances that are not in the Endpoints addresses.",
+			consulSvcName: "different-consul-svc-name",
+			k8sObjects: func() []runtime.Object {
+				pod1 := createPod("pod1", "1.2.3.4", true)
+				pod1.Annotations[annotationService] = "different-consul-svc-name"
+				endpoint := &corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "service-updated",
+						Namespace: "default",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									IP:       "1.2.3.4",
+									NodeName: &nodeName,
+									TargetRef: &corev1.ObjectReference{
+										Kind:      "Pod",
+										Name:      "pod1",
+										Namespace: "default",
+									},
+								},
+							},
+						},
+					},
+				}
+				return []runtime.Object{pod1, endpoint}
+			},
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-different-consul-svc-name",
+					Name:    "different-consul-svc-name",
+					Port:    80,
+					Address: "1.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
+					Name:    "different-consul-svc-name-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "different-consul-svc-name",
+						DestinationServiceID:   "pod1-different-consul-svc-name",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					ID:      "pod2-different-consul-svc-name",
+					Name:    "different-consul-svc-name",
+					Port:    80,
+					Address: "2.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod2-different-consul-svc-name-sidecar-proxy",
+					Name:    "different-consul-svc-name-sidecar-proxy",
+					Port:    20000,
+					Address: "2.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "different-consul-svc-name",
+						DestinationServiceID:   "pod2-different-consul-svc-name",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+			},
+			expectedNumSvcInstances: 1,
+			expectedConsulSvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-different-consul-svc-name",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+			expectedProxySvcInstances: []*api.CatalogService{
+				{
+					ServiceID:      "pod1-different-consul-svc-name-sidecar-proxy",
+					ServiceAddress: "1.2.3.4",
+				},
+			},
+		},
+		{
+			// When a k8s deployment is deleted but it's k8s service continues to exist, the endpoints has no addresses
+			// and the instances should be deleted from Consul.
+			name:          "Consul has instances that are not in the endpoints, and the endpoints has no addresses.",
+			consulSvcName: "service-updated",
 			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "1.2.3.4", true)
-				pod1.Status.Conditions = []corev1.PodCondition{{
-					Type:   corev1.PodReady,
-					Status: corev1.ConditionTrue,
-				}}
 				endpoint := &corev1.Endpoints{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "service-updated",
 						Namespace: "default",
 					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									IP:       "1.2.3.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
-								},
-							},
-						},
-					},
 				}
-				return []runtime.Object{pod1, endpoint}
+				return []runtime.Object{endpoint}
 			},
 			initialConsulSvcs: []*api.AgentServiceRegistration{
 				{
@@ -960,14 +2686,7 @@ func TestReconcileUpdateEndpoint(t *testing.T) {
 					Name:    "service-updated",
 					Port:    80,
 					Address: "1.2.3.4",
-					Check: &api.AgentServiceCheck{
-						CheckID:                "default/pod1-service-updated/kubernetes-health-check",
-						Name:                   "Kubernetes Health Check",
-						TTL:                    "100000h",
-						Status:                 "passing",
-						SuccessBeforePassing:   1,
-						FailuresBeforeCritical: 1,
-					},
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 				{
 					Kind:    api.ServiceKindConnectProxy,
@@ -979,1920 +2698,2783 @@ func TestReconcileUpdateEndpoint(t *testing.T) {
 						DestinationServiceName: "service-updated",
 						DestinationServiceID:   "pod1-service-updated",
 					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
-			},
-			expectedNumSvcInstances: 1,
-			expectedConsulSvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated",
-					ServiceAddress: "1.2.3.4",
-				},
-			},
-			expectedProxySvcInstances: []*api.CatalogService{
 				{
-					ServiceID:      "pod1-service-updated-sidecar-proxy",
-					ServiceAddress: "1.2.3.4",
+					ID:      "pod2-service-updated",
+					Name:    "service-updated",
+					Port:    80,
+					Address: "2.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
-			},
-			expectedAgentHealthChecks: []*api.AgentCheck{
 				{
-					CheckID:     "default/pod1-service-updated/kubernetes-health-check",
-					ServiceName: "service-updated",
-					ServiceID:   "pod1-service-updated",
-					Name:        "Kubernetes Health Check",
-					Status:      api.HealthPassing,
-					Output:      kubernetesSuccessReasonMsg,
-					Type:        ttl,
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod2-service-updated-sidecar-proxy",
+					Name:    "service-updated-sidecar-proxy",
+					Port:    20000,
+					Address: "2.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-updated",
+						DestinationServiceID:   "pod2-service-updated",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 			},
+			expectedNumSvcInstances:    0,
+			expectedConsulSvcInstances: []*api.CatalogService{},
+			expectedProxySvcInstances:  []*api.CatalogService{},
 		},
 		{
-			name:          "Endpoints has an updated address because health check changes from healthy to unhealthy",
-			consulSvcName: "service-updated",
+			// With a different Consul service name, when a k8s deployment is deleted but it's k8s service continues to
+			// exist, the endpoints has no addresses and the instances should be deleted from Consul.
+			name:          "Different Consul service name: Consul has instances that are not in the endpoints, and the endpoints has no addresses.",
+			consulSvcName: "different-consul-svc-name",
 			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "1.2.3.4", true)
 				endpoint := &corev1.Endpoints{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      "service-updated",
 						Namespace: "default",
 					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									IP:       "1.2.3.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
-								},
-							},
-						},
-					},
 				}
-				return []runtime.Object{pod1, endpoint}
+				return []runtime.Object{endpoint}
 			},
 			initialConsulSvcs: []*api.AgentServiceRegistration{
 				{
-					ID:      "pod1-service-updated",
-					Name:    "service-updated",
+					ID:      "pod1-different-consul-svc-name",
+					Name:    "different-consul-svc-name",
 					Port:    80,
 					Address: "1.2.3.4",
-					Check: &api.AgentServiceCheck{
-						CheckID:                "default/pod1-service-updated/kubernetes-health-check",
-						Name:                   "Kubernetes Health Check",
-						TTL:                    "100000h",
-						Status:                 "passing",
-						SuccessBeforePassing:   1,
-						FailuresBeforeCritical: 1,
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
+					Name:    "different-consul-svc-name-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "different-consul-svc-name",
+						DestinationServiceID:   "pod1-different-consul-svc-name",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					ID:      "pod2-different-consul-svc-name",
+					Name:    "different-consul-svc-name",
+					Port:    80,
+					Address: "2.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod2-different-consul-svc-name-sidecar-proxy",
+					Name:    "different-consul-svc-name-sidecar-proxy",
+					Port:    20000,
+					Address: "2.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "different-consul-svc-name",
+						DestinationServiceID:   "pod2-different-consul-svc-name",
+					},
+					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+				},
+			},
+			expectedNumSvcInstances:    0,
+			expectedConsulSvcInstances: []*api.CatalogService{},
+			expectedProxySvcInstances:  []*api.CatalogService{},
+		},
+	}
+	// Each test is run with ACLs+TLS (secure) enabled and disabled.
+	for _, secure := range []bool{true, false} {
+		for _, tt := range cases {
+			t.Run(fmt.Sprintf("%s - secure: %v", tt.name, secure), func(t *testing.T) {
+				ep, consulClient := newSecureTestEndpointsController(t, secure, tt.k8sObjects()...)
+
+				// Register service and proxy in consul
+				for _, svc := range tt.initialConsulSvcs {
+					err := consulClient.Agent().ServiceRegister(svc)
+					require.NoError(t, err)
+				}
+
+				namespacedName := types.NamespacedName{
+					Namespace: "default",
+					Name:      "service-updated",
+				}
+
+				resp, err := ep.Reconcile(context.Background(), ctrl.Request{
+					NamespacedName: namespacedName,
+				})
+				require.NoError(t, err)
+				require.False(t, resp.Requeue)
+
+				// After reconciliation, Consul should have service-updated with the correct number of instances
+				serviceInstances, _, err := consulClient.Catalog().Service(tt.consulSvcName, "", nil)
+				require.NoError(t, err)
+				require.Len(t, serviceInstances, tt.expectedNumSvcInstances)
+				for i, instance := range serviceInstances {
+					require.Equal(t, tt.expectedConsulSvcInstances[i].ServiceID, instance.ServiceID)
+					require.Equal(t, tt.expectedConsulSvcInstances[i].ServiceAddress, instance.ServiceAddress)
+				}
+				proxyServiceInstances, _, err := consulClient.Catalog().Service(fmt.Sprintf("%s-sidecar-proxy", tt.consulSvcName), "", nil)
+				require.NoError(t, err)
+				require.Len(t, proxyServiceInstances, tt.expectedNumSvcInstances)
+				for i, instance := range proxyServiceInstances {
+					require.Equal(t, tt.expectedProxySvcInstances[i].ServiceID, instance.ServiceID)
+					require.Equal(t, tt.expectedProxySvcInstances[i].ServiceAddress, instance.ServiceAddress)
+				}
+				// Check that the Consul health check was created for the k8s pod.
+				if tt.expectedAgentHealthChecks != nil {
+					for i, _ := range tt.expectedConsulSvcInstances {
+						filter := fmt.Sprintf("CheckID == `%s`", tt.expectedAgentHealthChecks[i].CheckID)
+						check, err := consulClient.Agent().ChecksWithFilter(filter)
+						require.NoError(t, err)
+						require.EqualValues(t, len(check), 1)
+						// Ignoring Namespace because the response from ENT includes it and OSS does not.
+						var ignoredFields = []string{"Node", "Definition", "Namespace"}
+						require.True(t, cmp.Equal(check[tt.expectedAgentHealthChecks[i].CheckID], tt.expectedAgentHealthChecks[i], cmpopts.IgnoreFields(api.AgentCheck{}, ignoredFields...)))
+					}
+				}
+			})
+		}
+	}
+}
+
+// Tests deleting an Endpoints object, with and without matching Consul and K8s service names.
+// This test covers EndpointsController.deregisterServiceOnAllAgents when the map is nil (not selectively deregistered).
+func TestReconcileDeleteEndpoint(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name              string
+		consulSvcName     string
+		initialConsulSvcs []*api.AgentServiceRegistration
+	}{
+		{
+			name:          "Consul service name matches K8s service name",
+			consulSvcName: "service-deleted",
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-service-deleted",
+					Name:    "service-deleted",
+					Port:    80,
+					Address: "1.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
+				},
+				{
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "pod1-service-deleted-sidecar-proxy",
+					Name:    "service-deleted-sidecar-proxy",
+					Port:    20000,
+					Address: "1.2.3.4",
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "service-deleted",
+						DestinationServiceID:   "pod1-service-deleted",
 					},
+					Meta: map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
+				},
+			},
+		},
+		{
+			name:          "Consul service name does not match K8s service name",
+			consulSvcName: "different-consul-svc-name",
+			initialConsulSvcs: []*api.AgentServiceRegistration{
+				{
+					ID:      "pod1-different-consul-svc-name",
+					Name:    "different-consul-svc-name",
+					Port:    80,
+					Address: "1.2.3.4",
+					Meta:    map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
 				},
 				{
 					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
+					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
+					Name:    "different-consul-svc-name-sidecar-proxy",
 					Port:    20000,
 					Address: "1.2.3.4",
 					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod1-service-updated",
+						DestinationServiceName: "different-consul-svc-name",
+						DestinationServiceID:   "pod1-different-consul-svc-name",
 					},
+					Meta: map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
 				},
 			},
-			expectedNumSvcInstances: 1,
-			expectedConsulSvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated",
-					ServiceAddress: "1.2.3.4",
+		},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			ep, consulClient := newTestEndpointsController(t)
+
+			// Register service and proxy in consul
+			for _, svc := range tt.initialConsulSvcs {
+				err := consulClient.Agent().ServiceRegister(svc)
+				require.NoError(t, err)
+			}
+
+			// Set up the Endpoint that will be reconciled, and reconcile
+			namespacedName := types.NamespacedName{
+				Namespace: "default",
+				Name:      "service-deleted",
+			}
+			resp, err := ep.Reconcile(context.Background(), ctrl.Request{
+				NamespacedName: namespacedName,
+			})
+			require.NoError(t, err)
+			require.False(t, resp.Requeue)
+
+			// After reconciliation, Consul should not have any instances of service-deleted
+			serviceInstances, _, err := consulClient.Catalog().Service(tt.consulSvcName, "", nil)
+			require.NoError(t, err)
+			require.Empty(t, serviceInstances)
+			proxyServiceInstances, _, err := consulClient.Catalog().Service(fmt.Sprintf("%s-sidecar-proxy", tt.consulSvcName), "", nil)
+			require.NoError(t, err)
+			require.Empty(t, proxyServiceInstances)
+
+		})
+	}
+}
+
+// TestReconcileDeleteEndpoint_DeregistersProxiesFirst tests that sidecar proxies are deregistered
+// before the services they proxy, using an agent stub that records deregistrations.
+func TestReconcileDeleteEndpoint_DeregistersProxiesFirst(t *testing.T) {
+	t.Parallel()
+	meta := map[string]string{MetaKeyKubeServiceName: "service-deleted", MetaKeyKubeNS: "default"}
+	services := map[string]*api.AgentService{
+		"pod1-service-deleted":               {ID: "pod1-service-deleted", Service: "service-deleted", Meta: meta},
+		"pod1-service-deleted-sidecar-proxy": {ID: "pod1-service-deleted-sidecar-proxy", Service: "service-deleted-sidecar-proxy", Kind: api.ServiceKindConnectProxy, Meta: meta},
+		"pod2-service-deleted":               {ID: "pod2-service-deleted", Service: "service-deleted", Meta: meta},
+		"pod2-service-deleted-sidecar-proxy": {ID: "pod2-service-deleted-sidecar-proxy", Service: "service-deleted-sidecar-proxy", Kind: api.ServiceKindConnectProxy, Meta: meta},
+	}
+	var deregistered []string
+	consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/agent/services":
+			require.NoError(t, json.NewEncoder(w).Encode(services))
+		case r.Method == http.MethodPut && strings.HasPrefix(r.URL.Path, "/v1/agent/service/deregister/"):
+			deregistered = append(deregistered, strings.TrimPrefix(r.URL.Path, "/v1/agent/service/deregister/"))
+		case r.Method == http.MethodGet && (r.URL.Path == "/v1/config/service-splitter" || r.URL.Path == "/v1/config/service-defaults"):
+			require.NoError(t, json.NewEncoder(w).Encode([]interface{}{}))
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/catalog/node-services/"+placeholderNodeName:
+			w.Write([]byte("null"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer consulServer.Close()
+	serverURL, err := url.Parse(consulServer.URL)
+	require.NoError(t, err)
+
+	// The controller talks to the agent stub rather than to the test server.
+	ep, _ := newTestEndpointsController(t)
+	ep.ConsulClientCfg = &api.Config{Address: serverURL.Host}
+	ep.ConsulClient, err = api.NewClient(ep.ConsulClientCfg)
+	require.NoError(t, err)
+	ep.ConsulPort = serverURL.Port()
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: "default", Name: "service-deleted"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"pod1-service-deleted-sidecar-proxy",
+		"pod2-service-deleted-sidecar-proxy",
+		"pod1-service-deleted",
+		"pod2-service-deleted",
+	}, deregistered)
+}
+
+func TestFilterAgentPods(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		object   client.Object
+		expected bool
+	}{
+		"label[app]=consul label[component]=client label[release] consul": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":       "consul",
+						"component": "client",
+						"release":   "consul",
+					},
 				},
 			},
-			expectedProxySvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated-sidecar-proxy",
-					ServiceAddress: "1.2.3.4",
+			expected: true,
+		},
+		"no labels": {
+			object:   &corev1.Pod{},
+			expected: false,
+		},
+		"label[app] empty": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"component": "client",
+						"release":   "consul",
+					},
 				},
 			},
-			expectedAgentHealthChecks: []*api.AgentCheck{
-				{
-					CheckID:     "default/pod1-service-updated/kubernetes-health-check",
-					ServiceName: "service-updated",
-					ServiceID:   "pod1-service-updated",
-					Name:        "Kubernetes Health Check",
-					Status:      api.HealthCritical,
-					Output:      testFailureMessage,
-					Type:        ttl,
+			expected: false,
+		},
+		"label[component] empty": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":     "consul",
+						"release": "consul",
+					},
 				},
 			},
+			expected: false,
 		},
-		{
-			name:          "Endpoints has an updated address (pod IP change).",
-			consulSvcName: "service-updated",
-			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "4.4.4.4", true)
-				endpoint := &corev1.Endpoints{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									IP:       "4.4.4.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
-								},
-							},
-						},
+		"label[release] empty": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":       "consul",
+						"component": "client",
 					},
-				}
-				return []runtime.Object{pod1, endpoint}
+				},
 			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-service-updated",
-					Name:    "service-updated",
-					Port:    80,
-					Address: "1.2.3.4",
+			expected: false,
+		},
+		"label[app]!=consul label[component]=client label[release]=consul": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":       "not-consul",
+						"component": "client",
+						"release":   "consul",
+					},
 				},
-				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod1-service-updated",
+			},
+			expected: false,
+		},
+		"label[component]!=client label[app]=consul label[release]=consul": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":       "consul",
+						"component": "not-client",
+						"release":   "consul",
 					},
 				},
 			},
-			expectedNumSvcInstances: 1,
-			expectedConsulSvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated",
-					ServiceAddress: "4.4.4.4",
+			expected: false,
+		},
+		"label[release]!=consul label[app]=consul label[component]=client": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":       "consul",
+						"component": "client",
+						"release":   "not-consul",
+					},
 				},
 			},
-			expectedProxySvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated-sidecar-proxy",
-					ServiceAddress: "4.4.4.4",
+			expected: false,
+		},
+		"label[app]!=consul label[component]!=client label[release]!=consul": {
+			object: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app":       "not-consul",
+						"component": "not-client",
+						"release":   "not-consul",
+					},
 				},
 			},
+			expected: false,
 		},
-		{
-			name:          "Different Consul service name: Endpoints has an updated address (pod IP change).",
-			consulSvcName: "different-consul-svc-name",
-			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "4.4.4.4", true)
-				pod1.Annotations[annotationService] = "different-consul-svc-name"
-				endpoint := &corev1.Endpoints{
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			controller := EndpointsController{
+				ReleaseName: "consul",
+			}
+
+			result := controller.filterAgentPods(test.object)
+			require.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestRequestsForRunningAgentPods(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		agentPod          *corev1.Pod
+		existingEndpoints []*corev1.Endpoints
+		expectedRequests  []ctrl.Request
+	}{
+		"pod=running, all endpoints need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+					Phase: corev1.PodRunning,
+				},
+			},
+			existingEndpoints: []*corev1.Endpoints{
+				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
+						Name: "endpoint-1",
 					},
 					Subsets: []corev1.EndpointSubset{
 						{
 							Addresses: []corev1.EndpointAddress{
 								{
-									IP:       "4.4.4.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-bar"),
 								},
 							},
 						},
 					},
-				}
-				return []runtime.Object{pod1, endpoint}
-			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-different-consul-svc-name",
-					Name:    "different-consul-svc-name",
-					Port:    80,
-					Address: "1.2.3.4",
 				},
+			},
+			expectedRequests: []ctrl.Request{
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
-					Name:    "different-consul-svc-name-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "different-consul-svc-name",
-						DestinationServiceID:   "pod1-different-consul-svc-name",
+					NamespacedName: types.NamespacedName{
+						Name: "endpoint-1",
 					},
 				},
 			},
-			expectedNumSvcInstances: 1,
-			expectedConsulSvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-different-consul-svc-name",
-					ServiceAddress: "4.4.4.4",
+		},
+		"pod=running, endpoints with ready address need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
 				},
-			},
-			expectedProxySvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-different-consul-svc-name-sidecar-proxy",
-					ServiceAddress: "4.4.4.4",
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+					Phase: corev1.PodRunning,
 				},
 			},
-		},
-		{
-			name:          "Endpoints has additional address not in Consul.",
-			consulSvcName: "service-updated",
-			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "1.2.3.4", true)
-				pod2 := createPod("pod2", "2.2.3.4", true)
-				endpointWithTwoAddresses := &corev1.Endpoints{
+			existingEndpoints: []*corev1.Endpoints{
+				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
+						Name: "endpoint-1",
 					},
 					Subsets: []corev1.EndpointSubset{
 						{
 							Addresses: []corev1.EndpointAddress{
 								{
-									IP:       "1.2.3.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
-								},
-								{
-									IP:       "2.2.3.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod2",
-										Namespace: "default",
-									},
+									NodeName: toStringPtr("node-foo"),
 								},
 							},
 						},
 					},
-				}
-				return []runtime.Object{pod1, pod2, endpointWithTwoAddresses}
-			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-service-updated",
-					Name:    "service-updated",
-					Port:    80,
-					Address: "1.2.3.4",
 				},
+			},
+			expectedRequests: []ctrl.Request{
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod1-service-updated",
+					NamespacedName: types.NamespacedName{
+						Name: "endpoint-1",
 					},
 				},
 			},
-			expectedNumSvcInstances: 2,
-			expectedConsulSvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated",
-					ServiceAddress: "1.2.3.4",
-				},
-				{
-					ServiceID:      "pod2-service-updated",
-					ServiceAddress: "2.2.3.4",
+		},
+		"pod=running, endpoints with not-ready address need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
 				},
-			},
-			expectedProxySvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated-sidecar-proxy",
-					ServiceAddress: "1.2.3.4",
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
 				},
-				{
-					ServiceID:      "pod2-service-updated-sidecar-proxy",
-					ServiceAddress: "2.2.3.4",
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+					Phase: corev1.PodRunning,
 				},
 			},
-			expectedAgentHealthChecks: []*api.AgentCheck{
-				{
-					CheckID:     "default/pod1-service-updated/kubernetes-health-check",
-					ServiceName: "service-updated",
-					ServiceID:   "pod1-service-updated",
-					Name:        "Kubernetes Health Check",
-					Status:      api.HealthCritical,
-					Output:      testFailureMessage,
-					Type:        ttl,
-				},
+			existingEndpoints: []*corev1.Endpoints{
 				{
-					CheckID:     "default/pod2-service-updated/kubernetes-health-check",
-					ServiceName: "service-updated",
-					ServiceID:   "pod2-service-updated",
-					Name:        "Kubernetes Health Check",
-					Status:      api.HealthCritical,
-					Output:      testFailureMessage,
-					Type:        ttl,
-				},
-			},
-		},
-		{
-			name:          "Consul has instances that are not in the Endpoints addresses.",
-			consulSvcName: "service-updated",
-			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "1.2.3.4", true)
-				endpoint := &corev1.Endpoints{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
+						Name: "endpoint-1",
 					},
 					Subsets: []corev1.EndpointSubset{
 						{
-							Addresses: []corev1.EndpointAddress{
+							NotReadyAddresses: []corev1.EndpointAddress{
 								{
-									IP:       "1.2.3.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
+									NodeName: toStringPtr("node-foo"),
 								},
 							},
 						},
 					},
-				}
-				return []runtime.Object{pod1, endpoint}
-			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-service-updated",
-					Name:    "service-updated",
-					Port:    80,
-					Address: "1.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
-				},
-				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod1-service-updated",
-					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
-				},
-				{
-					ID:      "pod2-service-updated",
-					Name:    "service-updated",
-					Port:    80,
-					Address: "2.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
+			},
+			expectedRequests: []ctrl.Request{
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod2-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
-					Port:    20000,
-					Address: "2.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod2-service-updated",
+					NamespacedName: types.NamespacedName{
+						Name: "endpoint-1",
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 			},
-			expectedNumSvcInstances: 1,
-			expectedConsulSvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated",
-					ServiceAddress: "1.2.3.4",
+		},
+		"pod=running, some endpoints need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
 				},
-			},
-			expectedProxySvcInstances: []*api.CatalogService{
-				{
-					ServiceID:      "pod1-service-updated-sidecar-proxy",
-					ServiceAddress: "1.2.3.4",
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+					Phase: corev1.PodRunning,
 				},
 			},
-		},
-		{
-			name:          "Different Consul service name: Consul has instances that are not in the Endpoints addresses.",
-			consulSvcName: "different-consul-svc-name",
-			k8sObjects: func() []runtime.Object {
-				pod1 := createPod("pod1", "1.2.3.4", true)
-				pod1.Annotations[annotationService] = "different-consul-svc-name"
-				endpoint := &corev1.Endpoints{
+			existingEndpoints: []*corev1.Endpoints{
+				{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
+						Name: "endpoint-1",
 					},
 					Subsets: []corev1.EndpointSubset{
 						{
 							Addresses: []corev1.EndpointAddress{
 								{
-									IP:       "1.2.3.4",
-									NodeName: &nodeName,
-									TargetRef: &corev1.ObjectReference{
-										Kind:      "Pod",
-										Name:      "pod1",
-										Namespace: "default",
-									},
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-bar"),
 								},
 							},
 						},
 					},
-				}
-				return []runtime.Object{pod1, endpoint}
-			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-different-consul-svc-name",
-					Name:    "different-consul-svc-name",
-					Port:    80,
-					Address: "1.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
-					Name:    "different-consul-svc-name-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "different-consul-svc-name",
-						DestinationServiceID:   "pod1-different-consul-svc-name",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-2",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-other"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-baz"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
-				},
-				{
-					ID:      "pod2-different-consul-svc-name",
-					Name:    "different-consul-svc-name",
-					Port:    80,
-					Address: "2.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod2-different-consul-svc-name-sidecar-proxy",
-					Name:    "different-consul-svc-name-sidecar-proxy",
-					Port:    20000,
-					Address: "2.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "different-consul-svc-name",
-						DestinationServiceID:   "pod2-different-consul-svc-name",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-3",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-baz"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 			},
-			expectedNumSvcInstances: 1,
-			expectedConsulSvcInstances: []*api.CatalogService{
+			expectedRequests: []ctrl.Request{
 				{
-					ServiceID:      "pod1-different-consul-svc-name",
-					ServiceAddress: "1.2.3.4",
+					NamespacedName: types.NamespacedName{
+						Name: "endpoint-1",
+					},
 				},
-			},
-			expectedProxySvcInstances: []*api.CatalogService{
 				{
-					ServiceID:      "pod1-different-consul-svc-name-sidecar-proxy",
-					ServiceAddress: "1.2.3.4",
+					NamespacedName: types.NamespacedName{
+						Name: "endpoint-3",
+					},
 				},
 			},
 		},
-		{
-			// When a k8s deployment is deleted but it's k8s service continues to exist, the endpoints has no addresses
-			// and the instances should be deleted from Consul.
-			name:          "Consul has instances that are not in the endpoints, and the endpoints has no addresses.",
-			consulSvcName: "service-updated",
-			k8sObjects: func() []runtime.Object {
-				endpoint := &corev1.Endpoints{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
+		"pod=running, no endpoints need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
 					},
-				}
-				return []runtime.Object{endpoint}
-			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-service-updated",
-					Name:    "service-updated",
-					Port:    80,
-					Address: "1.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+					Phase: corev1.PodRunning,
 				},
+			},
+			existingEndpoints: []*corev1.Endpoints{
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod1-service-updated",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-1",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-baz"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-bar"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 				{
-					ID:      "pod2-service-updated",
-					Name:    "service-updated",
-					Port:    80,
-					Address: "2.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-2",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-bar"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-baz"),
+								},
+							},
+						},
+					},
 				},
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod2-service-updated-sidecar-proxy",
-					Name:    "service-updated-sidecar-proxy",
-					Port:    20000,
-					Address: "2.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-updated",
-						DestinationServiceID:   "pod2-service-updated",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-3",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-bar"),
+								},
+							},
+							NotReadyAddresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-baz"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 			},
-			expectedNumSvcInstances:    0,
-			expectedConsulSvcInstances: []*api.CatalogService{},
-			expectedProxySvcInstances:  []*api.CatalogService{},
+			expectedRequests: []ctrl.Request{},
 		},
-		{
-			// With a different Consul service name, when a k8s deployment is deleted but it's k8s service continues to
-			// exist, the endpoints has no addresses and the instances should be deleted from Consul.
-			name:          "Different Consul service name: Consul has instances that are not in the endpoints, and the endpoints has no addresses.",
-			consulSvcName: "different-consul-svc-name",
-			k8sObjects: func() []runtime.Object {
-				endpoint := &corev1.Endpoints{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "service-updated",
-						Namespace: "default",
-					},
-				}
-				return []runtime.Object{endpoint}
-			},
-			initialConsulSvcs: []*api.AgentServiceRegistration{
-				{
-					ID:      "pod1-different-consul-svc-name",
-					Name:    "different-consul-svc-name",
-					Port:    80,
-					Address: "1.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
-				},
-				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
-					Name:    "different-consul-svc-name-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "different-consul-svc-name",
-						DestinationServiceID:   "pod1-different-consul-svc-name",
+		"pod not ready, no endpoints need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionFalse,
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+					Phase: corev1.PodRunning,
 				},
+			},
+			existingEndpoints: []*corev1.Endpoints{
 				{
-					ID:      "pod2-different-consul-svc-name",
-					Name:    "different-consul-svc-name",
-					Port:    80,
-					Address: "2.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-1",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+						},
+					},
 				},
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod2-different-consul-svc-name-sidecar-proxy",
-					Name:    "different-consul-svc-name-sidecar-proxy",
-					Port:    20000,
-					Address: "2.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "different-consul-svc-name",
-						DestinationServiceID:   "pod2-different-consul-svc-name",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-3",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-updated", "k8s-namespace": "default"},
 				},
 			},
-			expectedNumSvcInstances:    0,
-			expectedConsulSvcInstances: []*api.CatalogService{},
-			expectedProxySvcInstances:  []*api.CatalogService{},
+			expectedRequests: []ctrl.Request{},
 		},
-	}
-	// Each test is run with ACLs+TLS (secure) enabled and disabled.
-	for _, secure := range []bool{true, false} {
-		for _, tt := range cases {
-			t.Run(fmt.Sprintf("%s - secure: %v", tt.name, secure), func(t *testing.T) {
-				// The agent pod needs to have the address 127.0.0.1 so when the
-				// code gets the agent pods via the label component=client, and
-				// makes requests against the agent API, it will actually hit the
-				// test server we have on localhost.
-				fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
-				fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
-
-				// Create fake k8s client
-				k8sObjects := append(tt.k8sObjects(), fakeClientPod)
-				fakeClient := fake.NewClientBuilder().WithRuntimeObjects(k8sObjects...).Build()
-
-				masterToken := "b78d37c7-0ca7-5f4d-99ee-6d9975ce4586"
-				caFile, certFile, keyFile := common.GenerateServerCerts(t)
-				// Create test consul server, with ACLs+TLS if necessary
-				consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
-					if secure {
-						c.ACL.Enabled = true
-						c.ACL.DefaultPolicy = "deny"
-						c.ACL.Tokens.Master = masterToken
-						c.CAFile = caFile
-						c.CertFile = certFile
-						c.KeyFile = keyFile
-					}
-					c.NodeName = nodeName
-				})
-				require.NoError(t, err)
-				defer consul.Stop()
-				consul.WaitForServiceIntentions(t)
-				addr := strings.Split(consul.HTTPAddr, ":")
-				consulPort := addr[1]
-
-				cfg := &api.Config{
-					Scheme:  "http",
-					Address: consul.HTTPAddr,
-				}
-				if secure {
-					consulPort = strings.Split(consul.HTTPSAddr, ":")[1]
-					cfg.Address = consul.HTTPSAddr
-					cfg.Scheme = "https"
-					cfg.TLSConfig = api.TLSConfig{
-						CAFile: caFile,
-					}
-					cfg.Token = masterToken
-				}
-				consulClient, err := api.NewClient(cfg)
-				require.NoError(t, err)
-
-				// Register service and proxy in consul
-				for _, svc := range tt.initialConsulSvcs {
-					err = consulClient.Agent().ServiceRegister(svc)
-					require.NoError(t, err)
-				}
-
-				// Create the endpoints controller
-				ep := &EndpointsController{
-					Client:                fakeClient,
-					Log:                   logrtest.TestLogger{T: t},
-					ConsulClient:          consulClient,
-					ConsulPort:            consulPort,
-					ConsulScheme:          cfg.Scheme,
-					AllowK8sNamespacesSet: mapset.NewSetWith("*"),
-					DenyK8sNamespacesSet:  mapset.NewSetWith(),
-					ReleaseName:           "consul",
-					ReleaseNamespace:      "default",
-					ConsulClientCfg:       cfg,
-				}
-				namespacedName := types.NamespacedName{
-					Namespace: "default",
-					Name:      "service-updated",
-				}
-
-				resp, err := ep.Reconcile(context.Background(), ctrl.Request{
-					NamespacedName: namespacedName,
-				})
-				require.NoError(t, err)
-				require.False(t, resp.Requeue)
-
-				// After reconciliation, Consul should have service-updated with the correct number of instances
-				serviceInstances, _, err := consulClient.Catalog().Service(tt.consulSvcName, "", nil)
-				require.NoError(t, err)
-				require.Len(t, serviceInstances, tt.expectedNumSvcInstances)
-				for i, instance := range serviceInstances {
-					require.Equal(t, tt.expectedConsulSvcInstances[i].ServiceID, instance.ServiceID)
-					require.Equal(t, tt.expectedConsulSvcInstances[i].ServiceAddress, instance.ServiceAddress)
-				}
-				proxyServiceInstances, _, err := consulClient.Catalog().Service(fmt.Sprintf("%s-sidecar-proxy", tt.consulSvcName), "", nil)
-				require.NoError(t, err)
-				require.Len(t, proxyServiceInstances, tt.expectedNumSvcInstances)
-				for i, instance := range proxyServiceInstances {
-					require.Equal(t, tt.expectedProxySvcInstances[i].ServiceID, instance.ServiceID)
-					require.Equal(t, tt.expectedProxySvcInstances[i].ServiceAddress, instance.ServiceAddress)
-				}
-				// Check that the Consul health check was created for the k8s pod.
-				if tt.expectedAgentHealthChecks != nil {
-					for i, _ := range tt.expectedConsulSvcInstances {
-						filter := fmt.Sprintf("CheckID == `%s`", tt.expectedAgentHealthChecks[i].CheckID)
-						check, err := consulClient.Agent().ChecksWithFilter(filter)
-						require.NoError(t, err)
-						require.EqualValues(t, len(check), 1)
-						// Ignoring Namespace because the response from ENT includes it and OSS does not.
-						var ignoredFields = []string{"Node", "Definition", "Namespace"}
-						require.True(t, cmp.Equal(check[tt.expectedAgentHealthChecks[i].CheckID], tt.expectedAgentHealthChecks[i], cmpopts.IgnoreFields(api.AgentCheck{}, ignoredFields...)))
-					}
-				}
-			})
-		}
-	}
-}
-
-// Tests deleting an Endpoints object, with and without matching Consul and K8s service names.
-// This test covers EndpointsController.deregisterServiceOnAllAgents when the map is nil (not selectively deregistered).
-func TestReconcileDeleteEndpoint(t *testing.T) {
-	t.Parallel()
-	nodeName := "test-node"
-	cases := []struct {
-		name              string
-		consulSvcName     string
-		initialConsulSvcs []*api.AgentServiceRegistration
-	}{
-		{
-			name:          "Consul service name matches K8s service name",
-			consulSvcName: "service-deleted",
-			initialConsulSvcs: []*api.AgentServiceRegistration{
+		"pod not running, no endpoints need to be reconciled": {
+			agentPod: &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "consul-agent",
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "node-foo",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{
+						{
+							Type:   corev1.PodReady,
+							Status: corev1.ConditionTrue,
+						},
+					},
+					Phase: corev1.PodUnknown,
+				},
+			},
+			existingEndpoints: []*corev1.Endpoints{
 				{
-					ID:      "pod1-service-deleted",
-					Name:    "service-deleted",
-					Port:    80,
-					Address: "1.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-1",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+						},
+					},
 				},
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-service-deleted-sidecar-proxy",
-					Name:    "service-deleted-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "service-deleted",
-						DestinationServiceID:   "pod1-service-deleted",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-3",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
 				},
 			},
+			expectedRequests: []ctrl.Request{},
 		},
-		{
-			name:          "Consul service name does not match K8s service name",
-			consulSvcName: "different-consul-svc-name",
-			initialConsulSvcs: []*api.AgentServiceRegistration{
+		"pod is deleted, no endpoints need to be reconciled": {
+			agentPod: nil,
+			existingEndpoints: []*corev1.Endpoints{
 				{
-					ID:      "pod1-different-consul-svc-name",
-					Name:    "different-consul-svc-name",
-					Port:    80,
-					Address: "1.2.3.4",
-					Meta:    map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-1",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+						},
+					},
 				},
 				{
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "pod1-different-consul-svc-name-sidecar-proxy",
-					Name:    "different-consul-svc-name-sidecar-proxy",
-					Port:    20000,
-					Address: "1.2.3.4",
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "different-consul-svc-name",
-						DestinationServiceID:   "pod1-different-consul-svc-name",
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "endpoint-3",
+					},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{
+								{
+									NodeName: toStringPtr("node-foo"),
+								},
+							},
+						},
 					},
-					Meta: map[string]string{"k8s-service-name": "service-deleted", "k8s-namespace": "default"},
 				},
 			},
+			expectedRequests: []ctrl.Request{},
 		},
 	}
-	for _, tt := range cases {
-		t.Run(tt.name, func(t *testing.T) {
-			// The agent pod needs to have the address 127.0.0.1 so when the
-			// code gets the agent pods via the label component=client, and
-			// makes requests against the agent API, it will actually hit the
-			// test server we have on localhost.
-			fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
-			fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
-
-			// Create fake k8s client
-			fakeClient := fake.NewClientBuilder().WithRuntimeObjects(fakeClientPod).Build()
-
-			// Create test consul server
-			consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
-				c.NodeName = nodeName
-			})
-			require.NoError(t, err)
-			defer consul.Stop()
 
-			consul.WaitForServiceIntentions(t)
-			cfg := &api.Config{
-				Address: consul.HTTPAddr,
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			logger := logrtest.TestLogger{T: t}
+			s := runtime.NewScheme()
+			s.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{}, &corev1.Endpoints{}, &corev1.EndpointsList{})
+			var objects []runtime.Object
+			if test.agentPod != nil {
+				objects = append(objects, test.agentPod)
+			}
+			for _, endpoint := range test.existingEndpoints {
+				objects = append(objects, endpoint)
 			}
-			consulClient, err := api.NewClient(cfg)
-			require.NoError(t, err)
-			addr := strings.Split(consul.HTTPAddr, ":")
-			consulPort := addr[1]
 
-			// Register service and proxy in consul
-			for _, svc := range tt.initialConsulSvcs {
-				err = consulClient.Agent().ServiceRegister(svc)
-				require.NoError(t, err)
-			}
+			fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objects...).Build()
 
-			// Create the endpoints controller
-			ep := &EndpointsController{
-				Client:                fakeClient,
-				Log:                   logrtest.TestLogger{T: t},
-				ConsulClient:          consulClient,
-				ConsulPort:            consulPort,
-				ConsulScheme:          "http",
-				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
-				DenyK8sNamespacesSet:  mapset.NewSetWith(),
-				ReleaseName:           "consul",
-				ReleaseNamespace:      "default",
-				ConsulClientCfg:       cfg,
+			controller := &EndpointsController{
+				Client: fakeClient,
+				Scheme: s,
+				Log:    logger,
 			}
-
-			// Set up the Endpoint that will be reconciled, and reconcile
-			namespacedName := types.NamespacedName{
-				Namespace: "default",
-				Name:      "service-deleted",
+			var requests []ctrl.Request
+			if test.agentPod != nil {
+				requests = controller.requestsForRunningAgentPods(test.agentPod)
+			} else {
+				requests = controller.requestsForRunningAgentPods(minimal())
 			}
-			resp, err := ep.Reconcile(context.Background(), ctrl.Request{
-				NamespacedName: namespacedName,
-			})
-			require.NoError(t, err)
-			require.False(t, resp.Requeue)
-
-			// After reconciliation, Consul should not have any instances of service-deleted
-			serviceInstances, _, err := consulClient.Catalog().Service(tt.consulSvcName, "", nil)
-			require.NoError(t, err)
-			require.Empty(t, serviceInstances)
-			proxyServiceInstances, _, err := consulClient.Catalog().Service(fmt.Sprintf("%s-sidecar-proxy", tt.consulSvcName), "", nil)
-			require.NoError(t, err)
-			require.Empty(t, proxyServiceInstances)
-
+			require.ElementsMatch(t, requests, test.expectedRequests)
 		})
 	}
 }
 
-func TestFilterAgentPods(t *testing.T) {
+func TestReconcileOnPodChanges(t *testing.T) {
 	t.Parallel()
+
+	podTargetRef := func(name string) *corev1.ObjectReference {
+		return &corev1.ObjectReference{Kind: "Pod", Name: name, Namespace: "default"}
+	}
 	cases := map[string]struct {
-		object   client.Object
-		expected bool
+		updatePod        func(*corev1.Pod)
+		expectedRequests []ctrl.Request
 	}{
-		"label[app]=consul label[component]=client label[release] consul": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":       "consul",
-						"component": "client",
-						"release":   "consul",
-					},
-				},
+		"annotation change": {
+			updatePod: func(pod *corev1.Pod) {
+				pod.Annotations[annotationMeta+"version"] = "2"
+			},
+			expectedRequests: []ctrl.Request{
+				{NamespacedName: types.NamespacedName{Name: "service-created", Namespace: "default"}},
 			},
-			expected: true,
 		},
-		"no labels": {
-			object:   &corev1.Pod{},
-			expected: false,
+		"label change": {
+			updatePod: func(pod *corev1.Pod) {
+				pod.Labels = map[string]string{"version": "2"}
+			},
+			expectedRequests: []ctrl.Request{
+				{NamespacedName: types.NamespacedName{Name: "service-created", Namespace: "default"}},
+			},
 		},
-		"label[app] empty": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"component": "client",
-						"release":   "consul",
-					},
-				},
+		"inject status label removed": {
+			updatePod: func(pod *corev1.Pod) {
+				delete(pod.Labels, keyInjectStatus)
+			},
+			expectedRequests: []ctrl.Request{
+				{NamespacedName: types.NamespacedName{Name: "service-created", Namespace: "default"}},
 			},
-			expected: false,
 		},
-		"label[component] empty": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":     "consul",
-						"release": "consul",
-					},
-				},
+		"status change": {
+			updatePod: func(pod *corev1.Pod) {
+				pod.Status.Phase = corev1.PodSucceeded
 			},
-			expected: false,
 		},
-		"label[release] empty": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":       "consul",
-						"component": "client",
-					},
-				},
+		"pod not injected": {
+			updatePod: func(pod *corev1.Pod) {
+				delete(pod.Annotations, keyInjectStatus)
 			},
-			expected: false,
 		},
-		"label[app]!=consul label[component]=client label[release]=consul": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":       "not-consul",
-						"component": "client",
-						"release":   "consul",
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			oldPod := createPod("pod1", "1.2.3.4", true)
+			newPod := oldPod.DeepCopy()
+			c.updatePod(newPod)
+			endpoints := []runtime.Object{
+				&corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "service-created", Namespace: "default"},
+					Subsets: []corev1.EndpointSubset{
+						{
+							NotReadyAddresses: []corev1.EndpointAddress{{IP: "1.2.3.4", TargetRef: podTargetRef("pod1")}},
+						},
 					},
 				},
-			},
-			expected: false,
-		},
-		"label[component]!=client label[app]=consul label[release]=consul": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":       "consul",
-						"component": "not-client",
-						"release":   "consul",
+				&corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "other-service", Namespace: "default"},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{{IP: "2.2.3.4", TargetRef: podTargetRef("pod2")}},
+						},
 					},
 				},
-			},
-			expected: false,
-		},
-		"label[release]!=consul label[app]=consul label[component]=client": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":       "consul",
-						"component": "client",
-						"release":   "not-consul",
+				&corev1.Endpoints{
+					ObjectMeta: metav1.ObjectMeta{Name: "service-created", Namespace: "other"},
+					Subsets: []corev1.EndpointSubset{
+						{
+							Addresses: []corev1.EndpointAddress{{IP: "3.2.3.4", TargetRef: podTargetRef("pod1")}},
+						},
 					},
 				},
-			},
-			expected: false,
+			}
+			controller := &EndpointsController{
+				Client:                fake.NewClientBuilder().WithRuntimeObjects(endpoints...).Build(),
+				Log:                   logrtest.TestLogger{T: t},
+				ReconcileOnPodChanges: true,
+			}
+
+			var requests []ctrl.Request
+			if injectedPodMetadataChanged(event.UpdateEvent{ObjectOld: oldPod, ObjectNew: newPod}) {
+				requests = controller.requestsForInjectedPod(newPod)
+			}
+			require.ElementsMatch(t, c.expectedRequests, requests)
+		})
+	}
+}
+
+func TestServiceInstancesForK8SServiceNameAndNamespace(t *testing.T) {
+	t.Parallel()
+
+	const (
+		k8sSvc = "k8s-svc"
+		k8sNS  = "k8s-ns"
+	)
+	cases := []struct {
+		name               string
+		k8sServiceNameMeta string
+		k8sNamespaceMeta   string
+		expected           map[string]*api.AgentService
+	}{
+		{
+			"no k8s service name or namespace meta",
+			"",
+			"",
+			map[string]*api.AgentService{},
 		},
-		"label[app]!=consul label[component]!=client label[release]!=consul": {
-			object: &corev1.Pod{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app":       "not-consul",
-						"component": "not-client",
-						"release":   "not-consul",
+		{
+			"k8s service name set, but no namespace meta",
+			k8sSvc,
+			"",
+			map[string]*api.AgentService{},
+		},
+		{
+			"k8s namespace set, but no k8s service name meta",
+			"",
+			k8sNS,
+			map[string]*api.AgentService{},
+		},
+		{
+			"both k8s service name and namespace set",
+			k8sSvc,
+			k8sNS,
+			map[string]*api.AgentService{
+				"foo1": {
+					ID:      "foo1",
+					Service: "foo",
+					Meta:    map[string]string{"k8s-service-name": k8sSvc, "k8s-namespace": k8sNS},
+				},
+				"foo1-proxy": {
+					Kind:    api.ServiceKindConnectProxy,
+					ID:      "foo1-proxy",
+					Service: "foo-sidecar-proxy",
+					Port:    20000,
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "foo",
+						DestinationServiceID:   "foo1",
 					},
+					Meta: map[string]string{"k8s-service-name": k8sSvc, "k8s-namespace": k8sNS},
 				},
 			},
-			expected: false,
 		},
 	}
 
-	for name, test := range cases {
-		t.Run(name, func(t *testing.T) {
-			controller := EndpointsController{
-				ReleaseName: "consul",
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			servicesInConsul := []*api.AgentServiceRegistration{
+				{
+					ID:   "foo1",
+					Name: "foo",
+					Tags: []string{},
+					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": c.k8sNamespaceMeta},
+				},
+				{
+					Kind: api.ServiceKindConnectProxy,
+					ID:   "foo1-proxy",
+					Name: "foo-sidecar-proxy",
+					Port: 20000,
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "foo",
+						DestinationServiceID:   "foo1",
+					},
+					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": c.k8sNamespaceMeta},
+				},
+				{
+					ID:   "k8s-service-different-ns-id",
+					Name: "k8s-service-different-ns",
+					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": "different-ns"},
+				},
+				{
+					Kind: api.ServiceKindConnectProxy,
+					ID:   "k8s-service-different-ns-proxy",
+					Name: "k8s-service-different-ns-proxy",
+					Port: 20000,
+					Tags: []string{},
+					Proxy: &api.AgentServiceConnectProxyConfig{
+						DestinationServiceName: "k8s-service-different-ns",
+						DestinationServiceID:   "k8s-service-different-ns-id",
+					},
+					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": "different-ns"},
+				},
+			}
+
+			consul, err := testutil.NewTestServerConfigT(t, nil)
+			require.NoError(t, err)
+			defer consul.Stop()
+
+			consul.WaitForServiceIntentions(t)
+			consulClient, err := api.NewClient(&api.Config{
+				Address: consul.HTTPAddr,
+			})
+
+			for _, svc := range servicesInConsul {
+				err := consulClient.Agent().ServiceRegister(svc)
+				require.NoError(t, err)
 			}
 
-			result := controller.filterAgentPods(test.object)
-			require.Equal(t, test.expected, result)
+			svcs, err := serviceInstancesForK8SServiceNameAndNamespace(k8sSvc, k8sNS, consulClient)
+			require.NoError(t, err)
+			if len(svcs) > 0 {
+				require.Len(t, svcs, 2)
+				require.NotNil(t, c.expected["foo1"], svcs["foo1"])
+				require.Equal(t, c.expected["foo1"].Service, svcs["foo1"].Service)
+				require.NotNil(t, c.expected["foo1-proxy"], svcs["foo1-proxy"])
+				require.Equal(t, c.expected["foo1-proxy"].Service, svcs["foo1-proxy"].Service)
+			}
 		})
 	}
 }
 
-func TestRequestsForRunningAgentPods(t *testing.T) {
+func TestEndpointsController_createServiceRegistrations_withTransparentProxy(t *testing.T) {
 	t.Parallel()
+
+	const serviceName = "test-service"
+
 	cases := map[string]struct {
-		agentPod          *corev1.Pod
-		existingEndpoints []*corev1.Endpoints
-		expectedRequests  []ctrl.Request
+		globalEnabled      bool
+		annotationEnabled  *bool
+		modeAnnotation     string
+		service            *corev1.Service
+		expTaggedAddresses map[string]api.ServiceAddress
+		proxyMode          api.ProxyMode
+		expErr             string
 	}{
-		"pod=running, all endpoints need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"enabled globally, annotation not provided": {
+			globalEnabled:     true,
+			annotationEnabled: nil,
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionTrue,
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodRunning,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-bar"),
-								},
-							},
-						},
-					},
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "10.0.0.1",
+					Port:    80,
 				},
 			},
-			expectedRequests: []ctrl.Request{
-				{
-					NamespacedName: types.NamespacedName{
-						Name: "endpoint-1",
+			expErr: "",
+		},
+		"enabled globally, annotation is false": {
+			globalEnabled:     true,
+			annotationEnabled: pointerToBool(false),
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
+						{
+							Port: 80,
+						},
 					},
 				},
 			},
+			proxyMode:          api.ProxyModeDefault,
+			expTaggedAddresses: nil,
+			expErr:             "",
 		},
-		"pod=running, endpoints with ready address need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"enabled globally, annotation is true": {
+			globalEnabled:     true,
+			annotationEnabled: pointerToBool(true),
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionTrue,
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodRunning,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "10.0.0.1",
+					Port:    80,
+				},
+			},
+			expErr: "",
+		},
+		"disabled globally, annotation not provided": {
+			globalEnabled:     false,
+			annotationEnabled: nil,
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
+							Port: 80,
 						},
 					},
 				},
 			},
-			expectedRequests: []ctrl.Request{
-				{
-					NamespacedName: types.NamespacedName{
-						Name: "endpoint-1",
+			proxyMode:          api.ProxyModeDefault,
+			expTaggedAddresses: nil,
+			expErr:             "",
+		},
+		"disabled globally, annotation is false": {
+			globalEnabled:     false,
+			annotationEnabled: pointerToBool(false),
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
+						{
+							Port: 80,
+						},
 					},
 				},
 			},
+			proxyMode:          api.ProxyModeDefault,
+			expTaggedAddresses: nil,
+			expErr:             "",
 		},
-		"pod=running, endpoints with not-ready address need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"disabled globally, annotation is true": {
+			globalEnabled:     false,
+			annotationEnabled: pointerToBool(true),
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionTrue,
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodRunning,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "10.0.0.1",
+					Port:    80,
+				},
+			},
+			expErr: "",
+		},
+		// This case is impossible since we're always passing an endpoints object to this function,
+		// and Kubernetes will ensure that there is only an endpoints object if there is a service object.
+		// However, we're testing this case to check that we return an error in case we cannot get the service from k8s.
+		"no service": {
+			globalEnabled:      true,
+			service:            nil,
+			expTaggedAddresses: nil,
+			proxyMode:          api.ProxyModeDefault,
+			expErr:             "services \"test-service\" not found",
+		},
+		"service with a single port without a name": {
+			globalEnabled: true,
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
+							Port: 80,
 						},
 					},
 				},
 			},
-			expectedRequests: []ctrl.Request{
-				{
-					NamespacedName: types.NamespacedName{
-						Name: "endpoint-1",
-					},
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "10.0.0.1",
+					Port:    80,
 				},
 			},
+			expErr: "",
 		},
-		"pod=running, some endpoints need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"service with a single port with a name": {
+			globalEnabled: true,
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionTrue,
+							Name: "tcp",
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodRunning,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-bar"),
-								},
-							},
-						},
-					},
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual-tcp": {
+					Address: "10.0.0.1",
+					Port:    80,
 				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-2",
-					},
-					Subsets: []corev1.EndpointSubset{
+			},
+			expErr: "",
+		},
+		"service with a multiple ports": {
+			globalEnabled: true,
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-other"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-baz"),
-								},
-							},
+							Name: "tcp",
+							Port: 80,
 						},
-					},
-				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-3",
-					},
-					Subsets: []corev1.EndpointSubset{
 						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-baz"),
-								},
-							},
+							Name: "http",
+							Port: 8080,
 						},
 					},
 				},
 			},
-			expectedRequests: []ctrl.Request{
-				{
-					NamespacedName: types.NamespacedName{
-						Name: "endpoint-1",
-					},
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual-tcp": {
+					Address: "10.0.0.1",
+					Port:    80,
 				},
-				{
-					NamespacedName: types.NamespacedName{
-						Name: "endpoint-3",
-					},
+				"virtual-http": {
+					Address: "10.0.0.1",
+					Port:    8080,
 				},
 			},
+			expErr: "",
 		},
-		"pod=running, no endpoints need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"service with clusterIP=None (headless service)": {
+			globalEnabled: true,
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: corev1.ClusterIPNone,
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionTrue,
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodRunning,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-baz"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-bar"),
-								},
-							},
-						},
-					},
-				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-2",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-bar"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-baz"),
-								},
-							},
-						},
-					},
+			proxyMode:          api.ProxyModeDefault,
+			expTaggedAddresses: nil,
+			expErr:             "",
+		},
+		"service with an empty clusterIP": {
+			globalEnabled: true,
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-3",
-					},
-					Subsets: []corev1.EndpointSubset{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "",
+					Ports: []corev1.ServicePort{
 						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-bar"),
-								},
-							},
-							NotReadyAddresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-baz"),
-								},
-							},
+							Port: 80,
 						},
 					},
 				},
 			},
-			expectedRequests: []ctrl.Request{},
+			proxyMode:          api.ProxyModeDefault,
+			expTaggedAddresses: nil,
+			expErr:             "",
 		},
-		"pod not ready, no endpoints need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"service with an invalid clusterIP": {
+			globalEnabled: true,
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "invalid",
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionFalse,
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodRunning,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
-						},
-					},
+			expTaggedAddresses: nil,
+			proxyMode:          api.ProxyModeDefault,
+			expErr:             "",
+		},
+		"service with an IPv6 clusterIP": {
+			globalEnabled: true,
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-3",
-					},
-					Subsets: []corev1.EndpointSubset{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "2001:db8::68",
+					Ports: []corev1.ServicePort{
 						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
+							Port: 80,
 						},
 					},
 				},
 			},
-			expectedRequests: []ctrl.Request{},
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "2001:db8::68",
+					Port:    80,
+				},
+			},
+			expErr: "",
 		},
-		"pod not running, no endpoints need to be reconciled": {
-			agentPod: &corev1.Pod{
+		"enabled globally, annotation is false, mode annotation is transparent": {
+			globalEnabled:     true,
+			annotationEnabled: pointerToBool(false),
+			modeAnnotation:    "transparent",
+			service: &corev1.Service{
 				ObjectMeta: metav1.ObjectMeta{
-					Name: "consul-agent",
-				},
-				Spec: corev1.PodSpec{
-					NodeName: "node-foo",
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				Status: corev1.PodStatus{
-					Conditions: []corev1.PodCondition{
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Type:   corev1.PodReady,
-							Status: corev1.ConditionTrue,
+							Port: 80,
 						},
 					},
-					Phase: corev1.PodUnknown,
 				},
 			},
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
-						},
-					},
+			proxyMode: api.ProxyModeTransparent,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "10.0.0.1",
+					Port:    80,
 				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-3",
-					},
-					Subsets: []corev1.EndpointSubset{
+			},
+		},
+		"enabled globally, mode annotation is direct": {
+			globalEnabled:  true,
+			modeAnnotation: "direct",
+			service: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports: []corev1.ServicePort{
 						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
+							Port: 80,
 						},
 					},
 				},
 			},
-			expectedRequests: []ctrl.Request{},
+			proxyMode: api.ProxyModeDirect,
+			expTaggedAddresses: map[string]api.ServiceAddress{
+				"virtual": {
+					Address: "10.0.0.1",
+					Port:    80,
+				},
+			},
 		},
-		"pod is deleted, no endpoints need to be reconciled": {
-			agentPod: nil,
-			existingEndpoints: []*corev1.Endpoints{
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-1",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
-								},
-							},
-						},
-					},
+		"disabled globally, mode annotation is direct": {
+			globalEnabled:      false,
+			modeAnnotation:     "direct",
+			proxyMode:          api.ProxyModeDirect,
+			expTaggedAddresses: nil,
+		},
+		"disabled globally, mode annotation is transparent": {
+			globalEnabled:  false,
+			modeAnnotation: "transparent",
+			expErr:         `consul.hashicorp.com/proxy-mode annotation cannot be "transparent" when transparent proxy is disabled`,
+		},
+		"invalid mode annotation": {
+			globalEnabled:  true,
+			modeAnnotation: "invalid",
+			expErr:         `consul.hashicorp.com/proxy-mode annotation value of "invalid" must be "direct" or "transparent"`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := createPod("test-pod-1", "1.2.3.4", false)
+			if c.annotationEnabled != nil {
+				pod.Annotations[annotationTransparentProxy] = strconv.FormatBool(*c.annotationEnabled)
+			}
+			if c.modeAnnotation != "" {
+				pod.Annotations[annotationProxyMode] = c.modeAnnotation
+			}
+			endpoints := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
 				},
-				{
-					ObjectMeta: metav1.ObjectMeta{
-						Name: "endpoint-3",
-					},
-					Subsets: []corev1.EndpointSubset{
-						{
-							Addresses: []corev1.EndpointAddress{
-								{
-									NodeName: toStringPtr("node-foo"),
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "1.2.3.4",
+								TargetRef: &corev1.ObjectReference{
+									Kind:      "Pod",
+									Name:      pod.Name,
+									Namespace: pod.Namespace,
 								},
 							},
 						},
 					},
 				},
+			}
+			var fakeClient client.Client
+			if c.service != nil {
+				fakeClient = fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints, c.service).Build()
+			} else {
+				fakeClient = fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build()
+			}
+
+			epCtrl := EndpointsController{
+				Client:                 fakeClient,
+				EnableTransparentProxy: c.globalEnabled,
+				Log:                    logrtest.TestLogger{T: t},
+			}
+
+			serviceRegistration, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+			} else {
+				require.NoError(t, err)
+
+				require.Equal(t, c.proxyMode, proxyServiceRegistration.Proxy.Mode)
+				require.Equal(t, serviceRegistration.TaggedAddresses, c.expTaggedAddresses)
+				require.Equal(t, proxyServiceRegistration.TaggedAddresses, c.expTaggedAddresses)
+			}
+		})
+	}
+}
+
+// TestEndpointsController_createServiceRegistrations_proxyModePrecedence tests that the proxy mode set by a pod's
+// annotation takes precedence over the mode of ServiceDefaults, then ProxyDefaults and finally the handler's default.
+func TestEndpointsController_createServiceRegistrations_proxyModePrecedence(t *testing.T) {
+	t.Parallel()
+
+	const serviceName = "test-service"
+
+	cases := map[string]struct {
+		modeAnnotation      string
+		serviceDefaultsMode api.ProxyMode
+		proxyDefaultsMode   api.ProxyMode
+		tproxyDisabled      bool
+		expMode             api.ProxyMode
+		expErr              string
+	}{
+		"handler default": {
+			expMode: api.ProxyModeTransparent,
+		},
+		"ProxyDefaults overrides the handler default": {
+			proxyDefaultsMode: api.ProxyModeDirect,
+			expMode:           api.ProxyModeDirect,
+		},
+		"ServiceDefaults overrides ProxyDefaults": {
+			serviceDefaultsMode: api.ProxyModeTransparent,
+			proxyDefaultsMode:   api.ProxyModeDirect,
+			expMode:             api.ProxyModeTransparent,
+		},
+		"ServiceDefaults overrides the handler default": {
+			serviceDefaultsMode: api.ProxyModeDirect,
+			expMode:             api.ProxyModeDirect,
+		},
+		"annotation overrides ServiceDefaults": {
+			modeAnnotation:      "transparent",
+			serviceDefaultsMode: api.ProxyModeDirect,
+			proxyDefaultsMode:   api.ProxyModeDirect,
+			expMode:             api.ProxyModeTransparent,
+		},
+		"direct annotation overrides ServiceDefaults": {
+			modeAnnotation:      "direct",
+			serviceDefaultsMode: api.ProxyModeTransparent,
+			expMode:             api.ProxyModeDirect,
+		},
+		"transparent ServiceDefaults when transparent proxy is disabled": {
+			serviceDefaultsMode: api.ProxyModeTransparent,
+			tproxyDisabled:      true,
+			expErr:              `mode of the ServiceDefaults of "test-service" cannot be "transparent" when transparent proxy is disabled`,
+		},
+		"transparent ProxyDefaults when transparent proxy is disabled": {
+			proxyDefaultsMode: api.ProxyModeTransparent,
+			tproxyDisabled:    true,
+			expErr:            `mode of the global ProxyDefaults cannot be "transparent" when transparent proxy is disabled`,
+		},
+		"direct ProxyDefaults when transparent proxy is disabled": {
+			proxyDefaultsMode: api.ProxyModeDirect,
+			tproxyDisabled:    true,
+			expMode:           api.ProxyModeDirect,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			consul, err := testutil.NewTestServerConfigT(t, nil)
+			require.NoError(t, err)
+			defer consul.Stop()
+			consul.WaitForServiceIntentions(t)
+			consulClient, err := api.NewClient(&api.Config{Address: consul.HTTPAddr})
+			require.NoError(t, err)
+
+			if c.proxyDefaultsMode != "" {
+				_, _, err = consulClient.ConfigEntries().Set(&api.ProxyConfigEntry{
+					Kind: api.ProxyDefaults,
+					Name: api.ProxyConfigGlobal,
+					Mode: c.proxyDefaultsMode,
+				}, nil)
+				require.NoError(t, err)
+			}
+			if c.serviceDefaultsMode != "" {
+				_, _, err = consulClient.ConfigEntries().Set(&api.ServiceConfigEntry{
+					Kind: api.ServiceDefaults,
+					Name: serviceName,
+					Mode: c.serviceDefaultsMode,
+				}, nil)
+				require.NoError(t, err)
+			}
+
+			pod := createPod("test-pod-1", "1.2.3.4", false)
+			if c.modeAnnotation != "" {
+				pod.Annotations[annotationProxyMode] = c.modeAnnotation
+			}
+			endpoints := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+			}
+			service := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+				Spec: corev1.ServiceSpec{
+					ClusterIP: "10.0.0.1",
+					Ports:     []corev1.ServicePort{{Port: 80}},
+				},
+			}
+			epCtrl := EndpointsController{
+				Client:                 fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints, service).Build(),
+				ConsulClient:           consulClient,
+				EnableTransparentProxy: !c.tproxyDisabled,
+				Log:                    logrtest.TestLogger{T: t},
+			}
+
+			proxyModes := make(map[types.NamespacedName]api.ProxyMode)
+			_, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints, proxyModes)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expMode, proxyServiceRegistration.Proxy.Mode)
+
+			// The mode set by config entries is cached so they aren't read again for the same service.
+			_, err = consulClient.ConfigEntries().Delete(api.ServiceDefaults, serviceName, nil)
+			require.NoError(t, err)
+			_, err = consulClient.ConfigEntries().Delete(api.ProxyDefaults, api.ProxyConfigGlobal, nil)
+			require.NoError(t, err)
+			_, proxyServiceRegistration, err = epCtrl.createServiceRegistrations(*pod, *endpoints, proxyModes)
+			require.NoError(t, err)
+			require.Equal(t, c.expMode, proxyServiceRegistration.Proxy.Mode)
+		})
+	}
+}
+
+// TestEndpointsController_createServiceRegistrations_defaultProxyPublicListenerPort tests that the proxy of a pod
+// injected by a handler with a non-default public listener port is registered with that port.
+func TestEndpointsController_createServiceRegistrations_defaultProxyPublicListenerPort(t *testing.T) {
+	t.Parallel()
+	pod := createPod("pod1", "1.2.3.4", true)
+	h := Handler{DefaultProxyPublicListenerPort: 21000}
+	require.NoError(t, h.defaultAnnotations(pod))
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+	}
+	epCtrl := EndpointsController{
+		Client: fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build(),
+		Log:    logrtest.TestLogger{T: t},
+	}
+
+	_, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+	require.NoError(t, err)
+	require.Equal(t, 21000, proxyServiceRegistration.Port)
+	require.Equal(t, "1.2.3.4:21000", proxyServiceRegistration.Checks[0].TCP)
+}
+
+// TestEndpointsController_createServiceRegistrations_noServicePort tests that a pod without ports is registered
+// without a port and its proxy without a local service to proxy inbound traffic to.
+func TestEndpointsController_createServiceRegistrations_noServicePort(t *testing.T) {
+	t.Parallel()
+	pod := createPod("pod1", "1.2.3.4", true)
+	h := Handler{}
+	require.NoError(t, h.defaultAnnotations(pod))
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+	}
+	epCtrl := EndpointsController{
+		Client: fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build(),
+		Log:    logrtest.TestLogger{T: t},
+	}
+
+	serviceRegistration, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, serviceRegistration.Port)
+	require.Equal(t, 0, proxyServiceRegistration.Proxy.LocalServicePort)
+	require.Empty(t, proxyServiceRegistration.Proxy.LocalServiceAddress)
+}
+
+func TestEndpointsController_createServiceRegistrations_consulNamespaceOverride(t *testing.T) {
+	t.Parallel()
+	pod := createPod("pod1", "1.2.3.4", true)
+	pod.Annotations[annotationConsulNamespace] = "shared"
+	endpoints := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+	}
+	epCtrl := EndpointsController{
+		Client:                 fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build(),
+		Log:                    logrtest.TestLogger{T: t},
+		EnableConsulNamespaces: true,
+		EnableNSMirroring:      true,
+	}
+
+	serviceRegistration, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+	require.NoError(t, err)
+	require.Equal(t, "shared", serviceRegistration.Namespace)
+	require.Equal(t, "shared", proxyServiceRegistration.Namespace)
+}
+
+func TestEndpointsController_createServiceRegistrations_withGRPCCheck(t *testing.T) {
+	t.Parallel()
+
+	const serviceName = "test-service"
+
+	cases := map[string]struct {
+		annotations map[string]string
+		expCheck    *api.AgentServiceCheck
+		expErr      string
+	}{
+		"no gRPC check": {
+			annotations: nil,
+			expCheck:    nil,
+		},
+		"gRPC check without TLS": {
+			annotations: map[string]string{
+				annotationGRPCCheckPort: "9000",
+			},
+			expCheck: &api.AgentServiceCheck{
+				CheckID:  "default/test-pod-1-test-service/grpc-health-check",
+				Name:     "gRPC Health Check",
+				GRPC:     "1.2.3.4:9000",
+				Interval: "10s",
+			},
+		},
+		"gRPC check on a named port with TLS and a server name": {
+			annotations: map[string]string{
+				annotationGRPCCheckPort:          "grpc-health",
+				annotationGRPCCheckUseTLS:        "true",
+				annotationGRPCCheckTLSServerName: "test-service.default.svc",
+			},
+			expCheck: &api.AgentServiceCheck{
+				CheckID:       "default/test-pod-1-test-service/grpc-health-check",
+				Name:          "gRPC Health Check",
+				GRPC:          "1.2.3.4:9001",
+				GRPCUseTLS:    true,
+				TLSServerName: "test-service.default.svc",
+				Interval:      "10s",
+			},
+		},
+		"invalid port": {
+			annotations: map[string]string{
+				annotationGRPCCheckPort: "not-a-port",
+			},
+			expErr: "consul.hashicorp.com/service-grpc-check-port annotation value of not-a-port is not a valid port",
+		},
+		"invalid use TLS value": {
+			annotations: map[string]string{
+				annotationGRPCCheckPort:   "9000",
+				annotationGRPCCheckUseTLS: "yes please",
 			},
-			expectedRequests: []ctrl.Request{},
+			expErr: "consul.hashicorp.com/service-grpc-check-use-tls annotation value of yes please is not a valid boolean",
+		},
+		"server name without TLS": {
+			annotations: map[string]string{
+				annotationGRPCCheckPort:          "9000",
+				annotationGRPCCheckTLSServerName: "test-service.default.svc",
+			},
+			expErr: "consul.hashicorp.com/service-grpc-check-tls-server-name annotation can only be set if the consul.hashicorp.com/service-grpc-check-use-tls annotation is true",
+		},
+		"invalid server name": {
+			annotations: map[string]string{
+				annotationGRPCCheckPort:          "9000",
+				annotationGRPCCheckUseTLS:        "true",
+				annotationGRPCCheckTLSServerName: "Not_A_Server_Name",
+			},
+			expErr: "consul.hashicorp.com/service-grpc-check-tls-server-name annotation value of Not_A_Server_Name is not a valid server name: " +
+				"a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character " +
+				"(e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')",
+		},
+		"TLS without a gRPC check port": {
+			annotations: map[string]string{
+				annotationGRPCCheckUseTLS: "true",
+			},
+			expErr: "consul.hashicorp.com/service-grpc-check-use-tls annotation can only be set if the consul.hashicorp.com/service-grpc-check-port annotation is set",
 		},
 	}
 
-	for name, test := range cases {
+	for name, c := range cases {
 		t.Run(name, func(t *testing.T) {
-			logger := logrtest.TestLogger{T: t}
-			s := runtime.NewScheme()
-			s.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{}, &corev1.Endpoints{}, &corev1.EndpointsList{})
-			var objects []runtime.Object
-			if test.agentPod != nil {
-				objects = append(objects, test.agentPod)
+			pod := createPod("test-pod-1", "1.2.3.4", false)
+			pod.Spec.Containers = []corev1.Container{
+				{
+					Name:  "web",
+					Ports: []corev1.ContainerPort{{Name: "grpc-health", ContainerPort: 9001}},
+				},
 			}
-			for _, endpoint := range test.existingEndpoints {
-				objects = append(objects, endpoint)
+			for k, v := range c.annotations {
+				pod.Annotations[k] = v
+			}
+			endpoints := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
+				},
+			}
+			epCtrl := EndpointsController{
+				Client: fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build(),
+				Log:    logrtest.TestLogger{T: t},
 			}
 
-			fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objects...).Build()
-
-			controller := &EndpointsController{
-				Client: fakeClient,
-				Scheme: s,
-				Log:    logger,
+			serviceRegistration, _, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
 			}
-			var requests []ctrl.Request
-			if test.agentPod != nil {
-				requests = controller.requestsForRunningAgentPods(test.agentPod)
+			require.NoError(t, err)
+			// The Kubernetes health check is always registered.
+			require.Equal(t, "default/test-pod-1-test-service/kubernetes-health-check", serviceRegistration.Check.CheckID)
+			if c.expCheck == nil {
+				require.Empty(t, serviceRegistration.Checks)
 			} else {
-				requests = controller.requestsForRunningAgentPods(minimal())
+				require.Equal(t, api.AgentServiceChecks{c.expCheck}, serviceRegistration.Checks)
 			}
-			require.ElementsMatch(t, requests, test.expectedRequests)
 		})
 	}
 }
 
-func TestServiceInstancesForK8SServiceNameAndNamespace(t *testing.T) {
+func TestEndpointsController_createServiceRegistrations_withHTTPSCheck(t *testing.T) {
 	t.Parallel()
 
-	const (
-		k8sSvc = "k8s-svc"
-		k8sNS  = "k8s-ns"
-	)
-	cases := []struct {
-		name               string
-		k8sServiceNameMeta string
-		k8sNamespaceMeta   string
-		expected           map[string]*api.AgentService
+	const serviceName = "test-service"
+
+	cases := map[string]struct {
+		annotations map[string]string
+		expCheck    *api.AgentServiceCheck
+		expErr      string
 	}{
-		{
-			"no k8s service name or namespace meta",
-			"",
-			"",
-			map[string]*api.AgentService{},
+		"no HTTPS check": {
+			annotations: nil,
+			expCheck:    nil,
 		},
-		{
-			"k8s service name set, but no namespace meta",
-			k8sSvc,
-			"",
-			map[string]*api.AgentService{},
+		"HTTPS check with the default path": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort: "8443",
+			},
+			expCheck: &api.AgentServiceCheck{
+				CheckID:  "default/test-pod-1-test-service/https-health-check",
+				Name:     "HTTPS Health Check",
+				HTTP:     "https://1.2.3.4:8443/",
+				Interval: "10s",
+			},
 		},
-		{
-			"k8s namespace set, but no k8s service name meta",
-			"",
-			k8sNS,
-			map[string]*api.AgentService{},
+		"HTTPS check on a named port with a path and a server name": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort:          "https-health",
+				annotationHTTPSCheckPath:          "/healthz",
+				annotationHTTPSCheckTLSServerName: "test-service.default.svc",
+			},
+			expCheck: &api.AgentServiceCheck{
+				CheckID:       "default/test-pod-1-test-service/https-health-check",
+				Name:          "HTTPS Health Check",
+				HTTP:          "https://1.2.3.4:9443/healthz",
+				TLSServerName: "test-service.default.svc",
+				Interval:      "10s",
+			},
 		},
-		{
-			"both k8s service name and namespace set",
-			k8sSvc,
-			k8sNS,
-			map[string]*api.AgentService{
-				"foo1": {
-					ID:      "foo1",
-					Service: "foo",
-					Meta:    map[string]string{"k8s-service-name": k8sSvc, "k8s-namespace": k8sNS},
-				},
-				"foo1-proxy": {
-					Kind:    api.ServiceKindConnectProxy,
-					ID:      "foo1-proxy",
-					Service: "foo-sidecar-proxy",
-					Port:    20000,
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "foo",
-						DestinationServiceID:   "foo1",
-					},
-					Meta: map[string]string{"k8s-service-name": k8sSvc, "k8s-namespace": k8sNS},
-				},
+		"HTTPS check skipping verification": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort:          "8443",
+				annotationHTTPSCheckTLSSkipVerify: "true",
+			},
+			expCheck: &api.AgentServiceCheck{
+				CheckID:       "default/test-pod-1-test-service/https-health-check",
+				Name:          "HTTPS Health Check",
+				HTTP:          "https://1.2.3.4:8443/",
+				TLSSkipVerify: true,
+				Interval:      "10s",
 			},
 		},
+		"invalid port": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort: "not-a-port",
+			},
+			expErr: "consul.hashicorp.com/service-https-check-port annotation value of not-a-port is not a valid port",
+		},
+		"invalid path": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort: "8443",
+				annotationHTTPSCheckPath: "healthz",
+			},
+			expErr: "consul.hashicorp.com/service-https-check-path annotation value of healthz must start with /",
+		},
+		"invalid skip verify value": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort:          "8443",
+				annotationHTTPSCheckTLSSkipVerify: "maybe",
+			},
+			expErr: "consul.hashicorp.com/service-https-check-tls-skip-verify annotation value of maybe is not a valid boolean",
+		},
+		"server name while skipping verification": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort:          "8443",
+				annotationHTTPSCheckTLSServerName: "test-service.default.svc",
+				annotationHTTPSCheckTLSSkipVerify: "true",
+			},
+			expErr: "consul.hashicorp.com/service-https-check-tls-server-name annotation can't be set if the consul.hashicorp.com/service-https-check-tls-skip-verify annotation is true",
+		},
+		"invalid server name": {
+			annotations: map[string]string{
+				annotationHTTPSCheckPort:          "8443",
+				annotationHTTPSCheckTLSServerName: "Not_A_Server_Name",
+			},
+			expErr: "consul.hashicorp.com/service-https-check-tls-server-name annotation value of Not_A_Server_Name is not a valid server name: " +
+				"a lowercase RFC 1123 subdomain must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character " +
+				"(e.g. 'example.com', regex used for validation is '[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*')",
+		},
+		"server name without an HTTPS check port": {
+			annotations: map[string]string{
+				annotationHTTPSCheckTLSServerName: "test-service.default.svc",
+			},
+			expErr: "consul.hashicorp.com/service-https-check-tls-server-name annotation can only be set if the consul.hashicorp.com/service-https-check-port annotation is set",
+		},
 	}
 
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			servicesInConsul := []*api.AgentServiceRegistration{
-				{
-					ID:   "foo1",
-					Name: "foo",
-					Tags: []string{},
-					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": c.k8sNamespaceMeta},
-				},
-				{
-					Kind: api.ServiceKindConnectProxy,
-					ID:   "foo1-proxy",
-					Name: "foo-sidecar-proxy",
-					Port: 20000,
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "foo",
-						DestinationServiceID:   "foo1",
-					},
-					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": c.k8sNamespaceMeta},
-				},
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := createPod("test-pod-1", "1.2.3.4", false)
+			pod.Spec.Containers = []corev1.Container{
 				{
-					ID:   "k8s-service-different-ns-id",
-					Name: "k8s-service-different-ns",
-					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": "different-ns"},
+					Name:  "web",
+					Ports: []corev1.ContainerPort{{Name: "https-health", ContainerPort: 9443}},
 				},
-				{
-					Kind: api.ServiceKindConnectProxy,
-					ID:   "k8s-service-different-ns-proxy",
-					Name: "k8s-service-different-ns-proxy",
-					Port: 20000,
-					Tags: []string{},
-					Proxy: &api.AgentServiceConnectProxyConfig{
-						DestinationServiceName: "k8s-service-different-ns",
-						DestinationServiceID:   "k8s-service-different-ns-id",
-					},
-					Meta: map[string]string{"k8s-service-name": c.k8sServiceNameMeta, "k8s-namespace": "different-ns"},
+			}
+			for k, v := range c.annotations {
+				pod.Annotations[k] = v
+			}
+			endpoints := &corev1.Endpoints{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      serviceName,
+					Namespace: "default",
 				},
 			}
-
-			consul, err := testutil.NewTestServerConfigT(t, nil)
-			require.NoError(t, err)
-			defer consul.Stop()
-
-			consul.WaitForServiceIntentions(t)
-			consulClient, err := api.NewClient(&api.Config{
-				Address: consul.HTTPAddr,
-			})
-
-			for _, svc := range servicesInConsul {
-				err := consulClient.Agent().ServiceRegister(svc)
-				require.NoError(t, err)
+			epCtrl := EndpointsController{
+				Client: fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build(),
+				Log:    logrtest.TestLogger{T: t},
 			}
 
-			svcs, err := serviceInstancesForK8SServiceNameAndNamespace(k8sSvc, k8sNS, consulClient)
+			serviceRegistration, _, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
 			require.NoError(t, err)
-			if len(svcs) > 0 {
-				require.Len(t, svcs, 2)
-				require.NotNil(t, c.expected["foo1"], svcs["foo1"])
-				require.Equal(t, c.expected["foo1"].Service, svcs["foo1"].Service)
-				require.NotNil(t, c.expected["foo1-proxy"], svcs["foo1-proxy"])
-				require.Equal(t, c.expected["foo1-proxy"].Service, svcs["foo1-proxy"].Service)
+			if c.expCheck == nil {
+				require.Empty(t, serviceRegistration.Checks)
+			} else {
+				require.Equal(t, api.AgentServiceChecks{c.expCheck}, serviceRegistration.Checks)
 			}
 		})
 	}
 }
 
-func TestEndpointsController_createServiceRegistrations_withTransparentProxy(t *testing.T) {
+func TestEndpointsController_createServiceRegistrations_withSidecarProxyChecks(t *testing.T) {
 	t.Parallel()
 
 	const serviceName = "test-service"
+	defaultChecks := api.AgentServiceChecks{
+		{
+			Name:                           "Proxy Public Listener",
+			TCP:                            "1.2.3.4:20000",
+			Interval:                       "10s",
+			DeregisterCriticalServiceAfter: "10m",
+		},
+		{
+			Name:         "Destination Alias",
+			AliasService: "test-pod-1-test-service",
+		},
+	}
+	adminCheck := &api.AgentServiceCheck{
+		Name:     "Envoy Ready",
+		HTTP:     "http://127.0.0.1:19000/ready",
+		Interval: "5s",
+	}
 
 	cases := map[string]struct {
-		globalEnabled      bool
-		annotationEnabled  *bool
-		service            *corev1.Service
-		expTaggedAddresses map[string]api.ServiceAddress
-		proxyMode          api.ProxyMode
-		expErr             string
+		annotations map[string]string
+		expChecks   api.AgentServiceChecks
+		expErr      string
 	}{
-		"enabled globally, annotation not provided": {
-			globalEnabled:     true,
-			annotationEnabled: nil,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
-			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual": {
-					Address: "10.0.0.1",
-					Port:    80,
-				},
+		"no custom checks": {
+			expChecks: defaultChecks,
+		},
+		"custom checks augment the defaults": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks: `[{"Name": "Envoy Ready", "HTTP": "http://127.0.0.1:19000/ready", "Interval": "5s"}]`,
 			},
-			expErr: "",
+			expChecks: append(append(api.AgentServiceChecks{}, defaultChecks...), adminCheck),
 		},
-		"enabled globally, annotation is false": {
-			globalEnabled:     true,
-			annotationEnabled: pointerToBool(false),
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
+		"custom checks replace the defaults": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks:                `[{"Name": "Envoy Ready", "HTTP": "http://127.0.0.1:19000/ready", "Interval": "5s"}]`,
+				annotationSidecarProxyChecksReplaceDefaults: "true",
 			},
-			proxyMode:          api.ProxyModeDefault,
-			expTaggedAddresses: nil,
-			expErr:             "",
+			expChecks: api.AgentServiceChecks{adminCheck},
 		},
-		"enabled globally, annotation is true": {
-			globalEnabled:     true,
-			annotationEnabled: pointerToBool(true),
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
+		"invalid JSON": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks: `{"Name": "Envoy Ready"}`,
 			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual": {
-					Address: "10.0.0.1",
-					Port:    80,
-				},
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks annotation value is not a valid JSON list of checks: " +
+				"json: cannot unmarshal object into Go value of type api.AgentServiceChecks",
+		},
+		"check without a name": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks: `[{"TCP": "127.0.0.1:19000", "Interval": "5s"}]`,
 			},
-			expErr: "",
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks annotation check 0 is invalid: a Name must be set",
 		},
-		"disabled globally, annotation not provided": {
-			globalEnabled:     false,
-			annotationEnabled: nil,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
+		"check of multiple kinds": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks: `[{"Name": "Envoy", "TCP": "127.0.0.1:19000", "TTL": "30s", "Interval": "5s"}]`,
 			},
-			proxyMode:          api.ProxyModeDefault,
-			expTaggedAddresses: nil,
-			expErr:             "",
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks annotation check 0 is invalid: exactly one of HTTP, TCP, GRPC, TTL or AliasService must be set",
 		},
-		"disabled globally, annotation is false": {
-			globalEnabled:     false,
-			annotationEnabled: pointerToBool(false),
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
+		"check without an interval": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks: `[{"Name": "Envoy", "TCP": "127.0.0.1:19000"}]`,
 			},
-			proxyMode:          api.ProxyModeDefault,
-			expTaggedAddresses: nil,
-			expErr:             "",
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks annotation check 0 is invalid: an Interval must be set for HTTP, TCP and GRPC checks",
 		},
-		"disabled globally, annotation is true": {
-			globalEnabled:     false,
-			annotationEnabled: pointerToBool(true),
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
+		"check with an invalid timeout": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks: `[{"Name": "Envoy", "TCP": "127.0.0.1:19000", "Interval": "5s", "Timeout": "soon"}]`,
 			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual": {
-					Address: "10.0.0.1",
-					Port:    80,
-				},
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks annotation check 0 is invalid: value of soon for Timeout is not a valid duration",
+		},
+		"replace defaults without custom checks": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecksReplaceDefaults: "true",
 			},
-			expErr: "",
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks-replace-defaults annotation can only be set if the consul.hashicorp.com/sidecar-proxy-checks annotation is set",
 		},
-		// This case is impossible since we're always passing an endpoints object to this function,
-		// and Kubernetes will ensure that there is only an endpoints object if there is a service object.
-		// However, we're testing this case to check that we return an error in case we cannot get the service from k8s.
-		"no service": {
-			globalEnabled:      true,
-			service:            nil,
-			expTaggedAddresses: nil,
-			proxyMode:          api.ProxyModeDefault,
-			expErr:             "services \"test-service\" not found",
+		"invalid replace defaults": {
+			annotations: map[string]string{
+				annotationSidecarProxyChecks:                `[{"Name": "Envoy Ready", "HTTP": "http://127.0.0.1:19000/ready", "Interval": "5s"}]`,
+				annotationSidecarProxyChecksReplaceDefaults: "yes please",
+			},
+			expErr: "consul.hashicorp.com/sidecar-proxy-checks-replace-defaults annotation value of yes please is not a valid boolean",
 		},
-		"service with a single port without a name": {
-			globalEnabled: true,
-			service: &corev1.Service{
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := createPod("test-pod-1", "1.2.3.4", false)
+			for k, v := range c.annotations {
+				pod.Annotations[k] = v
+			}
+			endpoints := &corev1.Endpoints{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      serviceName,
 					Namespace: "default",
 				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
+			}
+			epCtrl := EndpointsController{
+				Client: fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build(),
+				Log:    logrtest.TestLogger{T: t},
+			}
+
+			_, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints, nil)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expChecks, proxyServiceRegistration.Checks)
+		})
+	}
+}
+
+// TestReconcile_ClusterName tests that the cluster name is added to the metadata of registered service instances
+// and updated when it changes.
+func TestReconcile_ClusterName(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
 						},
 					},
 				},
 			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual": {
-					Address: "10.0.0.1",
-					Port:    80,
-				},
-			},
-			expErr: "",
 		},
-		"service with a single port with a name": {
-			globalEnabled: true,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Name: "tcp",
-							Port: 80,
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	ep.ClusterName = "east"
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+	requireClusterMeta := func(cluster string) {
+		for _, instance := range requireServiceInstances(t, consulClient, "service-created", "pod1-service-created") {
+			require.Equal(t, cluster, instance.ServiceMeta[MetaKeyKubeCluster])
+		}
+	}
+
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireClusterMeta("east")
+
+	ep.ClusterName = "west"
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireClusterMeta("west")
+}
+
+// TestReconcile_UpstreamsSplitter tests that the ServiceSplitters of weighted upstreams are written along with the
+// ServiceDefaults of their virtual services, left alone while the pods disagree on the weights and deleted once
+// the pods no longer weight their upstreams.
+func TestReconcile_UpstreamsSplitter(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	pod1.Annotations[annotationUpstreams] = "web-v1:1234, web-v2:2345"
+	pod1.Annotations[annotationUpstreamsWeights] = "web-v1=90, web-v2=10"
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
 						},
 					},
 				},
 			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual-tcp": {
-					Address: "10.0.0.1",
-					Port:    80,
-				},
-			},
-			expErr: "",
 		},
-		"service with a multiple ports": {
-			globalEnabled: true,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "10.0.0.1",
-					Ports: []corev1.ServicePort{
-						{
-							Name: "tcp",
-							Port: 80,
-						},
-						{
-							Name: "http",
-							Port: 8080,
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	recorder := record.NewFakeRecorder(20)
+	ep.Recorder = recorder
+	var auditBuf strings.Builder
+	ep.AuditLog = NewAuditLogger(&auditBuf)
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+	virtualServices := []string{"service-created-web-v1-weighted", "service-created-web-v2-weighted"}
+	// configEntryAudits returns the audit entries of config entry writes and deletes since it was last called.
+	configEntryAudits := func() []AuditEntry {
+		var entries []AuditEntry
+		for _, line := range strings.Split(strings.TrimSpace(auditBuf.String()), "\n") {
+			var entry AuditEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			if entry.ConfigEntryKind != "" {
+				entry.Time = time.Time{}
+				entries = append(entries, entry)
+			}
+		}
+		auditBuf.Reset()
+		return entries
+	}
+	configEntryAudit := func(operation, kind, name string) AuditEntry {
+		return AuditEntry{Operation: operation, ServiceName: name, ConfigEntryKind: kind, Result: auditResultSuccess}
+	}
+	requireSplits := func(expected []api.ServiceSplit) {
+		for _, virtualService := range virtualServices {
+			entry, _, err := consulClient.ConfigEntries().Get(api.ServiceSplitter, virtualService, nil)
+			require.NoError(t, err)
+			require.Equal(t, expected, entry.(*api.ServiceSplitterConfigEntry).Splits)
+			entry, _, err = consulClient.ConfigEntries().Get(api.ServiceDefaults, virtualService, nil)
+			require.NoError(t, err)
+			require.Equal(t, "http", entry.(*api.ServiceConfigEntry).Protocol)
+		}
+	}
+
+	// Traffic can only be split between upstreams that use an L7 protocol.
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.EqualError(t, err, `upstreams of service "service-created" can only be weighted if they use the http, http2 or grpc protocol, but "web-v1" uses "tcp"`)
+
+	_, _, err = consulClient.ConfigEntries().Set(&api.ProxyConfigEntry{
+		Kind:   api.ProxyDefaults,
+		Name:   api.ProxyConfigGlobal,
+		Config: map[string]interface{}{"protocol": "http"},
+	}, nil)
+	require.NoError(t, err)
+	auditBuf.Reset()
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireSplits([]api.ServiceSplit{
+		{Weight: 90, Service: "web-v1"},
+		{Weight: 10, Service: "web-v2"},
+	})
+	require.ElementsMatch(t, []AuditEntry{
+		configEntryAudit(auditOperationWriteConfig, api.ServiceDefaults, virtualServices[0]),
+		configEntryAudit(auditOperationWriteConfig, api.ServiceSplitter, virtualServices[0]),
+		configEntryAudit(auditOperationWriteConfig, api.ServiceDefaults, virtualServices[1]),
+		configEntryAudit(auditOperationWriteConfig, api.ServiceSplitter, virtualServices[1]),
+	}, configEntryAudits())
+
+	// Every weighted upstream points at its virtual service.
+	instances, _, err := consulClient.Catalog().Service("service-created-sidecar-proxy", "", nil)
+	require.NoError(t, err)
+	require.Len(t, instances, 1)
+	require.Equal(t, virtualServices[0], instances[0].ServiceProxy.Upstreams[0].DestinationName)
+	require.Equal(t, virtualServices[1], instances[0].ServiceProxy.Upstreams[1].DestinationName)
+
+	// A pod weighting the upstreams differently doesn't change the splitters.
+	pod2 := createPod("pod2", "2.2.3.4", true)
+	pod2.Annotations[annotationUpstreams] = "web-v1:1234, web-v2:2345"
+	pod2.Annotations[annotationUpstreamsWeights] = "web-v1=50, web-v2=50"
+	require.NoError(t, ep.Client.Create(context.Background(), pod2))
+	endpoint.Subsets[0].Addresses = append(endpoint.Subsets[0].Addresses, corev1.EndpointAddress{
+		IP:        "2.2.3.4",
+		TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "pod2", Namespace: "default"},
+	})
+	require.NoError(t, ep.Client.Update(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireSplits([]api.ServiceSplit{
+		{Weight: 90, Service: "web-v1"},
+		{Weight: 10, Service: "web-v2"},
+	})
+	require.Empty(t, configEntryAudits())
+	var conflicts []string
+	for len(recorder.Events) > 0 {
+		if event := <-recorder.Events; strings.Contains(event, reasonUpstreamWeightsConflict) {
+			conflicts = append(conflicts, event)
+		}
+	}
+	require.ElementsMatch(t, []string{
+		`Warning UpstreamWeightsConflict pod "pod2" weights its upstreams differently from other pods of the service, so ServiceSplitter "service-created-web-v1-weighted" isn't changed until they agree`,
+		`Warning UpstreamWeightsConflict pod "pod2" weights its upstreams differently from other pods of the service, so ServiceSplitter "service-created-web-v2-weighted" isn't changed until they agree`,
+	}, conflicts)
+
+	// Once the pods agree, the new weights are written.
+	pod1.Annotations[annotationUpstreamsWeights] = "web-v1=50, web-v2=50"
+	require.NoError(t, ep.Client.Update(context.Background(), pod1))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireSplits([]api.ServiceSplit{
+		{Weight: 50, Service: "web-v1"},
+		{Weight: 50, Service: "web-v2"},
+	})
+	require.Len(t, configEntryAudits(), 4)
+
+	// ServiceDefaults left behind by a splitter deleted earlier are deleted too.
+	_, err = consulClient.ConfigEntries().Delete(api.ServiceSplitter, virtualServices[1], nil)
+	require.NoError(t, err)
+	require.NoError(t, ep.reconcileUpstreamsSplitters("service-created", "default", map[types.NamespacedName]*api.ServiceSplitterConfigEntry{
+		{Name: virtualServices[0]}: nil,
+	}))
+	require.Equal(t, []AuditEntry{
+		configEntryAudit(auditOperationDeleteConfig, api.ServiceDefaults, virtualServices[1]),
+	}, configEntryAudits())
+
+	require.NoError(t, ep.Client.Delete(context.Background(), pod2))
+	endpoint.Subsets[0].Addresses = endpoint.Subsets[0].Addresses[:1]
+	require.NoError(t, ep.Client.Update(context.Background(), endpoint))
+	delete(pod1.Annotations, annotationUpstreamsWeights)
+	require.NoError(t, ep.Client.Update(context.Background(), pod1))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, []AuditEntry{
+		configEntryAudit(auditOperationDeleteConfig, api.ServiceSplitter, virtualServices[0]),
+		configEntryAudit(auditOperationDeleteConfig, api.ServiceDefaults, virtualServices[0]),
+	}, configEntryAudits())
+
+	for _, virtualService := range virtualServices {
+		for _, kind := range []string{api.ServiceSplitter, api.ServiceDefaults} {
+			_, _, err = consulClient.ConfigEntries().Get(kind, virtualService, nil)
+			require.True(t, isNotFoundErr(err), "expected %s %q to be deleted, got %v", kind, virtualService, err)
+		}
+	}
+}
+
+// TestReconcile_SidecarProxyChecks tests that custom sidecar proxy checks are registered with the proxy and
+// removed when it's deregistered.
+func TestReconcile_SidecarProxyChecks(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	pod1.Annotations[annotationSidecarProxyChecks] = `[{"Name": "Envoy Alive", "TTL": "1m"}]`
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
 						},
 					},
 				},
 			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual-tcp": {
-					Address: "10.0.0.1",
-					Port:    80,
-				},
-				"virtual-http": {
-					Address: "10.0.0.1",
-					Port:    8080,
-				},
-			},
-			expErr: "",
 		},
-		"service with clusterIP=None (headless service)": {
-			globalEnabled: true,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: corev1.ClusterIPNone,
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+	proxyCheckNames := func() []string {
+		checks, err := consulClient.Agent().ChecksWithFilter(`ServiceID == "pod1-service-created-sidecar-proxy"`)
+		require.NoError(t, err)
+		var names []string
+		for _, check := range checks {
+			names = append(names, check.Name)
+		}
+		return names
+	}
+
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"Proxy Public Listener", "Destination Alias", "Envoy Alive"}, proxyCheckNames())
+
+	// Deleting the endpoints deregisters the proxy along with its checks.
+	require.NoError(t, ep.Client.Delete(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Empty(t, proxyCheckNames())
+}
+
+func createPod(name, ip string, inject bool) *corev1.Pod {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			Labels:      map[string]string{},
+			Annotations: map[string]string{},
+		},
+		Status: corev1.PodStatus{
+			PodIP:  ip,
+			HostIP: "127.0.0.1",
+			Phase:  corev1.PodRunning,
+			Conditions: []corev1.PodCondition{{
+				Type:    corev1.PodReady,
+				Status:  corev1.ConditionFalse,
+				Message: testFailureMessage,
+			}},
+		},
+	}
+	if inject {
+		pod.Labels[keyInjectStatus] = injected
+		pod.Annotations[keyInjectStatus] = injected
+	}
+	return pod
+}
+
+// newTestEndpointsController starts a Consul test server and returns an EndpointsController registering
+// services with it, along with a client of the server. The controller's Kubernetes client has k8sObjects and
+// the pod of a Consul client agent running on the server.
+func newTestEndpointsController(t *testing.T, k8sObjects ...runtime.Object) (*EndpointsController, *api.Client) {
+	t.Helper()
+	return newSecureTestEndpointsController(t, false, k8sObjects...)
+}
+
+// newSecureTestEndpointsController is like newTestEndpointsController, but if secure is true the Consul test
+// server has ACLs and TLS enabled and both the controller and the client use HTTPS and the master token.
+func newSecureTestEndpointsController(t *testing.T, secure bool, k8sObjects ...runtime.Object) (*EndpointsController, *api.Client) {
+	t.Helper()
+	// The agent pod needs to have the address 127.0.0.1 so when the
+	// code gets the agent pods via the label component=client, and
+	// makes requests against the agent API, it will actually hit the
+	// test server we have on localhost.
+	fakeClientPod := createPod("fake-consul-client", "127.0.0.1", false)
+	fakeClientPod.Labels = map[string]string{"component": "client", "app": "consul", "release": "consul"}
+	fakeClient := fake.NewClientBuilder().WithRuntimeObjects(append(k8sObjects, fakeClientPod)...).Build()
+
+	masterToken := "b78d37c7-0ca7-5f4d-99ee-6d9975ce4586"
+	var caFile, certFile, keyFile string
+	if secure {
+		caFile, certFile, keyFile = common.GenerateServerCerts(t)
+	}
+	consul, err := testutil.NewTestServerConfigT(t, func(c *testutil.TestServerConfig) {
+		if secure {
+			c.ACL.Enabled = true
+			c.ACL.DefaultPolicy = "deny"
+			c.ACL.Tokens.Master = masterToken
+			c.CAFile = caFile
+			c.CertFile = certFile
+			c.KeyFile = keyFile
+		}
+		c.NodeName = "test-node"
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = consul.Stop()
+	})
+	consul.WaitForServiceIntentions(t)
+
+	cfg := &api.Config{Scheme: "http", Address: consul.HTTPAddr}
+	if secure {
+		cfg.Scheme = "https"
+		cfg.Address = consul.HTTPSAddr
+		cfg.TLSConfig = api.TLSConfig{CAFile: caFile}
+		cfg.Token = masterToken
+	}
+	consulClient, err := api.NewClient(cfg)
+	require.NoError(t, err)
+
+	return &EndpointsController{
+		Client:                fakeClient,
+		Log:                   logrtest.TestLogger{T: t},
+		ConsulClient:          consulClient,
+		ConsulPort:            strings.Split(cfg.Address, ":")[1],
+		ConsulScheme:          cfg.Scheme,
+		AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+		DenyK8sNamespacesSet:  mapset.NewSetWith(),
+		ReleaseName:           "consul",
+		ReleaseNamespace:      "default",
+		ConsulClientCfg:       cfg,
+	}, consulClient
+}
+
+// requireServiceInstances requires the instances of the Consul service serviceName and of its sidecar proxy
+// service to be those of the service instances expectedIDs, and returns the instances of both.
+func requireServiceInstances(t *testing.T, consulClient *api.Client, serviceName string, expectedIDs ...string) []*api.CatalogService {
+	t.Helper()
+	var allInstances []*api.CatalogService
+	for _, name := range []string{serviceName, serviceName + "-sidecar-proxy"} {
+		instances, _, err := consulClient.Catalog().Service(name, "", nil)
+		require.NoError(t, err)
+		var ids []string
+		for _, instance := range instances {
+			ids = append(ids, strings.TrimSuffix(instance.ServiceID, "-sidecar-proxy"))
+		}
+		require.ElementsMatch(t, expectedIDs, ids, name)
+		allInstances = append(allInstances, instances...)
+	}
+	return allInstances
+}
+
+// TestReconcile_ConsulServiceNamePrefixAndSuffix tests that the service name prefix and suffix are added to the names
+// of registered services and their proxies, and that the instances are deregistered once the Endpoints are deleted.
+func TestReconcile_ConsulServiceNamePrefixAndSuffix(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
 						},
 					},
 				},
 			},
-			proxyMode:          api.ProxyModeDefault,
-			expTaggedAddresses: nil,
-			expErr:             "",
 		},
-		"service with an empty clusterIP": {
-			globalEnabled: true,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
-						},
-					},
-				},
+	}
+	ep, consulClient := newTestEndpointsController(t, pod1, endpoint)
+	ep.ConsulServiceNamePrefix = "east-"
+	ep.ConsulServiceNameSuffix = "-k8s"
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+
+	instances := requireServiceInstances(t, consulClient, "east-service-created-k8s", "pod1-east-service-created-k8s")
+	proxyInstance := instances[1]
+	require.Equal(t, "east-service-created-k8s", proxyInstance.ServiceProxy.DestinationServiceName)
+	require.Equal(t, "pod1-east-service-created-k8s", proxyInstance.ServiceProxy.DestinationServiceID)
+
+	// Nothing is registered under the unprefixed name.
+	requireServiceInstances(t, consulClient, "service-created")
+
+	require.NoError(t, ep.Client.Delete(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	services, _, err := consulClient.Catalog().Services(nil)
+	require.NoError(t, err)
+	require.NotContains(t, services, "east-service-created-k8s")
+	require.NotContains(t, services, "east-service-created-k8s-sidecar-proxy")
+}
+
+// TestReconcile_RegistrationTimeout tests that when registering the instances of an Endpoints object takes longer
+// than the registration timeout, the reconcile is requeued and the requeued reconciles only register the remaining
+// instances.
+func TestReconcile_RegistrationTimeout(t *testing.T) {
+	t.Parallel()
+	var addresses []corev1.EndpointAddress
+	objs := []runtime.Object{}
+	for i, ip := range []string{"1.2.3.4", "2.2.3.4", "3.2.3.4"} {
+		name := fmt.Sprintf("pod%d", i+1)
+		objs = append(objs, createPod(name, ip, true))
+		addresses = append(addresses, corev1.EndpointAddress{
+			IP: ip,
+			TargetRef: &corev1.ObjectReference{
+				Kind:      "Pod",
+				Name:      name,
+				Namespace: "default",
 			},
-			proxyMode:          api.ProxyModeDefault,
-			expTaggedAddresses: nil,
-			expErr:             "",
+		})
+	}
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
 		},
-		"service with an invalid clusterIP": {
-			globalEnabled: true,
-			service: &corev1.Service{
+		Subsets: []corev1.EndpointSubset{{Addresses: addresses}},
+	}
+	ep, consulClient := newTestEndpointsController(t, append(objs, endpoint)...)
+
+	// The controller talks to the agent through a proxy that delays every registration so that registering
+	// a pod's service and proxy takes longer than the registration timeout.
+	consulURL, err := url.Parse("http://" + ep.ConsulClientCfg.Address)
+	require.NoError(t, err)
+	agentProxy := httputil.NewSingleHostReverseProxy(consulURL)
+	slowAgent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/agent/service/register" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		agentProxy.ServeHTTP(w, r)
+	}))
+	defer slowAgent.Close()
+	slowAgentURL, err := url.Parse(slowAgent.URL)
+	require.NoError(t, err)
+	ep.ConsulPort = slowAgentURL.Port()
+	ep.RegistrationTimeout = 300 * time.Millisecond
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+
+	// Each reconcile registers one more pod before the timeout and is requeued.
+	result, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.True(t, result.Requeue)
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created")
+
+	result, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.True(t, result.Requeue)
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created", "pod2-service-created")
+
+	// The last pod is registered within the timeout so the reconcile completes.
+	result, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.False(t, result.Requeue)
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created", "pod2-service-created", "pod3-service-created")
+}
+
+// TestReconcile_StaleCatalogReads tests that service instances aren't deregistered when the Consul catalog
+// doesn't reflect their registration yet, and that catalog reads are consistent if ConsistentReads is set.
+func TestReconcile_StaleCatalogReads(t *testing.T) {
+	t.Parallel()
+	for _, consistentReads := range []bool{false, true} {
+		t.Run(fmt.Sprintf("consistent reads %t", consistentReads), func(t *testing.T) {
+			pod1 := createPod("pod1", "1.2.3.4", true)
+			endpoint := &corev1.Endpoints{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
+					Name:      "service-created",
 					Namespace: "default",
 				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "invalid",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
+				Subsets: []corev1.EndpointSubset{
+					{
+						Addresses: []corev1.EndpointAddress{
+							{
+								IP: "1.2.3.4",
+								TargetRef: &corev1.ObjectReference{
+									Kind:      "Pod",
+									Name:      "pod1",
+									Namespace: "default",
+								},
+							},
 						},
 					},
 				},
-			},
-			expTaggedAddresses: nil,
-			proxyMode:          api.ProxyModeDefault,
-			expErr:             "",
+			}
+			ep, agentClient := newTestEndpointsController(t, pod1, endpoint)
+
+			// The controller talks to Consul through a proxy whose catalog reads always return no instances,
+			// as a stale read right after a registration would.
+			consulURL, err := url.Parse("http://" + ep.ConsulClientCfg.Address)
+			require.NoError(t, err)
+			agentProxy := httputil.NewSingleHostReverseProxy(consulURL)
+			var consistentCatalogReads, catalogReads int
+			var mu sync.Mutex
+			staleConsul := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasPrefix(r.URL.Path, "/v1/catalog/") || strings.HasPrefix(r.URL.Path, "/v1/health/") {
+					mu.Lock()
+					catalogReads++
+					if _, ok := r.URL.Query()["consistent"]; ok {
+						consistentCatalogReads++
+					}
+					mu.Unlock()
+					w.Header().Set("X-Consul-Index", "1")
+					if strings.HasPrefix(r.URL.Path, "/v1/catalog/node-services/") {
+						w.Write([]byte("null"))
+					} else {
+						w.Write([]byte("[]"))
+					}
+					return
+				}
+				agentProxy.ServeHTTP(w, r)
+			}))
+			defer staleConsul.Close()
+			staleConsulURL, err := url.Parse(staleConsul.URL)
+			require.NoError(t, err)
+
+			ep.ConsulClientCfg = &api.Config{Address: staleConsulURL.Host}
+			ep.ConsulClient, err = api.NewClient(ep.ConsulClientCfg)
+			require.NoError(t, err)
+			ep.ConsulPort = staleConsulURL.Port()
+			ep.ConsistentReads = consistentReads
+			namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+
+			for i := 0; i < 2; i++ {
+				_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+				require.NoError(t, err)
+
+				services, err := agentClient.Agent().Services()
+				require.NoError(t, err)
+				require.Contains(t, services, "pod1-service-created")
+				require.Contains(t, services, "pod1-service-created-sidecar-proxy")
+			}
+
+			require.NotZero(t, catalogReads)
+			if consistentReads {
+				require.Equal(t, catalogReads, consistentCatalogReads)
+			} else {
+				require.Zero(t, consistentCatalogReads)
+			}
+		})
+	}
+}
+
+// TestReconcile_RegistrationMetrics tests that registrations, deregistrations and failed reconciles are counted.
+// It doesn't run in parallel since the metrics are shared by all controllers.
+func TestReconcile_RegistrationMetrics(t *testing.T) {
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	endpoint := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "service-created",
+			Namespace: "default",
 		},
-		"service with an IPv6 clusterIP": {
-			globalEnabled: true,
-			service: &corev1.Service{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
-					Namespace: "default",
-				},
-				Spec: corev1.ServiceSpec{
-					ClusterIP: "2001:db8::68",
-					Ports: []corev1.ServicePort{
-						{
-							Port: 80,
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses: []corev1.EndpointAddress{
+					{
+						IP: "1.2.3.4",
+						TargetRef: &corev1.ObjectReference{
+							Kind:      "Pod",
+							Name:      "pod1",
+							Namespace: "default",
 						},
 					},
 				},
 			},
-			proxyMode: api.ProxyModeTransparent,
-			expTaggedAddresses: map[string]api.ServiceAddress{
-				"virtual": {
-					Address: "2001:db8::68",
-					Port:    80,
-				},
-			},
-			expErr: "",
 		},
 	}
+	ep, _ := newTestEndpointsController(t, pod1, endpoint)
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
 
-	for name, c := range cases {
-		t.Run(name, func(t *testing.T) {
-			pod := createPod("test-pod-1", "1.2.3.4", false)
-			if c.annotationEnabled != nil {
-				pod.Annotations[annotationTransparentProxy] = strconv.FormatBool(*c.annotationEnabled)
+	// counterValue returns the value of the counter name for the default Consul namespace
+	// as exported by the controller-runtime metrics registry.
+	counterValue := func(name string) float64 {
+		families, err := metrics.Registry.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() != name {
+				continue
 			}
-			endpoints := &corev1.Endpoints{
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == metricLabelConsulNamespace && label.GetValue() == "" {
+						return metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return 0
+	}
+	registered := counterValue("consul_k8s_endpoints_services_registered_total")
+	deregistered := counterValue("consul_k8s_endpoints_services_deregistered_total")
+	failures := counterValue("consul_k8s_endpoints_reconcile_errors_total")
+
+	// The service and its proxy are registered.
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, registered+2, counterValue("consul_k8s_endpoints_services_registered_total"))
+	require.Equal(t, deregistered, counterValue("consul_k8s_endpoints_services_deregistered_total"))
+
+	// The service and its proxy are deregistered once the Endpoints are deleted.
+	require.NoError(t, ep.Client.Delete(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, deregistered+2, counterValue("consul_k8s_endpoints_services_deregistered_total"))
+	require.Equal(t, failures, counterValue("consul_k8s_endpoints_reconcile_errors_total"))
+
+	// Failing to get the pod backing the Endpoints fails the reconcile.
+	endpoint.ResourceVersion = ""
+	endpoint.Subsets[0].Addresses[0].TargetRef.Name = "missing-pod"
+	require.NoError(t, ep.Client.Create(context.Background(), endpoint))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.Error(t, err)
+	require.Equal(t, failures+1, counterValue("consul_k8s_endpoints_reconcile_errors_total"))
+}
+
+// TestReconcile_DeregistersPodsNoLongerInjected tests that the service instances of a pod are deregistered
+// once either its inject status annotation or label is removed, even though the pod is still part of the Endpoints.
+func TestReconcile_DeregistersPodsNoLongerInjected(t *testing.T) {
+	t.Parallel()
+	cases := map[string]func(pod *corev1.Pod){
+		"inject status annotation removed": func(pod *corev1.Pod) {
+			delete(pod.Annotations, keyInjectStatus)
+		},
+		"inject status label removed": func(pod *corev1.Pod) {
+			delete(pod.Labels, keyInjectStatus)
+		},
+	}
+	for name, removeInjectStatus := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod1 := createPod("pod1", "1.2.3.4", true)
+			pod2 := createPod("pod2", "2.2.3.4", true)
+			endpoint := &corev1.Endpoints{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      serviceName,
+					Name:      "service-created",
 					Namespace: "default",
 				},
 				Subsets: []corev1.EndpointSubset{
@@ -2902,65 +5484,130 @@ func TestEndpointsController_createServiceRegistrations_withTransparentProxy(t *
 								IP: "1.2.3.4",
 								TargetRef: &corev1.ObjectReference{
 									Kind:      "Pod",
-									Name:      pod.Name,
-									Namespace: pod.Namespace,
+									Name:      "pod1",
+									Namespace: "default",
+								},
+							},
+							{
+								IP: "2.2.3.4",
+								TargetRef: &corev1.ObjectReference{
+									Kind:      "Pod",
+									Name:      "pod2",
+									Namespace: "default",
 								},
 							},
 						},
 					},
 				},
 			}
-			var fakeClient client.Client
-			if c.service != nil {
-				fakeClient = fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints, c.service).Build()
-			} else {
-				fakeClient = fake.NewClientBuilder().WithRuntimeObjects(pod, endpoints).Build()
-			}
+			ep, consulClient := newTestEndpointsController(t, pod1, pod2, endpoint)
+			namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
 
-			epCtrl := EndpointsController{
-				Client:                 fakeClient,
-				EnableTransparentProxy: c.globalEnabled,
-				Log:                    logrtest.TestLogger{T: t},
-			}
+			_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+			requireServiceInstances(t, consulClient, "service-created", "pod1-service-created", "pod2-service-created")
 
-			serviceRegistration, proxyServiceRegistration, err := epCtrl.createServiceRegistrations(*pod, *endpoints)
-			if c.expErr != "" {
-				require.EqualError(t, err, c.expErr)
-			} else {
-				require.NoError(t, err)
+			removeInjectStatus(pod1)
+			require.NoError(t, ep.Client.Update(context.Background(), pod1))
 
-				require.Equal(t, c.proxyMode, proxyServiceRegistration.Proxy.Mode)
-				require.Equal(t, serviceRegistration.TaggedAddresses, c.expTaggedAddresses)
-				require.Equal(t, proxyServiceRegistration.TaggedAddresses, c.expTaggedAddresses)
-			}
+			_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+			requireServiceInstances(t, consulClient, "service-created", "pod2-service-created")
 		})
 	}
 }
 
-func createPod(name, ip string, inject bool) *corev1.Pod {
-	pod := &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        name,
-			Namespace:   "default",
-			Labels:      map[string]string{},
-			Annotations: map[string]string{},
+// TestReconcile_EndpointSlices tests that when EndpointSlices are used, the addresses of all slices of a service
+// are registered and that instances are deregistered once their slice is removed.
+func TestReconcile_EndpointSlices(t *testing.T) {
+	t.Parallel()
+	pod1 := createPod("pod1", "1.2.3.4", true)
+	pod2 := createPod("pod2", "2.2.3.4", true)
+	endpointSlice := func(name, ip, podName string) *discoveryv1beta1.EndpointSlice {
+		return &discoveryv1beta1.EndpointSlice{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+				Labels:    map[string]string{discoveryv1beta1.LabelServiceName: "service-created"},
+			},
+			AddressType: discoveryv1beta1.AddressTypeIPv4,
+			Endpoints: []discoveryv1beta1.Endpoint{
+				{
+					Addresses: []string{ip},
+					TargetRef: &corev1.ObjectReference{
+						Kind:      "Pod",
+						Name:      podName,
+						Namespace: "default",
+					},
+				},
+			},
+		}
+	}
+	slice1 := endpointSlice("service-created-abc", "1.2.3.4", "pod1")
+	slice2 := endpointSlice("service-created-def", "2.2.3.4", "pod2")
+	ep, consulClient := newTestEndpointsController(t, pod1, pod2, slice1, slice2)
+	ep.UseEndpointSlices = true
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "service-created"}
+
+	// Both slices are registered.
+	_, err := ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created", "pod2-service-created")
+
+	// Removing a slice deregisters only its instances.
+	require.NoError(t, ep.Client.Delete(context.Background(), slice2))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireServiceInstances(t, consulClient, "service-created", "pod1-service-created")
+
+	// Removing all slices deregisters the service.
+	require.NoError(t, ep.Client.Delete(context.Background(), slice1))
+	_, err = ep.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	requireServiceInstances(t, consulClient, "service-created")
+}
+
+func TestEndpointsFromSlices(t *testing.T) {
+	t.Parallel()
+	notReady := false
+	slices := []discoveryv1beta1.EndpointSlice{
+		{
+			AddressType: discoveryv1beta1.AddressTypeIPv4,
+			Endpoints: []discoveryv1beta1.Endpoint{
+				{
+					Addresses: []string{"1.2.3.4"},
+					NodeName:  toStringPtr("node1"),
+				},
+				{
+					Addresses:  []string{"2.2.3.4"},
+					Conditions: discoveryv1beta1.EndpointConditions{Ready: &notReady},
+					Topology:   map[string]string{corev1.LabelHostname: "node2"},
+				},
+			},
 		},
-		Status: corev1.PodStatus{
-			PodIP:  ip,
-			HostIP: "127.0.0.1",
-			Phase:  corev1.PodRunning,
-			Conditions: []corev1.PodCondition{{
-				Type:    corev1.PodReady,
-				Status:  corev1.ConditionFalse,
-				Message: testFailureMessage,
-			}},
+		{
+			AddressType: discoveryv1beta1.AddressTypeFQDN,
+			Endpoints: []discoveryv1beta1.Endpoint{
+				{
+					Addresses: []string{"example.com"},
+				},
+			},
 		},
 	}
-	if inject {
-		pod.Labels[keyInjectStatus] = injected
-		pod.Annotations[keyInjectStatus] = injected
-	}
-	return pod
+
+	endpoints := endpointsFromSlices(types.NamespacedName{Name: "svc", Namespace: "ns"}, slices)
+	require.Equal(t, corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "svc",
+			Namespace: "ns",
+		},
+		Subsets: []corev1.EndpointSubset{
+			{
+				Addresses:         []corev1.EndpointAddress{{IP: "1.2.3.4", NodeName: toStringPtr("node1")}},
+				NotReadyAddresses: []corev1.EndpointAddress{{IP: "2.2.3.4", NodeName: toStringPtr("node2")}},
+			},
+		},
+	}, endpoints)
 }
 
 func toStringPtr(input string) *string {
@@ -2,14 +2,37 @@ package connectinject
 
 import (
 	"fmt"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/shlex"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
+// envoyAdminPort is the port the Envoy admin API listens on unless overridden.
+const envoyAdminPort = 19000
+
+// defaultEnvoyAdminBindAddress is the address the Envoy admin API binds to unless overridden.
+const defaultEnvoyAdminBindAddress = "127.0.0.1"
+
+// envoySidecarContainerName is the name of the injected Envoy sidecar container.
+const envoySidecarContainerName = "envoy-sidecar"
+
+// sidecarProxyVolumesDir is the directory that the volumes listed in the
+// sidecar-proxy-volume-mounts annotation are mounted under.
+const sidecarProxyVolumesDir = "/consul/sidecar-proxy-volumes"
+
+// defaultSidecarProxyDrainTime is how long the sidecar proxy's preStop hook waits
+// for connections to drain if the drain time annotation isn't set.
+const defaultSidecarProxyDrainTime = 10 * time.Second
+
+// defaultEnvoyReadinessWait is how long the Envoy sidecar's postStart hook waits for
+// Envoy to be ready if the readiness wait annotation isn't set.
+const defaultEnvoyReadinessWait = 1 * time.Minute
+
 func (h *Handler) envoySidecar(pod corev1.Pod) (corev1.Container, error) {
 	resources, err := h.envoySidecarResources(pod)
 	if err != nil {
@@ -21,6 +44,16 @@ func (h *Handler) envoySidecar(pod corev1.Pod) (corev1.Container, error) {
 		return corev1.Container{}, err
 	}
 
+	extraVolumeMounts, err := sidecarProxyVolumeMounts(pod)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+
+	lifecycle, err := h.envoySidecarLifecycle(pod)
+	if err != nil {
+		return corev1.Container{}, err
+	}
+
 	if pod.Spec.SecurityContext != nil {
 		// User container and Envoy container cannot have the same UID.
 		if pod.Spec.SecurityContext.RunAsUser != nil && *pod.Spec.SecurityContext.RunAsUser == envoyUserAndGroupID {
@@ -37,7 +70,7 @@ func (h *Handler) envoySidecar(pod corev1.Pod) (corev1.Container, error) {
 	}
 
 	container := corev1.Container{
-		Name:  "envoy-sidecar",
+		Name:  envoySidecarContainerName,
 		Image: h.ImageEnvoy,
 		Env: []corev1.EnvVar{
 			{
@@ -47,14 +80,16 @@ func (h *Handler) envoySidecar(pod corev1.Pod) (corev1.Container, error) {
 				},
 			},
 		},
+		EnvFrom:   h.EnvoyExtraEnvFrom,
 		Resources: resources,
-		VolumeMounts: []corev1.VolumeMount{
+		VolumeMounts: append([]corev1.VolumeMount{
 			{
 				Name:      volumeName,
 				MountPath: "/consul/connect-inject",
 			},
-		},
-		Command: cmd,
+		}, extraVolumeMounts...),
+		Command:   cmd,
+		Lifecycle: lifecycle,
 		SecurityContext: &corev1.SecurityContext{
 			RunAsUser:              pointerToInt64(envoyUserAndGroupID),
 			RunAsGroup:             pointerToInt64(envoyUserAndGroupID),
@@ -64,6 +99,111 @@ func (h *Handler) envoySidecar(pod corev1.Pod) (corev1.Container, error) {
 	}
 	return container, nil
 }
+
+// sidecarProxyVolumeMounts returns the volume mounts for the pod volumes listed in the
+// sidecar-proxy-volume-mounts annotation. It errors if a listed volume isn't defined on the pod.
+func sidecarProxyVolumeMounts(pod corev1.Pod) ([]corev1.VolumeMount, error) {
+	raw, ok := pod.Annotations[annotationSidecarProxyVolumeMounts]
+	if !ok || raw == "" {
+		return nil, nil
+	}
+
+	volumes := make(map[string]bool)
+	for _, v := range pod.Spec.Volumes {
+		volumes[v.Name] = true
+	}
+
+	var mounts []corev1.VolumeMount
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if !volumes[name] {
+			return nil, fmt.Errorf("%s annotation references volume %q which is not defined on the pod", annotationSidecarProxyVolumeMounts, name)
+		}
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      name,
+			MountPath: fmt.Sprintf("%s/%s", sidecarProxyVolumesDir, name),
+		})
+	}
+	return mounts, nil
+}
+
+// envoySidecarLifecycle returns the lifecycle of the Envoy sidecar. If the proxy lifecycle is enabled
+// via the handler or the pod's annotation, its preStop hook gracefully drains Envoy's listeners
+// and then waits for the drain time so that in-flight requests can finish. If dependency checks
+// are enabled, its postStart hook waits until Envoy is ready and fails if it isn't by the readiness wait.
+func (h *Handler) envoySidecarLifecycle(pod corev1.Pod) (*corev1.Lifecycle, error) {
+	enabled := h.EnableProxyLifecycle
+	if raw, ok := pod.Annotations[annotationEnableSidecarProxyLifecycle]; ok && raw != "" {
+		enableLifecycle, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation value of %s was invalid: %s", annotationEnableSidecarProxyLifecycle, raw, err)
+		}
+		enabled = enableLifecycle
+	}
+
+	drainTime := defaultSidecarProxyDrainTime
+	if raw, ok := pod.Annotations[annotationSidecarProxyDrainTime]; ok && raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation value of %s was invalid: %s", annotationSidecarProxyDrainTime, raw, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s annotation value of %s must not be negative", annotationSidecarProxyDrainTime, raw)
+		}
+		drainTime = d
+	}
+
+	readinessWait := defaultEnvoyReadinessWait
+	if raw, ok := pod.Annotations[annotationEnvoyReadinessWait]; ok && raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation value of %s was invalid: %s", annotationEnvoyReadinessWait, raw, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("%s annotation value of %s must be positive", annotationEnvoyReadinessWait, raw)
+		}
+		readinessWait = d
+	}
+
+	if !enabled && !h.EnableDependencyChecks {
+		return nil, nil
+	}
+
+	adminAddr, err := envoyAdminAddr(pod)
+	if err != nil {
+		return nil, err
+	}
+
+	var lifecycle corev1.Lifecycle
+	// Envoy images don't ship an HTTP client, so the hooks run the consul-k8s binary that
+	// the init container copies into the shared volume.
+	if enabled {
+		lifecycle.PreStop = &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					consulK8SCopyPath, "envoy-lifecycle",
+					"-drain",
+					fmt.Sprintf("-admin-addr=%s", adminAddr),
+					fmt.Sprintf("-drain-time=%s", drainTime),
+				},
+			},
+		}
+	}
+	if h.EnableDependencyChecks {
+		lifecycle.PostStart = &corev1.Handler{
+			Exec: &corev1.ExecAction{
+				Command: []string{
+					consulK8SCopyPath, "envoy-lifecycle",
+					"-wait-ready",
+					fmt.Sprintf("-admin-addr=%s", adminAddr),
+					fmt.Sprintf("-ready-timeout=%s", readinessWait),
+				},
+			},
+		}
+	}
+	return &lifecycle, nil
+}
+
 func (h *Handler) getContainerSidecarCommand(pod corev1.Pod) ([]string, error) {
 	cmd := []string{
 		"envoy",
@@ -97,6 +237,133 @@ func (h *Handler) getContainerSidecarCommand(pod corev1.Pod) ([]string, error) {
 	return cmd, nil
 }
 
+// proxyPublicListener returns the port and bind address of the sidecar proxy's
+// public listener. The port defaults to defaultProxyPublicListenerPort and an
+// empty bind address means Consul's default is used. Both may be overridden
+// via annotations.
+func proxyPublicListener(pod corev1.Pod) (int, string, error) {
+	port := defaultProxyPublicListenerPort
+	if raw, ok := pod.Annotations[annotationSidecarProxyPort]; ok && raw != "" {
+		p, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, "", fmt.Errorf("%s annotation value of %s is not a valid integer", annotationSidecarProxyPort, raw)
+		}
+		if p < 1 || p > 65535 {
+			return 0, "", fmt.Errorf("%s annotation value of %d is not in the valid port range 1-65535", annotationSidecarProxyPort, p)
+		}
+		port = p
+	}
+
+	bindAddress := pod.Annotations[annotationSidecarProxyBindAddress]
+	if bindAddress != "" && net.ParseIP(bindAddress) == nil {
+		return 0, "", fmt.Errorf("%s annotation value of %s is not a valid IP address", annotationSidecarProxyBindAddress, bindAddress)
+	}
+
+	return port, bindAddress, nil
+}
+
+// envoyAdminBind returns the address and port that the Envoy admin API binds to. They default to
+// defaultEnvoyAdminBindAddress and envoyAdminPort and may be overridden via annotations.
+func envoyAdminBind(pod corev1.Pod) (string, int, error) {
+	address := defaultEnvoyAdminBindAddress
+	if raw, ok := pod.Annotations[annotationEnvoyAdminBind]; ok && raw != "" {
+		if net.ParseIP(raw) == nil {
+			return "", 0, fmt.Errorf("%s annotation value of %s is not a valid IP address", annotationEnvoyAdminBind, raw)
+		}
+		address = raw
+	}
+
+	port := envoyAdminPort
+	if raw, ok := pod.Annotations[annotationEnvoyAdminPort]; ok && raw != "" {
+		p, err := strconv.Atoi(raw)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s annotation value of %s is not a valid integer", annotationEnvoyAdminPort, raw)
+		}
+		if p < 1 || p > 65535 {
+			return "", 0, fmt.Errorf("%s annotation value of %d is not in the valid port range 1-65535", annotationEnvoyAdminPort, p)
+		}
+		port = p
+	}
+	return address, port, nil
+}
+
+// envoyAdminAddr returns the host:port that the Envoy admin API is reached on from within the pod.
+func envoyAdminAddr(pod corev1.Pod) (string, error) {
+	address, port, err := envoyAdminBind(pod)
+	if err != nil {
+		return "", err
+	}
+	if net.ParseIP(address).IsUnspecified() {
+		address = defaultEnvoyAdminBindAddress
+	}
+	return net.JoinHostPort(address, strconv.Itoa(port)), nil
+}
+
+// validateEnvoyAdminBind returns an error if the Envoy admin bind annotations are invalid or if metrics
+// are merged but the admin API can't be reached on 127.0.0.1:19000, where consul-sidecar scrapes Envoy's
+// metrics from.
+func (h *Handler) validateEnvoyAdminBind(pod corev1.Pod) error {
+	address, port, err := envoyAdminBind(pod)
+	if err != nil {
+		return err
+	}
+	merged, err := h.MetricsConfig.shouldRunMergedMetricsServer(pod)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(address)
+	if merged && (port != envoyAdminPort || !(ip.IsUnspecified() || ip.Equal(net.ParseIP(defaultEnvoyAdminBindAddress)))) {
+		return fmt.Errorf("the Envoy admin API must be reachable on %s:%d when metrics are merged",
+			defaultEnvoyAdminBindAddress, envoyAdminPort)
+	}
+	return nil
+}
+
+// validateProxyPublicListenerPort returns an error if the port of the sidecar
+// proxy's public listener collides with the Envoy admin port, the Prometheus
+// scrape port or a port of one of the pod's containers.
+func (h *Handler) validateProxyPublicListenerPort(pod corev1.Pod) error {
+	port, _, err := proxyPublicListener(pod)
+	if err != nil {
+		return err
+	}
+	_, adminPort, err := envoyAdminBind(pod)
+	if err != nil {
+		return err
+	}
+	if port == adminPort {
+		return fmt.Errorf("sidecar proxy port %d collides with the Envoy admin port", port)
+	}
+
+	enableMetrics, err := h.MetricsConfig.enableMetrics(pod)
+	if err != nil {
+		return err
+	}
+	if enableMetrics {
+		prometheusScrapePort, err := h.MetricsConfig.prometheusScrapePort(pod)
+		if err != nil {
+			return err
+		}
+		if strconv.Itoa(port) == prometheusScrapePort {
+			return fmt.Errorf("sidecar proxy port %d collides with the Prometheus scrape port", port)
+		}
+	}
+
+	for _, c := range pod.Spec.Containers {
+		// A pre-existing Envoy sidecar container that is kept instead of being injected is expected to
+		// bind the public listener port.
+		if h.SkipExistingSidecars && c.Name == envoySidecarContainerName {
+			continue
+		}
+		for _, p := range c.Ports {
+			if int(p.ContainerPort) == port {
+				return fmt.Errorf("sidecar proxy port %d collides with a port of container %q", port, c.Name)
+			}
+		}
+	}
+	return nil
+}
+
 func (h *Handler) envoySidecarResources(pod corev1.Pod) (corev1.ResourceRequirements, error) {
 	resources := corev1.ResourceRequirements{
 		Limits:   corev1.ResourceList{},
@@ -43,6 +43,299 @@ func TestHandlerEnvoySidecar(t *testing.T) {
 	})
 }
 
+func TestHandlerEnvoySidecar_EnvFrom(t *testing.T) {
+	envFrom := []corev1.EnvFromSource{
+		{
+			ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tracing-config"}},
+		},
+		{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "tracing-creds"}},
+		},
+	}
+	h := Handler{EnvoyExtraEnvFrom: envFrom}
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationService: "foo",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "web",
+				},
+			},
+		},
+	}
+	container, err := h.envoySidecar(pod)
+	require.NoError(t, err)
+	require.Equal(t, envFrom, container.EnvFrom)
+
+	// No env sources are added unless configured.
+	h.EnvoyExtraEnvFrom = nil
+	container, err = h.envoySidecar(pod)
+	require.NoError(t, err)
+	require.Empty(t, container.EnvFrom)
+}
+
+func TestHandlerEnvoySidecar_VolumeMounts(t *testing.T) {
+	cases := map[string]struct {
+		annotation      string
+		expVolumeMounts []corev1.VolumeMount
+		expErr          string
+	}{
+		"single volume": {
+			annotation: "ca-bundle",
+			expVolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      volumeName,
+					MountPath: "/consul/connect-inject",
+				},
+				{
+					Name:      "ca-bundle",
+					MountPath: "/consul/sidecar-proxy-volumes/ca-bundle",
+				},
+			},
+		},
+		"multiple volumes": {
+			annotation: "ca-bundle, spiffe-socket",
+			expVolumeMounts: []corev1.VolumeMount{
+				{
+					Name:      volumeName,
+					MountPath: "/consul/connect-inject",
+				},
+				{
+					Name:      "ca-bundle",
+					MountPath: "/consul/sidecar-proxy-volumes/ca-bundle",
+				},
+				{
+					Name:      "spiffe-socket",
+					MountPath: "/consul/sidecar-proxy-volumes/spiffe-socket",
+				},
+			},
+		},
+		"volume not defined on the pod": {
+			annotation: "ca-bundle,missing",
+			expErr:     `consul.hashicorp.com/sidecar-proxy-volume-mounts annotation references volume "missing" which is not defined on the pod`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler{}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationSidecarProxyVolumeMounts: c.annotation,
+					},
+				},
+				Spec: corev1.PodSpec{
+					Volumes: []corev1.Volume{
+						{
+							Name: "ca-bundle",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "ca-bundle"},
+								},
+							},
+						},
+						{
+							Name: "spiffe-socket",
+							VolumeSource: corev1.VolumeSource{
+								HostPath: &corev1.HostPathVolumeSource{Path: "/run/spiffe"},
+							},
+						},
+					},
+					Containers: []corev1.Container{
+						{
+							Name: "web",
+						},
+					},
+				},
+			}
+			container, err := h.envoySidecar(pod)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expVolumeMounts, container.VolumeMounts)
+		})
+	}
+}
+
+func TestHandlerEnvoySidecar_Lifecycle(t *testing.T) {
+	preStop := func(drainTime string) *corev1.Lifecycle {
+		return &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{
+					Command: []string{
+						"/consul/connect-inject/consul-k8s", "envoy-lifecycle",
+						"-drain",
+						"-admin-addr=127.0.0.1:19000",
+						"-drain-time=" + drainTime,
+					},
+				},
+			},
+		}
+	}
+	cases := map[string]struct {
+		enableProxyLifecycle bool
+		annotations          map[string]string
+		expLifecycle         *corev1.Lifecycle
+		expErr               string
+	}{
+		"disabled": {
+			expLifecycle: nil,
+		},
+		"enabled with the default drain time": {
+			enableProxyLifecycle: true,
+			expLifecycle:         preStop("10s"),
+		},
+		"enabled with a drain time annotation": {
+			enableProxyLifecycle: true,
+			annotations:          map[string]string{annotationSidecarProxyDrainTime: "1m30s"},
+			expLifecycle:         preStop("1m30s"),
+		},
+		"drain time below a second": {
+			enableProxyLifecycle: true,
+			annotations:          map[string]string{annotationSidecarProxyDrainTime: "500ms"},
+			expLifecycle:         preStop("500ms"),
+		},
+		"admin bind override": {
+			enableProxyLifecycle: true,
+			annotations:          map[string]string{annotationEnvoyAdminBind: "10.0.0.1", annotationEnvoyAdminPort: "19100"},
+			expLifecycle: &corev1.Lifecycle{
+				PreStop: &corev1.Handler{
+					Exec: &corev1.ExecAction{
+						Command: []string{
+							"/consul/connect-inject/consul-k8s", "envoy-lifecycle",
+							"-drain",
+							"-admin-addr=10.0.0.1:19100",
+							"-drain-time=10s",
+						},
+					},
+				},
+			},
+		},
+		"enabled via annotation": {
+			annotations:  map[string]string{annotationEnableSidecarProxyLifecycle: "true"},
+			expLifecycle: preStop("10s"),
+		},
+		"disabled via annotation": {
+			enableProxyLifecycle: true,
+			annotations:          map[string]string{annotationEnableSidecarProxyLifecycle: "false"},
+			expLifecycle:         nil,
+		},
+		"invalid enable annotation": {
+			annotations: map[string]string{annotationEnableSidecarProxyLifecycle: "yes please"},
+			expErr:      `consul.hashicorp.com/enable-sidecar-proxy-lifecycle annotation value of yes please was invalid: strconv.ParseBool: parsing "yes please": invalid syntax`,
+		},
+		"invalid drain time": {
+			enableProxyLifecycle: true,
+			annotations:          map[string]string{annotationSidecarProxyDrainTime: "30"},
+			expErr:               `consul.hashicorp.com/sidecar-proxy-drain-time annotation value of 30 was invalid: time: missing unit in duration "30"`,
+		},
+		"negative drain time": {
+			enableProxyLifecycle: true,
+			annotations:          map[string]string{annotationSidecarProxyDrainTime: "-5s"},
+			expErr:               "consul.hashicorp.com/sidecar-proxy-drain-time annotation value of -5s must not be negative",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler{EnableProxyLifecycle: c.enableProxyLifecycle}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: c.annotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "web",
+						},
+					},
+				},
+			}
+			container, err := h.envoySidecar(pod)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expLifecycle, container.Lifecycle)
+		})
+	}
+}
+
+func TestHandlerEnvoySidecar_DependencyChecks(t *testing.T) {
+	cases := map[string]struct {
+		enableDependencyChecks bool
+		annotations            map[string]string
+		expReadyTimeout        string
+		expErr                 string
+	}{
+		"disabled": {},
+		"enabled with the default readiness wait": {
+			enableDependencyChecks: true,
+			expReadyTimeout:        "1m0s",
+		},
+		"enabled with a readiness wait annotation": {
+			enableDependencyChecks: true,
+			annotations:            map[string]string{annotationEnvoyReadinessWait: "2m"},
+			expReadyTimeout:        "2m0s",
+		},
+		"readiness wait below a second": {
+			enableDependencyChecks: true,
+			annotations:            map[string]string{annotationEnvoyReadinessWait: "1500ms"},
+			expReadyTimeout:        "1.5s",
+		},
+		"invalid readiness wait": {
+			enableDependencyChecks: true,
+			annotations:            map[string]string{annotationEnvoyReadinessWait: "soon"},
+			expErr:                 `consul.hashicorp.com/consul-envoy-readiness-wait annotation value of soon was invalid: time: invalid duration "soon"`,
+		},
+		"zero readiness wait": {
+			enableDependencyChecks: true,
+			annotations:            map[string]string{annotationEnvoyReadinessWait: "0s"},
+			expErr:                 "consul.hashicorp.com/consul-envoy-readiness-wait annotation value of 0s must be positive",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler{EnableDependencyChecks: c.enableDependencyChecks}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: c.annotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "web",
+						},
+					},
+				},
+			}
+			container, err := h.envoySidecar(pod)
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			if !c.enableDependencyChecks {
+				require.Nil(t, container.Lifecycle)
+				return
+			}
+			require.Nil(t, container.Lifecycle.PreStop)
+			require.Equal(t, []string{
+				"/consul/connect-inject/consul-k8s", "envoy-lifecycle",
+				"-wait-ready",
+				"-admin-addr=127.0.0.1:19000",
+				"-ready-timeout=" + c.expReadyTimeout,
+			}, container.Lifecycle.PostStart.Exec.Command)
+		})
+	}
+}
+
 // Test that if the user specifies a pod security context with the same uid as `envoyUserAndGroupID` that we return
 // an error to the handler.
 func TestHandlerEnvoySidecar_FailsWithDuplicatePodSecurityContextUID(t *testing.T) {
@@ -362,3 +655,150 @@ func TestHandlerEnvoySidecar_Resources(t *testing.T) {
 		})
 	}
 }
+
+func TestProxyPublicListener(t *testing.T) {
+	cases := map[string]struct {
+		annotations    map[string]string
+		expPort        int
+		expBindAddress string
+		expErr         string
+	}{
+		"no annotations": {
+			annotations:    nil,
+			expPort:        20000,
+			expBindAddress: "",
+		},
+		"port override": {
+			annotations: map[string]string{
+				annotationSidecarProxyPort: "21000",
+			},
+			expPort:        21000,
+			expBindAddress: "",
+		},
+		"port and bind address override": {
+			annotations: map[string]string{
+				annotationSidecarProxyPort:        "21000",
+				annotationSidecarProxyBindAddress: "127.0.0.1",
+			},
+			expPort:        21000,
+			expBindAddress: "127.0.0.1",
+		},
+		"non-numeric port": {
+			annotations: map[string]string{
+				annotationSidecarProxyPort: "public",
+			},
+			expErr: "consul.hashicorp.com/sidecar-proxy-port annotation value of public is not a valid integer",
+		},
+		"port out of range": {
+			annotations: map[string]string{
+				annotationSidecarProxyPort: "70000",
+			},
+			expErr: "consul.hashicorp.com/sidecar-proxy-port annotation value of 70000 is not in the valid port range 1-65535",
+		},
+		"invalid bind address": {
+			annotations: map[string]string{
+				annotationSidecarProxyBindAddress: "not-an-ip",
+			},
+			expErr: "consul.hashicorp.com/sidecar-proxy-bind-address annotation value of not-an-ip is not a valid IP address",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: c.annotations,
+				},
+			}
+			port, bindAddress, err := proxyPublicListener(pod)
+			if c.expErr != "" {
+				require.EqualError(err, c.expErr)
+				return
+			}
+			require.NoError(err)
+			require.Equal(c.expPort, port)
+			require.Equal(c.expBindAddress, bindAddress)
+		})
+	}
+}
+
+func TestHandlerValidateEnvoyAdminBind(t *testing.T) {
+	merged := map[string]string{
+		annotationEnableMetrics:        "true",
+		annotationEnableMetricsMerging: "true",
+		annotationPort:                 "8080",
+	}
+	withMerged := func(annotations map[string]string) map[string]string {
+		for k, v := range merged {
+			annotations[k] = v
+		}
+		return annotations
+	}
+	cases := map[string]struct {
+		annotations map[string]string
+		expAddr     string
+		expErr      string
+	}{
+		"no annotations": {
+			expAddr: "127.0.0.1:19000",
+		},
+		"unspecified address": {
+			annotations: map[string]string{annotationEnvoyAdminBind: "0.0.0.0"},
+			expAddr:     "127.0.0.1:19000",
+		},
+		"address and port": {
+			annotations: map[string]string{annotationEnvoyAdminBind: "10.0.0.1", annotationEnvoyAdminPort: "19100"},
+			expAddr:     "10.0.0.1:19100",
+		},
+		"IPv6 address": {
+			annotations: map[string]string{annotationEnvoyAdminBind: "::1"},
+			expAddr:     "[::1]:19000",
+		},
+		"invalid address": {
+			annotations: map[string]string{annotationEnvoyAdminBind: "pod-ip"},
+			expErr:      "consul.hashicorp.com/envoy-admin-bind annotation value of pod-ip is not a valid IP address",
+		},
+		"non-numeric port": {
+			annotations: map[string]string{annotationEnvoyAdminPort: "admin"},
+			expErr:      "consul.hashicorp.com/envoy-admin-port annotation value of admin is not a valid integer",
+		},
+		"port out of range": {
+			annotations: map[string]string{annotationEnvoyAdminPort: "0"},
+			expErr:      "consul.hashicorp.com/envoy-admin-port annotation value of 0 is not in the valid port range 1-65535",
+		},
+		"merged metrics with unspecified address": {
+			annotations: withMerged(map[string]string{annotationEnvoyAdminBind: "0.0.0.0"}),
+			expAddr:     "127.0.0.1:19000",
+		},
+		"merged metrics with pod address": {
+			annotations: withMerged(map[string]string{annotationEnvoyAdminBind: "10.0.0.1"}),
+			expErr:      "the Envoy admin API must be reachable on 127.0.0.1:19000 when metrics are merged",
+		},
+		"merged metrics with port override": {
+			annotations: withMerged(map[string]string{annotationEnvoyAdminPort: "19100"}),
+			expErr:      "the Envoy admin API must be reachable on 127.0.0.1:19000 when metrics are merged",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: c.annotations,
+				},
+			}
+			h := Handler{}
+			err := h.validateEnvoyAdminBind(pod)
+			if c.expErr != "" {
+				require.EqualError(err, c.expErr)
+				return
+			}
+			require.NoError(err)
+			addr, err := envoyAdminAddr(pod)
+			require.NoError(err)
+			require.Equal(c.expAddr, addr)
+		})
+	}
+}
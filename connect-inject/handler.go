@@ -1,12 +1,16 @@
 package connectinject
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/deckarep/golang-set"
 	"github.com/go-logr/logr"
@@ -16,8 +20,10 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -31,6 +37,28 @@ var (
 	kubeSystemNamespaces = mapset.NewSetWith(metav1.NamespaceSystem, metav1.NamespacePublic)
 )
 
+// Supported values of Handler.SharedProcessNamespacePolicy.
+const (
+	// SharedProcessNamespaceAllow injects pods sharing their process namespace like any other pod.
+	SharedProcessNamespaceAllow = "allow"
+	// SharedProcessNamespaceWarn injects pods sharing their process namespace and returns a warning to the client.
+	SharedProcessNamespaceWarn = "warn"
+	// SharedProcessNamespaceDeny rejects pods sharing their process namespace.
+	SharedProcessNamespaceDeny = "deny"
+)
+
+// Supported values of Handler.WindowsPodPolicy.
+const (
+	// WindowsPodSkip admits Windows pods without injecting them and returns a warning to the client.
+	WindowsPodSkip = "skip"
+	// WindowsPodDeny rejects Windows pods that would otherwise be injected.
+	WindowsPodDeny = "deny"
+)
+
+// namespaceCacheTTL is how long the handler remembers a Consul namespace to
+// exist before it checks it again.
+const namespaceCacheTTL = 5 * time.Minute
+
 // Handler is the HTTP handler for admission webhooks.
 type Handler struct {
 	ConsulClient *api.Client
@@ -46,10 +74,19 @@ type Handler struct {
 	// This image is used for the consul-sidecar container.
 	ImageConsulK8S string
 
+	// ImageConsulCopy is the container image the Consul binary is copied from
+	// into the pod by the copy init container. If empty, ImageConsul is used.
+	ImageConsulCopy string
+
 	// Optional: set when you need extra options to be set when running envoy
 	// See a list of args here: https://www.envoyproxy.io/docs/envoy/latest/operations/cli
 	EnvoyExtraArgs string
 
+	// EnvoyExtraEnvFrom are ConfigMaps and Secrets whose keys are added to the
+	// environment of the Envoy sidecar, e.g. for tracing credentials. They're
+	// looked up in the pod's namespace.
+	EnvoyExtraEnvFrom []corev1.EnvFromSource
+
 	// RequireAnnotation means that the annotation must be given to inject.
 	// If this is false, injection is default.
 	RequireAnnotation bool
@@ -58,11 +95,49 @@ type Handler struct {
 	// use for identity with connectInjection if ACLs are enabled
 	AuthMethod string
 
+	// ACLLoginRetries is the number of times the init container retries
+	// logging in with AuthMethod. If 0, the connect-init default of 3 is used.
+	ACLLoginRetries uint64
+
+	// ACLLoginTimeout is how long the init container keeps retrying logging in
+	// with AuthMethod for. If 0, only ACLLoginRetries limits logging in.
+	ACLLoginTimeout time.Duration
+
 	// The PEM-encoded CA certificate string
 	// to use when communicating with Consul clients over HTTPS.
 	// If not set, will use HTTP.
 	ConsulCACert string
 
+	// ConsulCACertSecretName is the name of a Secret holding the CA
+	// certificate to use when communicating with Consul clients over HTTPS
+	// under the ConsulCACertSecretKey key. If set, the Secret is mounted into
+	// the init container instead of writing ConsulCACert into its command,
+	// so the certificate doesn't show up in pod specs. The Secret must exist
+	// in the namespace of every injected pod.
+	ConsulCACertSecretName string
+
+	// ConsulCACertSecretKey is the key of the CA certificate in the
+	// ConsulCACertSecretName Secret. Defaults to "tls.crt".
+	ConsulCACertSecretKey string
+
+	// The PEM-encoded CA certificate string to use when the gRPC (xDS) port
+	// of Consul clients uses TLS but their HTTP port doesn't. This is ignored
+	// if ConsulCACert is set since gRPC then uses TLS with that CA.
+	// If neither is set, gRPC will use plaintext.
+	ConsulGRPCCACert string
+
+	// ConsulHTTPPort and ConsulHTTPSPort are the HTTP and HTTPS ports of
+	// Consul clients that the init container registers services with. The
+	// HTTPS port is used if ConsulCACert or ConsulCACertSecretName is set.
+	// They default to 8500 and 8501.
+	ConsulHTTPPort  int
+	ConsulHTTPSPort int
+
+	// ConsulGRPCPort is the gRPC (xDS) port of Consul clients that Envoy
+	// connects to. It uses TLS if ConsulCACert, ConsulCACertSecretName or
+	// ConsulGRPCCACert is set. Defaults to 8502.
+	ConsulGRPCPort int
+
 	// EnableNamespaces indicates that a user is running Consul Enterprise
 	// with version 1.7+ which is namespace aware. It enables Consul namespaces,
 	// with injection into either a single Consul namespace or mirrored from
@@ -75,12 +150,43 @@ type Handler struct {
 	// is applied before checking pod annotations.
 	AllowK8sNamespacesSet mapset.Set
 
+	// AllowConsulNamespaceOverridesSet is the set of Consul namespaces that pods
+	// may register their service in with the consul-namespace annotation instead
+	// of the namespace derived from their k8s namespace. It supports the special
+	// character `*` which allows any namespace. An empty set means pods can't
+	// override their namespace. Overrides are always rejected if an auth method
+	// is set since the pod's ACL token is only valid in its derived namespace.
+	AllowConsulNamespaceOverridesSet mapset.Set
+
 	// DenyK8sNamespacesSet is a set of k8s namespaces to explicitly deny
 	// injection and thus service registration with Consul. An empty set
 	// means that no namespaces are removed from consideration. This filter
 	// takes precedence over AllowK8sNamespacesSet.
 	DenyK8sNamespacesSet mapset.Set
 
+	// AlwaysAllowNamespacesSet is a set of k8s namespaces whose pods are always
+	// admitted without being mutated. It is checked before the request is decoded
+	// so that pods in these namespaces, e.g. critical system components, are never
+	// blocked by errors in the webhook. A nil set means no namespaces are always allowed.
+	AlwaysAllowNamespacesSet mapset.Set
+
+	// ObjectSelector is the label selector that the webhook configuration's
+	// objectSelector is set to, if any. Pods that don't match it, e.g. because the
+	// webhook configuration is out of date, are never injected. Pods that match it
+	// are still subject to the system namespaces, the allow/deny lists (deny wins)
+	// and PodLabelSelector, and an inject annotation on the pod or else on its
+	// ServiceAccount decides whether they're injected. Only matching pods without
+	// either annotation are injected by default, even if RequireAnnotation is true,
+	// since the API server filtered them in for injection. A nil selector means
+	// pods aren't selected by label.
+	ObjectSelector labels.Selector
+
+	// PodLabelSelector, if set, limits the pods that are injected to those
+	// matching it. The endpoints controller is given the same selector so that
+	// only the service instances of injected pods that still match it are
+	// registered.
+	PodLabelSelector labels.Selector
+
 	// ConsulDestinationNamespace is the name of the Consul namespace to register all
 	// injected services into if Consul namespaces are enabled and mirroring
 	// is disabled. This may be set, but will not be used if mirroring is enabled.
@@ -97,6 +203,12 @@ type Handler struct {
 	// `k8s-default` namespace.
 	K8SNSMirroringPrefix string
 
+	// K8SNSMirroringSeparator is added between K8SNSMirroringPrefix and the
+	// k8s namespace, e.g. if the prefix is "k8s" and the separator is "-",
+	// then the k8s `default` namespace is mirrored in Consul's `k8s-default`
+	// namespace. It's ignored if the prefix is empty.
+	K8SNSMirroringSeparator string
+
 	// CrossNamespaceACLPolicy is the name of the ACL policy to attach to
 	// any created Consul namespaces to allow cross namespace service discovery.
 	// Only necessary if ACLs are enabled.
@@ -109,6 +221,11 @@ type Handler struct {
 	DefaultProxyMemoryRequest resource.Quantity
 	DefaultProxyMemoryLimit   resource.Quantity
 
+	// DefaultProxyPublicListenerPort is the port the sidecar proxy's public
+	// listener is registered and bound on unless overridden with the
+	// consul.hashicorp.com/sidecar-proxy-port annotation. Defaults to 20000 if 0.
+	DefaultProxyPublicListenerPort int
+
 	// MetricsConfig contains metrics configuration from the inject-connect command and has methods to determine whether
 	// configuration should come from the default flags or annotations. The handler uses this to configure prometheus
 	// annotations and the merged metrics server.
@@ -118,25 +235,101 @@ type Handler struct {
 	// will be populated by the defaults provided in the initial flags.
 	InitContainerResources corev1.ResourceRequirements
 
+	// InitContainerRunAsUser is the non-root user id the connect-inject init
+	// container runs as when transparent proxy isn't enabled for the pod. With
+	// transparent proxy the init container has to run as root. If 0, the init
+	// container runs as the pod's user.
+	InitContainerRunAsUser int64
+
 	// Resource settings for Consul sidecar. All of these fields
 	// will be populated by the defaults provided in the initial flags.
 	ConsulSidecarResources corev1.ResourceRequirements
 
+	// EnableProxyLifecycle adds a preStop hook to the Envoy sidecar that drains its
+	// listeners and waits for in-flight connections to finish before Envoy is stopped.
+	// It may be overridden per pod via annotation.
+	EnableProxyLifecycle bool
+
+	// EnableDependencyChecks holds the pod's application containers until the
+	// Envoy sidecar is ready so that they can make requests through the mesh as
+	// soon as they start. Envoy is injected as the first container with a postStart
+	// hook that waits for it to be ready since Kubernetes doesn't start the next
+	// container until the hook completes. An init container can't be used since
+	// Envoy only starts after all init containers have completed.
+	EnableDependencyChecks bool
+
+	// SkipExistingSidecars skips injecting the Envoy sidecar or the consul-sidecar
+	// container into pods that already have a container with the same name, e.g.
+	// because it was created by another tool. The init containers and volumes are
+	// still injected.
+	SkipExistingSidecars bool
+
+	// SharedProcessNamespacePolicy controls how pods with shareProcessNamespace
+	// set are handled. The pod's other containers can see the Envoy sidecar's
+	// processes and, when running as root, access its filesystem and ACL token
+	// through /proc. Must be one of SharedProcessNamespaceAllow (the default if
+	// empty), SharedProcessNamespaceWarn or SharedProcessNamespaceDeny.
+	SharedProcessNamespacePolicy string
+
+	// WarnOnDeniedNamespaceInjection adds an admission warning to pods that
+	// set the inject annotation to true but are in a namespace on the deny
+	// list. The deny list always takes precedence; such pods are admitted
+	// without injection and the conflict is logged either way.
+	WarnOnDeniedNamespaceInjection bool
+
+	// RequireServicePort rejects pods that would be injected without a
+	// service port, i.e. that have no service port annotation and whose first
+	// container has no ports. Otherwise such pods are registered without a
+	// port and their sidecar proxy only proxies outbound traffic.
+	RequireServicePort bool
+
+	// MaxConsulAnnotations and MaxConsulAnnotationsSize limit the number of
+	// consul.hashicorp.com/ annotations of a pod and the total size in bytes
+	// of their keys and values. Pods exceeding either limit are rejected so
+	// that they can't bloat their registrations. No limit applies if 0.
+	MaxConsulAnnotations     int
+	MaxConsulAnnotationsSize int
+
+	// WindowsPodPolicy controls how pods scheduled onto Windows nodes are
+	// handled, since the injected init container and sidecars only run on
+	// Linux. Must be one of WindowsPodSkip (the default if empty) or
+	// WindowsPodDeny.
+	WindowsPodPolicy string
+
+	// MeshGatewayAddress, if set, is the host:port of the mesh gateway that
+	// services reach services in other datacenters through. It's added to
+	// injected pods in the annotationMeshGatewayAddress annotation and the
+	// CONSUL_MESH_GATEWAY_ADDRESS environment variable of their containers
+	// for apps that construct the URLs of remote services themselves.
+	MeshGatewayAddress string
+
 	// EnableTransparentProxy enables transparent proxy mode.
 	// This means that the injected init container will apply traffic redirection rules
 	// so that all traffic will go through the Envoy proxy.
 	EnableTransparentProxy bool
 
+	// Clientset is used to look up the ServiceAccount of pods that don't have
+	// the inject annotation so that workloads can be opted in or out of
+	// injection via their ServiceAccount's annotations. If nil, ServiceAccount
+	// annotations are ignored.
+	Clientset kubernetes.Interface
+
 	// Log
 	Log logr.Logger
 
-	decoder *admission.Decoder
+	decoder         *admission.Decoder
+	serviceAccounts *serviceAccountCache
+	namespaces      *namespaces.Cache
 }
 
 // Handle is the admission.Handler implementation that actually handles the
 // webhook request for admission control. This should be registered or
 // served via the controller runtime manager.
-func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Response {
+func (h *Handler) Handle(ctx context.Context, req admission.Request) admission.Response {
+	if h.AlwaysAllowNamespacesSet != nil && h.AlwaysAllowNamespacesSet.Contains(req.Namespace) {
+		return admission.Allowed(fmt.Sprintf("pods in namespace %s are always allowed", req.Namespace))
+	}
+
 	var pod corev1.Pod
 
 	// Decode the pod from the request
@@ -156,6 +349,10 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 		h.Log.Error(err, "error validating pod", "request name", req.Name)
 		return admission.Errored(http.StatusBadRequest, err)
 	}
+	if err := h.validateConsulNamespaceOverride(pod, req.Namespace); err != nil {
+		h.Log.Error(err, "error validating pod", "request name", req.Name)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
 
 	// Setup the default annotation values that are used for the container.
 	// This MUST be done before shouldInject is called since that function
@@ -167,18 +364,72 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 
 	// Check if we should inject, for example we don't inject in the
 	// system namespaces.
-	if shouldInject, err := h.shouldInject(pod, req.Namespace); err != nil {
+	if shouldInject, err := h.shouldInject(ctx, pod, req.Namespace); err != nil {
 		h.Log.Error(err, "error checking if should inject", "request name", req.Name)
 		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking if should inject: %s", err))
 	} else if !shouldInject {
+		if h.injectionDenied(pod, req.Namespace) {
+			warning := fmt.Sprintf("pod requests injection with the %s annotation but namespace %s is denied injection and the pod was not injected", annotationInject, req.Namespace)
+			h.Log.Info(warning, "request name", req.Name)
+			if h.WarnOnDeniedNamespaceInjection {
+				resp := admission.Allowed(warning)
+				resp.Warnings = []string{warning}
+				return resp
+			}
+		}
 		return admission.Allowed(fmt.Sprintf("%s %s does not require injection", pod.Kind, pod.Name))
 	}
 
+	if targetsWindows(pod) {
+		if h.WindowsPodPolicy == WindowsPodDeny {
+			err := errors.New("pods scheduled onto Windows nodes cannot be injected")
+			h.Log.Error(err, "error validating pod", "request name", req.Name)
+			return admission.Errored(http.StatusBadRequest, err)
+		}
+		warning := "pod is scheduled onto Windows nodes and was not injected: the Consul sidecars only run on Linux"
+		h.Log.Info(warning, "request name", req.Name)
+		resp := admission.Allowed(warning)
+		resp.Warnings = []string{warning}
+		return resp
+	}
+
+	// The proxy's public listener port can only be checked against the pod's other ports once
+	// its default has been set, and only pods that will be injected need to be checked.
+	if err := h.validateProxyPublicListenerPort(pod); err != nil {
+		h.Log.Error(err, "error validating pod", "request name", req.Name)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// The service port annotation has been defaulted to the first container
+	// port by now, so it's only empty if no port was set or found.
+	if h.RequireServicePort && pod.Annotations[annotationPort] == "" {
+		err := fmt.Errorf("pod has no %s annotation and its first container has no ports, a service port is required", annotationPort)
+		h.Log.Error(err, "error validating pod", "request name", req.Name)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	var warnings []string
+	if sharesProcessNamespace(pod) {
+		switch h.SharedProcessNamespacePolicy {
+		case SharedProcessNamespaceDeny:
+			err := errors.New("pods with shareProcessNamespace set cannot be injected")
+			h.Log.Error(err, "error validating pod", "request name", req.Name)
+			return admission.Errored(http.StatusBadRequest, err)
+		case SharedProcessNamespaceWarn:
+			warning := "pod shares its process namespace: its containers can see the processes of the injected Envoy sidecar"
+			h.Log.Info(warning, "request name", req.Name)
+			warnings = append(warnings, warning)
+		}
+	}
+
 	h.Log.Info("received pod", "name", pod.Name, "ns", pod.Namespace)
 
 	// Add our volume that will be shared by the init container and
 	// the sidecar for passing data in the pod.
 	pod.Spec.Volumes = append(pod.Spec.Volumes, h.containerVolume())
+	if h.ConsulCACertSecretName != "" {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, h.caCertVolume())
+	}
 
 	// Add the upstream services as environment variables for easy
 	// service discovery.
@@ -191,6 +442,18 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 		container.Env = append(container.Env, containerEnvVars...)
 	}
 
+	// Add the mesh gateway address before the sidecars are added so that
+	// only the pod's own containers get it.
+	if h.MeshGatewayAddress != "" {
+		pod.Annotations[annotationMeshGatewayAddress] = h.MeshGatewayAddress
+		for i := range pod.Spec.Containers {
+			pod.Spec.Containers[i].Env = append(pod.Spec.Containers[i].Env, corev1.EnvVar{
+				Name:  "CONSUL_MESH_GATEWAY_ADDRESS",
+				Value: h.MeshGatewayAddress,
+			})
+		}
+	}
+
 	// Add the init container which copies the Consul binary to /consul/connect-inject/.
 	initCopyContainer := h.containerInitCopyContainer()
 	pod.Spec.InitContainers = append(pod.Spec.InitContainers, initCopyContainer)
@@ -204,13 +467,32 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 	}
 	pod.Spec.InitContainers = append(pod.Spec.InitContainers, initContainer)
 
-	// Add the Envoy sidecar.
-	envoySidecar, err := h.envoySidecar(pod)
+	// Connect-native pods talk to the mesh themselves and get neither the Envoy
+	// sidecar nor the consul-sidecar, which only merges Envoy's metrics.
+	native, err := connectNativeEnabled(pod)
 	if err != nil {
-		h.Log.Error(err, "error configuring injection sidecar container", "request name", req.Name)
-		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring injection sidecar container: %s", err))
+		h.Log.Error(err, "error checking if the pod is Connect-native", "request name", req.Name)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	// Add the Envoy sidecar.
+	if native {
+		h.Log.Info("skipping injecting the Envoy sidecar since the pod is Connect-native", "request name", req.Name)
+	} else if h.SkipExistingSidecars && hasContainer(pod, envoySidecarContainerName) {
+		h.Log.Info("skipping injecting the Envoy sidecar since the pod already has a container with its name",
+			"request name", req.Name, "container", envoySidecarContainerName)
+	} else {
+		envoySidecar, err := h.envoySidecar(pod)
+		if err != nil {
+			h.Log.Error(err, "error configuring injection sidecar container", "request name", req.Name)
+			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring injection sidecar container: %s", err))
+		}
+		if h.EnableDependencyChecks {
+			pod.Spec.Containers = append([]corev1.Container{envoySidecar}, pod.Spec.Containers...)
+		} else {
+			pod.Spec.Containers = append(pod.Spec.Containers, envoySidecar)
+		}
 	}
-	pod.Spec.Containers = append(pod.Spec.Containers, envoySidecar)
 
 	// Now that the consul-sidecar no longer needs to re-register services periodically
 	// (that functionality lives in the endpoints-controller),
@@ -221,9 +503,13 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 		h.Log.Error(err, "error determining if metrics merging server should be run", "request name", req.Name)
 		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error determining if metrics merging server should be run: %s", err))
 	}
+	shouldRunMetricsMerging = shouldRunMetricsMerging && !native
 
 	// Add the consul-sidecar only if we need to run the metrics merging server.
-	if shouldRunMetricsMerging {
+	if shouldRunMetricsMerging && h.SkipExistingSidecars && hasContainer(pod, consulSidecarContainerName) {
+		h.Log.Info("skipping injecting the consul-sidecar since the pod already has a container with its name",
+			"request name", req.Name, "container", consulSidecarContainerName)
+	} else if shouldRunMetricsMerging {
 		consulSidecar, err := h.consulSidecar(pod)
 		if err != nil {
 			h.Log.Error(err, "error configuring consul sidecar container", "request name", req.Name)
@@ -237,7 +523,7 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 	pod.Annotations[keyInjectStatus] = injected
 
 	// Add annotations for metrics.
-	if err = h.prometheusAnnotations(&pod); err != nil {
+	if err = h.prometheusAnnotations(&pod, req.Namespace); err != nil {
 		h.Log.Error(err, "error configuring prometheus annotations", "request name", req.Name)
 		return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error configuring prometheus annotations: %s", err))
 	}
@@ -249,7 +535,7 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 
 	// Consul-ENT only: Add the Consul destination namespace as an annotation to the pod.
 	if h.EnableNamespaces {
-		pod.Annotations[annotationConsulNamespace] = h.consulNamespace(req.Namespace)
+		pod.Annotations[annotationConsulNamespace] = h.podConsulNamespace(pod, req.Namespace)
 	}
 
 	// Marshall the pod into JSON after it has the desired envs, annotations, labels,
@@ -268,28 +554,66 @@ func (h *Handler) Handle(_ context.Context, req admission.Request) admission.Res
 
 	// Check and potentially create Consul resources. This is done after
 	// all patches are created to guarantee no errors were encountered in
-	// that process before modifying the Consul cluster.
-	if h.EnableNamespaces {
-		if _, err := namespaces.EnsureExists(h.ConsulClient, h.consulNamespace(req.Namespace), h.CrossNamespaceACLPolicy); err != nil {
+	// that process before modifying the Consul cluster. Dry runs don't modify it.
+	if h.EnableNamespaces && (req.DryRun == nil || !*req.DryRun) {
+		if _, err := h.namespaces.EnsureExists(h.ConsulClient, h.podConsulNamespace(pod, req.Namespace), h.CrossNamespaceACLPolicy); err != nil {
 			h.Log.Error(err, "error checking or creating namespace",
-				"ns", h.consulNamespace(req.Namespace), "request name", req.Name)
+				"ns", h.podConsulNamespace(pod, req.Namespace), "request name", req.Name)
 			return admission.Errored(http.StatusInternalServerError, fmt.Errorf("error checking or creating namespace: %s", err))
 		}
 	}
 
 	// Return a Patched response along with the patches we intend on applying to the
 	// Pod received by the handler.
-	return admission.Patched(fmt.Sprintf("valid %s request", pod.Kind), patches...)
+	resp := admission.Patched(fmt.Sprintf("valid %s request", pod.Kind), patches...)
+	resp.Warnings = warnings
+	return resp
+}
+
+// sharesProcessNamespace returns true if the containers of the pod share a single process namespace.
+func sharesProcessNamespace(pod corev1.Pod) bool {
+	return pod.Spec.ShareProcessNamespace != nil && *pod.Spec.ShareProcessNamespace
+}
+
+// targetsWindows returns true if the pod can only be scheduled onto Windows nodes,
+// either through its nodeSelector or its required node affinity.
+func targetsWindows(pod corev1.Pod) bool {
+	if pod.Spec.NodeSelector[corev1.LabelOSStable] == "windows" {
+		return true
+	}
+	if pod.Spec.Affinity == nil || pod.Spec.Affinity.NodeAffinity == nil ||
+		pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return false
+	}
+	// The node selector terms are ORed so every term must require Windows.
+	terms := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	for _, term := range terms {
+		if !termRequiresWindows(term) {
+			return false
+		}
+	}
+	return len(terms) > 0
 }
 
-func (h *Handler) shouldInject(pod corev1.Pod, namespace string) (bool, error) {
+// termRequiresWindows returns true if nodes must run Windows to match the node selector term.
+func termRequiresWindows(term corev1.NodeSelectorTerm) bool {
+	for _, expr := range term.MatchExpressions {
+		if expr.Key == corev1.LabelOSStable && expr.Operator == corev1.NodeSelectorOpIn &&
+			len(expr.Values) == 1 && expr.Values[0] == "windows" {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) shouldInject(ctx context.Context, pod corev1.Pod, namespace string) (bool, error) {
 	// Don't inject in the Kubernetes system namespaces
 	if kubeSystemNamespaces.Contains(namespace) {
 		return false, nil
 	}
 
 	// Namespace logic
-	// If in deny list, don't inject
+	// If in deny list, don't inject, even if the pod requests injection.
 	if h.DenyK8sNamespacesSet.Contains(namespace) {
 		return false, nil
 	}
@@ -304,6 +628,18 @@ func (h *Handler) shouldInject(pod corev1.Pod, namespace string) (bool, error) {
 		return false, nil
 	}
 
+	// Be consistent with the API server's filtering in case it sent us a pod
+	// that the webhook's objectSelector doesn't match.
+	if h.ObjectSelector != nil && !h.ObjectSelector.Matches(labels.Set(pod.Labels)) {
+		return false, nil
+	}
+
+	// Pods not matching the pod label selector would never be registered by the
+	// endpoints controller, so their sidecars would never become ready.
+	if h.PodLabelSelector != nil && !h.PodLabelSelector.Matches(labels.Set(pod.Labels)) {
+		return false, nil
+	}
+
 	// If the explicit true/false is on, then take that value. Note that
 	// this has to be the last check since it sets a default value after
 	// all other checks.
@@ -311,7 +647,35 @@ func (h *Handler) shouldInject(pod corev1.Pod, namespace string) (bool, error) {
 		return strconv.ParseBool(raw)
 	}
 
-	return !h.RequireAnnotation, nil
+	// Otherwise, fall back to the inject annotation of the pod's ServiceAccount.
+	if h.Clientset != nil {
+		serviceAccountName := pod.Spec.ServiceAccountName
+		if serviceAccountName == "" {
+			serviceAccountName = "default"
+		}
+		// If the ServiceAccount can't be looked up, the pod is treated as if its
+		// ServiceAccount had no annotations rather than failing the admission request.
+		annotations, err := h.serviceAccounts.annotations(ctx, h.Clientset, namespace, serviceAccountName)
+		if err != nil {
+			h.Log.Error(err, "error looking up service account, ignoring its annotations", "name", serviceAccountName, "ns", namespace)
+		}
+		if raw, ok := annotations[annotationInject]; ok {
+			return strconv.ParseBool(raw)
+		}
+	}
+
+	// Pods selected by the webhook's objectSelector have opted in to injection.
+	return h.ObjectSelector != nil || !h.RequireAnnotation, nil
+}
+
+// injectionDenied returns true if the pod sets the inject annotation to true
+// but wasn't injected because its namespace is on the deny list.
+func (h *Handler) injectionDenied(pod corev1.Pod, namespace string) bool {
+	if !h.DenyK8sNamespacesSet.Contains(namespace) || pod.Annotations[keyInjectStatus] != "" {
+		return false
+	}
+	inject, err := strconv.ParseBool(pod.Annotations[annotationInject])
+	return err == nil && inject
 }
 
 func (h *Handler) defaultAnnotations(pod *corev1.Pod) error {
@@ -319,6 +683,15 @@ func (h *Handler) defaultAnnotations(pod *corev1.Pod) error {
 		pod.Annotations = make(map[string]string)
 	}
 
+	// The service name may be a template that's resolved from the pod's metadata.
+	if raw, ok := pod.Annotations[annotationService]; ok && strings.Contains(raw, "{{") {
+		serviceName, err := serviceNameFromTemplate(*pod, raw)
+		if err != nil {
+			return err
+		}
+		pod.Annotations[annotationService] = serviceName
+	}
+
 	// Default service port is the first port exported in the container
 	if _, ok := pod.ObjectMeta.Annotations[annotationPort]; !ok {
 		if cs := pod.Spec.Containers; len(cs) > 0 {
@@ -332,12 +705,47 @@ func (h *Handler) defaultAnnotations(pod *corev1.Pod) error {
 		}
 	}
 
+	// The endpoints controller reads the proxy's public listener port from
+	// the pod, so a non-default port has to be set as an annotation.
+	if _, ok := pod.Annotations[annotationSidecarProxyPort]; !ok {
+		if h.DefaultProxyPublicListenerPort != 0 && h.DefaultProxyPublicListenerPort != defaultProxyPublicListenerPort {
+			pod.Annotations[annotationSidecarProxyPort] = strconv.Itoa(h.DefaultProxyPublicListenerPort)
+		}
+	}
+
 	return nil
 }
 
+// serviceNameFromTemplate executes the connect-service annotation value raw as a template
+// with the pod's labels and annotations, e.g. {{ .Labels.app }}. It errors if the template
+// references a label or annotation the pod doesn't have or resolves to an empty name.
+func serviceNameFromTemplate(pod corev1.Pod, raw string) (string, error) {
+	tpl, err := template.New("service").Option("missingkey=error").Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%s annotation value of %q is not a valid template: %s", annotationService, raw, err)
+	}
+
+	data := struct {
+		Labels      map[string]string
+		Annotations map[string]string
+	}{
+		Labels:      pod.Labels,
+		Annotations: pod.Annotations,
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%s annotation value of %q could not be resolved from the pod: %s", annotationService, raw, err)
+	}
+	if buf.Len() == 0 {
+		return "", fmt.Errorf("%s annotation value of %q resolved to an empty service name", annotationService, raw)
+	}
+	return buf.String(), nil
+}
+
 // prometheusAnnotations sets the Prometheus scraping configuration
-// annotations on the Pod.
-func (h *Handler) prometheusAnnotations(pod *corev1.Pod) error {
+// annotations on the Pod, along with annotations identifying the service
+// for relabeling. k8sNamespace is the Kubernetes namespace of the Pod.
+func (h *Handler) prometheusAnnotations(pod *corev1.Pod, k8sNamespace string) error {
 	enableMetrics, err := h.MetricsConfig.enableMetrics(*pod)
 	if err != nil {
 		return err
@@ -347,11 +755,25 @@ func (h *Handler) prometheusAnnotations(pod *corev1.Pod) error {
 		return err
 	}
 	prometheusScrapePath := h.MetricsConfig.prometheusScrapePath(*pod)
+	prometheusScrapeScheme, err := h.MetricsConfig.prometheusScrapeScheme(*pod)
+	if err != nil {
+		return err
+	}
 
 	if enableMetrics {
 		pod.Annotations[annotationPrometheusScrape] = "true"
 		pod.Annotations[annotationPrometheusPort] = prometheusScrapePort
 		pod.Annotations[annotationPrometheusPath] = prometheusScrapePath
+		if prometheusScrapeScheme != "" {
+			pod.Annotations[annotationPrometheusScheme] = prometheusScrapeScheme
+		}
+
+		if serviceName := pod.Annotations[annotationService]; serviceName != "" {
+			pod.Annotations[annotationPrometheusService] = serviceName
+		}
+		if h.EnableNamespaces {
+			pod.Annotations[annotationPrometheusConsulNamespace] = h.podConsulNamespace(*pod, k8sNamespace)
+		}
 	}
 	return nil
 }
@@ -360,21 +782,334 @@ func (h *Handler) prometheusAnnotations(pod *corev1.Pod) error {
 // registered in based on the namespace options. It returns an
 // empty string if namespaces aren't enabled.
 func (h *Handler) consulNamespace(ns string) string {
-	return namespaces.ConsulNamespace(ns, h.EnableNamespaces, h.ConsulDestinationNamespace, h.EnableK8SNSMirroring, h.K8SNSMirroringPrefix)
+	return namespaces.ConsulNamespace(ns, h.EnableNamespaces, h.ConsulDestinationNamespace, h.EnableK8SNSMirroring,
+		namespaces.MirroringPrefix(h.K8SNSMirroringPrefix, h.K8SNSMirroringSeparator))
+}
+
+// podConsulNamespace returns the namespace that the service of pod should be
+// registered in: the namespace set by the pod's consul-namespace annotation or,
+// if it's not set, the namespace of k8sNamespace. It returns an empty string
+// if namespaces aren't enabled.
+func (h *Handler) podConsulNamespace(pod corev1.Pod, k8sNamespace string) string {
+	if ns := pod.Annotations[annotationConsulNamespace]; ns != "" && h.EnableNamespaces {
+		return ns
+	}
+	return h.consulNamespace(k8sNamespace)
+}
+
+// validateConsulNamespaceOverride returns an error if pod overrides the namespace
+// that its service is registered in with the consul-namespace annotation and either
+// the namespace isn't allowed or an auth method is set, since the pod's ACL token
+// is only valid in the namespace derived from k8sNamespace.
+func (h *Handler) validateConsulNamespaceOverride(pod corev1.Pod, k8sNamespace string) error {
+	ns := pod.Annotations[annotationConsulNamespace]
+	if !h.EnableNamespaces || ns == "" || ns == h.consulNamespace(k8sNamespace) {
+		return nil
+	}
+	if h.AuthMethod != "" {
+		return fmt.Errorf("%s annotation cannot be used with ACLs since the pod's ACL token is only valid in the Consul namespace %q",
+			annotationConsulNamespace, h.consulNamespace(k8sNamespace))
+	}
+	if !consulNamespaceOverrideAllowed(h.AllowConsulNamespaceOverridesSet, ns) {
+		return fmt.Errorf("%s annotation value of %q is not a Consul namespace that pods are allowed to register into",
+			annotationConsulNamespace, ns)
+	}
+	return nil
+}
+
+// consulNamespaceOverrideAllowed returns true if the Consul namespace ns is in
+// allowSet or allowSet contains `*`.
+func consulNamespaceOverrideAllowed(allowSet mapset.Set, ns string) bool {
+	return allowSet != nil && (allowSet.Contains("*") || allowSet.Contains(ns))
+}
+
+// hasContainer returns true if the pod has a container with the given name.
+func hasContainer(pod corev1.Pod, name string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Handler) validatePod(pod corev1.Pod) error {
+	// Check the annotations' size first so that oversized values aren't parsed.
+	if err := h.validateConsulAnnotationsSize(pod); err != nil {
+		return err
+	}
+
 	if _, ok := pod.Annotations[annotationProtocol]; ok {
 		return fmt.Errorf("the %q annotation is no longer supported. Instead, create a ServiceDefaults resource (see www.consul.io/docs/k8s/crds/upgrade-to-crds)",
 			annotationProtocol)
 	}
 
+	if pod.Annotations[annotationConsulNamespace] == namespaces.WildcardNamespace {
+		return fmt.Errorf("%s annotation cannot be the wildcard namespace %q", annotationConsulNamespace, namespaces.WildcardNamespace)
+	}
+
 	if _, ok := pod.Annotations[annotationSyncPeriod]; ok {
 		return fmt.Errorf("the %q annotation is no longer supported because consul-sidecar is no longer injected to periodically register services", annotationSyncPeriod)
 	}
+
+	if _, _, err := proxyPublicListener(pod); err != nil {
+		return err
+	}
+
+	if err := validateServicePort(pod); err != nil {
+		return err
+	}
+
+	if err := h.MetricsConfig.validateMetricsPorts(pod); err != nil {
+		return err
+	}
+
+	if err := h.validateEnvoyAdminBind(pod); err != nil {
+		return err
+	}
+
+	if _, err := h.MetricsConfig.prometheusScrapeScheme(pod); err != nil {
+		return err
+	}
+
+	if _, err := kubernetesHealthCheckEnabled(pod); err != nil {
+		return err
+	}
+
+	if _, err := grpcHealthCheck(pod, ""); err != nil {
+		return err
+	}
+
+	if _, err := sidecarProxyChecks(pod, nil); err != nil {
+		return err
+	}
+
+	if _, err := sidecarProxyVolumeMounts(pod); err != nil {
+		return err
+	}
+
+	if _, err := h.envoySidecarLifecycle(pod); err != nil {
+		return err
+	}
+
+	if _, err := proxyModeOverride(pod, h.EnableTransparentProxy); err != nil {
+		return err
+	}
+
+	if err := h.validateUpstreams(pod); err != nil {
+		return err
+	}
+	if err := validateUpstreamWeights(pod); err != nil {
+		return err
+	}
+	return validateAnnotationCombinations(pod)
+}
+
+// injectionOnlyAnnotations are the annotations that only take effect if the pod is injected.
+var injectionOnlyAnnotations = []string{
+	annotationService,
+	annotationUpstreams,
+	annotationEnableMetrics,
+	annotationEnableMetricsMerging,
+	annotationMergedMetricsPort,
+	annotationPrometheusScrapePort,
+	annotationPrometheusScrapePath,
+}
+
+// validateAnnotationCombinations returns an error if the pod sets annotations that contradict
+// each other, so that the ignored configuration doesn't go unnoticed.
+func validateAnnotationCombinations(pod corev1.Pod) error {
+	if inject, err := strconv.ParseBool(pod.Annotations[annotationInject]); err == nil && !inject {
+		for _, annotation := range injectionOnlyAnnotations {
+			if _, ok := pod.Annotations[annotation]; ok {
+				return fmt.Errorf("%s annotation can't be set if the %s annotation is false because the pod isn't injected", annotation, annotationInject)
+			}
+		}
+	}
+
+	tproxy, err := strconv.ParseBool(pod.Annotations[annotationTransparentProxy])
+	if err != nil || !tproxy {
+		return nil
+	}
+	if native, err := connectNativeEnabled(pod); err != nil {
+		return err
+	} else if native {
+		return fmt.Errorf("%s annotation can't be true if the %s annotation is true because Connect-native pods have no proxy to redirect traffic to",
+			annotationTransparentProxy, annotationConnectNative)
+	}
+	return nil
+}
+
+// validateConsulAnnotationsSize returns an error if the consul.hashicorp.com/
+// annotations of the pod exceed MaxConsulAnnotations or MaxConsulAnnotationsSize.
+func (h *Handler) validateConsulAnnotationsSize(pod corev1.Pod) error {
+	var count, size int
+	for k, v := range pod.Annotations {
+		if strings.HasPrefix(k, annotationPrefix) {
+			count++
+			size += len(k) + len(v)
+		}
+	}
+	if h.MaxConsulAnnotations > 0 && count > h.MaxConsulAnnotations {
+		return fmt.Errorf("pod has %d %s annotations, more than the maximum of %d", count, annotationPrefix, h.MaxConsulAnnotations)
+	}
+	if h.MaxConsulAnnotationsSize > 0 && size > h.MaxConsulAnnotationsSize {
+		return fmt.Errorf("the %s annotations of the pod are %d bytes, more than the maximum of %d", annotationPrefix, size, h.MaxConsulAnnotationsSize)
+	}
 	return nil
 }
 
+// validateUpstreams returns an error identifying the first malformed entry of the
+// upstreams annotation. Entries must be in the form <service>:<port>[:<datacenter>]
+// or prepared_query:<query>:<port>, where the port is a port number or the name of
+// a container port.
+func (h *Handler) validateUpstreams(pod corev1.Pod) error {
+	raw, ok := pod.Annotations[annotationUpstreams]
+	if !ok || raw == "" {
+		return nil
+	}
+
+	for i, upstream := range strings.Split(raw, ",") {
+		invalid := func(reason string) error {
+			return fmt.Errorf("%s annotation entry %d (%q) is invalid: %s", annotationUpstreams, i+1, strings.TrimSpace(upstream), reason)
+		}
+
+		parts := strings.SplitN(upstream, ":", 3)
+		for j := range parts {
+			parts[j] = strings.TrimSpace(parts[j])
+		}
+
+		var rawPort string
+		if parts[0] == "prepared_query" {
+			if len(parts) < 3 || parts[1] == "" {
+				return invalid("prepared query upstreams must be in the form prepared_query:<query>:<port>")
+			}
+			rawPort = parts[2]
+		} else {
+			if parts[0] == "" {
+				return invalid("missing service name")
+			}
+			if len(parts) < 2 || parts[1] == "" {
+				return invalid("missing port")
+			}
+			if _, _, _, err := h.k8sServiceUpstream(parts[0]); err != nil {
+				return err
+			}
+			if len(parts) > 2 && parts[2] == "" {
+				return invalid("datacenter is empty")
+			}
+			rawPort = parts[1]
+		}
+
+		if port, err := portValue(pod, rawPort); err != nil || port < 1 || port > 65535 {
+			return invalid(fmt.Sprintf("port %q is neither a port number in the range 1-65535 nor the name of a container port", rawPort))
+		}
+	}
+	return nil
+}
+
+// upstreamWeight is the share of traffic sent to one upstream by the upstream weights annotation.
+type upstreamWeight struct {
+	upstream string
+	weight   int
+}
+
+// parseUpstreamWeights parses the upstream weights annotation value raw. It errors unless
+// at least two distinct upstreams are weighted and their weights sum to 100.
+func parseUpstreamWeights(raw string) ([]upstreamWeight, error) {
+	var weights []upstreamWeight
+	seen := make(map[string]bool)
+	total := 0
+	for _, entry := range strings.Split(raw, ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		upstream := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || upstream == "" {
+			return nil, fmt.Errorf("%s annotation entry %q is invalid: must be in the form <upstream>=<weight>",
+				annotationUpstreamsWeights, strings.TrimSpace(entry))
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || weight < 1 || weight > 100 {
+			return nil, fmt.Errorf("%s annotation weight of upstream %q is not an integer in the range 1-100",
+				annotationUpstreamsWeights, upstream)
+		}
+		if seen[upstream] {
+			return nil, fmt.Errorf("%s annotation weights upstream %q more than once", annotationUpstreamsWeights, upstream)
+		}
+		seen[upstream] = true
+		total += weight
+		weights = append(weights, upstreamWeight{upstream: upstream, weight: weight})
+	}
+	if len(weights) < 2 {
+		return nil, fmt.Errorf("%s annotation must weight at least two upstreams", annotationUpstreamsWeights)
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("%s annotation weights sum to %d instead of 100", annotationUpstreamsWeights, total)
+	}
+	return weights, nil
+}
+
+// validateUpstreamWeights returns an error if the upstream weights annotation is malformed
+// or weights an upstream that isn't declared in the upstreams annotation or that is in
+// another datacenter, since ServiceSplitters can't split traffic between datacenters.
+func validateUpstreamWeights(pod corev1.Pod) error {
+	raw, ok := pod.Annotations[annotationUpstreamsWeights]
+	if !ok {
+		return nil
+	}
+	weights, err := parseUpstreamWeights(raw)
+	if err != nil {
+		return err
+	}
+
+	// declared maps the service of each declared upstream to whether it's in another datacenter.
+	declared := make(map[string]bool)
+	for _, upstream := range strings.Split(pod.Annotations[annotationUpstreams], ",") {
+		parts := strings.SplitN(upstream, ":", 3)
+		if name := strings.TrimSpace(parts[0]); name != "prepared_query" {
+			declared[name] = len(parts) > 2
+		}
+	}
+	for _, w := range weights {
+		remote, ok := declared[w.upstream]
+		if !ok {
+			return fmt.Errorf("%s annotation upstream %q is not declared in the %s annotation",
+				annotationUpstreamsWeights, w.upstream, annotationUpstreams)
+		}
+		if remote {
+			return fmt.Errorf("%s annotation upstream %q is in another datacenter", annotationUpstreamsWeights, w.upstream)
+		}
+	}
+	return nil
+}
+
+// k8sServiceUpstream returns the Consul service name and Consul namespace for
+// an upstream that references a Kubernetes Service by its DNS name. ok is false
+// if the upstream is a regular Consul service name.
+func (h *Handler) k8sServiceUpstream(raw string) (service string, namespace string, ok bool, err error) {
+	service, k8sNS, ok, err := parseK8sServiceUpstream(raw)
+	if !ok || err != nil {
+		return "", "", ok, err
+	}
+	return service, h.consulNamespace(k8sNS), true, nil
+}
+
+// parseK8sServiceUpstream parses the service portion of an upstream in the form
+// <service>.<namespace>.svc and returns the Kubernetes service name and
+// namespace. ok is false if raw does not reference a Kubernetes Service.
+// <service>.svc isn't a Kubernetes Service reference because it's the form of
+// an upstream in the Consul namespace "svc". Consul namespace names can't
+// contain dots, so a Kubernetes Service reference is never mistaken for one.
+func parseK8sServiceUpstream(raw string) (service string, namespace string, ok bool, err error) {
+	labels := strings.Split(raw, ".")
+	if len(labels) < 3 || labels[len(labels)-1] != "svc" {
+		return "", "", false, nil
+	}
+	if len(labels) != 3 || labels[0] == "" || labels[1] == "" {
+		return "", "", true, fmt.Errorf("upstream %q is invalid: Kubernetes Service upstreams must be in the form <service>.<namespace>.svc", raw)
+	}
+	return labels[0], labels[1], true, nil
+}
+
 func portValue(pod corev1.Pod, value string) (int32, error) {
 	// First search for the named port
 	for _, c := range pod.Spec.Containers {
@@ -390,6 +1125,33 @@ func portValue(pod corev1.Pod, value string) (int32, error) {
 	return int32(raw), err
 }
 
+// validateServicePort returns an error if the service port annotation is set to
+// neither a port number nor the name of a port of one of the pod's containers.
+// The error lists the names of the pod's ports to help fix the annotation.
+func validateServicePort(pod corev1.Pod) error {
+	raw, ok := pod.Annotations[annotationPort]
+	if !ok || raw == "" {
+		return nil
+	}
+	if _, err := portValue(pod, raw); err == nil {
+		return nil
+	}
+
+	var names []string
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name != "" {
+				names = append(names, p.Name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("%s annotation value of %q is not a port number and the pod has no named container ports", annotationPort, raw)
+	}
+	return fmt.Errorf("%s annotation value of %q is not a port number or the name of a container port, available port names are: %s",
+		annotationPort, raw, strings.Join(names, ", "))
+}
+
 func findServiceAccountVolumeMount(pod corev1.Pod) (corev1.VolumeMount, error) {
 	// Find the volume mount that is mounted at the known
 	// service account token location
@@ -413,5 +1175,10 @@ func findServiceAccountVolumeMount(pod corev1.Pod) (corev1.VolumeMount, error) {
 
 func (h *Handler) InjectDecoder(d *admission.Decoder) error {
 	h.decoder = d
+	// This is called once when the handler is registered with the webhook
+	// server so it's also where the ServiceAccount and namespace caches are
+	// created.
+	h.serviceAccounts = &serviceAccountCache{}
+	h.namespaces = &namespaces.Cache{TTL: namespaceCacheTTL}
 	return nil
 }
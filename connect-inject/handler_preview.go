@@ -0,0 +1,95 @@
+package connectinject
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"gomodules.xyz/jsonpatch/v2"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// maxPreviewBodySize is the maximum size of the pod manifest accepted by HandlePreview.
+const maxPreviewBodySize = 1 << 20
+
+// PreviewResponse is the response of HandlePreview.
+type PreviewResponse struct {
+	// Allowed is false if the webhook would reject the pod.
+	Allowed bool `json:"allowed"`
+	// Message is the reason the pod would be rejected or, if it's allowed,
+	// why it would or wouldn't be injected.
+	Message string `json:"message,omitempty"`
+	// Patch is the JSON patch the webhook would apply to the pod. It's empty
+	// if the pod wouldn't be injected.
+	Patch []jsonpatch.JsonPatchOperation `json:"patch"`
+	// Warnings are the warnings the webhook would return to the client.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// HandlePreview responds with the patch the webhook would apply to the pod in the JSON
+// manifest POSTed to it, without the pod being created. The pod is previewed in the namespace
+// set by the namespace query parameter, or else in its own namespace or the default namespace.
+// The admission request is a dry run so that no Consul namespace is created for the pod.
+// HandlePreview doesn't authenticate requests, so it mustn't be served alongside the webhook.
+func (h *Handler) HandlePreview(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, "only POST requests are supported", http.StatusMethodNotAllowed)
+		return
+	}
+	raw, err := ioutil.ReadAll(http.MaxBytesReader(rw, r.Body, maxPreviewBodySize))
+	if err != nil {
+		http.Error(rw, fmt.Sprintf("unable to read request body: %s", err), http.StatusBadRequest)
+		return
+	}
+	var pod corev1.Pod
+	if err := json.Unmarshal(raw, &pod); err != nil {
+		http.Error(rw, fmt.Sprintf("request body is not a valid pod manifest: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	namespace := r.URL.Query().Get("namespace")
+	if namespace == "" {
+		namespace = pod.Namespace
+	}
+	if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+	dryRun := true
+	resp := h.Handle(r.Context(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			UID:       "preview",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+			Name:      pod.Name,
+			Namespace: namespace,
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+			DryRun:    &dryRun,
+		},
+	})
+
+	preview := PreviewResponse{
+		Allowed:  resp.Allowed,
+		Patch:    resp.Patches,
+		Warnings: resp.Warnings,
+	}
+	if preview.Patch == nil {
+		preview.Patch = []jsonpatch.JsonPatchOperation{}
+	}
+	if resp.Result != nil {
+		preview.Message = resp.Result.Message
+		if preview.Message == "" {
+			preview.Message = string(resp.Result.Reason)
+		}
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(preview); err != nil {
+		h.Log.Error(err, "unable to write preview response")
+	}
+}
@@ -0,0 +1,133 @@
+package connectinject
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	mapset "github.com/deckarep/golang-set"
+	logrtest "github.com/go-logr/logr/testing"
+	capi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestHandlerHandlePreview(t *testing.T) {
+	t.Parallel()
+	s := runtime.NewScheme()
+	s.AddKnownTypes(schema.GroupVersion{
+		Group:   "",
+		Version: "v1",
+	}, &corev1.Pod{})
+	decoder, err := admission.NewDecoder(s)
+	require.NoError(t, err)
+
+	h := Handler{
+		Log:                   logrtest.TestLogger{T: t},
+		AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+		DenyK8sNamespacesSet:  mapset.NewSetWith("denied"),
+		decoder:               decoder,
+	}
+	pod := &corev1.Pod{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Pod",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "web",
+				},
+			},
+		},
+	}
+	raw := encodeRaw(t, pod).Raw
+
+	preview := func(h *Handler, method, query string, body []byte) (*httptest.ResponseRecorder, PreviewResponse) {
+		rec := httptest.NewRecorder()
+		h.HandlePreview(rec, httptest.NewRequest(method, "/preview"+query, bytes.NewReader(body)))
+		var resp PreviewResponse
+		if rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		}
+		return rec, resp
+	}
+
+	t.Run("patch matches the webhook's", func(t *testing.T) {
+		expected := h.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admissionv1.AdmissionRequest{
+				Namespace: "default",
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+		require.True(t, expected.Allowed)
+		require.NotEmpty(t, expected.Patches)
+
+		rec, resp := preview(&h, http.MethodPost, "", raw)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+		require.True(t, resp.Allowed)
+		require.Equal(t, "valid Pod request", resp.Message)
+		require.ElementsMatch(t, expected.Patches, resp.Patch)
+	})
+
+	t.Run("denied namespace has no patch", func(t *testing.T) {
+		rec, resp := preview(&h, http.MethodPost, "?namespace=denied", raw)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.True(t, resp.Allowed)
+		require.Empty(t, resp.Patch)
+		require.Contains(t, rec.Body.String(), `"patch":[]`)
+		require.Equal(t, "Pod web does not require injection", resp.Message)
+	})
+
+	t.Run("rejected pod", func(t *testing.T) {
+		rejected := pod.DeepCopy()
+		rejected.Annotations = map[string]string{annotationProtocol: "http"}
+		rec, resp := preview(&h, http.MethodPost, "", encodeRaw(t, rejected).Raw)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.False(t, resp.Allowed)
+		require.Empty(t, resp.Patch)
+		require.Contains(t, resp.Message, "annotation is no longer supported")
+	})
+
+	t.Run("invalid pod manifest", func(t *testing.T) {
+		rec, _ := preview(&h, http.MethodPost, "", []byte("not a pod"))
+		require.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("only POST is supported", func(t *testing.T) {
+		rec, _ := preview(&h, http.MethodGet, "", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+		require.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	})
+
+	t.Run("Consul namespaces aren't created", func(t *testing.T) {
+		consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("unexpected request to Consul %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		defer consulServer.Close()
+		consulClient, err := capi.NewClient(&capi.Config{Address: consulServer.URL})
+		require.NoError(t, err)
+
+		nsHandler := h
+		nsHandler.ConsulClient = consulClient
+		nsHandler.EnableNamespaces = true
+		rec, resp := preview(&nsHandler, http.MethodPost, "", raw)
+		require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+		require.True(t, resp.Allowed)
+		require.NotEmpty(t, resp.Patch)
+	})
+}
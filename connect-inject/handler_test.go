@@ -3,6 +3,7 @@ package connectinject
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"strings"
 	"testing"
 
@@ -13,8 +14,11 @@ import (
 	admissionv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
@@ -62,6 +66,153 @@ func TestHandlerHandle(t *testing.T) {
 			nil,
 		},
 
+		{
+			"always allowed namespace",
+			Handler{
+				Log:                      logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:    mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:     mapset.NewSet(),
+				AlwaysAllowNamespacesSet: mapset.NewSetWith("critical"),
+				decoder:                  decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "critical",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationInject: "true",
+							},
+						},
+						Spec: basicSpec,
+					}),
+				},
+			},
+			"",
+			nil,
+		},
+
+		{
+			"always allowed namespace with a request that can't be decoded",
+			Handler{
+				Log:                      logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:    mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:     mapset.NewSet(),
+				AlwaysAllowNamespacesSet: mapset.NewSetWith("critical"),
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "critical",
+					Object:    runtime.RawExtension{Raw: []byte("not a pod")},
+				},
+			},
+			"",
+			nil,
+		},
+
+		{
+			"always allowed namespace with an invalid pod",
+			Handler{
+				Log:                      logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:    mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:     mapset.NewSet(),
+				AlwaysAllowNamespacesSet: mapset.NewSetWith("critical"),
+				decoder:                  decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "critical",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationInject:        "true",
+								annotationUpstreams:     "not-a-valid-upstream",
+								annotationGRPCCheckPort: "not-a-port",
+							},
+						},
+						Spec: basicSpec,
+					}),
+				},
+			},
+			"",
+			nil,
+		},
+
+		{
+			"sidecar proxy volume mount of a volume not defined on the pod",
+			Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationSidecarProxyVolumeMounts: "ca-bundle",
+							},
+						},
+						Spec: basicSpec,
+					}),
+				},
+			},
+			`consul.hashicorp.com/sidecar-proxy-volume-mounts annotation references volume "ca-bundle" which is not defined on the pod`,
+			nil,
+		},
+
+		{
+			"invalid enable-health-check annotation",
+			Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationEnableHealthCheck: "no",
+							},
+						},
+						Spec: basicSpec,
+					}),
+				},
+			},
+			`consul.hashicorp.com/enable-health-check annotation value of no is not a valid boolean`,
+			nil,
+		},
+
+		{
+			"transparent proxy mode with transparent proxy disabled",
+			Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationProxyMode: "transparent",
+							},
+						},
+						Spec: basicSpec,
+					}),
+				},
+			},
+			`consul.hashicorp.com/proxy-mode annotation cannot be "transparent" when transparent proxy is disabled`,
+			nil,
+		},
+
 		{
 			"already injected",
 			Handler{
@@ -126,7 +277,171 @@ func TestHandlerHandle(t *testing.T) {
 			},
 		},
 
+		{
+			"pod with existing sidecar containers",
+			Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				SkipExistingSidecars:  true,
+				MetricsConfig: MetricsConfig{
+					DefaultEnableMetrics:        true,
+					DefaultEnableMetricsMerging: true,
+					DefaultMergedMetricsPort:    "20100",
+					DefaultPrometheusScrapePort: "20200",
+					DefaultPrometheusScrapePath: "/metrics",
+				},
+				decoder: decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Object: encodeRaw(t, &corev1.Pod{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name: "web",
+								},
+								{
+									Name:  "envoy-sidecar",
+									Ports: []corev1.ContainerPort{{ContainerPort: 20000}},
+								},
+								{
+									Name: "consul-sidecar",
+								},
+							},
+						},
+					}),
+				},
+			},
+			"",
+			[]jsonpatch.Operation{
+				{
+					Operation: "add",
+					Path:      "/metadata/labels",
+				},
+				{
+					Operation: "add",
+					Path:      "/metadata/annotations",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/volumes",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/initContainers",
+				},
+			},
+		},
+
+		{
+			"empty pod with dependency checks injects Envoy as the first container",
+			Handler{
+				Log:                    logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:  mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:   mapset.NewSet(),
+				EnableDependencyChecks: true,
+				decoder:                decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Object: encodeRaw(t, &corev1.Pod{
+						Spec: basicSpec,
+					}),
+				},
+			},
+			"",
+			[]jsonpatch.Operation{
+				{
+					Operation: "add",
+					Path:      "/metadata/labels",
+				},
+				{
+					Operation: "add",
+					Path:      "/metadata/annotations",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/volumes",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/initContainers",
+				},
+				// The web container moves to index 1 and index 0 is replaced by Envoy.
+				{
+					Operation: "add",
+					Path:      "/spec/containers/1",
+				},
+				{
+					Operation: "replace",
+					Path:      "/spec/containers/0/name",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/containers/0/command",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/containers/0/env",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/containers/0/volumeMounts",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/containers/0/lifecycle",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/containers/0/securityContext",
+				},
+			},
+		},
+
 		// todo: why is upstreams different then basic
+		{
+			"connect-native pod isn't injected with the Envoy sidecar",
+			Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			},
+			admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationConnectNative: "true",
+							},
+						},
+						Spec: basicSpec,
+					}),
+				},
+			},
+			"",
+			[]jsonpatch.Operation{
+				{
+					Operation: "add",
+					Path:      "/metadata/labels",
+				},
+				{
+					Operation: "add",
+					Path:      "/metadata/annotations/" + escapeJSONPointer(keyInjectStatus),
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/volumes",
+				},
+				{
+					Operation: "add",
+					Path:      "/spec/initContainers",
+				},
+			},
+		},
+
 		{
 			"pod with upstreams specified",
 			Handler{
@@ -490,7 +805,818 @@ func TestHandler_ErrorsOnDeprecatedAnnotations(t *testing.T) {
 	}
 }
 
-func TestHandlerDefaultAnnotations(t *testing.T) {
+// Test that we error out when contradictory annotations are set.
+func TestHandler_ErrorsOnContradictoryAnnotations(t *testing.T) {
+	cases := map[string]struct {
+		annotations map[string]string
+		expErr      string
+	}{
+		"inject false with service": {
+			annotations: map[string]string{
+				annotationInject:  "false",
+				annotationService: "web",
+			},
+			expErr: "consul.hashicorp.com/connect-service annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"inject false with upstreams": {
+			annotations: map[string]string{
+				annotationInject:    "false",
+				annotationUpstreams: "db:1234",
+			},
+			expErr: "consul.hashicorp.com/connect-service-upstreams annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"inject false with enable metrics": {
+			annotations: map[string]string{
+				annotationInject:        "false",
+				annotationEnableMetrics: "true",
+			},
+			expErr: "consul.hashicorp.com/enable-metrics annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"inject false with enable metrics merging": {
+			annotations: map[string]string{
+				annotationInject:               "false",
+				annotationEnableMetricsMerging: "true",
+			},
+			expErr: "consul.hashicorp.com/enable-metrics-merging annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"inject false with merged metrics port": {
+			annotations: map[string]string{
+				annotationInject:            "false",
+				annotationMergedMetricsPort: "20100",
+			},
+			expErr: "consul.hashicorp.com/merged-metrics-port annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"inject false with prometheus scrape port": {
+			annotations: map[string]string{
+				annotationInject:               "false",
+				annotationPrometheusScrapePort: "20200",
+			},
+			expErr: "consul.hashicorp.com/prometheus-scrape-port annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"inject false with prometheus scrape path": {
+			annotations: map[string]string{
+				annotationInject:               "false",
+				annotationPrometheusScrapePath: "/metrics",
+			},
+			expErr: "consul.hashicorp.com/prometheus-scrape-path annotation can't be set if the consul.hashicorp.com/connect-inject annotation is false because the pod isn't injected",
+		},
+		"transparent proxy with connect-native": {
+			annotations: map[string]string{
+				annotationTransparentProxy: "true",
+				annotationConnectNative:    "true",
+			},
+			expErr: "consul.hashicorp.com/transparent-proxy annotation can't be true if the consul.hashicorp.com/connect-inject-native annotation is true because Connect-native pods have no proxy to redirect traffic to",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(t, err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			}
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: c.annotations,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name: "web",
+								},
+							},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			require.False(t, response.Allowed)
+			require.Equal(t, c.expErr, response.Result.Message)
+		})
+	}
+
+	// Annotations that agree with each other are allowed.
+	require.NoError(t, validateAnnotationCombinations(corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				annotationInject:           "true",
+				annotationUpstreams:        "db:1234",
+				annotationTransparentProxy: "false",
+				annotationConnectNative:    "true",
+			},
+		},
+	}))
+}
+
+func TestHandler_ErrorsOnUnknownServicePort(t *testing.T) {
+	cases := map[string]struct {
+		containers []corev1.Container
+		expErr     string
+	}{
+		"no named ports": {
+			containers: []corev1.Container{
+				{
+					Name:  "web",
+					Ports: []corev1.ContainerPort{{ContainerPort: 8080}},
+				},
+			},
+			expErr: `consul.hashicorp.com/connect-service-port annotation value of "grpc" is not a port number and the pod has no named container ports`,
+		},
+		"named ports in multiple containers": {
+			containers: []corev1.Container{
+				{
+					Name:  "web",
+					Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}, {ContainerPort: 8081}},
+				},
+				{
+					Name:  "logger",
+					Ports: []corev1.ContainerPort{{Name: "logs", ContainerPort: 9000}},
+				},
+			},
+			expErr: `consul.hashicorp.com/connect-service-port annotation value of "grpc" is not a port number or the name of a container port, available port names are: http, logs`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			}
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{
+								annotationPort: "grpc",
+							},
+						},
+						Spec: corev1.PodSpec{
+							Containers: c.containers,
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			require.False(response.Allowed)
+			require.Equal(c.expErr, response.Result.Message)
+		})
+	}
+}
+
+// Test that pods sharing their process namespace are handled according to the
+// configured policy.
+func TestHandler_SharedProcessNamespace(t *testing.T) {
+	cases := map[string]struct {
+		policy      string
+		shared      bool
+		expAllowed  bool
+		expWarnings []string
+		expErr      string
+	}{
+		"default policy": {
+			shared:     true,
+			expAllowed: true,
+		},
+		"allow": {
+			policy:     SharedProcessNamespaceAllow,
+			shared:     true,
+			expAllowed: true,
+		},
+		"warn": {
+			policy:      SharedProcessNamespaceWarn,
+			shared:      true,
+			expAllowed:  true,
+			expWarnings: []string{"pod shares its process namespace: its containers can see the processes of the injected Envoy sidecar"},
+		},
+		"deny": {
+			policy: SharedProcessNamespaceDeny,
+			shared: true,
+			expErr: "pods with shareProcessNamespace set cannot be injected",
+		},
+		"deny with process namespace not shared": {
+			policy:     SharedProcessNamespaceDeny,
+			expAllowed: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                          logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:        mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:         mapset.NewSet(),
+				SharedProcessNamespacePolicy: c.policy,
+				decoder:                      decoder,
+			}
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						Spec: corev1.PodSpec{
+							ShareProcessNamespace: pointerToBool(c.shared),
+							Containers:            []corev1.Container{{Name: "web"}},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			require.Equal(c.expAllowed, response.Allowed)
+			if c.expErr != "" {
+				require.Equal(c.expErr, response.Result.Message)
+				return
+			}
+			require.NotEmpty(response.Patches)
+			require.Equal(c.expWarnings, response.Warnings)
+		})
+	}
+}
+
+func TestHandler_WindowsPods(t *testing.T) {
+	windowsAffinity := &corev1.Affinity{
+		NodeAffinity: &corev1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{
+				NodeSelectorTerms: []corev1.NodeSelectorTerm{
+					{
+						MatchExpressions: []corev1.NodeSelectorRequirement{
+							{
+								Key:      corev1.LabelOSStable,
+								Operator: corev1.NodeSelectorOpIn,
+								Values:   []string{"windows"},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	skipWarning := "pod is scheduled onto Windows nodes and was not injected: the Consul sidecars only run on Linux"
+
+	cases := map[string]struct {
+		policy       string
+		nodeSelector map[string]string
+		affinity     *corev1.Affinity
+		expInjected  bool
+		expWarnings  []string
+		expErr       string
+	}{
+		"linux pod": {
+			nodeSelector: map[string]string{corev1.LabelOSStable: "linux"},
+			expInjected:  true,
+		},
+		"default policy": {
+			nodeSelector: map[string]string{corev1.LabelOSStable: "windows"},
+			expWarnings:  []string{skipWarning},
+		},
+		"skip": {
+			policy:       WindowsPodSkip,
+			nodeSelector: map[string]string{corev1.LabelOSStable: "windows"},
+			expWarnings:  []string{skipWarning},
+		},
+		"skip with node affinity": {
+			policy:      WindowsPodSkip,
+			affinity:    windowsAffinity,
+			expWarnings: []string{skipWarning},
+		},
+		"deny": {
+			policy:       WindowsPodDeny,
+			nodeSelector: map[string]string{corev1.LabelOSStable: "windows"},
+			expErr:       "pods scheduled onto Windows nodes cannot be injected",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				WindowsPodPolicy:      c.policy,
+				decoder:               decoder,
+			}
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						Spec: corev1.PodSpec{
+							NodeSelector: c.nodeSelector,
+							Affinity:     c.affinity,
+							Containers:   []corev1.Container{{Name: "web"}},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			if c.expErr != "" {
+				require.False(response.Allowed)
+				require.Equal(c.expErr, response.Result.Message)
+				return
+			}
+			require.True(response.Allowed)
+			require.Equal(c.expInjected, len(response.Patches) > 0)
+			require.Equal(c.expWarnings, response.Warnings)
+		})
+	}
+}
+
+func TestHandler_MaxConsulAnnotations(t *testing.T) {
+	// The keys and values of the Consul annotations are 92 bytes in total.
+	annotations := map[string]string{
+		annotationService:      "web",
+		annotationUpstreams:    "db:1234",
+		"app.example.com/team": "payments",
+	}
+
+	cases := map[string]struct {
+		maxCount int
+		maxSize  int
+		expErr   string
+	}{
+		"no limits": {},
+		"at the count limit": {
+			maxCount: 2,
+		},
+		"above the count limit": {
+			maxCount: 1,
+			expErr:   "pod has 2 consul.hashicorp.com/ annotations, more than the maximum of 1",
+		},
+		"at the size limit": {
+			maxSize: 92,
+		},
+		"above the size limit": {
+			maxSize: 91,
+			expErr:  "the consul.hashicorp.com/ annotations of the pod are 92 bytes, more than the maximum of 91",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                      logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:    mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:     mapset.NewSet(),
+				MaxConsulAnnotations:     c.maxCount,
+				MaxConsulAnnotationsSize: c.maxSize,
+				decoder:                  decoder,
+			}
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: annotations,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "web", Ports: []corev1.ContainerPort{{ContainerPort: 8080}}}},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			if c.expErr != "" {
+				require.False(response.Allowed)
+				require.Equal(c.expErr, response.Result.Message)
+				return
+			}
+			require.True(response.Allowed)
+			require.NotEmpty(response.Patches)
+		})
+	}
+}
+
+func TestHandler_RequireServicePort(t *testing.T) {
+	cases := map[string]struct {
+		annotations map[string]string
+		ports       []corev1.ContainerPort
+		require     bool
+		expErr      string
+	}{
+		"no ports": {},
+		"no ports with port required": {
+			require: true,
+			expErr:  "pod has no consul.hashicorp.com/connect-service-port annotation and its first container has no ports, a service port is required",
+		},
+		"container port with port required": {
+			ports:   []corev1.ContainerPort{{ContainerPort: 8080}},
+			require: true,
+		},
+		"port annotation with port required": {
+			annotations: map[string]string{annotationPort: "8080"},
+			require:     true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				RequireServicePort:    c.require,
+				decoder:               decoder,
+			}
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: c.annotations,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "web", Ports: c.ports}},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			if c.expErr != "" {
+				require.False(response.Allowed)
+				require.Equal(c.expErr, response.Result.Message)
+				return
+			}
+			require.True(response.Allowed)
+			require.NotEmpty(response.Patches)
+		})
+	}
+}
+
+func TestHandler_MeshGatewayAddress(t *testing.T) {
+	cases := map[string]struct {
+		address     string
+		expEnv      []interface{}
+		expAnnotate bool
+	}{
+		"not configured": {},
+		"configured": {
+			address: "10.0.0.1:8443",
+			expEnv: []interface{}{
+				map[string]interface{}{"name": "CONSUL_MESH_GATEWAY_ADDRESS", "value": "10.0.0.1:8443"},
+			},
+			expAnnotate: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				MeshGatewayAddress:    c.address,
+				decoder:               decoder,
+			}
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "web"}},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			require.True(response.Allowed)
+
+			var annotations map[string]interface{}
+			var env []interface{}
+			for _, patch := range response.Patches {
+				switch patch.Path {
+				case "/metadata/annotations":
+					annotations = patch.Value.(map[string]interface{})
+				case "/spec/containers/0/env":
+					env = patch.Value.([]interface{})
+				case "/spec/containers/1":
+					// The Envoy sidecar doesn't get the address.
+					require.NotContains(patch.Value.(map[string]interface{})["env"], map[string]interface{}{
+						"name": "CONSUL_MESH_GATEWAY_ADDRESS", "value": c.address,
+					})
+				}
+			}
+			require.Equal(c.expEnv, env)
+			if c.expAnnotate {
+				require.Equal(c.address, annotations[annotationMeshGatewayAddress])
+			} else {
+				require.NotContains(annotations, annotationMeshGatewayAddress)
+			}
+		})
+	}
+}
+
+func TestHandler_ErrorsOnInvalidMetricsPorts(t *testing.T) {
+	cases := []struct {
+		name        string
+		annotations map[string]string
+		expErr      string
+	}{
+		{
+			"merged metrics port out of range",
+			map[string]string{
+				annotationMergedMetricsPort: "80",
+			},
+			"consul.hashicorp.com/merged-metrics-port annotation value of 80 is not in the unprivileged port range 1024-65535",
+		},
+		{
+			"prometheus scrape port out of range",
+			map[string]string{
+				annotationPrometheusScrapePort: "70000",
+			},
+			"consul.hashicorp.com/prometheus-scrape-port annotation value of 70000 is not in the unprivileged port range 1024-65535",
+		},
+		{
+			"non-numeric merged metrics port",
+			map[string]string{
+				annotationMergedMetricsPort: "metrics",
+			},
+			"consul.hashicorp.com/merged-metrics-port annotation value of metrics is not a valid integer",
+		},
+		{
+			"merged metrics port collides with the envoy admin port",
+			map[string]string{
+				annotationMergedMetricsPort: "19000",
+			},
+			"merged metrics port 19000 collides with the Envoy admin port",
+		},
+		{
+			"merged metrics port collides with the envoy public listener port",
+			map[string]string{
+				annotationMergedMetricsPort: "20000",
+			},
+			"merged metrics port 20000 collides with the Envoy public listener port",
+		},
+		{
+			"merged metrics port collides with an overridden envoy public listener port",
+			map[string]string{
+				annotationMergedMetricsPort: "21000",
+				annotationSidecarProxyPort:  "21000",
+			},
+			"merged metrics port 21000 collides with the Envoy public listener port",
+		},
+		{
+			"invalid prometheus scrape scheme",
+			map[string]string{
+				annotationPrometheusScrapeScheme: "tcp",
+			},
+			"consul.hashicorp.com/prometheus-scrape-scheme annotation value of tcp must be http or https",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			}
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: c.annotations,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name: "web",
+								},
+							},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			require.False(response.Allowed)
+			require.Equal(c.expErr, response.Result.Message)
+		})
+	}
+}
+
+func TestHandler_ValidatesUpstreams(t *testing.T) {
+	cases := map[string]struct {
+		upstreams string
+		weights   string
+		expErr    string
+	}{
+		"valid upstreams": {
+			upstreams: "db:1234, cache:http:dc2, prepared_query:search:5678, api.default.svc:2345",
+		},
+		"missing port": {
+			upstreams: "db:1234,cache",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams annotation entry 2 ("cache") is invalid: missing port`,
+		},
+		"non-numeric port": {
+			upstreams: "db:not-a-port",
+			expErr: `consul.hashicorp.com/connect-service-upstreams annotation entry 1 ("db:not-a-port") is invalid: ` +
+				`port "not-a-port" is neither a port number in the range 1-65535 nor the name of a container port`,
+		},
+		"port out of range": {
+			upstreams: "db:70000",
+			expErr: `consul.hashicorp.com/connect-service-upstreams annotation entry 1 ("db:70000") is invalid: ` +
+				`port "70000" is neither a port number in the range 1-65535 nor the name of a container port`,
+		},
+		"missing service name": {
+			upstreams: "db:1234, :2345",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams annotation entry 2 (":2345") is invalid: missing service name`,
+		},
+		"empty datacenter": {
+			upstreams: "db:1234:",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams annotation entry 1 ("db:1234:") is invalid: datacenter is empty`,
+		},
+		"prepared query without port": {
+			upstreams: "prepared_query:search",
+			expErr: `consul.hashicorp.com/connect-service-upstreams annotation entry 1 ("prepared_query:search") is invalid: ` +
+				`prepared query upstreams must be in the form prepared_query:<query>:<port>`,
+		},
+		"valid weights": {
+			upstreams: "web-v1:1234, web-v2:2345",
+			weights:   "web-v1=90, web-v2=10",
+		},
+		"malformed weight": {
+			upstreams: "web-v1:1234, web-v2:2345",
+			weights:   "web-v1=90, web-v2",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams-weights annotation entry "web-v2" is invalid: must be in the form <upstream>=<weight>`,
+		},
+		"non-numeric weight": {
+			upstreams: "web-v1:1234, web-v2:2345",
+			weights:   "web-v1=90, web-v2=ten",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams-weights annotation weight of upstream "web-v2" is not an integer in the range 1-100`,
+		},
+		"weights not summing to 100": {
+			upstreams: "web-v1:1234, web-v2:2345",
+			weights:   "web-v1=90, web-v2=20",
+			expErr:    "consul.hashicorp.com/connect-service-upstreams-weights annotation weights sum to 110 instead of 100",
+		},
+		"single weighted upstream": {
+			upstreams: "web-v1:1234",
+			weights:   "web-v1=100",
+			expErr:    "consul.hashicorp.com/connect-service-upstreams-weights annotation must weight at least two upstreams",
+		},
+		"duplicate weighted upstream": {
+			upstreams: "web-v1:1234",
+			weights:   "web-v1=50, web-v1=50",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams-weights annotation weights upstream "web-v1" more than once`,
+		},
+		"weighted upstream not declared": {
+			upstreams: "web-v1:1234",
+			weights:   "web-v1=90, web-v3=10",
+			expErr: `consul.hashicorp.com/connect-service-upstreams-weights annotation upstream "web-v3" is not declared in the ` +
+				`consul.hashicorp.com/connect-service-upstreams annotation`,
+		},
+		"weighted upstream in another datacenter": {
+			upstreams: "web-v1:1234, web-v2:2345:dc2",
+			weights:   "web-v1=90, web-v2=10",
+			expErr:    `consul.hashicorp.com/connect-service-upstreams-weights annotation upstream "web-v2" is in another datacenter`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                   logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				decoder:               decoder,
+			}
+
+			annotations := map[string]string{annotationUpstreams: c.upstreams}
+			if c.weights != "" {
+				annotations[annotationUpstreamsWeights] = c.weights
+			}
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: annotations,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "web",
+									Ports: []corev1.ContainerPort{{Name: "http", ContainerPort: 8080}},
+								},
+							},
+						},
+					}),
+				},
+			}
+
+			response := handler.Handle(context.Background(), request)
+			if c.expErr != "" {
+				require.False(response.Allowed)
+				require.Equal(c.expErr, response.Result.Message)
+				return
+			}
+			require.True(response.Allowed)
+			require.NotEmpty(response.Patches)
+		})
+	}
+}
+
+func TestHandlerDefaultAnnotations(t *testing.T) {
 	cases := []struct {
 		Name     string
 		Pod      *corev1.Pod
@@ -602,6 +1728,53 @@ func TestHandlerDefaultAnnotations(t *testing.T) {
 			},
 			"",
 		},
+
+		{
+			"basic pod, name templated from label",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{
+						"app": "web",
+					},
+					Annotations: map[string]string{
+						annotationService: "{{ .Labels.app }}-svc",
+					},
+				},
+
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						corev1.Container{
+							Name: "web",
+						},
+					},
+				},
+			},
+			map[string]string{
+				annotationService: "web-svc",
+			},
+			"",
+		},
+
+		{
+			"basic pod, name templated from missing label",
+			&corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationService: "{{ .Labels.app }}",
+					},
+				},
+
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						corev1.Container{
+							Name: "web",
+						},
+					},
+				},
+			},
+			nil,
+			"could not be resolved from the pod",
+		},
 	}
 
 	for _, tt := range cases {
@@ -618,20 +1791,129 @@ func TestHandlerDefaultAnnotations(t *testing.T) {
 				return
 			}
 
-			actual := tt.Pod.Annotations
-			if len(actual) == 0 {
-				actual = nil
+			actual := tt.Pod.Annotations
+			if len(actual) == 0 {
+				actual = nil
+			}
+			require.Equal(tt.Expected, actual)
+		})
+	}
+}
+
+func TestHandlerDefaultAnnotations_ProxyPublicListenerPort(t *testing.T) {
+	cases := map[string]struct {
+		defaultPort int
+		annotations map[string]string
+		expPort     string
+	}{
+		"no default port": {
+			defaultPort: 0,
+			expPort:     "",
+		},
+		"default port of 20000": {
+			defaultPort: 20000,
+			expPort:     "",
+		},
+		"non-default port": {
+			defaultPort: 21000,
+			expPort:     "21000",
+		},
+		"non-default port with annotation": {
+			defaultPort: 21000,
+			annotations: map[string]string{annotationSidecarProxyPort: "22000"},
+			expPort:     "22000",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			h := Handler{DefaultProxyPublicListenerPort: c.defaultPort}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: c.annotations}}
+			require.NoError(t, h.defaultAnnotations(pod))
+			require.Equal(t, c.expPort, pod.Annotations[annotationSidecarProxyPort])
+		})
+	}
+}
+
+func TestHandler_ErrorsOnCollidingProxyPublicListenerPort(t *testing.T) {
+	cases := map[string]struct {
+		defaultPort int
+		annotations map[string]string
+		ports       []corev1.ContainerPort
+		expErr      string
+	}{
+		"default port collides with a container port": {
+			ports:  []corev1.ContainerPort{{ContainerPort: 20000}},
+			expErr: `sidecar proxy port 20000 collides with a port of container "web"`,
+		},
+		"configured default port collides with a container port": {
+			defaultPort: 21000,
+			ports:       []corev1.ContainerPort{{ContainerPort: 8080}, {ContainerPort: 21000}},
+			expErr:      `sidecar proxy port 21000 collides with a port of container "web"`,
+		},
+		"annotated port collides with the envoy admin port": {
+			annotations: map[string]string{annotationSidecarProxyPort: "19000"},
+			expErr:      "sidecar proxy port 19000 collides with the Envoy admin port",
+		},
+		"annotated port collides with the prometheus scrape port": {
+			annotations: map[string]string{
+				annotationSidecarProxyPort:     "20200",
+				annotationEnableMetrics:        "true",
+				annotationPrometheusScrapePort: "20200",
+			},
+			expErr: "sidecar proxy port 20200 collides with the Prometheus scrape port",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                            logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:          mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:           mapset.NewSet(),
+				DefaultProxyPublicListenerPort: c.defaultPort,
+				decoder:                        decoder,
+			}
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: "default",
+					Object: encodeRaw(t, &corev1.Pod{
+						ObjectMeta: metav1.ObjectMeta{
+							Annotations: c.annotations,
+						},
+						Spec: corev1.PodSpec{
+							Containers: []corev1.Container{
+								{
+									Name:  "web",
+									Ports: c.ports,
+								},
+							},
+						},
+					}),
+				},
 			}
-			require.Equal(tt.Expected, actual)
+
+			response := handler.Handle(context.Background(), request)
+			require.False(response.Allowed)
+			require.Equal(c.expErr, response.Result.Message)
 		})
 	}
 }
 
 func TestHandlerPrometheusAnnotations(t *testing.T) {
 	cases := []struct {
-		Name     string
-		Handler  Handler
-		Expected map[string]string
+		Name        string
+		Handler     Handler
+		Annotations map[string]string
+		Expected    map[string]string
 	}{
 		{
 			Name: "Sets the correct prometheus annotations on the pod if metrics are enabled",
@@ -659,6 +1941,85 @@ func TestHandlerPrometheusAnnotations(t *testing.T) {
 			},
 			Expected: map[string]string{},
 		},
+		{
+			Name: "Sets the scheme annotation if a default scheme is configured",
+			Handler: Handler{
+				MetricsConfig: MetricsConfig{
+					DefaultEnableMetrics:          true,
+					DefaultPrometheusScrapePort:   "20200",
+					DefaultPrometheusScrapePath:   "/metrics",
+					DefaultPrometheusScrapeScheme: "https",
+				},
+			},
+			Expected: map[string]string{
+				annotationPrometheusScrape: "true",
+				annotationPrometheusPort:   "20200",
+				annotationPrometheusPath:   "/metrics",
+				annotationPrometheusScheme: "https",
+			},
+		},
+		{
+			Name: "Sets the scheme annotation if the scheme is annotated",
+			Handler: Handler{
+				MetricsConfig: MetricsConfig{
+					DefaultEnableMetrics:          true,
+					DefaultPrometheusScrapePort:   "20200",
+					DefaultPrometheusScrapePath:   "/metrics",
+					DefaultPrometheusScrapeScheme: "http",
+				},
+			},
+			Annotations: map[string]string{
+				annotationPrometheusScrapeScheme: "https",
+			},
+			Expected: map[string]string{
+				annotationPrometheusScrapeScheme: "https",
+				annotationPrometheusScrape:       "true",
+				annotationPrometheusPort:         "20200",
+				annotationPrometheusPath:         "/metrics",
+				annotationPrometheusScheme:       "https",
+			},
+		},
+		{
+			Name: "Sets the service and Consul namespace annotations if metrics are enabled",
+			Handler: Handler{
+				EnableNamespaces:           true,
+				ConsulDestinationNamespace: "consul-ns",
+				MetricsConfig: MetricsConfig{
+					DefaultEnableMetrics:        true,
+					DefaultPrometheusScrapePort: "20200",
+					DefaultPrometheusScrapePath: "/metrics",
+				},
+			},
+			Annotations: map[string]string{
+				annotationService: "web",
+			},
+			Expected: map[string]string{
+				annotationService:                   "web",
+				annotationPrometheusScrape:          "true",
+				annotationPrometheusPort:            "20200",
+				annotationPrometheusPath:            "/metrics",
+				annotationPrometheusService:         "web",
+				annotationPrometheusConsulNamespace: "consul-ns",
+			},
+		},
+		{
+			Name: "Does not set the service and Consul namespace annotations if metrics are not enabled",
+			Handler: Handler{
+				EnableNamespaces:           true,
+				ConsulDestinationNamespace: "consul-ns",
+				MetricsConfig: MetricsConfig{
+					DefaultEnableMetrics:        false,
+					DefaultPrometheusScrapePort: "20200",
+					DefaultPrometheusScrapePath: "/metrics",
+				},
+			},
+			Annotations: map[string]string{
+				annotationService: "web",
+			},
+			Expected: map[string]string{
+				annotationService: "web",
+			},
+		},
 	}
 
 	for _, tt := range cases {
@@ -666,8 +2027,11 @@ func TestHandlerPrometheusAnnotations(t *testing.T) {
 			require := require.New(t)
 			h := tt.Handler
 			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			for k, v := range tt.Annotations {
+				pod.Annotations[k] = v
+			}
 
-			err := h.prometheusAnnotations(pod)
+			err := h.prometheusAnnotations(pod, "default")
 			require.NoError(err)
 
 			require.Equal(pod.Annotations, tt.Expected)
@@ -742,105 +2106,427 @@ func TestHandlerPortValue(t *testing.T) {
 			int32(8080),
 			"",
 		},
+
+		{
+			"named port on a container other than the first",
+			&corev1.Pod{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						corev1.Container{
+							Name: "logger",
+							Ports: []corev1.ContainerPort{
+								corev1.ContainerPort{
+									Name:          "logs",
+									ContainerPort: 9000,
+								},
+							},
+						},
+
+						corev1.Container{
+							Name: "web",
+							Ports: []corev1.ContainerPort{
+								corev1.ContainerPort{
+									Name:          "http",
+									ContainerPort: 8080,
+								},
+							},
+						},
+					},
+				},
+			},
+			"http",
+			int32(8080),
+			"",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			require := require.New(t)
+
+			port, err := portValue(*tt.Pod, tt.Value)
+			if (tt.Err != "") != (err != nil) {
+				t.Fatalf("actual: %v, expected err: %v", err, tt.Err)
+			}
+			if tt.Err != "" {
+				require.Contains(err.Error(), tt.Err)
+				return
+			}
+
+			require.Equal(tt.Expected, port)
+		})
+	}
+}
+
+// Test consulNamespace function
+func TestConsulNamespace(t *testing.T) {
+	cases := []struct {
+		Name                       string
+		EnableNamespaces           bool
+		ConsulDestinationNamespace string
+		EnableK8SNSMirroring       bool
+		K8SNSMirroringPrefix       string
+		K8SNSMirroringSeparator    string
+		K8sNamespace               string
+		Expected                   string
+	}{
+		{
+			"namespaces disabled",
+			false,
+			"default",
+			false,
+			"",
+			"",
+			"namespace",
+			"",
+		},
+
+		{
+			"namespaces disabled, mirroring enabled",
+			false,
+			"default",
+			true,
+			"",
+			"",
+			"namespace",
+			"",
+		},
+
+		{
+			"namespaces disabled, mirroring enabled, prefix defined",
+			false,
+			"default",
+			true,
+			"test-",
+			"",
+			"namespace",
+			"",
+		},
+
+		{
+			"namespaces enabled, mirroring disabled",
+			true,
+			"default",
+			false,
+			"",
+			"",
+			"namespace",
+			"default",
+		},
+
+		{
+			"namespaces enabled, mirroring disabled, prefix defined",
+			true,
+			"default",
+			false,
+			"test-",
+			"",
+			"namespace",
+			"default",
+		},
+
+		{
+			"namespaces enabled, mirroring enabled",
+			true,
+			"default",
+			true,
+			"",
+			"",
+			"namespace",
+			"namespace",
+		},
+
+		{
+			"namespaces enabled, mirroring enabled, prefix defined",
+			true,
+			"default",
+			true,
+			"test-",
+			"",
+			"namespace",
+			"test-namespace",
+		},
+
+		{
+			"namespaces enabled, mirroring enabled, prefix and separator defined",
+			true,
+			"default",
+			true,
+			"test",
+			"-",
+			"namespace",
+			"test-namespace",
+		},
+
+		{
+			"namespaces enabled, mirroring enabled, separator defined without prefix",
+			true,
+			"default",
+			true,
+			"",
+			"-",
+			"namespace",
+			"namespace",
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.Name, func(t *testing.T) {
+			require := require.New(t)
+
+			h := Handler{
+				EnableNamespaces:           tt.EnableNamespaces,
+				ConsulDestinationNamespace: tt.ConsulDestinationNamespace,
+				EnableK8SNSMirroring:       tt.EnableK8SNSMirroring,
+				K8SNSMirroringPrefix:       tt.K8SNSMirroringPrefix,
+				K8SNSMirroringSeparator:    tt.K8SNSMirroringSeparator,
+			}
+
+			ns := h.consulNamespace(tt.K8sNamespace)
+
+			require.Equal(tt.Expected, ns)
+		})
+	}
+}
+
+// Test that the consul-namespace annotation overrides the namespace a pod's
+// service is registered in.
+func TestPodConsulNamespace(t *testing.T) {
+	cases := []struct {
+		Name                 string
+		EnableNamespaces     bool
+		EnableK8SNSMirroring bool
+		Annotation           string
+		K8sNamespace         string
+		Expected             string
+	}{
+		{
+			"namespaces disabled, annotation set",
+			false,
+			false,
+			"shared",
+			"namespace",
+			"",
+		},
+		{
+			"namespaces enabled, annotation unset",
+			true,
+			false,
+			"",
+			"namespace",
+			"default",
+		},
+		{
+			"namespaces enabled, annotation set",
+			true,
+			false,
+			"shared",
+			"namespace",
+			"shared",
+		},
+		{
+			"mirroring enabled, annotation unset",
+			true,
+			true,
+			"",
+			"namespace",
+			"namespace",
+		},
+		{
+			"mirroring enabled, annotation set",
+			true,
+			true,
+			"shared",
+			"namespace",
+			"shared",
+		},
 	}
 
 	for _, tt := range cases {
 		t.Run(tt.Name, func(t *testing.T) {
-			require := require.New(t)
+			h := Handler{
+				EnableNamespaces:           tt.EnableNamespaces,
+				ConsulDestinationNamespace: "default",
+				EnableK8SNSMirroring:       tt.EnableK8SNSMirroring,
+			}
+			r := EndpointsController{
+				EnableConsulNamespaces:     tt.EnableNamespaces,
+				ConsulDestinationNamespace: "default",
+				EnableNSMirroring:          tt.EnableK8SNSMirroring,
+			}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   tt.K8sNamespace,
+					Annotations: map[string]string{},
+				},
+			}
+			if tt.Annotation != "" {
+				pod.Annotations[annotationConsulNamespace] = tt.Annotation
+			}
 
-			port, err := portValue(*tt.Pod, tt.Value)
-			if (tt.Err != "") != (err != nil) {
-				t.Fatalf("actual: %v, expected err: %v", err, tt.Err)
+			require.Equal(t, tt.Expected, h.podConsulNamespace(pod, tt.K8sNamespace))
+			require.Equal(t, tt.Expected, r.podConsulNamespace(pod))
+		})
+	}
+}
+
+// Test that pods can only override the Consul namespace of their service with an
+// allowed namespace, and never if an auth method is set.
+func TestHandler_validateConsulNamespaceOverride(t *testing.T) {
+	cases := map[string]struct {
+		handler    Handler
+		annotation string
+		expErr     string
+	}{
+		"no override": {
+			handler: Handler{EnableNamespaces: true},
+		},
+		"namespaces disabled": {
+			handler:    Handler{},
+			annotation: "shared",
+		},
+		"override with the derived namespace": {
+			handler:    Handler{EnableNamespaces: true, ConsulDestinationNamespace: "shared"},
+			annotation: "shared",
+		},
+		"allowed override": {
+			handler:    Handler{EnableNamespaces: true, AllowConsulNamespaceOverridesSet: mapset.NewSetWith("shared")},
+			annotation: "shared",
+		},
+		"any override allowed": {
+			handler:    Handler{EnableNamespaces: true, AllowConsulNamespaceOverridesSet: mapset.NewSetWith("*")},
+			annotation: "shared",
+		},
+		"override not allowed": {
+			handler:    Handler{EnableNamespaces: true, AllowConsulNamespaceOverridesSet: mapset.NewSetWith("other")},
+			annotation: "shared",
+			expErr:     `consul.hashicorp.com/consul-namespace annotation value of "shared" is not a Consul namespace that pods are allowed to register into`,
+		},
+		"no overrides allowed": {
+			handler:    Handler{EnableNamespaces: true},
+			annotation: "shared",
+			expErr:     `consul.hashicorp.com/consul-namespace annotation value of "shared" is not a Consul namespace that pods are allowed to register into`,
+		},
+		"override with an auth method": {
+			handler: Handler{
+				EnableNamespaces:                 true,
+				EnableK8SNSMirroring:             true,
+				AuthMethod:                       "auth-method",
+				AllowConsulNamespaceOverridesSet: mapset.NewSetWith("*"),
+			},
+			annotation: "shared",
+			expErr:     `consul.hashicorp.com/consul-namespace annotation cannot be used with ACLs since the pod's ACL token is only valid in the Consul namespace "k8s"`,
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{}}}
+			if c.annotation != "" {
+				pod.Annotations[annotationConsulNamespace] = c.annotation
 			}
-			if tt.Err != "" {
-				require.Contains(err.Error(), tt.Err)
-				return
+			err := c.handler.validateConsulNamespaceOverride(pod, "k8s")
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+			} else {
+				require.NoError(t, err)
 			}
 
-			require.Equal(tt.Expected, port)
+			// The endpoints controller doesn't register the pods the handler rejects
+			// for overriding their namespace with one that isn't allowed.
+			if c.handler.AuthMethod == "" {
+				pod.Namespace = "k8s"
+				r := EndpointsController{
+					EnableConsulNamespaces:           c.handler.EnableNamespaces,
+					ConsulDestinationNamespace:       c.handler.ConsulDestinationNamespace,
+					AllowConsulNamespaceOverridesSet: c.handler.AllowConsulNamespaceOverridesSet,
+				}
+				require.Equal(t, c.expErr == "", r.podConsulNamespaceAllowed(pod))
+			}
 		})
 	}
 }
 
-// Test consulNamespace function
-func TestConsulNamespace(t *testing.T) {
+// Test k8sServiceUpstream function
+func TestHandlerK8sServiceUpstream(t *testing.T) {
 	cases := []struct {
-		Name                       string
-		EnableNamespaces           bool
-		ConsulDestinationNamespace string
-		EnableK8SNSMirroring       bool
-		K8SNSMirroringPrefix       string
-		K8sNamespace               string
-		Expected                   string
+		Name              string
+		Upstream          string
+		EnableNamespaces  bool
+		EnableMirroring   bool
+		ExpectedService   string
+		ExpectedNamespace string
+		ExpectedOK        bool
+		Err               string
 	}{
 		{
-			"namespaces disabled",
+			"consul service name",
+			"web",
 			false,
-			"default",
 			false,
 			"",
-			"namespace",
+			"",
+			false,
 			"",
 		},
-
 		{
-			"namespaces disabled, mirroring enabled",
+			"same namespace, namespaces disabled",
+			"web.default.svc",
 			false,
-			"default",
-			true,
+			false,
+			"web",
 			"",
-			"namespace",
+			true,
 			"",
 		},
-
 		{
-			"namespaces disabled, mirroring enabled, prefix defined",
-			false,
+			"same namespace, mirroring enabled",
+			"web.default.svc",
+			true,
+			true,
+			"web",
 			"default",
 			true,
-			"test-",
-			"namespace",
 			"",
 		},
-
 		{
-			"namespaces enabled, mirroring disabled",
+			"cross namespace, mirroring enabled",
+			"web.other.svc",
+			true,
+			true,
+			"web",
+			"other",
 			true,
-			"default",
-			false,
 			"",
-			"namespace",
-			"default",
 		},
-
 		{
-			"namespaces enabled, mirroring disabled, prefix defined",
+			"cross namespace, mirroring disabled",
+			"web.other.svc",
 			true,
-			"default",
 			false,
-			"test-",
-			"namespace",
-			"default",
+			"web",
+			"dest",
+			true,
+			"",
 		},
-
 		{
-			"namespaces enabled, mirroring enabled",
+			"consul namespace named svc",
+			"web.svc",
 			true,
-			"default",
 			true,
 			"",
-			"namespace",
-			"namespace",
+			"",
+			false,
+			"",
 		},
-
 		{
-			"namespaces enabled, mirroring enabled, prefix defined",
+			"empty service name",
+			".default.svc",
 			true,
-			"default",
 			true,
-			"test-",
-			"namespace",
-			"test-namespace",
+			"",
+			"",
+			true,
+			"upstream \".default.svc\" is invalid: Kubernetes Service upstreams must be in the form <service>.<namespace>.svc",
 		},
 	}
 
@@ -850,18 +2536,65 @@ func TestConsulNamespace(t *testing.T) {
 
 			h := Handler{
 				EnableNamespaces:           tt.EnableNamespaces,
-				ConsulDestinationNamespace: tt.ConsulDestinationNamespace,
-				EnableK8SNSMirroring:       tt.EnableK8SNSMirroring,
-				K8SNSMirroringPrefix:       tt.K8SNSMirroringPrefix,
+				ConsulDestinationNamespace: "dest",
+				EnableK8SNSMirroring:       tt.EnableMirroring,
 			}
 
-			ns := h.consulNamespace(tt.K8sNamespace)
-
-			require.Equal(tt.Expected, ns)
+			svc, ns, ok, err := h.k8sServiceUpstream(tt.Upstream)
+			require.Equal(tt.ExpectedOK, ok)
+			if tt.Err != "" {
+				require.EqualError(err, tt.Err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(tt.ExpectedService, svc)
+			require.Equal(tt.ExpectedNamespace, ns)
 		})
 	}
 }
 
+func TestHandler_ErrorsOnMalformedK8sServiceUpstream(t *testing.T) {
+	require := require.New(t)
+	s := runtime.NewScheme()
+	s.AddKnownTypes(schema.GroupVersion{
+		Group:   "",
+		Version: "v1",
+	}, &corev1.Pod{})
+	decoder, err := admission.NewDecoder(s)
+	require.NoError(err)
+
+	handler := Handler{
+		Log:                   logrtest.TestLogger{T: t},
+		AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+		DenyK8sNamespacesSet:  mapset.NewSet(),
+		decoder:               decoder,
+	}
+
+	request := admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{
+			Namespace: "default",
+			Object: encodeRaw(t, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						annotationUpstreams: "db:1234,web.a.b.svc:2345",
+					},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{
+							Name: "web",
+						},
+					},
+				},
+			}),
+		},
+	}
+
+	response := handler.Handle(context.Background(), request)
+	require.False(response.Allowed)
+	require.Equal("upstream \"web.a.b.svc\" is invalid: Kubernetes Service upstreams must be in the form <service>.<namespace>.svc", response.Result.Message)
+}
+
 // Test shouldInject function
 func TestShouldInject(t *testing.T) {
 	cases := []struct {
@@ -1157,7 +2890,7 @@ func TestShouldInject(t *testing.T) {
 				DenyK8sNamespacesSet:  tt.DenyK8sNamespacesSet,
 			}
 
-			injected, err := h.shouldInject(*tt.Pod, tt.K8sNamespace)
+			injected, err := h.shouldInject(context.Background(), *tt.Pod, tt.K8sNamespace)
 
 			require.Equal(nil, err)
 			require.Equal(tt.Expected, injected)
@@ -1165,6 +2898,321 @@ func TestShouldInject(t *testing.T) {
 	}
 }
 
+// Test that the inject annotation of the pod's ServiceAccount is used when the pod
+// doesn't have the inject annotation itself.
+// Tests that pods requesting injection in a denied namespace aren't injected
+// and get a warning if that's enabled.
+func TestHandler_InjectionDenied(t *testing.T) {
+	deniedWarning := "pod requests injection with the consul.hashicorp.com/connect-inject annotation but namespace denied is denied injection and the pod was not injected"
+
+	cases := map[string]struct {
+		namespace   string
+		annotations map[string]string
+		warn        bool
+		expInjected bool
+		expDenied   bool
+		expWarnings []string
+	}{
+		"requests injection in a denied namespace": {
+			namespace:   "denied",
+			annotations: map[string]string{annotationInject: "true"},
+			expDenied:   true,
+		},
+		"requests injection in a denied namespace with warning": {
+			namespace:   "denied",
+			annotations: map[string]string{annotationInject: "true"},
+			warn:        true,
+			expDenied:   true,
+			expWarnings: []string{deniedWarning},
+		},
+		"no inject annotation in a denied namespace": {
+			namespace: "denied",
+			warn:      true,
+		},
+		"opts out in a denied namespace": {
+			namespace:   "denied",
+			annotations: map[string]string{annotationInject: "false"},
+			warn:        true,
+		},
+		"requests injection in an allowed namespace": {
+			namespace:   "default",
+			annotations: map[string]string{annotationInject: "true"},
+			warn:        true,
+			expInjected: true,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require := require.New(t)
+			s := runtime.NewScheme()
+			s.AddKnownTypes(schema.GroupVersion{
+				Group:   "",
+				Version: "v1",
+			}, &corev1.Pod{})
+			decoder, err := admission.NewDecoder(s)
+			require.NoError(err)
+
+			handler := Handler{
+				Log:                            logrtest.TestLogger{T: t},
+				AllowK8sNamespacesSet:          mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:           mapset.NewSetWith("denied"),
+				WarnOnDeniedNamespaceInjection: c.warn,
+				decoder:                        decoder,
+			}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: c.annotations,
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "web"}},
+				},
+			}
+			require.Equal(c.expDenied, handler.injectionDenied(pod, c.namespace))
+
+			request := admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{
+					Namespace: c.namespace,
+					Object:    encodeRaw(t, &pod),
+				},
+			}
+			response := handler.Handle(context.Background(), request)
+			require.True(response.Allowed)
+			require.Equal(c.expInjected, len(response.Patches) > 0)
+			require.Equal(c.expWarnings, response.Warnings)
+		})
+	}
+}
+
+func TestShouldInject_ServiceAccountAnnotation(t *testing.T) {
+	cases := map[string]struct {
+		podAnnotations     map[string]string
+		serviceAccountName string
+		saAnnotations      map[string]string
+		lookupFails        bool
+		requireAnnotation  bool
+		expected           bool
+		expErr             string
+	}{
+		"service account opts in": {
+			serviceAccountName: "web",
+			saAnnotations:      map[string]string{annotationInject: "true"},
+			requireAnnotation:  true,
+			expected:           true,
+		},
+		"service account opts out": {
+			serviceAccountName: "web",
+			saAnnotations:      map[string]string{annotationInject: "false"},
+			requireAnnotation:  false,
+			expected:           false,
+		},
+		"default service account opts in": {
+			saAnnotations:     map[string]string{annotationInject: "true"},
+			requireAnnotation: true,
+			expected:          true,
+		},
+		"pod annotation takes precedence over service account": {
+			podAnnotations:     map[string]string{annotationInject: "false"},
+			serviceAccountName: "web",
+			saAnnotations:      map[string]string{annotationInject: "true"},
+			requireAnnotation:  true,
+			expected:           false,
+		},
+		"service account without annotation": {
+			serviceAccountName: "web",
+			requireAnnotation:  true,
+			expected:           false,
+		},
+		"service account does not exist": {
+			serviceAccountName: "does-not-exist",
+			requireAnnotation:  false,
+			expected:           true,
+		},
+		"service account lookup fails": {
+			serviceAccountName: "web",
+			saAnnotations:      map[string]string{annotationInject: "true"},
+			lookupFails:        true,
+			requireAnnotation:  true,
+			expected:           false,
+		},
+		"invalid service account annotation": {
+			serviceAccountName: "web",
+			saAnnotations:      map[string]string{annotationInject: "foo"},
+			requireAnnotation:  true,
+			expErr:             `strconv.ParseBool: parsing "foo": invalid syntax`,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			saName := c.serviceAccountName
+			if saName == "" || saName == "does-not-exist" {
+				saName = "default"
+			}
+			clientset := fake.NewSimpleClientset(&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        saName,
+					Namespace:   "default",
+					Annotations: c.saAnnotations,
+				},
+			})
+			if c.lookupFails {
+				clientset.PrependReactor("get", "serviceaccounts", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("connection refused")
+				})
+			}
+			h := Handler{
+				RequireAnnotation:     c.requireAnnotation,
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  mapset.NewSet(),
+				Clientset:             clientset,
+				Log:                   logrtest.TestLogger{T: t},
+			}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: c.podAnnotations,
+				},
+				Spec: corev1.PodSpec{
+					ServiceAccountName: c.serviceAccountName,
+				},
+			}
+
+			injected, err := h.shouldInject(context.Background(), pod, "default")
+			if c.expErr != "" {
+				require.EqualError(t, err, c.expErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, c.expected, injected)
+		})
+	}
+}
+
+func TestShouldInject_ObjectSelector(t *testing.T) {
+	cases := map[string]struct {
+		podLabels         map[string]string
+		podAnnotations    map[string]string
+		saAnnotations     map[string]string
+		namespace         string
+		denyNamespaces    mapset.Set
+		requireAnnotation bool
+		expected          bool
+	}{
+		"matching pod is injected without the inject annotation": {
+			podLabels:         map[string]string{"mesh": "enabled"},
+			namespace:         "default",
+			requireAnnotation: true,
+			expected:          true,
+		},
+		"pod that doesn't match is not injected": {
+			podLabels:         map[string]string{"mesh": "disabled"},
+			namespace:         "default",
+			requireAnnotation: false,
+			expected:          false,
+		},
+		"pod that doesn't match is not injected even with the inject annotation": {
+			podLabels:         map[string]string{"mesh": "disabled"},
+			podAnnotations:    map[string]string{annotationInject: "true"},
+			namespace:         "default",
+			requireAnnotation: false,
+			expected:          false,
+		},
+		"inject annotation opts a matching pod out": {
+			podLabels:         map[string]string{"mesh": "enabled"},
+			podAnnotations:    map[string]string{annotationInject: "false"},
+			namespace:         "default",
+			requireAnnotation: true,
+			expected:          false,
+		},
+		"service account inject annotation opts a matching pod out": {
+			podLabels:         map[string]string{"mesh": "enabled"},
+			saAnnotations:     map[string]string{annotationInject: "false"},
+			namespace:         "default",
+			requireAnnotation: true,
+			expected:          false,
+		},
+		"deny list takes precedence over a matching pod": {
+			podLabels:         map[string]string{"mesh": "enabled"},
+			namespace:         "denied",
+			denyNamespaces:    mapset.NewSetWith("denied"),
+			requireAnnotation: true,
+			expected:          false,
+		},
+		"system namespaces take precedence over a matching pod": {
+			podLabels:         map[string]string{"mesh": "enabled"},
+			namespace:         metav1.NamespaceSystem,
+			requireAnnotation: true,
+			expected:          false,
+		},
+	}
+
+	selector, err := labels.Parse("mesh=enabled")
+	require.NoError(t, err)
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			denyNamespaces := c.denyNamespaces
+			if denyNamespaces == nil {
+				denyNamespaces = mapset.NewSet()
+			}
+			h := Handler{
+				RequireAnnotation:     c.requireAnnotation,
+				AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+				DenyK8sNamespacesSet:  denyNamespaces,
+				ObjectSelector:        selector,
+				Clientset: fake.NewSimpleClientset(&corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:        "default",
+						Namespace:   c.namespace,
+						Annotations: c.saAnnotations,
+					},
+				}),
+			}
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      c.podLabels,
+					Annotations: c.podAnnotations,
+				},
+			}
+
+			injected, err := h.shouldInject(context.Background(), pod, c.namespace)
+			require.NoError(t, err)
+			require.Equal(t, c.expected, injected)
+		})
+	}
+}
+
+func TestShouldInject_PodLabelSelector(t *testing.T) {
+	selector, err := labels.Parse("mesh=enabled")
+	require.NoError(t, err)
+	h := Handler{
+		AllowK8sNamespacesSet: mapset.NewSetWith("*"),
+		DenyK8sNamespacesSet:  mapset.NewSet(),
+		PodLabelSelector:      selector,
+	}
+
+	cases := map[string]struct {
+		podLabels map[string]string
+		expected  bool
+	}{
+		"matching pod is injected":          {podLabels: map[string]string{"mesh": "enabled"}, expected: true},
+		"pod that doesn't match is skipped": {podLabels: map[string]string{"mesh": "disabled"}, expected: false},
+		"pod without labels is skipped":     {expected: false},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			pod := corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels:      c.podLabels,
+					Annotations: map[string]string{annotationInject: "true"},
+				},
+			}
+			injected, err := h.shouldInject(context.Background(), pod, "default")
+			require.NoError(t, err)
+			require.Equal(t, c.expected, injected)
+		})
+	}
+}
+
 // encodeRaw is a helper to encode some data into a RawExtension.
 func encodeRaw(t *testing.T, input interface{}) runtime.RawExtension {
 	data, err := json.Marshal(input)
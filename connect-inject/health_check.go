@@ -0,0 +1,44 @@
+package connectinject
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+)
+
+// CacheSyncer waits for a cache to sync. It is satisfied by the
+// controller-runtime manager's cache.
+type CacheSyncer interface {
+	WaitForCacheSync(ctx context.Context) bool
+}
+
+// HealthCheck serves the liveness and readiness endpoints of the webhook server.
+// The webhook server is only served once the manager has started so liveness always passes,
+// whereas readiness only passes once the manager's cache has synced because until then
+// the endpoints controller and the webhook can't read from Kubernetes.
+type HealthCheck struct {
+	// cacheSynced is set to 1 once the cache has synced. It is accessed atomically.
+	cacheSynced int32
+}
+
+// WaitForCacheSync blocks until cache has synced or ctx is cancelled and, if the cache
+// synced, marks the health check as ready.
+func (h *HealthCheck) WaitForCacheSync(ctx context.Context, cache CacheSyncer) {
+	if cache.WaitForCacheSync(ctx) {
+		atomic.StoreInt32(&h.cacheSynced, 1)
+	}
+}
+
+// HandleReady responds with 200 once the cache has synced and 503 until then.
+func (h *HealthCheck) HandleReady(rw http.ResponseWriter, _ *http.Request) {
+	if atomic.LoadInt32(&h.cacheSynced) == 0 {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// HandleLive always responds with 200.
+func (h *HealthCheck) HandleLive(rw http.ResponseWriter, _ *http.Request) {
+	rw.WriteHeader(http.StatusOK)
+}
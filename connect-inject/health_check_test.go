@@ -0,0 +1,75 @@
+package connectinject
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCacheSyncer is a CacheSyncer whose cache syncs once synced is closed.
+type fakeCacheSyncer struct {
+	synced chan struct{}
+}
+
+func (f *fakeCacheSyncer) WaitForCacheSync(ctx context.Context) bool {
+	select {
+	case <-f.synced:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+	var health HealthCheck
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health/ready", health.HandleReady)
+	mux.HandleFunc("/health/live", health.HandleLive)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	statusCode := func(path string) int {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	cache := &fakeCacheSyncer{synced: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		health.WaitForCacheSync(context.Background(), cache)
+	}()
+
+	// Before the cache has synced only liveness passes.
+	require.Equal(t, http.StatusServiceUnavailable, statusCode("/health/ready"))
+	require.Equal(t, http.StatusOK, statusCode("/health/live"))
+
+	close(cache.synced)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the cache to sync")
+	}
+
+	require.Equal(t, http.StatusOK, statusCode("/health/ready"))
+	require.Equal(t, http.StatusOK, statusCode("/health/live"))
+}
+
+func TestHealthCheck_CacheNeverSyncs(t *testing.T) {
+	t.Parallel()
+	var health HealthCheck
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	health.WaitForCacheSync(ctx, &fakeCacheSyncer{synced: make(chan struct{})})
+
+	rec := httptest.NewRecorder()
+	health.HandleReady(rec, httptest.NewRequest("GET", "/health/ready", nil))
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
@@ -15,6 +15,9 @@ type MetricsConfig struct {
 	DefaultMergedMetricsPort    string
 	DefaultPrometheusScrapePort string
 	DefaultPrometheusScrapePath string
+	// DefaultPrometheusScrapeScheme is the scheme Prometheus uses to scrape
+	// metrics. If empty, no scheme is set and Prometheus uses http.
+	DefaultPrometheusScrapeScheme string
 }
 
 type metricsPorts struct {
@@ -111,6 +114,19 @@ func (mc MetricsConfig) prometheusScrapePath(pod corev1.Pod) string {
 	return mc.DefaultPrometheusScrapePath
 }
 
+// prometheusScrapeScheme returns the scheme for Prometheus to scrape with, either via the default value in the handler,
+// or if it's been overridden via the annotation. It returns an error if the scheme is neither http nor https.
+func (mc MetricsConfig) prometheusScrapeScheme(pod corev1.Pod) (string, error) {
+	scheme := mc.DefaultPrometheusScrapeScheme
+	if raw, ok := pod.Annotations[annotationPrometheusScrapeScheme]; ok && raw != "" {
+		scheme = raw
+	}
+	if scheme != "" && scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("%s annotation value of %s must be http or https", annotationPrometheusScrapeScheme, scheme)
+	}
+	return scheme, nil
+}
+
 // serviceMetricsPort returns the port the service exposes metrics on. This will
 // default to the port used to register the service with Consul, and can be
 // overridden with the annotation if provided.
@@ -171,6 +187,47 @@ func (mc MetricsConfig) shouldRunMergedMetricsServer(pod corev1.Pod) (bool, erro
 	return false, nil
 }
 
+// validateMetricsPorts validates the merged metrics and Prometheus scrape port
+// annotations. Both must be numeric and in the unprivileged port range, and the
+// merged metrics port must not collide with the ports Envoy listens on.
+func (mc MetricsConfig) validateMetricsPorts(pod corev1.Pod) error {
+	for _, annotation := range []string{annotationMergedMetricsPort, annotationPrometheusScrapePort} {
+		if raw, ok := pod.Annotations[annotation]; ok && raw != "" {
+			if _, err := strconv.Atoi(raw); err != nil {
+				return fmt.Errorf("%s annotation value of %s is not a valid integer", annotation, raw)
+			}
+		}
+	}
+
+	mergedMetricsPort, err := mc.mergedMetricsPort(pod)
+	if err != nil {
+		return err
+	}
+	if _, err := mc.prometheusScrapePort(pod); err != nil {
+		return err
+	}
+
+	if mergedMetricsPort == "" {
+		return nil
+	}
+	proxyPort, _, err := proxyPublicListener(pod)
+	if err != nil {
+		return err
+	}
+	_, adminPort, err := envoyAdminBind(pod)
+	if err != nil {
+		return err
+	}
+	port, _ := strconv.Atoi(mergedMetricsPort)
+	if port == adminPort {
+		return fmt.Errorf("merged metrics port %d collides with the Envoy admin port", port)
+	}
+	if port == proxyPort {
+		return fmt.Errorf("merged metrics port %d collides with the Envoy public listener port", port)
+	}
+	return nil
+}
+
 // determineAndValidatePort behaves as follows:
 // If the annotation exists, validate the port and return it.
 // If the annotation does not exist, return the default port.
@@ -0,0 +1,108 @@
+package connectinject
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// serviceAccountCacheTTL is how long the annotations of a ServiceAccount are
+// cached for before being looked up again.
+const serviceAccountCacheTTL = 30 * time.Second
+
+// serviceAccountCacheMaxEntries is the maximum number of ServiceAccounts whose
+// annotations are cached.
+const serviceAccountCacheMaxEntries = 1024
+
+// serviceAccountCache caches the annotations of ServiceAccounts so that
+// every admission request doesn't result in a call to the Kubernetes API.
+// It holds at most serviceAccountCacheMaxEntries entries. The zero value is
+// ready to use and a nil cache doesn't cache lookups.
+type serviceAccountCache struct {
+	sync.Mutex
+	entries map[string]serviceAccountCacheEntry
+
+	// now returns the current time. It is only overridden in tests.
+	now func() time.Time
+}
+
+type serviceAccountCacheEntry struct {
+	annotations map[string]string
+	expiresAt   time.Time
+}
+
+// annotations returns the annotations of the ServiceAccount name in namespace.
+// If the ServiceAccount doesn't exist, no annotations and no error are returned.
+// Failed lookups aren't cached.
+func (c *serviceAccountCache) annotations(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (map[string]string, error) {
+	if c == nil {
+		return lookupServiceAccountAnnotations(ctx, clientset, namespace, name)
+	}
+
+	key := namespace + "/" + name
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	c.Lock()
+	entry, ok := c.entries[key]
+	c.Unlock()
+	if ok && now().Before(entry.expiresAt) {
+		return entry.annotations, nil
+	}
+
+	annotations, err := lookupServiceAccountAnnotations(ctx, clientset, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]serviceAccountCacheEntry)
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= serviceAccountCacheMaxEntries {
+		c.evict(now())
+	}
+	c.entries[key] = serviceAccountCacheEntry{
+		annotations: annotations,
+		expiresAt:   now().Add(serviceAccountCacheTTL),
+	}
+	return annotations, nil
+}
+
+// evict removes the expired entries from the cache or, if none have expired,
+// the entry that expires first. The cache must be locked.
+func (c *serviceAccountCache) evict(now time.Time) {
+	var firstKey string
+	var firstExpiry time.Time
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+			continue
+		}
+		if firstKey == "" || entry.expiresAt.Before(firstExpiry) {
+			firstKey, firstExpiry = key, entry.expiresAt
+		}
+	}
+	if len(c.entries) >= serviceAccountCacheMaxEntries {
+		delete(c.entries, firstKey)
+	}
+}
+
+// lookupServiceAccountAnnotations returns the annotations of the ServiceAccount name in namespace
+// from the Kubernetes API. If the ServiceAccount doesn't exist, no annotations and no error are returned.
+func lookupServiceAccountAnnotations(ctx context.Context, clientset kubernetes.Interface, namespace, name string) (map[string]string, error) {
+	sa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return sa.Annotations, nil
+}
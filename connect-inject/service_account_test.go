@@ -0,0 +1,78 @@
+package connectinject
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that ServiceAccount annotations are cached until the cache entry expires.
+func TestServiceAccountCache(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{annotationInject: "true"},
+		},
+	})
+	now := time.Now()
+	cache := &serviceAccountCache{now: func() time.Time { return now }}
+
+	annotations, err := cache.annotations(context.Background(), clientset, "default", "web")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{annotationInject: "true"}, annotations)
+
+	// Deleting the ServiceAccount isn't seen until the entry expires.
+	err = clientset.CoreV1().ServiceAccounts("default").Delete(context.Background(), "web", metav1.DeleteOptions{})
+	require.NoError(t, err)
+	annotations, err = cache.annotations(context.Background(), clientset, "default", "web")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{annotationInject: "true"}, annotations)
+
+	now = now.Add(serviceAccountCacheTTL)
+	annotations, err = cache.annotations(context.Background(), clientset, "default", "web")
+	require.NoError(t, err)
+	require.Nil(t, annotations)
+
+	// A nil cache always looks up the ServiceAccount.
+	var nilCache *serviceAccountCache
+	annotations, err = nilCache.annotations(context.Background(), clientset, "default", "web")
+	require.NoError(t, err)
+	require.Nil(t, annotations)
+}
+
+// Test that the cache holds at most serviceAccountCacheMaxEntries entries, evicting
+// expired entries first and otherwise the entry that expires first.
+func TestServiceAccountCache_Eviction(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	now := time.Now()
+	cache := &serviceAccountCache{now: func() time.Time { return now }}
+
+	for i := 0; i < serviceAccountCacheMaxEntries; i++ {
+		_, err := cache.annotations(context.Background(), clientset, "default", fmt.Sprintf("sa-%d", i))
+		require.NoError(t, err)
+		now = now.Add(time.Millisecond)
+	}
+	require.Len(t, cache.entries, serviceAccountCacheMaxEntries)
+
+	// Adding an entry to a full cache evicts the oldest entry.
+	_, err := cache.annotations(context.Background(), clientset, "default", "new")
+	require.NoError(t, err)
+	require.Len(t, cache.entries, serviceAccountCacheMaxEntries)
+	require.NotContains(t, cache.entries, "default/sa-0")
+	require.Contains(t, cache.entries, "default/sa-1")
+	require.Contains(t, cache.entries, "default/new")
+
+	// Once entries have expired, they're all evicted.
+	now = now.Add(serviceAccountCacheTTL)
+	_, err = cache.annotations(context.Background(), clientset, "default", "newer")
+	require.NoError(t, err)
+	require.Len(t, cache.entries, 1)
+	require.Contains(t, cache.entries, "default/newer")
+}
@@ -75,6 +75,18 @@ type ConfigEntryController struct {
 	// any created Consul namespaces to allow cross namespace service discovery.
 	// Only necessary if ACLs are enabled.
 	CrossNSACLPolicy string
+
+	// NoLeaderRetryInterval is how long to wait before retrying a reconcile
+	// that failed because the Consul servers have no leader, e.g. during a
+	// leader election. These reconciles are requeued without an error and
+	// without changing the resource's synced condition since the failure is
+	// expected to be transient. If zero, they fail like any other error.
+	NoLeaderRetryInterval time.Duration
+
+	// consulNamespaces caches the Consul namespaces that are known to exist
+	// so that reconciles don't check for them every time. It's shared by all
+	// CRD-specific controllers.
+	consulNamespaces namespaces.Cache
 }
 
 // ReconcileEntry reconciles an update to a resource. CRD-specific controller's
@@ -117,10 +129,13 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 			// Ignore the error where the config entry isn't found in Consul.
 			// It is indicative of desired state.
 			if err != nil && !isNotFoundErr(err) {
+				if result, ok := r.retryWithoutLeader(logger, err); ok {
+					return result, nil
+				}
 				return ctrl.Result{}, fmt.Errorf("getting config entry from consul: %w", err)
 			} else if err == nil {
 				// Only delete the resource from Consul if it is owned by our datacenter.
-				if entry.GetMeta()[common.DatacenterKey] == r.DatacenterName {
+				if managingDatacenter(entry) == r.DatacenterName {
 					_, err := r.ConsulClient.ConfigEntries().Delete(configEntry.ConsulKind(), configEntry.ConsulName(), &capi.WriteOptions{
 						Namespace: r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
 					})
@@ -130,7 +145,7 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 					}
 					logger.Info("deletion from Consul successful")
 				} else {
-					logger.Info("config entry in Consul was created in another datacenter - skipping delete from Consul", "external-datacenter", entry.GetMeta()[common.DatacenterKey])
+					logger.Info("config entry in Consul was created in another datacenter - skipping delete from Consul", "external-datacenter", managingDatacenter(entry))
 				}
 			}
 			// remove our finalizer from the list and update it.
@@ -157,7 +172,7 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 		// destination consul namespace first.
 		if r.EnableConsulNamespaces {
 			consulNS := r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource())
-			created, err := namespaces.EnsureExists(r.ConsulClient, consulNS, r.CrossNSACLPolicy)
+			created, err := r.consulNamespaces.EnsureExists(r.ConsulClient, consulNS, r.CrossNSACLPolicy)
 			if err != nil {
 				return r.syncFailed(ctx, logger, crdCtrl, configEntry, ConsulAgentError,
 					fmt.Errorf("creating consul namespace %q: %w", consulNS, err))
@@ -172,6 +187,9 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 			Namespace: r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
 		})
 		if err != nil {
+			// The namespace may have been deleted since it was cached, so
+			// check for it again next time.
+			r.consulNamespaces.Forget(r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()))
 			return r.syncFailed(ctx, logger, crdCtrl, configEntry, ConsulAgentError,
 				fmt.Errorf("writing config entry to consul: %w", err))
 		}
@@ -186,7 +204,7 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 	}
 
 	requiresMigration := false
-	sourceDatacenter := entry.GetMeta()[common.DatacenterKey]
+	sourceDatacenter := managingDatacenter(entry)
 
 	// Check if the config entry is managed by our datacenter.
 	// Do not process resource if the entry was not created within our datacenter
@@ -225,7 +243,7 @@ func (r *ConfigEntryController) ReconcileEntry(ctx context.Context, crdCtrl Cont
 		}
 		logger.Info("config entry updated", "request-time", writeMeta.RequestTime)
 		return r.syncSuccessful(ctx, crdCtrl, configEntry)
-	} else if requiresMigration && entry.GetMeta()[common.DatacenterKey] != r.DatacenterName {
+	} else if requiresMigration && managingDatacenter(entry) != r.DatacenterName {
 		// If we get here then we're doing a migration and the entry in Consul
 		// matches the entry in Kubernetes. We just need to update the metadata
 		// of the entry in Consul to say that it's now managed by Kubernetes.
@@ -266,7 +284,21 @@ func (r *ConfigEntryController) consulNamespace(configEntry capi.ConfigEntry, na
 	return ""
 }
 
+// retryWithoutLeader returns the result to requeue a reconcile that failed
+// with err and true if err is because the Consul servers have no leader and
+// NoLeaderRetryInterval is set.
+func (r *ConfigEntryController) retryWithoutLeader(logger logr.Logger, err error) (ctrl.Result, bool) {
+	if r.NoLeaderRetryInterval <= 0 || !isNoLeaderErr(err) {
+		return ctrl.Result{}, false
+	}
+	logger.Info("consul servers have no leader, retrying", "retry-after", r.NoLeaderRetryInterval, "err", err.Error())
+	return ctrl.Result{RequeueAfter: r.NoLeaderRetryInterval}, true
+}
+
 func (r *ConfigEntryController) syncFailed(ctx context.Context, logger logr.Logger, updater Controller, configEntry common.ConfigEntryResource, errType string, err error) (ctrl.Result, error) {
+	if result, ok := r.retryWithoutLeader(logger, err); ok {
+		return result, nil
+	}
 	configEntry.SetSyncedCondition(corev1.ConditionFalse, errType, err.Error())
 	if updateErr := updater.UpdateStatus(ctx, configEntry); updateErr != nil {
 		// Log the original error here because we are returning the updateErr.
@@ -281,6 +313,7 @@ func (r *ConfigEntryController) syncSuccessful(ctx context.Context, updater Cont
 	configEntry.SetSyncedCondition(corev1.ConditionTrue, "", "")
 	timeNow := metav1.NewTime(time.Now())
 	configEntry.SetLastSyncedTime(&timeNow)
+	lastSyncAge.setLastSyncedTime(configEntry.KubeKind(), timeNow.Time)
 	return ctrl.Result{}, updater.UpdateStatus(ctx, configEntry)
 }
 
@@ -296,6 +329,9 @@ func (r *ConfigEntryController) syncUnknownWithError(ctx context.Context,
 	errType string,
 	err error) (ctrl.Result, error) {
 
+	if result, ok := r.retryWithoutLeader(logger, err); ok {
+		return result, nil
+	}
 	configEntry.SetSyncedCondition(corev1.ConditionUnknown, errType, err.Error())
 	if updateErr := updater.UpdateStatus(ctx, configEntry); updateErr != nil {
 		// Log the original error here because we are returning the updateErr.
@@ -323,10 +359,39 @@ func (r *ConfigEntryController) nonMatchingMigrationError(kubeEntry common.Confi
 	return fmt.Errorf("migration failed: Kubernetes resource does not match existing Consul config entry: consul=%s, kube=%s", consulJSON, kubeJSON)
 }
 
+// ConsulDrift compares configEntry with the corresponding config entry in
+// Consul. It returns the reason they differ, or an empty string if the config
+// entry in Consul is managed by this datacenter and matches configEntry.
+func (r *ConfigEntryController) ConsulDrift(configEntry common.ConfigEntryResource) (string, error) {
+	consulEntry := configEntry.ToConsul(r.DatacenterName)
+	entry, _, err := r.ConsulClient.ConfigEntries().Get(configEntry.ConsulKind(), configEntry.ConsulName(), &capi.QueryOptions{
+		Namespace: r.consulNamespace(consulEntry, configEntry.ConsulMirroringNS(), configEntry.ConsulGlobalResource()),
+	})
+	if isNotFoundErr(err) {
+		return "config entry not found in Consul", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading config entry from consul: %w", err)
+	}
+	if sourceDatacenter := managingDatacenter(entry); sourceDatacenter != r.DatacenterName {
+		return sourceDatacenterMismatchErr(sourceDatacenter).Error(), nil
+	}
+	if !configEntry.MatchesConsul(entry) {
+		return "config entry in Consul does not match the custom resource", nil
+	}
+	return "", nil
+}
+
 func isNotFoundErr(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "404")
 }
 
+// isNoLeaderErr returns true if err is because the Consul servers have no
+// leader, which they return while a leader is being elected.
+func isNoLeaderErr(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "No cluster leader")
+}
+
 // containsString returns true if s is in slice.
 func containsString(slice []string, s string) bool {
 	for _, item := range slice {
@@ -337,6 +402,15 @@ func containsString(slice []string, s string) bool {
 	return false
 }
 
+// managingDatacenter returns the datacenter whose controller manages entry, a
+// config entry read from Consul, or an empty string if no controller manages it.
+func managingDatacenter(entry capi.ConfigEntry) string {
+	if !common.IsManagedBy(entry.GetMeta()) {
+		return ""
+	}
+	return common.EntryDatacenter(entry.GetMeta())
+}
+
 // sourceDatacenterMismatchErr returns an error for when the source datacenter
 // meta key does not match our datacenter. This could be because the config
 // entry was created directly in Consul or because it was created by another
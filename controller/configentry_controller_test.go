@@ -3,6 +3,10 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -22,6 +26,7 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 )
 
 const datacenterName = "datacenter"
@@ -1307,6 +1312,79 @@ func TestConfigEntryControllers_errorUpdatesSyncStatus(t *testing.T) {
 	req.Contains(errMsg, expErr)
 }
 
+// Test that the sync error shown in the Error column, i.e. the message of the
+// synced condition, is set when syncing fails and cleared once it succeeds.
+func TestConfigEntryControllers_clearsSyncErrorOnSuccess(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var lock sync.Mutex
+	failWrites := true
+	consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/config/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "PUT" && r.URL.Path == "/v1/config":
+			if failWrites {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte("write failed"))
+				return
+			}
+			w.Write([]byte("true"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer consulServer.Close()
+	consulClient, err := capi.NewClient(&capi.Config{Address: consulServer.URL})
+	require.NoError(t, err)
+
+	svcDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaults)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(svcDefaults).Build()
+	r := &ServiceDefaultsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   consulClient,
+			DatacenterName: datacenterName,
+		},
+	}
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "foo"}
+
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+	require.Error(t, err)
+	require.NoError(t, fakeClient.Get(ctx, namespacedName, svcDefaults))
+	status, reason, errMsg := svcDefaults.SyncedCondition()
+	require.Equal(t, corev1.ConditionFalse, status)
+	require.Equal(t, ConsulAgentError, reason)
+	require.Contains(t, errMsg, "write failed")
+
+	lock.Lock()
+	failWrites = false
+	lock.Unlock()
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	synced := &v1alpha1.ServiceDefaults{}
+	require.NoError(t, fakeClient.Get(ctx, namespacedName, synced))
+	status, reason, errMsg = synced.SyncedCondition()
+	require.Equal(t, corev1.ConditionTrue, status)
+	require.Empty(t, reason)
+	require.Empty(t, errMsg)
+	require.NotNil(t, synced.Status.LastSyncedTime)
+}
+
 // Test that if the config entry hasn't changed in Consul but our resource
 // synced status isn't set to true then we update its status.
 func TestConfigEntryControllers_setsSyncedToTrue(t *testing.T) {
@@ -1376,6 +1454,73 @@ func TestConfigEntryControllers_setsSyncedToTrue(t *testing.T) {
 	req.Equal(corev1.ConditionTrue, svcDefaults.SyncedConditionStatus())
 }
 
+// Test that a successful sync updates the last sync age metric of the
+// resource's kind. This test isn't run in parallel because the metric is
+// shared by all controllers.
+func TestConfigEntryControllers_updatesLastSyncAgeMetric(t *testing.T) {
+	kubeNS := "default"
+	req := require.New(t)
+	ctx := context.Background()
+	s := runtime.NewScheme()
+	svcDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: kubeNS,
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaults)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(svcDefaults).Build()
+
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	req.NoError(err)
+	defer consul.Stop()
+
+	consul.WaitForServiceIntentions(t)
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+	})
+	req.NoError(err)
+	reconciler := &ServiceDefaultsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   consulClient,
+			DatacenterName: datacenterName,
+		},
+	}
+
+	before := time.Now()
+	_, err = reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: types.NamespacedName{Namespace: kubeNS, Name: svcDefaults.KubernetesName()},
+	})
+	req.NoError(err)
+
+	// Read the age the metrics endpoint would serve for the resource's kind.
+	families, err := metrics.Registry.Gather()
+	req.NoError(err)
+	var age float64
+	found := false
+	for _, family := range families {
+		if family.GetName() != "consul_k8s_config_entry_last_sync_age_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "kind" && label.GetValue() == svcDefaults.KubeKind() {
+					age = metric.GetGauge().GetValue()
+					found = true
+				}
+			}
+		}
+	}
+	req.True(found)
+	req.GreaterOrEqual(age, 0.0)
+	req.LessOrEqual(age, time.Since(before).Seconds())
+}
+
 // Test that if the config entry exists in Consul but is not managed by the
 // controller, creating/updating the resource fails
 func TestConfigEntryControllers_doesNotCreateUnownedConfigEntry(t *testing.T) {
@@ -1384,7 +1529,9 @@ func TestConfigEntryControllers_doesNotCreateUnownedConfigEntry(t *testing.T) {
 
 	cases := []struct {
 		datacenterAnnotation string
-		expErr               string
+		// source overrides the external-source meta of the entry in Consul if set.
+		source string
+		expErr string
 	}{
 		{
 			datacenterAnnotation: "",
@@ -1394,10 +1541,15 @@ func TestConfigEntryControllers_doesNotCreateUnownedConfigEntry(t *testing.T) {
 			datacenterAnnotation: "other-datacenter",
 			expErr:               "config entry managed in different datacenter: \"other-datacenter\"",
 		},
+		{
+			datacenterAnnotation: datacenterName,
+			source:               "terraform",
+			expErr:               "config entry already exists in Consul",
+		},
 	}
 
 	for _, c := range cases {
-		t.Run(fmt.Sprintf("datacenter: %q", c.datacenterAnnotation), func(t *testing.T) {
+		t.Run(fmt.Sprintf("datacenter: %q, source: %q", c.datacenterAnnotation, c.source), func(t *testing.T) {
 			req := require.New(t)
 			ctx := context.Background()
 
@@ -1427,7 +1579,11 @@ func TestConfigEntryControllers_doesNotCreateUnownedConfigEntry(t *testing.T) {
 			// We haven't run reconcile yet. We must create the config entry
 			// in Consul ourselves in a different datacenter.
 			{
-				written, _, err := consulClient.ConfigEntries().Set(svcDefaults.ToConsul(c.datacenterAnnotation), nil)
+				entry := svcDefaults.ToConsul(c.datacenterAnnotation)
+				if c.source != "" {
+					entry.GetMeta()[common.SourceKey] = c.source
+				}
+				written, _, err := consulClient.ConfigEntries().Set(entry, nil)
 				req.NoError(err)
 				req.True(written)
 			}
@@ -1556,6 +1712,67 @@ func TestConfigEntryControllers_doesNotDeleteUnownedConfig(t *testing.T) {
 	}
 }
 
+// Test that deleting a resource whose config entry was already deleted from
+// Consul removes the finalizer without an error.
+func TestConfigEntryControllers_deletesWhenNotInConsul(t *testing.T) {
+	t.Parallel()
+	kubeNS := "default"
+	req := require.New(t)
+	ctx := context.Background()
+
+	s := runtime.NewScheme()
+	svcDefaultsWithDeletion := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "foo",
+			Namespace:         kubeNS,
+			DeletionTimestamp: &metav1.Time{Time: time.Now()},
+			Finalizers:        []string{FinalizerName},
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaultsWithDeletion)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(svcDefaultsWithDeletion).Build()
+
+	consul, err := testutil.NewTestServerConfigT(t, nil)
+	req.NoError(err)
+	defer consul.Stop()
+
+	consul.WaitForServiceIntentions(t)
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+	})
+	req.NoError(err)
+	reconciler := &ServiceDefaultsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:   consulClient,
+			DatacenterName: datacenterName,
+		},
+	}
+
+	// The config entry was never written to Consul, as if it had been
+	// deleted there already.
+	namespacedName := types.NamespacedName{
+		Namespace: kubeNS,
+		Name:      svcDefaultsWithDeletion.KubernetesName(),
+	}
+	resp, err := reconciler.Reconcile(ctx, ctrl.Request{
+		NamespacedName: namespacedName,
+	})
+	req.NoError(err)
+	req.False(resp.Requeue)
+
+	_, _, err = consulClient.ConfigEntries().Get(capi.ServiceDefaults, svcDefaultsWithDeletion.ConsulName(), nil)
+	req.True(isNotFoundErr(err))
+
+	svcDefault := &v1alpha1.ServiceDefaults{}
+	_ = fakeClient.Get(ctx, namespacedName, svcDefault)
+	req.Empty(svcDefault.Finalizers())
+}
+
 func TestConfigEntryControllers_updatesStatusWhenDeleteFails(t *testing.T) {
 	ctx := context.Background()
 	kubeNS := "default"
@@ -1800,3 +2017,170 @@ func TestConfigEntryController_Migration(t *testing.T) {
 		})
 	}
 }
+
+// Test that Consul namespaces are only checked until they're known to exist and
+// are checked again after writing a config entry into them fails.
+func TestConfigEntryController_CachesExistingConsulNamespaces(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var lock sync.Mutex
+	namespaceReads := make(map[string]int)
+	failWrites := false
+	consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/namespace/"):
+			ns := strings.TrimPrefix(r.URL.Path, "/v1/namespace/")
+			namespaceReads[ns]++
+			w.Write([]byte(fmt.Sprintf(`{"Name": %q}`, ns)))
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/config/"):
+			// The config entry is never found so that every reconcile ensures the namespace exists.
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "PUT" && r.URL.Path == "/v1/config":
+			if failWrites {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("true"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer consulServer.Close()
+	consulClient, err := capi.NewClient(&capi.Config{Address: consulServer.URL})
+	require.NoError(t, err)
+
+	var resources []runtime.Object
+	for _, ns := range []string{"ns1", "ns2"} {
+		resources = append(resources, &v1alpha1.ServiceDefaults{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "foo",
+				Namespace: ns,
+			},
+			Spec: v1alpha1.ServiceDefaultsSpec{
+				Protocol: "http",
+			},
+		})
+	}
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, &v1alpha1.ServiceDefaults{})
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(resources...).Build()
+
+	r := &ServiceDefaultsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:           consulClient,
+			DatacenterName:         datacenterName,
+			EnableConsulNamespaces: true,
+			EnableNSMirroring:      true,
+		},
+	}
+	reconcile := func(ns string) error {
+		_, err := r.Reconcile(ctx, ctrl.Request{
+			NamespacedName: types.NamespacedName{Namespace: ns, Name: "foo"},
+		})
+		return err
+	}
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, reconcile("ns1"))
+		require.NoError(t, reconcile("ns2"))
+	}
+	lock.Lock()
+	require.Equal(t, map[string]int{"ns1": 1, "ns2": 1}, namespaceReads)
+	failWrites = true
+	lock.Unlock()
+
+	// A failed write invalidates the cached namespace so it's checked again.
+	require.Error(t, reconcile("ns1"))
+	lock.Lock()
+	failWrites = false
+	lock.Unlock()
+	require.NoError(t, reconcile("ns1"))
+	require.NoError(t, reconcile("ns1"))
+	lock.Lock()
+	defer lock.Unlock()
+	require.Equal(t, map[string]int{"ns1": 2, "ns2": 1}, namespaceReads)
+}
+
+// Test that a reconcile that fails because the Consul servers have no leader
+// is requeued without an error or a failed sync status, and that the next
+// reconcile succeeds once there's a leader.
+func TestConfigEntryController_RequeuesWithoutLeader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	var lock sync.Mutex
+	noLeader := true
+	consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch {
+		case noLeader:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("No cluster leader"))
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/v1/config/"):
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "PUT" && r.URL.Path == "/v1/config":
+			w.Write([]byte("true"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer consulServer.Close()
+	consulClient, err := capi.NewClient(&capi.Config{Address: consulServer.URL})
+	require.NoError(t, err)
+
+	svcDefaults := &v1alpha1.ServiceDefaults{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "foo",
+			Namespace: "default",
+		},
+		Spec: v1alpha1.ServiceDefaultsSpec{
+			Protocol: "http",
+		},
+	}
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, svcDefaults)
+	fakeClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(svcDefaults).Build()
+
+	r := &ServiceDefaultsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+		ConfigEntryController: &ConfigEntryController{
+			ConsulClient:          consulClient,
+			DatacenterName:        datacenterName,
+			NoLeaderRetryInterval: 3 * time.Second,
+		},
+	}
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "foo"}
+
+	resp, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, ctrl.Result{RequeueAfter: 3 * time.Second}, resp)
+	require.NoError(t, fakeClient.Get(ctx, namespacedName, svcDefaults))
+	status, _, _ := svcDefaults.SyncedCondition()
+	require.Equal(t, corev1.ConditionUnknown, status)
+
+	lock.Lock()
+	noLeader = false
+	lock.Unlock()
+	resp, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+	require.NoError(t, err)
+	require.Equal(t, ctrl.Result{}, resp)
+	require.NoError(t, fakeClient.Get(ctx, namespacedName, svcDefaults))
+	status, _, _ = svcDefaults.SyncedCondition()
+	require.Equal(t, corev1.ConditionTrue, status)
+
+	// Without a retry interval the error fails the reconcile.
+	lock.Lock()
+	noLeader = true
+	lock.Unlock()
+	r.ConfigEntryController.NoLeaderRetryInterval = 0
+	_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "No cluster leader")
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// lastSyncAge is the metric tracking the time since config entries of each
+// kind were last successfully synced to Consul.
+var lastSyncAge = newLastSyncAgeCollector(time.Now)
+
+func init() {
+	metrics.Registry.MustRegister(lastSyncAge)
+}
+
+// lastSyncAgeCollector is a Prometheus collector reporting, for each CRD kind,
+// the number of seconds since a resource of that kind was last successfully
+// synced. The age is computed when the metric is collected so that it keeps
+// growing while a controller is stuck.
+type lastSyncAgeCollector struct {
+	desc *prometheus.Desc
+	now  func() time.Time
+
+	mutex      sync.Mutex
+	lastSynced map[string]time.Time
+}
+
+func newLastSyncAgeCollector(now func() time.Time) *lastSyncAgeCollector {
+	return &lastSyncAgeCollector{
+		desc: prometheus.NewDesc(
+			"consul_k8s_config_entry_last_sync_age_seconds",
+			"Seconds since a config entry resource of the given kind was last successfully synced to Consul.",
+			[]string{"kind"}, nil),
+		now:        now,
+		lastSynced: make(map[string]time.Time),
+	}
+}
+
+// setLastSyncedTime records that a resource of the given kind was synced at t.
+func (c *lastSyncAgeCollector) setLastSyncedTime(kind string, t time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lastSynced[kind] = t
+}
+
+// Describe implements prometheus.Collector.
+func (c *lastSyncAgeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *lastSyncAgeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	now := c.now()
+	for kind, t := range c.lastSynced {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, now.Sub(t).Seconds(), kind)
+	}
+}
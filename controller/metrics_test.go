@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLastSyncAgeCollector(t *testing.T) {
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	collector := newLastSyncAgeCollector(func() time.Time { return now })
+
+	// Nothing is reported until a resource has been synced.
+	require.Equal(t, 0, testutil.CollectAndCount(collector))
+
+	collector.setLastSyncedTime("servicedefaults", now.Add(-30*time.Second))
+	collector.setLastSyncedTime("serviceresolver", now.Add(-90*time.Second))
+	expected := `
+# HELP consul_k8s_config_entry_last_sync_age_seconds Seconds since a config entry resource of the given kind was last successfully synced to Consul.
+# TYPE consul_k8s_config_entry_last_sync_age_seconds gauge
+consul_k8s_config_entry_last_sync_age_seconds{kind="servicedefaults"} 30
+consul_k8s_config_entry_last_sync_age_seconds{kind="serviceresolver"} 90
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+
+	// The age keeps growing until the next sync.
+	now = now.Add(time.Minute)
+	collector.setLastSyncedTime("serviceresolver", now)
+	expected = `
+# HELP consul_k8s_config_entry_last_sync_age_seconds Seconds since a config entry resource of the given kind was last successfully synced to Consul.
+# TYPE consul_k8s_config_entry_last_sync_age_seconds gauge
+consul_k8s_config_entry_last_sync_age_seconds{kind="servicedefaults"} 90
+consul_k8s_config_entry_last_sync_age_seconds{kind="serviceresolver"} 0
+`
+	require.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
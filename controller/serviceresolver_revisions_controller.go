@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/hashicorp/consul-k8s/api/common"
+	consulv1alpha1 "github.com/hashicorp/consul-k8s/api/v1alpha1"
+	connectinject "github.com/hashicorp/consul-k8s/connect-inject"
+)
+
+// ServiceResolverRevisionsController maintains a subset per revision on
+// ServiceResolvers that have the common.RevisionSubsetsLabelKey annotation.
+// The annotation's value is a pod label key, e.g. "version", and each
+// distinct value of that label across the live injected pods in the
+// resolver's namespace that are registered as the resolver's Consul service
+// becomes a subset filtering on the service meta key of the same name. The
+// pods must therefore also set the consul.hashicorp.com/service-meta-<key>
+// annotation to the revision.
+//
+// Revisions are read from the pods rather than from their Deployments'
+// templates so that, during a rollout, the old revision's subset stays
+// until its last pod is gone. The Consul service of a pod is resolved like
+// the endpoints controller does: it's the name of each Kubernetes Service
+// selecting the pod, overridden by the pod's connect-service annotation,
+// with ConsulServiceNamePrefix and ConsulServiceNameSuffix added.
+//
+// Subsets added by hand are left alone. A subset is only removed if it
+// has the filter this controller would generate for it and no pod has that
+// revision anymore.
+type ServiceResolverRevisionsController struct {
+	client.Client
+	Log logr.Logger
+	// ConsulServiceNamePrefix and ConsulServiceNameSuffix must match the
+	// endpoints controller's so that pods are matched to the Consul services
+	// they're registered as.
+	ConsulServiceNamePrefix string
+	ConsulServiceNameSuffix string
+}
+
+// +kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+
+func (r *ServiceResolverRevisionsController) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := r.Log.WithValues("request", req.NamespacedName)
+
+	var resolver consulv1alpha1.ServiceResolver
+	if err := r.Get(ctx, req.NamespacedName, &resolver); k8serr.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	} else if err != nil {
+		logger.Error(err, "failed to retrieve ServiceResolver")
+		return ctrl.Result{}, err
+	}
+	labelKey := resolver.Annotations[common.RevisionSubsetsLabelKey]
+	if labelKey == "" || !resolver.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	var pods corev1.PodList
+	if err := r.List(ctx, &pods, client.InNamespace(req.Namespace)); err != nil {
+		logger.Error(err, "failed to list Pods")
+		return ctrl.Result{}, err
+	}
+	var services corev1.ServiceList
+	if err := r.List(ctx, &services, client.InNamespace(req.Namespace)); err != nil {
+		logger.Error(err, "failed to list Services")
+		return ctrl.Result{}, err
+	}
+	revisions := make(map[string]bool)
+	for _, pod := range pods.Items {
+		if !r.podServiceNames(pod, services.Items)[resolver.ConsulName()] {
+			continue
+		}
+		revision, ok := pod.Labels[labelKey]
+		if !ok {
+			continue
+		}
+		// Subset names must be valid DNS labels.
+		if errs := validation.IsDNS1123Label(revision); len(errs) > 0 {
+			logger.Info("skipping revision that isn't a valid subset name", "pod", pod.Name, "revision", revision)
+			continue
+		}
+		revisions[revision] = true
+	}
+
+	subsets := make(consulv1alpha1.ServiceResolverSubsetMap)
+	for name, subset := range resolver.Spec.Subsets {
+		if subset == revisionSubset(labelKey, name) && !revisions[name] {
+			continue
+		}
+		subsets[name] = subset
+	}
+	for revision := range revisions {
+		if _, ok := subsets[revision]; !ok {
+			subsets[revision] = revisionSubset(labelKey, revision)
+		}
+	}
+	if len(subsets) == 0 {
+		subsets = nil
+	}
+	if reflect.DeepEqual(subsets, resolver.Spec.Subsets) {
+		return ctrl.Result{}, nil
+	}
+
+	logger.Info("updating revision subsets", "subsets", len(subsets))
+	resolver.Spec.Subsets = subsets
+	if err := r.Update(ctx, &resolver); err != nil {
+		logger.Error(err, "failed to update ServiceResolver")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// revisionSubset returns the subset generated for revision.
+func revisionSubset(labelKey, revision string) consulv1alpha1.ServiceResolverSubset {
+	return consulv1alpha1.ServiceResolverSubset{
+		Filter: fmt.Sprintf("Service.Meta[%q] == %q", labelKey, revision),
+	}
+}
+
+// podServiceNames returns the names of the Consul services pod is registered as,
+// given the Kubernetes Services in its namespace. Pods that aren't injected or
+// have terminated aren't registered.
+func (r *ServiceResolverRevisionsController) podServiceNames(pod corev1.Pod, services []corev1.Service) map[string]bool {
+	if !connectinject.IsInjected(pod) || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil
+	}
+	names := make(map[string]bool)
+	for _, svc := range services {
+		if selects(svc, pod) {
+			names[connectinject.PodServiceName(pod, svc.Name, r.ConsulServiceNamePrefix, r.ConsulServiceNameSuffix)] = true
+		}
+	}
+	return names
+}
+
+// selects returns true if svc selects pod, i.e. pod is one of its endpoints.
+func selects(svc corev1.Service, pod corev1.Pod) bool {
+	return len(svc.Spec.Selector) > 0 && labels.SelectorFromSet(svc.Spec.Selector).Matches(labels.Set(pod.Labels))
+}
+
+// resolversForConsulServices returns a request for each ServiceResolver in namespace
+// whose Consul service is in serviceNames.
+func (r *ServiceResolverRevisionsController) resolversForConsulServices(namespace string, serviceNames map[string]bool) []ctrl.Request {
+	var resolvers consulv1alpha1.ServiceResolverList
+	if err := r.List(context.Background(), &resolvers, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "failed to list ServiceResolvers", "namespace", namespace)
+		return nil
+	}
+	var requests []ctrl.Request
+	for _, resolver := range resolvers.Items {
+		if serviceNames[resolver.ConsulName()] {
+			requests = append(requests, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: resolver.Name}})
+		}
+	}
+	return requests
+}
+
+// resolversForPod maps a Pod to the ServiceResolvers of the services it's
+// registered as.
+func (r *ServiceResolverRevisionsController) resolversForPod(object client.Object) []ctrl.Request {
+	pod, ok := object.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+	var services corev1.ServiceList
+	if err := r.List(context.Background(), &services, client.InNamespace(pod.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list Services", "namespace", pod.Namespace)
+		return nil
+	}
+	return r.resolversForConsulServices(pod.Namespace, r.podServiceNames(*pod, services.Items))
+}
+
+// resolversForService maps a Service to the ServiceResolvers of the services
+// the pods it selects are registered as, since adding or removing the Service
+// registers or deregisters them.
+func (r *ServiceResolverRevisionsController) resolversForService(object client.Object) []ctrl.Request {
+	svc, ok := object.(*corev1.Service)
+	if !ok {
+		return nil
+	}
+	var pods corev1.PodList
+	if err := r.List(context.Background(), &pods, client.InNamespace(svc.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list Pods", "namespace", svc.Namespace)
+		return nil
+	}
+	serviceNames := make(map[string]bool)
+	for _, pod := range pods.Items {
+		for name := range r.podServiceNames(pod, []corev1.Service{*svc}) {
+			serviceNames[name] = true
+		}
+	}
+	return r.resolversForConsulServices(svc.Namespace, serviceNames)
+}
+
+func (r *ServiceResolverRevisionsController) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("serviceresolver-revisions").
+		For(&consulv1alpha1.ServiceResolver{}).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.resolversForPod)).
+		Watches(&source.Kind{Type: &corev1.Service{}}, handler.EnqueueRequestsFromMapFunc(r.resolversForService)).
+		Complete(r)
+}
@@ -0,0 +1,302 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	logrtest "github.com/go-logr/logr/testing"
+	"github.com/hashicorp/consul-k8s/api/common"
+	"github.com/hashicorp/consul-k8s/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestServiceResolverRevisionsController(t *testing.T) {
+	t.Parallel()
+	fooService := selectorService("foo", map[string]string{"app": "foo"})
+	cases := map[string]struct {
+		annotations map[string]string
+		subsets     v1alpha1.ServiceResolverSubsetMap
+		objects     []runtime.Object
+		prefix      string
+		suffix      string
+		expSubsets  v1alpha1.ServiceResolverSubsetMap
+	}{
+		"not annotated": {
+			objects: []runtime.Object{fooService, revisionPod("foo-v1", "", "v1")},
+		},
+		"creates a subset per revision": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			objects: []runtime.Object{
+				fooService,
+				revisionPod("foo-v1-a", "", "v1"),
+				revisionPod("foo-v1-b", "", "v1"),
+				revisionPod("foo-v2", "", "v2"),
+				revisionPod("bar-v3", "bar", "v3"),
+			},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1": {Filter: `Service.Meta["version"] == "v1"`},
+				"v2": {Filter: `Service.Meta["version"] == "v2"`},
+			},
+		},
+		"removes subsets of revisions that are gone": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			subsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1": {Filter: `Service.Meta["version"] == "v1"`},
+				"v2": {Filter: `Service.Meta["version"] == "v2"`},
+			},
+			objects: []runtime.Object{fooService, revisionPod("foo-v2", "", "v2")},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v2": {Filter: `Service.Meta["version"] == "v2"`},
+			},
+		},
+		"keeps subsets added by hand": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			subsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1":     {Filter: `Service.Meta["version"] == "v1"`, OnlyPassing: true},
+				"canary": {Filter: `Service.Meta["canary"] == "true"`},
+			},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1":     {Filter: `Service.Meta["version"] == "v1"`, OnlyPassing: true},
+				"canary": {Filter: `Service.Meta["canary"] == "true"`},
+			},
+		},
+		"matches the Consul service name of the resolver": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version", common.ServiceNameKey: "bar"},
+			objects: []runtime.Object{
+				fooService,
+				revisionPod("foo-v1", "", "v1"),
+				revisionPod("bar-v2", "bar", "v2"),
+			},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v2": {Filter: `Service.Meta["version"] == "v2"`},
+			},
+		},
+		"defaults to the services selecting the pods": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			objects: []runtime.Object{
+				revisionPod("foo-v1", "", "v1"),
+				revisionPod("bar-v2", "", "v2"),
+				selectorService("foo", map[string]string{"version": "v1"}),
+				selectorService("bar", map[string]string{"version": "v2"}),
+			},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1": {Filter: `Service.Meta["version"] == "v1"`},
+			},
+		},
+		"ignores pods no service selects": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			objects:     []runtime.Object{revisionPod("foo-v1", "foo", "v1")},
+		},
+		"ignores pods that aren't injected or have terminated": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			objects: []runtime.Object{
+				fooService,
+				revisionPod("foo-v1", "", "v1"),
+				func() *corev1.Pod {
+					pod := revisionPod("foo-v2", "", "v2")
+					delete(pod.Annotations, "consul.hashicorp.com/connect-inject-status")
+					delete(pod.Labels, "consul.hashicorp.com/connect-inject-status")
+					return pod
+				}(),
+				func() *corev1.Pod {
+					pod := revisionPod("foo-v3", "", "v3")
+					pod.Status.Phase = corev1.PodSucceeded
+					return pod
+				}(),
+			},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1": {Filter: `Service.Meta["version"] == "v1"`},
+			},
+		},
+		"adds the service name prefix and suffix": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version", common.ServiceNameKey: "k8s-foo-dc1"},
+			objects: []runtime.Object{
+				fooService,
+				revisionPod("foo-v1", "", "v1"),
+				revisionPod("bar-v2", "bar", "v2"),
+			},
+			prefix: "k8s-",
+			suffix: "-dc1",
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1": {Filter: `Service.Meta["version"] == "v1"`},
+			},
+		},
+		"skips revisions that aren't valid subset names": {
+			annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+			objects: []runtime.Object{
+				fooService,
+				revisionPod("foo-v1", "", "v1"),
+				revisionPod("foo-v1-1", "", "v1.1"),
+			},
+			expSubsets: v1alpha1.ServiceResolverSubsetMap{
+				"v1": {Filter: `Service.Meta["version"] == "v1"`},
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			resolver := &v1alpha1.ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "foo",
+					Namespace:   "default",
+					Annotations: c.annotations,
+				},
+				Spec: v1alpha1.ServiceResolverSpec{
+					Subsets: c.subsets,
+				},
+			}
+			fakeClient := fake.NewClientBuilder().WithScheme(revisionsScheme()).
+				WithRuntimeObjects(append(c.objects, resolver)...).Build()
+
+			r := &ServiceResolverRevisionsController{
+				Client:                  fakeClient,
+				Log:                     logrtest.TestLogger{T: t},
+				ConsulServiceNamePrefix: c.prefix,
+				ConsulServiceNameSuffix: c.suffix,
+			}
+			namespacedName := types.NamespacedName{Namespace: "default", Name: "foo"}
+			_, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: namespacedName})
+			require.NoError(t, err)
+
+			var updated v1alpha1.ServiceResolver
+			require.NoError(t, fakeClient.Get(context.Background(), namespacedName, &updated))
+			require.Equal(t, c.expSubsets, updated.Spec.Subsets)
+		})
+	}
+}
+
+func TestServiceResolverRevisionsController_RevisionsComeAndGo(t *testing.T) {
+	t.Parallel()
+	resolver := &v1alpha1.ServiceResolver{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "default",
+			Annotations: map[string]string{common.RevisionSubsetsLabelKey: "version"},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(revisionsScheme()).
+		WithRuntimeObjects(resolver, selectorService("foo", map[string]string{"app": "foo"})).Build()
+	r := &ServiceResolverRevisionsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+	}
+	ctx := context.Background()
+	namespacedName := types.NamespacedName{Namespace: "default", Name: "foo"}
+	reconcile := func() v1alpha1.ServiceResolverSubsetMap {
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: namespacedName})
+		require.NoError(t, err)
+		var updated v1alpha1.ServiceResolver
+		require.NoError(t, fakeClient.Get(ctx, namespacedName, &updated))
+		return updated.Spec.Subsets
+	}
+
+	// Roll out a canary next to the current revision.
+	v1a := revisionPod("foo-v1-a", "", "v1")
+	v1b := revisionPod("foo-v1-b", "", "v1")
+	v2 := revisionPod("foo-v2", "", "v2")
+	require.NoError(t, fakeClient.Create(ctx, v1a))
+	require.NoError(t, fakeClient.Create(ctx, v1b))
+	require.NoError(t, fakeClient.Create(ctx, v2))
+	require.Equal(t, v1alpha1.ServiceResolverSubsetMap{
+		"v1": {Filter: `Service.Meta["version"] == "v1"`},
+		"v2": {Filter: `Service.Meta["version"] == "v2"`},
+	}, reconcile())
+
+	// Promote the canary. The old revision's subset stays while any of its pods still serve.
+	require.NoError(t, fakeClient.Delete(ctx, v1a))
+	require.Equal(t, v1alpha1.ServiceResolverSubsetMap{
+		"v1": {Filter: `Service.Meta["version"] == "v1"`},
+		"v2": {Filter: `Service.Meta["version"] == "v2"`},
+	}, reconcile())
+	require.NoError(t, fakeClient.Delete(ctx, v1b))
+	require.Equal(t, v1alpha1.ServiceResolverSubsetMap{
+		"v2": {Filter: `Service.Meta["version"] == "v2"`},
+	}, reconcile())
+
+	// Relabel the remaining pod with a new revision.
+	v2.Labels["version"] = "v3"
+	require.NoError(t, fakeClient.Update(ctx, v2))
+	require.Equal(t, v1alpha1.ServiceResolverSubsetMap{
+		"v3": {Filter: `Service.Meta["version"] == "v3"`},
+	}, reconcile())
+
+	require.NoError(t, fakeClient.Delete(ctx, v2))
+	require.Nil(t, reconcile())
+}
+
+func TestServiceResolverRevisionsController_resolversForPod(t *testing.T) {
+	t.Parallel()
+	resolver := func(name string, annotations map[string]string) *v1alpha1.ServiceResolver {
+		return &v1alpha1.ServiceResolver{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Annotations: annotations}}
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(revisionsScheme()).WithRuntimeObjects(
+		resolver("foo", nil),
+		resolver("renamed", map[string]string{common.ServiceNameKey: "bar"}),
+		selectorService("foo", map[string]string{"app": "foo"}),
+		selectorService("baz", map[string]string{"version": "v3"}),
+		revisionPod("bar-v1", "bar", "v1"),
+	).Build()
+	r := &ServiceResolverRevisionsController{
+		Client: fakeClient,
+		Log:    logrtest.TestLogger{T: t},
+	}
+
+	request := func(name string) []ctrl.Request {
+		return []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}}}
+	}
+	require.Equal(t, request("foo"), r.resolversForPod(revisionPod("foo-v1", "", "v1")))
+	require.Equal(t, request("renamed"), r.resolversForPod(revisionPod("bar-v1", "bar", "v1")))
+	require.Nil(t, r.resolversForPod(revisionPod("baz-v1", "qux", "v1")))
+	require.Equal(t, request("renamed"), r.resolversForService(selectorService("foo", map[string]string{"app": "foo"})))
+	require.Nil(t, r.resolversForService(selectorService("baz", map[string]string{"version": "v3"})))
+}
+
+// revisionsScheme returns a scheme with the types the ServiceResolverRevisionsController reads.
+func revisionsScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	s.AddKnownTypes(v1alpha1.GroupVersion, &v1alpha1.ServiceResolver{}, &v1alpha1.ServiceResolverList{})
+	s.AddKnownTypes(corev1.SchemeGroupVersion, &corev1.Pod{}, &corev1.PodList{}, &corev1.Service{}, &corev1.ServiceList{})
+	return s
+}
+
+// selectorService returns a Service in the default namespace selecting pods with selector.
+func selectorService(name string, selector map[string]string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Selector: selector,
+		},
+	}
+}
+
+// revisionPod returns an injected pod in the default namespace with the app
+// label foo and the version label set to revision. It's registered as service
+// if it's set, or else under the name of each Kubernetes Service selecting it.
+func revisionPod(name, service, revision string) *corev1.Pod {
+	annotations := map[string]string{"consul.hashicorp.com/connect-inject-status": "injected"}
+	if service != "" {
+		annotations["consul.hashicorp.com/connect-service"] = service
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels: map[string]string{
+				"app":     "foo",
+				"version": revision,
+				"consul.hashicorp.com/connect-inject-status": "injected",
+			},
+			Annotations: annotations,
+		},
+	}
+}
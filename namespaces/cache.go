@@ -0,0 +1,77 @@
+package namespaces
+
+import (
+	"sync"
+	"time"
+
+	capi "github.com/hashicorp/consul/api"
+)
+
+// Cache remembers the Consul namespaces that are known to exist so that
+// callers don't check for them in Consul every time they need them.
+// The zero value is ready to use and a nil cache doesn't cache anything.
+type Cache struct {
+	// TTL is how long a namespace is remembered to exist before it's
+	// checked again. It bounds how long a namespace deleted from Consul
+	// out of band goes unnoticed. If zero, namespaces are remembered until
+	// they're forgotten.
+	TTL time.Duration
+
+	mu sync.Mutex
+	// expiresAt is when each namespace has to be checked again. It's the
+	// zero time if the namespace doesn't expire.
+	expiresAt map[string]time.Time
+
+	// now returns the current time. It is only overridden in tests.
+	now func() time.Time
+}
+
+// EnsureExists calls EnsureExists for ns unless ns is already known to exist.
+// If it fails, ns is forgotten so that the next call checks it again.
+// Boolean return value indicates if the namespace was created by this call.
+func (c *Cache) EnsureExists(client *capi.Client, ns string, crossNSACLPolicy string) (bool, error) {
+	if c == nil {
+		return EnsureExists(client, ns, crossNSACLPolicy)
+	}
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	c.mu.Lock()
+	expiresAt, ok := c.expiresAt[ns]
+	c.mu.Unlock()
+	if ok && (expiresAt.IsZero() || now().Before(expiresAt)) {
+		return false, nil
+	}
+
+	created, err := EnsureExists(client, ns, crossNSACLPolicy)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		delete(c.expiresAt, ns)
+		return false, err
+	}
+	if c.expiresAt == nil {
+		c.expiresAt = make(map[string]time.Time)
+	}
+	if c.TTL > 0 {
+		c.expiresAt[ns] = now().Add(c.TTL)
+	} else {
+		c.expiresAt[ns] = time.Time{}
+	}
+	return created, nil
+}
+
+// Forget removes ns from the cache so that it's checked again the next time
+// it's needed.
+func (c *Cache) Forget(ns string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.expiresAt, ns)
+}
@@ -0,0 +1,102 @@
+package namespaces
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	capi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that a namespace is only checked and created once until the cache
+// entry expires, and that failures aren't cached.
+func TestCache(t *testing.T) {
+	var mu sync.Mutex
+	reads, creates := 0, 0
+	fail := false
+	consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/namespace/foo":
+			reads++
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPut && r.URL.Path == "/v1/namespace":
+			creates++
+			w.Write([]byte(`{"Name": "foo"}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer consulServer.Close()
+	client, err := capi.NewClient(&capi.Config{Address: consulServer.URL})
+	require.NoError(t, err)
+
+	now := time.Now()
+	cache := &Cache{TTL: time.Minute, now: func() time.Time { return now }}
+	counts := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return reads, creates
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := cache.EnsureExists(client, "foo", "")
+		require.NoError(t, err)
+	}
+	r, c := counts()
+	require.Equal(t, 1, r)
+	require.Equal(t, 1, c)
+
+	// Once the entry expires the namespace is checked again.
+	now = now.Add(time.Minute)
+	mu.Lock()
+	fail = true
+	mu.Unlock()
+	_, err = cache.EnsureExists(client, "foo", "")
+	require.Error(t, err)
+
+	// The failure isn't cached.
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	created, err := cache.EnsureExists(client, "foo", "")
+	require.NoError(t, err)
+	require.True(t, created)
+	r, c = counts()
+	require.Equal(t, 2, r)
+	require.Equal(t, 2, c)
+
+	// A nil cache always checks the namespace.
+	var nilCache *Cache
+	_, err = nilCache.EnsureExists(client, "foo", "")
+	require.NoError(t, err)
+	r, c = counts()
+	require.Equal(t, 3, r)
+	require.Equal(t, 3, c)
+
+	// Without a TTL, namespaces are remembered until they're forgotten.
+	cache = &Cache{now: func() time.Time { return now }}
+	_, err = cache.EnsureExists(client, "foo", "")
+	require.NoError(t, err)
+	now = now.Add(24 * time.Hour)
+	_, err = cache.EnsureExists(client, "foo", "")
+	require.NoError(t, err)
+	r, c = counts()
+	require.Equal(t, 4, r)
+	require.Equal(t, 4, c)
+
+	cache.Forget("foo")
+	_, err = cache.EnsureExists(client, "foo", "")
+	require.NoError(t, err)
+	r, c = counts()
+	require.Equal(t, 5, r)
+	require.Equal(t, 5, c)
+}
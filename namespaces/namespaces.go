@@ -3,7 +3,9 @@
 package namespaces
 
 import (
+	"bytes"
 	"fmt"
+	"text/template"
 
 	capi "github.com/hashicorp/consul/api"
 )
@@ -52,6 +54,59 @@ func EnsureExists(client *capi.Client, ns string, crossNSAClPolicy string) (bool
 	return true, err
 }
 
+// EnsureExistsWithACLPolicy ensures a Consul namespace with name ns exists
+// like EnsureExists and, if policyTemplate is set, that the namespace also has
+// a namespace-scoped ACL policy named policyName. The policy's rules are
+// policyTemplate rendered as a text/template with the namespace's name as
+// .Namespace. An existing policy is updated if its rules differ.
+// Boolean return value indicates if the namespace or the policy was created
+// by this call.
+func EnsureExistsWithACLPolicy(client *capi.Client, ns, crossNSAClPolicy, policyName, policyTemplate string) (bool, error) {
+	created, err := EnsureExists(client, ns, crossNSAClPolicy)
+	if err != nil || policyTemplate == "" || ns == WildcardNamespace {
+		return created, err
+	}
+
+	tmpl, err := template.New("policy").Parse(policyTemplate)
+	if err != nil {
+		return created, fmt.Errorf("parsing policy template: %s", err)
+	}
+	var rules bytes.Buffer
+	if err := tmpl.Execute(&rules, struct{ Namespace string }{Namespace: ns}); err != nil {
+		return created, fmt.Errorf("rendering policy template: %s", err)
+	}
+
+	policy, _, err := client.ACL().PolicyReadByName(policyName, &capi.QueryOptions{Namespace: ns})
+	if err != nil {
+		return created, err
+	}
+	if policy == nil {
+		_, _, err = client.ACL().PolicyCreate(&capi.ACLPolicy{
+			Name:        policyName,
+			Description: "Auto-generated by consul-k8s",
+			Rules:       rules.String(),
+			Namespace:   ns,
+		}, nil)
+		return true, err
+	}
+	if policy.Rules != rules.String() {
+		policy.Rules = rules.String()
+		_, _, err = client.ACL().PolicyUpdate(policy, nil)
+	}
+	return created, err
+}
+
+// MirroringPrefix returns the prefix of mirrored Consul namespaces given the
+// configured prefix and separator, i.e. prefix followed by separator, so that
+// the k8s `default` namespace is mirrored in Consul's `<prefix><separator>default`
+// namespace. The separator is only added if the prefix is set.
+func MirroringPrefix(prefix, separator string) string {
+	if prefix == "" {
+		return ""
+	}
+	return prefix + separator
+}
+
 // ConsulNamespace returns the consul namespace that a service should be
 // registered in based on the namespace options. It returns an
 // empty string if namespaces aren't enabled.
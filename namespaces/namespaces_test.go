@@ -156,6 +156,93 @@ func TestEnsureExists_CreatesNS(tt *testing.T) {
 	}
 }
 
+// Test that it creates the namespace and its policy if they don't exist, and
+// that calling it again doesn't create anything.
+func TestEnsureExistsWithACLPolicy_Creates(t *testing.T) {
+	req := require.New(t)
+	ns := "ns"
+	consulClient := testACLClient(t)
+
+	created, err := EnsureExistsWithACLPolicy(consulClient, ns, "", "ns-policy", `service_prefix "" { policy = "read" } # {{ .Namespace }}`)
+	req.NoError(err)
+	req.True(created)
+
+	cNS, _, err := consulClient.Namespaces().Read(ns, nil)
+	req.NoError(err)
+	req.NotNil(cNS)
+	policy, _, err := consulClient.ACL().PolicyReadByName("ns-policy", &capi.QueryOptions{Namespace: ns})
+	req.NoError(err)
+	req.NotNil(policy)
+	req.Equal(`service_prefix "" { policy = "read" } # ns`, policy.Rules)
+
+	// Calling it again is a no-op.
+	created, err = EnsureExistsWithACLPolicy(consulClient, ns, "", "ns-policy", `service_prefix "" { policy = "read" } # {{ .Namespace }}`)
+	req.NoError(err)
+	req.False(created)
+	unchanged, _, err := consulClient.ACL().PolicyReadByName("ns-policy", &capi.QueryOptions{Namespace: ns})
+	req.NoError(err)
+	req.Equal(policy.ModifyIndex, unchanged.ModifyIndex)
+}
+
+// Test that the policy is created in a namespace that already exists and
+// that its rules are updated if the template changes.
+func TestEnsureExistsWithACLPolicy_AlreadyExists(t *testing.T) {
+	req := require.New(t)
+	ns := "ns"
+	consulClient := testACLClient(t)
+
+	_, _, err := consulClient.Namespaces().Create(&capi.Namespace{
+		Name: ns,
+	}, nil)
+	req.NoError(err)
+
+	created, err := EnsureExistsWithACLPolicy(consulClient, ns, "", "ns-policy", `service_prefix "" { policy = "read" }`)
+	req.NoError(err)
+	req.True(created)
+
+	created, err = EnsureExistsWithACLPolicy(consulClient, ns, "", "ns-policy", `node_prefix "" { policy = "read" }`)
+	req.NoError(err)
+	req.False(created)
+	policy, _, err := consulClient.ACL().PolicyReadByName("ns-policy", &capi.QueryOptions{Namespace: ns})
+	req.NoError(err)
+	req.Equal(`node_prefix "" { policy = "read" }`, policy.Rules)
+}
+
+// Test that no policy is created without a policy template.
+func TestEnsureExistsWithACLPolicy_NoTemplate(t *testing.T) {
+	req := require.New(t)
+	ns := "ns"
+	consulClient := testACLClient(t)
+
+	created, err := EnsureExistsWithACLPolicy(consulClient, ns, "", "ns-policy", "")
+	req.NoError(err)
+	req.True(created)
+	policy, _, err := consulClient.ACL().PolicyReadByName("ns-policy", &capi.QueryOptions{Namespace: ns})
+	req.NoError(err)
+	req.Nil(policy)
+}
+
+// testACLClient starts a Consul server with ACLs enabled and returns a client
+// using its master token.
+func testACLClient(t *testing.T) *capi.Client {
+	masterToken := "master"
+	consul, err := testutil.NewTestServerConfigT(t, func(cfg *testutil.TestServerConfig) {
+		cfg.ACL.Enabled = true
+		cfg.ACL.DefaultPolicy = "deny"
+		cfg.ACL.Tokens.Master = masterToken
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { consul.Stop() })
+	consul.WaitForLeader(t)
+
+	consulClient, err := capi.NewClient(&capi.Config{
+		Address: consul.HTTPAddr,
+		Token:   masterToken,
+	})
+	require.NoError(t, err)
+	return consulClient
+}
+
 func TestConsulNamespace(t *testing.T) {
 	cases := map[string]struct {
 		kubeNS                 string
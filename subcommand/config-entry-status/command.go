@@ -0,0 +1,200 @@
+package configentrystatus
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/consul-k8s/api/common"
+	"github.com/hashicorp/consul-k8s/api/v1alpha1"
+	"github.com/hashicorp/consul-k8s/controller"
+	"github.com/hashicorp/consul-k8s/namespaces"
+	"github.com/hashicorp/consul-k8s/subcommand"
+	"github.com/hashicorp/consul-k8s/subcommand/flags"
+	"github.com/mitchellh/cli"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type Command struct {
+	UI cli.Ui
+
+	flags     *flag.FlagSet
+	k8sFlags  *flags.K8SFlags
+	httpFlags *flags.HTTPFlags
+
+	flagDatacenter string
+
+	// Flags to support Consul Enterprise namespaces.
+	flagEnableNamespaces           bool
+	flagConsulDestinationNamespace string
+	flagEnableNSMirroring          bool
+	flagNSMirroringPrefix          string
+	flagNSMirroringSeparator       string
+
+	kubeClient client.Client
+
+	once sync.Once
+	help string
+}
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+}
+
+// configEntryLists returns an empty list for each kind of config entry
+// custom resource.
+func configEntryLists() []client.ObjectList {
+	return []client.ObjectList{
+		&v1alpha1.ServiceDefaultsList{},
+		&v1alpha1.ServiceResolverList{},
+		&v1alpha1.ProxyDefaultsList{},
+		&v1alpha1.ServiceRouterList{},
+		&v1alpha1.ServiceSplitterList{},
+		&v1alpha1.ServiceIntentionsList{},
+		&v1alpha1.IngressGatewayList{},
+		&v1alpha1.TerminatingGatewayList{},
+	}
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagDatacenter, "datacenter", "",
+		"Name of the Consul datacenter the controller is operating in.")
+	c.flags.BoolVar(&c.flagEnableNamespaces, "enable-namespaces", false,
+		"[Enterprise Only] Enables Consul Enterprise namespaces, in either a single Consul namespace or mirrored.")
+	c.flags.StringVar(&c.flagConsulDestinationNamespace, "consul-destination-namespace", "default",
+		"[Enterprise Only] Defines which Consul namespace config entries are created in, regardless of their source Kubernetes namespace."+
+			" If '-enable-k8s-namespace-mirroring' is true, this is not used.")
+	c.flags.BoolVar(&c.flagEnableNSMirroring, "enable-k8s-namespace-mirroring", false, "[Enterprise Only] Enables "+
+		"k8s namespace mirroring.")
+	c.flags.StringVar(&c.flagNSMirroringPrefix, "k8s-namespace-mirroring-prefix", "",
+		"[Enterprise Only] Prefix that is added to all k8s namespaces mirrored into Consul if mirroring is enabled.")
+	c.flags.StringVar(&c.flagNSMirroringSeparator, "k8s-namespace-mirroring-separator", "",
+		"[Enterprise Only] Separator added between '-k8s-namespace-mirroring-prefix' and the k8s namespace, "+
+			"so that k8s namespaces are mirrored into Consul namespaces named <prefix><separator><k8s namespace>. "+
+			"Ignored if the prefix is empty.")
+
+	c.k8sFlags = &flags.K8SFlags{}
+	c.httpFlags = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.k8sFlags.Flags())
+	flags.Merge(c.flags, c.httpFlags.Flags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run compares every config entry custom resource with the corresponding
+// config entry in Consul and reports those that don't match.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.validateFlags(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+
+	if c.kubeClient == nil {
+		config, err := subcommand.K8SConfig(c.k8sFlags.KubeConfig())
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error retrieving Kubernetes auth: %s", err))
+			return 1
+		}
+		c.kubeClient, err = client.New(config, client.Options{Scheme: scheme})
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error initializing Kubernetes client: %s", err))
+			return 1
+		}
+	}
+
+	consulClient, err := c.httpFlags.APIClient()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error initializing Consul client: %s", err))
+		return 1
+	}
+	configEntryController := &controller.ConfigEntryController{
+		ConsulClient:               consulClient,
+		DatacenterName:             c.flagDatacenter,
+		EnableConsulNamespaces:     c.flagEnableNamespaces,
+		ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
+		EnableNSMirroring:          c.flagEnableNSMirroring,
+		NSMirroringPrefix:          namespaces.MirroringPrefix(c.flagNSMirroringPrefix, c.flagNSMirroringSeparator),
+	}
+
+	var total, drifted int
+	for _, list := range configEntryLists() {
+		if err := c.kubeClient.List(context.Background(), list); err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing config entry resources: %s", err))
+			return 1
+		}
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error listing config entry resources: %s", err))
+			return 1
+		}
+		for _, item := range items {
+			configEntry, ok := item.(common.ConfigEntryResource)
+			if !ok {
+				continue
+			}
+			// Resources being deleted are expected to differ from Consul.
+			if !configEntry.GetDeletionTimestamp().IsZero() {
+				continue
+			}
+			total++
+
+			name := fmt.Sprintf("%s %s/%s", configEntry.KubeKind(), configEntry.GetNamespace(), configEntry.KubernetesName())
+			reason, err := configEntryController.ConsulDrift(configEntry)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Error checking %s: %s", name, err))
+				return 1
+			}
+			if reason != "" {
+				drifted++
+				c.UI.Error(fmt.Sprintf("%s: %s", name, reason))
+			} else {
+				c.UI.Info(fmt.Sprintf("%s: in sync", name))
+			}
+		}
+	}
+
+	if drifted > 0 {
+		c.UI.Error(fmt.Sprintf("%d of %d config entries are out of sync with Consul", drifted, total))
+		return 1
+	}
+	c.UI.Info(fmt.Sprintf("All %d config entries are in sync with Consul", total))
+	return 0
+}
+
+func (c *Command) validateFlags(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if len(c.flags.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	if c.flagDatacenter == "" {
+		return errors.New("-datacenter must be set")
+	}
+	return nil
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Report config entry custom resources that differ from Consul"
+const help = `
+Usage: consul-k8s config-entry-status [options]
+
+  Compares every config entry custom resource in the Kubernetes cluster with
+  the corresponding config entry in Consul and reports the resources that
+  differ, e.g. because the config entry was edited in Consul directly.
+  Exits with a non-zero status if any resource differs.
+
+`
@@ -0,0 +1,101 @@
+package configentrystatus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/api/v1alpha1"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		flags  []string
+		expErr string
+	}{
+		{
+			flags:  []string{},
+			expErr: "-datacenter must be set",
+		},
+		{
+			flags:  []string{"-datacenter", "dc1", "foo"},
+			expErr: "should have no non-flag arguments",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			code := cmd.Run(c.flags)
+			require.Equal(t, 1, code)
+			require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+		})
+	}
+}
+
+func TestRun_ReportsDrift(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		consulConnectTimeout time.Duration
+		expCode              int
+		expOutput            string
+	}{
+		"in sync": {
+			consulConnectTimeout: 10 * time.Second,
+			expCode:              0,
+			expOutput:            "serviceresolver default/foo: in sync",
+		},
+		"drifted": {
+			consulConnectTimeout: 20 * time.Second,
+			expCode:              1,
+			expOutput:            "serviceresolver default/foo: config entry in Consul does not match the custom resource",
+		},
+		"not in Consul": {
+			expCode:   1,
+			expOutput: "serviceresolver default/foo: config entry not found in Consul",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			serviceResolver := &v1alpha1.ServiceResolver{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "foo",
+					Namespace: "default",
+				},
+				Spec: v1alpha1.ServiceResolverSpec{
+					ConnectTimeout: 10 * time.Second,
+				},
+			}
+			kubeClient := fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(serviceResolver).Build()
+
+			consul, err := testutil.NewTestServerConfigT(t, nil)
+			require.NoError(t, err)
+			defer consul.Stop()
+			consul.WaitForLeader(t)
+			consulClient, err := api.NewClient(&api.Config{Address: consul.HTTPAddr})
+			require.NoError(t, err)
+
+			if c.consulConnectTimeout != 0 {
+				entry := serviceResolver.ToConsul("dc1").(*api.ServiceResolverConfigEntry)
+				entry.ConnectTimeout = c.consulConnectTimeout
+				_, _, err = consulClient.ConfigEntries().Set(entry, nil)
+				require.NoError(t, err)
+			}
+
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui, kubeClient: kubeClient}
+			code := cmd.Run([]string{"-datacenter", "dc1", "-http-addr", consul.HTTPAddr})
+			require.Equal(t, c.expCode, code)
+			output := ui.OutputWriter.String() + ui.ErrorWriter.String()
+			require.Contains(t, output, c.expOutput)
+		})
+	}
+}
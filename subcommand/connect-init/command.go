@@ -1,9 +1,12 @@
 package connectinit
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,27 +24,37 @@ const (
 	defaultTokenSinkFile   = "/consul/connect-inject/acl-token"
 	defaultProxyIDFile     = "/consul/connect-inject/proxyid"
 
-	// The number of times to attempt ACL Login.
-	numLoginRetries = 3
+	// The default number of times to retry ACL Login.
+	defaultLoginRetries = 3
 	// The number of times to attempt to read this service (120s).
 	defaultServicePollingRetries = 120
+	// The default time to wait for upstreams to have enough passing instances.
+	defaultWaitForUpstreamTimeout = 2 * time.Minute
+	// The interval at which to poll for the passing instances of upstreams.
+	defaultUpstreamPollingInterval = 1 * time.Second
 )
 
 type Command struct {
 	UI cli.Ui
 
-	flagACLAuthMethod          string // Auth Method to use for ACLs, if enabled.
-	flagPodName                string // Pod name.
-	flagPodNamespace           string // Pod namespace.
-	flagAuthMethodNamespace    string // Consul namespace the auth-method is defined in.
-	flagConsulServiceNamespace string // Consul destination namespace for the service.
-	flagServiceAccountName     string // Service account name.
-	flagServiceName            string // Service name.
+	flagACLAuthMethod          string        // Auth Method to use for ACLs, if enabled.
+	flagPodName                string        // Pod name.
+	flagPodNamespace           string        // Pod namespace.
+	flagAuthMethodNamespace    string        // Consul namespace the auth-method is defined in.
+	flagConsulServiceNamespace string        // Consul destination namespace for the service.
+	flagServiceAccountName     string        // Service account name.
+	flagServiceName            string        // Service name.
+	flagACLLoginRetries        uint64        // Number of times to retry ACL login.
+	flagACLLoginTimeout        time.Duration // How long to keep retrying ACL login for.
 
-	bearerTokenFile                    string // Location of the bearer token. Default is /var/run/secrets/kubernetes.io/serviceaccount/token.
-	tokenSinkFile                      string // Location to write the output token. Default is defaultTokenSinkFile.
-	proxyIDFile                        string // Location to write the output proxyID. Default is defaultProxyIDFile.
-	serviceRegistrationPollingAttempts uint64 // Number of times to poll for this service to be registered.
+	flagWaitForUpstreams       flags.FlagMapValue // Minimum number of passing instances per upstream to wait for.
+	flagWaitForUpstreamTimeout time.Duration      // How long to wait for upstreams to have enough passing instances.
+
+	bearerTokenFile                    string        // Location of the bearer token. Default is /var/run/secrets/kubernetes.io/serviceaccount/token.
+	tokenSinkFile                      string        // Location to write the output token. Default is defaultTokenSinkFile.
+	proxyIDFile                        string        // Location to write the output proxyID. Default is defaultProxyIDFile.
+	serviceRegistrationPollingAttempts uint64        // Number of times to poll for this service to be registered.
+	upstreamPollingInterval            time.Duration // Interval at which to poll for the passing instances of upstreams.
 
 	flagSet *flag.FlagSet
 	http    *flags.HTTPFlags
@@ -59,6 +72,16 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagConsulServiceNamespace, "consul-service-namespace", "", "Consul destination namespace of the service.")
 	c.flagSet.StringVar(&c.flagServiceAccountName, "service-account-name", "", "Service account name on the pod.")
 	c.flagSet.StringVar(&c.flagServiceName, "service-name", "", "Service name as specified via the pod annotation.")
+	c.flagSet.Uint64Var(&c.flagACLLoginRetries, "acl-auth-method-login-retries", defaultLoginRetries,
+		"Number of times to retry logging in with the auth method if it fails.")
+	c.flagSet.DurationVar(&c.flagACLLoginTimeout, "login-timeout", 0,
+		"How long to keep retrying logging in with the auth method for. If 0, logging in is only "+
+			"limited by -acl-auth-method-login-retries.")
+	c.flagSet.Var(&c.flagWaitForUpstreams, "wait-for-upstream",
+		"Upstream service and minimum number of passing instances of it to wait for, in the form <service>=<n>. "+
+			"May be specified multiple times.")
+	c.flagSet.DurationVar(&c.flagWaitForUpstreamTimeout, "wait-for-upstream-timeout", defaultWaitForUpstreamTimeout,
+		"How long to wait for the services set with -wait-for-upstream to have enough passing instances.")
 
 	if c.bearerTokenFile == "" {
 		c.bearerTokenFile = defaultBearerTokenFile
@@ -72,6 +95,9 @@ func (c *Command) init() {
 	if c.serviceRegistrationPollingAttempts == 0 {
 		c.serviceRegistrationPollingAttempts = defaultServicePollingRetries
 	}
+	if c.upstreamPollingInterval == 0 {
+		c.upstreamPollingInterval = defaultUpstreamPollingInterval
+	}
 
 	c.http = &flags.HTTPFlags{}
 	flags.Merge(c.flagSet, c.http.Flags())
@@ -97,6 +123,11 @@ func (c *Command) Run(args []string) int {
 		c.UI.Error("-service-account-name must be set when ACLs are enabled")
 		return 1
 	}
+	waitForUpstreams, err := parseWaitForUpstreams(c.flagWaitForUpstreams)
+	if err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
 
 	cfg := api.DefaultConfig()
 	cfg.Namespace = c.flagConsulServiceNamespace
@@ -111,13 +142,19 @@ func (c *Command) Run(args []string) int {
 	if c.flagACLAuthMethod != "" {
 		// loginMeta is the default metadata that we pass to the consul login API.
 		loginMeta := map[string]string{"pod": fmt.Sprintf("%s/%s", c.flagPodNamespace, c.flagPodName)}
+		var loginBackoff backoff.BackOff = backoff.WithMaxRetries(backoff.NewConstantBackOff(1*time.Second), c.flagACLLoginRetries)
+		if c.flagACLLoginTimeout > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), c.flagACLLoginTimeout)
+			defer cancel()
+			loginBackoff = backoff.WithContext(loginBackoff, ctx)
+		}
 		err = backoff.Retry(func() error {
 			err := common.ConsulLogin(consulClient, c.bearerTokenFile, c.flagACLAuthMethod, c.tokenSinkFile, c.flagAuthMethodNamespace, loginMeta)
 			if err != nil {
 				c.UI.Error(fmt.Sprintf("Consul login failed; retrying: %s", err))
 			}
 			return err
-		}, backoff.WithMaxRetries(backoff.NewConstantBackOff(1*time.Second), numLoginRetries))
+		}, loginBackoff)
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("Hit maximum retries for consul login: %s", err))
 			return 1
@@ -135,6 +172,7 @@ func (c *Command) Run(args []string) int {
 	// Now wait for the service to be registered. Do this by querying the Agent for a service
 	// which maps to this pod+namespace.
 	var proxyID string
+	var native bool
 	var errServiceNameMismatch error
 	err = backoff.Retry(func() error {
 		filter := fmt.Sprintf("Meta[%q] == %q and Meta[%q] == %q", connectinject.MetaKeyPodName, c.flagPodName, connectinject.MetaKeyKubeNS, c.flagPodNamespace)
@@ -143,8 +181,15 @@ func (c *Command) Run(args []string) int {
 			c.UI.Error(fmt.Sprintf("Unable to get Agent services: %s", err))
 			return err
 		}
-		// Wait for the service and the connect-proxy service to be registered.
-		if len(serviceList) != 2 {
+		// Wait for the service and the connect-proxy service to be registered, or only
+		// the service if it's Connect-native.
+		native = false
+		for _, svc := range serviceList {
+			if svc.Connect != nil && svc.Connect.Native {
+				native = true
+			}
+		}
+		if (native && len(serviceList) != 1) || (!native && len(serviceList) != 2) {
 			c.UI.Info("Unable to find registered services; retrying")
 			return fmt.Errorf("did not find correct number of services: %d", len(serviceList))
 		}
@@ -169,7 +214,7 @@ func (c *Command) Run(args []string) int {
 			}
 		}
 
-		if proxyID == "" {
+		if proxyID == "" && !native {
 			// In theory we can't reach this point unless we have 2 services registered against
 			// this pod and neither are the connect-proxy. We don't support this case anyway, but it
 			// is necessary to return from the function.
@@ -186,15 +231,70 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 	// Write the proxy ID to the shared volume so `consul connect envoy` can use it for bootstrapping.
-	err = common.WriteFileWithPerms(c.proxyIDFile, proxyID, os.FileMode(0444))
-	if err != nil {
-		c.UI.Error(fmt.Sprintf("Unable to write proxy ID to file: %s", err))
-		return 1
+	// Connect-native services don't have a proxy to bootstrap.
+	if !native {
+		err = common.WriteFileWithPerms(c.proxyIDFile, proxyID, os.FileMode(0444))
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Unable to write proxy ID to file: %s", err))
+			return 1
+		}
+	}
+
+	// Finally, wait for the upstreams to have the minimum number of passing instances, if any were requested.
+	if len(waitForUpstreams) > 0 {
+		if err = c.waitForUpstreams(consulClient, waitForUpstreams); err != nil {
+			c.UI.Error(fmt.Sprintf("Timed out waiting for upstreams: %v", err))
+			return 1
+		}
 	}
 	c.UI.Info("Connect initialization completed")
 	return 0
 }
 
+// waitForUpstreams polls Consul until every service in upstreams has at least the
+// given number of passing instances or -wait-for-upstream-timeout is reached.
+func (c *Command) waitForUpstreams(consulClient *api.Client, upstreams map[string]int) error {
+	// Sort the services so that they're checked and logged in a consistent order.
+	var services []string
+	for service := range upstreams {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	attempts := uint64(c.flagWaitForUpstreamTimeout / c.upstreamPollingInterval)
+	return backoff.Retry(func() error {
+		for _, service := range services {
+			entries, _, err := consulClient.Health().Service(service, "", true, nil)
+			if err != nil {
+				c.UI.Error(fmt.Sprintf("Unable to get passing instances of upstream %s: %s", service, err))
+				return err
+			}
+			if len(entries) < upstreams[service] {
+				c.UI.Info(fmt.Sprintf("Upstream %s has %d of %d required passing instances; retrying", service, len(entries), upstreams[service]))
+				return fmt.Errorf("upstream %s has %d of %d required passing instances", service, len(entries), upstreams[service])
+			}
+		}
+		return nil
+	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(c.upstreamPollingInterval), attempts))
+}
+
+// parseWaitForUpstreams parses the values of the -wait-for-upstream flag into a map of
+// each upstream service to the minimum number of passing instances to wait for.
+func parseWaitForUpstreams(raw map[string]string) (map[string]int, error) {
+	upstreams := make(map[string]int)
+	for service, rawCount := range raw {
+		if service == "" {
+			return nil, fmt.Errorf("-wait-for-upstream value %q is invalid: service must be set", "="+rawCount)
+		}
+		count, err := strconv.Atoi(rawCount)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("-wait-for-upstream value %q is invalid: the number of instances must be a positive integer", service+"="+rawCount)
+		}
+		upstreams[service] = count
+	}
+	return upstreams, nil
+}
+
 func (c *Command) Synopsis() string { return synopsis }
 func (c *Command) Help() string {
 	c.once.Do(c.init)
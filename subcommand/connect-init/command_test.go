@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
@@ -36,6 +37,18 @@ func TestRun_FlagValidation(t *testing.T) {
 			flags:  []string{"-pod-name", testPodName, "-pod-namespace", testPodNamespace, "-acl-auth-method", testAuthMethod},
 			expErr: "-service-account-name must be set when ACLs are enabled",
 		},
+		{
+			flags:  []string{"-pod-name", testPodName, "-pod-namespace", testPodNamespace, "-wait-for-upstream", "=2"},
+			expErr: `-wait-for-upstream value "=2" is invalid: service must be set`,
+		},
+		{
+			flags:  []string{"-pod-name", testPodName, "-pod-namespace", testPodNamespace, "-wait-for-upstream", "db=0"},
+			expErr: `-wait-for-upstream value "db=0" is invalid: the number of instances must be a positive integer`,
+		},
+		{
+			flags:  []string{"-pod-name", testPodName, "-pod-namespace", testPodNamespace, "-wait-for-upstream", "db=two"},
+			expErr: `-wait-for-upstream value "db=two" is invalid: the number of instances must be a positive integer`,
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.expErr, func(t *testing.T) {
@@ -324,6 +337,43 @@ func TestRun_ServicePollingOnly(t *testing.T) {
 
 }
 
+// TestRun_ServicePollingConnectNative tests that a Connect-native service is
+// detected without a proxy service and that no proxy ID is written.
+func TestRun_ServicePollingConnectNative(t *testing.T) {
+	t.Parallel()
+	proxyFile := fmt.Sprintf("/tmp/%d", rand.Int())
+	t.Cleanup(func() {
+		os.Remove(proxyFile)
+	})
+
+	server, err := testutil.NewTestServerConfigT(t, nil)
+	require.NoError(t, err)
+	defer server.Stop()
+	server.WaitForLeader(t)
+	consulClient, err := api.NewClient(&api.Config{Address: server.HTTPAddr})
+	require.NoError(t, err)
+
+	nativeSvc := consulCountingSvc
+	nativeSvc.Connect = &api.AgentServiceConnect{Native: true}
+	require.NoError(t, consulClient.Agent().ServiceRegister(&nativeSvc))
+
+	ui := cli.NewMockUi()
+	cmd := Command{
+		UI:                                 ui,
+		proxyIDFile:                        proxyFile,
+		serviceRegistrationPollingAttempts: 3,
+	}
+	flags := []string{
+		"-pod-name", testPodName,
+		"-pod-namespace", testPodNamespace,
+		"-http-addr", server.HTTPAddr}
+	code := cmd.Run(flags)
+	require.Equal(t, 0, code, ui.ErrorWriter.String())
+
+	_, err = os.Stat(proxyFile)
+	require.True(t, os.IsNotExist(err))
+}
+
 // TestRun_ServicePollingErrors tests that when registered services could not be found,
 // we error out.
 func TestRun_ServicePollingErrors(t *testing.T) {
@@ -561,6 +611,88 @@ func TestRun_RetryServicePolling(t *testing.T) {
 	require.Contains(t, string(data), "counting-counting-sidecar-proxy")
 }
 
+// TestRun_WaitForUpstreams tests that the command waits for the upstreams set with -wait-for-upstream
+// to have the minimum number of passing instances and fails once -wait-for-upstream-timeout is reached.
+func TestRun_WaitForUpstreams(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		registerUpstreams func(t *testing.T, consulClient *api.Client)
+		flags             []string
+		expErr            string
+	}{
+		"upstream has enough passing instances after a delay": {
+			registerUpstreams: func(t *testing.T, consulClient *api.Client) {
+				go func() {
+					for _, id := range []string{"db-1", "db-2"} {
+						time.Sleep(500 * time.Millisecond)
+						require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{ID: id, Name: "db"}))
+					}
+				}()
+			},
+			flags: []string{"-wait-for-upstream", "db=2"},
+		},
+		"upstreams do not have enough passing instances": {
+			registerUpstreams: func(t *testing.T, consulClient *api.Client) {
+				require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{ID: "db-1", Name: "db"}))
+				require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{ID: "cache-1", Name: "cache"}))
+			},
+			flags:  []string{"-wait-for-upstream", "db=2", "-wait-for-upstream", "cache=1"},
+			expErr: "Timed out waiting for upstreams: upstream db has 1 of 2 required passing instances",
+		},
+		"critical instances are not counted": {
+			registerUpstreams: func(t *testing.T, consulClient *api.Client) {
+				require.NoError(t, consulClient.Agent().ServiceRegister(&api.AgentServiceRegistration{
+					ID:    "db-1",
+					Name:  "db",
+					Check: &api.AgentServiceCheck{TTL: "100000h", Status: api.HealthCritical},
+				}))
+			},
+			flags:  []string{"-wait-for-upstream", "db=1"},
+			expErr: "Timed out waiting for upstreams: upstream db has 0 of 1 required passing instances",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			proxyFile := common.WriteTempFile(t, "")
+
+			server, err := testutil.NewTestServerConfigT(t, nil)
+			require.NoError(t, err)
+			defer server.Stop()
+			server.WaitForLeader(t)
+			consulClient, err := api.NewClient(&api.Config{Address: server.HTTPAddr})
+			require.NoError(t, err)
+
+			testConsulServices := []api.AgentServiceRegistration{consulCountingSvc, consulCountingSvcSidecar}
+			for _, svc := range testConsulServices {
+				require.NoError(t, consulClient.Agent().ServiceRegister(&svc))
+			}
+			c.registerUpstreams(t, consulClient)
+
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI:                                 ui,
+				proxyIDFile:                        proxyFile,
+				serviceRegistrationPollingAttempts: 3,
+				upstreamPollingInterval:            100 * time.Millisecond,
+			}
+			flags := append([]string{
+				"-pod-name", testPodName,
+				"-pod-namespace", testPodNamespace,
+				"-http-addr", server.HTTPAddr,
+				"-wait-for-upstream-timeout", "3s",
+			}, c.flags...)
+			code := cmd.Run(flags)
+			if c.expErr != "" {
+				require.Equal(t, 1, code)
+				require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+				return
+			}
+			require.Equal(t, 0, code, ui.ErrorWriter.String())
+			require.Contains(t, ui.OutputWriter.String(), "Upstream db has 0 of 2 required passing instances; retrying")
+		})
+	}
+}
+
 // TestRun_InvalidProxyFile validates that we correctly fail in case the proxyid file
 // is not writable. This functions as coverage for both ACL and non-ACL codepaths.
 func TestRun_InvalidProxyFile(t *testing.T) {
@@ -738,6 +870,90 @@ func TestRun_LoginWithRetries(t *testing.T) {
 	}
 }
 
+// TestRun_LoginRetriesAndTimeout tests that ACL login is retried as configured by
+// -acl-auth-method-login-retries and -login-timeout.
+func TestRun_LoginRetriesAndTimeout(t *testing.T) {
+	t.Parallel()
+	cases := map[string]struct {
+		flags            []string
+		failedLogins     int
+		expCode          int
+		expLoginAttempts int
+		expErr           string
+	}{
+		"succeeds after failures with more retries than the default": {
+			flags:            []string{"-acl-auth-method-login-retries", "5"},
+			failedLogins:     4,
+			expCode:          0,
+			expLoginAttempts: 5,
+		},
+		"fails once retries are exhausted": {
+			flags:            []string{"-acl-auth-method-login-retries", "1"},
+			failedLogins:     5,
+			expCode:          1,
+			expLoginAttempts: 2,
+			expErr:           "Hit maximum retries for consul login",
+		},
+		"fails once the login timeout is reached": {
+			flags:            []string{"-acl-auth-method-login-retries", "10", "-login-timeout", "1500ms"},
+			failedLogins:     10,
+			expCode:          1,
+			expLoginAttempts: 2,
+			expErr:           "Hit maximum retries for consul login",
+		},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			bearerFile := common.WriteTempFile(t, "bearerTokenFile")
+			tokenFile := common.WriteTempFile(t, "")
+			proxyFile := common.WriteTempFile(t, "")
+
+			// Start the mock Consul server which fails the first c.failedLogins logins.
+			var lock sync.Mutex
+			counter := 0
+			consulServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r != nil && r.URL.Path == "/v1/acl/login" && r.Method == "POST" {
+					lock.Lock()
+					counter++
+					failed := counter <= c.failedLogins
+					lock.Unlock()
+					if !failed {
+						w.Write([]byte(testLoginResponse))
+					}
+				}
+				if r != nil && r.URL.Path == "/v1/agent/services" && r.Method == "GET" {
+					w.Write([]byte(testServiceListResponse))
+				}
+			}))
+			defer consulServer.Close()
+
+			serverURL, err := url.Parse(consulServer.URL)
+			require.NoError(t, err)
+
+			ui := cli.NewMockUi()
+			cmd := Command{
+				UI:              ui,
+				tokenSinkFile:   tokenFile,
+				bearerTokenFile: bearerFile,
+				proxyIDFile:     proxyFile,
+			}
+			code := cmd.Run(append([]string{
+				"-pod-name", testPodName,
+				"-pod-namespace", testPodNamespace,
+				"-acl-auth-method", testAuthMethod,
+				"-service-account-name", testServiceAccountName,
+				"-http-addr", serverURL.String()}, c.flags...))
+			require.Equal(t, c.expCode, code, ui.ErrorWriter.String())
+			lock.Lock()
+			require.Equal(t, c.expLoginAttempts, counter)
+			lock.Unlock()
+			if c.expErr != "" {
+				require.Contains(t, ui.ErrorWriter.String(), c.expErr)
+			}
+		})
+	}
+}
+
 const (
 	metaKeyPodName         = "pod-name"
 	metaKeyKubeNS          = "k8s-namespace"
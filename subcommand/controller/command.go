@@ -4,10 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/consul-k8s/api/common"
 	"github.com/hashicorp/consul-k8s/api/v1alpha1"
 	"github.com/hashicorp/consul-k8s/controller"
+	"github.com/hashicorp/consul-k8s/namespaces"
 	"github.com/hashicorp/consul-k8s/subcommand/flags"
 	"github.com/mitchellh/cli"
 	"go.uber.org/zap/zapcore"
@@ -33,11 +35,20 @@ type Command struct {
 	flagDatacenter           string
 	flagLogLevel             string
 
+	// Flags to maintain ServiceResolver subsets per pod revision.
+	flagEnableRevisionSubsets   bool
+	flagConsulServiceNamePrefix string
+	flagConsulServiceNameSuffix string
+
+	// Flag to retry reconciles while the Consul servers have no leader.
+	flagNoLeaderRetryInterval time.Duration
+
 	// Flags to support Consul Enterprise namespaces.
 	flagEnableNamespaces           bool
 	flagConsulDestinationNamespace string
 	flagEnableNSMirroring          bool
 	flagNSMirroringPrefix          string
+	flagNSMirroringSeparator       string
 	flagCrossNSACLPolicy           string
 
 	once sync.Once
@@ -71,11 +82,28 @@ func (c *Command) init() {
 		"k8s namespace mirroring.")
 	c.flagSet.StringVar(&c.flagNSMirroringPrefix, "k8s-namespace-mirroring-prefix", "",
 		"[Enterprise Only] Prefix that will be added to all k8s namespaces mirrored into Consul if mirroring is enabled.")
+	c.flagSet.StringVar(&c.flagNSMirroringSeparator, "k8s-namespace-mirroring-separator", "",
+		"[Enterprise Only] Separator added between '-k8s-namespace-mirroring-prefix' and the k8s namespace, "+
+			"so that k8s namespaces are mirrored into Consul namespaces named <prefix><separator><k8s namespace>. "+
+			"Ignored if the prefix is empty.")
 	c.flagSet.StringVar(&c.flagCrossNSACLPolicy, "consul-cross-namespace-acl-policy", "",
 		"[Enterprise Only] Name of the ACL policy to attach to all created Consul namespaces to allow service "+
 			"discovery across Consul namespaces. Only necessary if ACLs are enabled.")
 	c.flagSet.StringVar(&c.flagWebhookTLSCertDir, "webhook-tls-cert-dir", "",
 		"Directory that contains the TLS cert and key required for the webhook. The cert and key files must be named 'tls.crt' and 'tls.key' respectively.")
+	c.flagSet.BoolVar(&c.flagEnableRevisionSubsets, "enable-revision-subsets", false,
+		"Maintain a subset per revision on ServiceResolvers annotated with '"+common.RevisionSubsetsLabelKey+"', "+
+			"keyed by the values of that label across the service's live pods. "+
+			"Requires permission to list and watch Pods.")
+	c.flagSet.StringVar(&c.flagConsulServiceNamePrefix, "consul-service-name-prefix", "",
+		"Prefix the connect injector adds to the Consul name of every service it registers. Used to match pods "+
+			"to ServiceResolvers when -enable-revision-subsets is set, so it must match the injector's flag of the same name.")
+	c.flagSet.StringVar(&c.flagConsulServiceNameSuffix, "consul-service-name-suffix", "",
+		"Suffix the connect injector adds to the Consul name of every service it registers. "+
+			"Must match the injector's flag of the same name.")
+	c.flagSet.DurationVar(&c.flagNoLeaderRetryInterval, "no-leader-retry-interval", 5*time.Second,
+		"How long to wait before retrying a reconcile that failed because the Consul servers have no leader, "+
+			"e.g. during leader election. These failures aren't reported as errors. Set to 0 to treat them like any other error.")
 	c.flagSet.BoolVar(&c.flagEnableWebhooks, "enable-webhooks", true,
 		"Enable webhooks. Disable when running locally since Kube API server won't be able to route to local server.")
 	c.flagSet.StringVar(&c.flagLogLevel, "log-level", zapcore.InfoLevel.String(),
@@ -105,6 +133,15 @@ func (c *Command) Run(args []string) int {
 		c.UI.Error("Invalid arguments: -datacenter must be set")
 		return 1
 	}
+	// The wildcard namespace only matches namespaces, config entries can't be created in it.
+	if c.flagEnableNamespaces && !c.flagEnableNSMirroring && c.flagConsulDestinationNamespace == common.WildcardNamespace {
+		c.UI.Error(fmt.Sprintf("Invalid arguments: -consul-destination-namespace cannot be the wildcard namespace %q", common.WildcardNamespace))
+		return 1
+	}
+	if c.flagNoLeaderRetryInterval < 0 {
+		c.UI.Error("Invalid arguments: -no-leader-retry-interval must not be negative")
+		return 1
+	}
 
 	var zapLevel zapcore.Level
 	if err := zapLevel.UnmarshalText([]byte(c.flagLogLevel)); err != nil {
@@ -135,14 +172,18 @@ func (c *Command) Run(args []string) int {
 		return 1
 	}
 
+	// Mirrored Consul namespaces are named <prefix><separator><k8s namespace>.
+	nsMirroringPrefix := namespaces.MirroringPrefix(c.flagNSMirroringPrefix, c.flagNSMirroringSeparator)
+
 	configEntryReconciler := &controller.ConfigEntryController{
 		ConsulClient:               consulClient,
 		DatacenterName:             c.flagDatacenter,
 		EnableConsulNamespaces:     c.flagEnableNamespaces,
 		ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
 		EnableNSMirroring:          c.flagEnableNSMirroring,
-		NSMirroringPrefix:          c.flagNSMirroringPrefix,
+		NSMirroringPrefix:          nsMirroringPrefix,
 		CrossNSACLPolicy:           c.flagCrossNSACLPolicy,
+		NoLeaderRetryInterval:      c.flagNoLeaderRetryInterval,
 	}
 	if err = (&controller.ServiceDefaultsController{
 		ConfigEntryController: configEntryReconciler,
@@ -216,6 +257,17 @@ func (c *Command) Run(args []string) int {
 		setupLog.Error(err, "unable to create controller", "controller", common.TerminatingGateway)
 		return 1
 	}
+	if c.flagEnableRevisionSubsets {
+		if err = (&controller.ServiceResolverRevisionsController{
+			Client:                  mgr.GetClient(),
+			Log:                     ctrl.Log.WithName("controller").WithName("serviceresolver-revisions"),
+			ConsulServiceNamePrefix: c.flagConsulServiceNamePrefix,
+			ConsulServiceNameSuffix: c.flagConsulServiceNameSuffix,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "serviceresolver-revisions")
+			return 1
+		}
+	}
 
 	if c.flagEnableWebhooks {
 		// This webhook server sets up a Cert Watcher on the CertDir. This watches for file changes and updates the webhook certificates
@@ -232,7 +284,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-serviceresolver",
 			&webhook.Admission{Handler: &v1alpha1.ServiceResolverWebhook{
@@ -242,7 +294,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-proxydefaults",
 			&webhook.Admission{Handler: &v1alpha1.ProxyDefaultsWebhook{
@@ -260,7 +312,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-servicesplitter",
 			&webhook.Admission{Handler: &v1alpha1.ServiceSplitterWebhook{
@@ -270,7 +322,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-serviceintentions",
 			&webhook.Admission{Handler: &v1alpha1.ServiceIntentionsWebhook{
@@ -280,7 +332,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-ingressgateway",
 			&webhook.Admission{Handler: &v1alpha1.IngressGatewayWebhook{
@@ -290,7 +342,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 		mgr.GetWebhookServer().Register("/mutate-v1alpha1-terminatinggateway",
 			&webhook.Admission{Handler: &v1alpha1.TerminatingGatewayWebhook{
@@ -300,7 +352,7 @@ func (c *Command) Run(args []string) int {
 				EnableConsulNamespaces:     c.flagEnableNamespaces,
 				EnableNSMirroring:          c.flagEnableNSMirroring,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-				NSMirroringPrefix:          c.flagNSMirroringPrefix,
+				NSMirroringPrefix:          nsMirroringPrefix,
 			}})
 	}
 	// +kubebuilder:scaffold:builder
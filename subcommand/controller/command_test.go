@@ -30,6 +30,15 @@ func TestRun_FlagValidation(t *testing.T) {
 			flags:  []string{"-webhook-tls-cert-dir", "/foo", "-datacenter", "foo", "-log-level", "invalid"},
 			expErr: `Error parsing -log-level "invalid": unrecognized level: "invalid"`,
 		},
+		{
+			flags: []string{"-webhook-tls-cert-dir", "/foo", "-datacenter", "foo", "-enable-namespaces",
+				"-consul-destination-namespace", "*"},
+			expErr: `-consul-destination-namespace cannot be the wildcard namespace "*"`,
+		},
+		{
+			flags:  []string{"-webhook-tls-cert-dir", "/foo", "-datacenter", "foo", "-no-leader-retry-interval", "-1s"},
+			expErr: "-no-leader-retry-interval must not be negative",
+		},
 	}
 
 	for _, c := range cases {
@@ -0,0 +1,133 @@
+package envoylifecycle
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul-k8s/subcommand/flags"
+	"github.com/mitchellh/cli"
+)
+
+const defaultAdminAddr = "127.0.0.1:19000"
+
+type Command struct {
+	UI cli.Ui
+
+	flags *flag.FlagSet
+
+	flagAdminAddr    string
+	flagDrain        bool
+	flagDrainTime    time.Duration
+	flagWaitReady    bool
+	flagReadyTimeout time.Duration
+
+	httpClient *http.Client
+	once       sync.Once
+	help       string
+}
+
+func (c *Command) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.StringVar(&c.flagAdminAddr, "admin-addr", defaultAdminAddr,
+		"The host:port of the Envoy admin API.")
+	c.flags.BoolVar(&c.flagDrain, "drain", false,
+		"Gracefully drain Envoy's listeners and then wait for -drain-time so that in-flight requests can finish.")
+	c.flags.DurationVar(&c.flagDrainTime, "drain-time", 0,
+		"How long to wait after draining Envoy's listeners.")
+	c.flags.BoolVar(&c.flagWaitReady, "wait-ready", false,
+		"Wait until Envoy is ready, failing if it isn't by -ready-timeout.")
+	c.flags.DurationVar(&c.flagReadyTimeout, "ready-timeout", time.Minute,
+		"How long to wait for Envoy to be ready.")
+	c.help = flags.Usage(help, c.flags)
+}
+
+// Run drains the listeners of the Envoy sidecar or waits until it's ready. It's run
+// from the sidecar's lifecycle hooks since Envoy images don't ship an HTTP client.
+func (c *Command) Run(args []string) int {
+	c.once.Do(c.init)
+	if err := c.validateFlags(args); err != nil {
+		c.UI.Error(err.Error())
+		return 1
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: 5 * time.Second}
+	}
+	if c.flagWaitReady {
+		return c.waitReady()
+	}
+
+	// Envoy may already be stopping, so a failed drain is logged rather than
+	// skipping the wait for in-flight requests.
+	resp, err := c.httpClient.Post(fmt.Sprintf("http://%s/drain_listeners?graceful", c.flagAdminAddr), "", nil)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Unable to drain Envoy's listeners: %s", err))
+	} else {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			c.UI.Error(fmt.Sprintf("Unable to drain Envoy's listeners: unexpected response code %d", resp.StatusCode))
+		}
+	}
+	time.Sleep(c.flagDrainTime)
+	return 0
+}
+
+// waitReady polls Envoy's readiness endpoint once a second until it's ready or
+// the ready timeout has passed.
+func (c *Command) waitReady() int {
+	deadline := time.Now().Add(c.flagReadyTimeout)
+	for {
+		resp, err := c.httpClient.Get(fmt.Sprintf("http://%s/ready", c.flagAdminAddr))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				c.UI.Info("Envoy is ready")
+				return 0
+			}
+		}
+		if time.Now().Add(time.Second).After(deadline) {
+			c.UI.Error(fmt.Sprintf("Timed out after %s waiting for Envoy to be ready", c.flagReadyTimeout))
+			return 1
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (c *Command) validateFlags(args []string) error {
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	if len(c.flags.Args()) > 0 {
+		return errors.New("should have no non-flag arguments")
+	}
+	if c.flagDrain == c.flagWaitReady {
+		return errors.New("exactly one of -drain or -wait-ready must be set")
+	}
+	if c.flagDrainTime < 0 {
+		return errors.New("-drain-time must not be negative")
+	}
+	if c.flagReadyTimeout <= 0 {
+		return errors.New("-ready-timeout must be positive")
+	}
+	return nil
+}
+
+func (c *Command) Synopsis() string { return synopsis }
+func (c *Command) Help() string {
+	c.once.Do(c.init)
+	return c.help
+}
+
+const synopsis = "Manage the lifecycle of an Envoy sidecar"
+const help = `
+Usage: consul-k8s envoy-lifecycle [options]
+
+  Runs the lifecycle hooks of an Envoy sidecar through its admin API.
+  With -drain, it gracefully drains Envoy's listeners and then waits for
+  -drain-time. With -wait-ready, it waits until Envoy is ready and fails
+  if it isn't by -ready-timeout. It's copied into the pod by the
+  connect-inject init container.
+`
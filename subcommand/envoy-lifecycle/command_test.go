@@ -0,0 +1,117 @@
+package envoylifecycle
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun_FlagValidation(t *testing.T) {
+	cases := []struct {
+		Flags  []string
+		ExpErr string
+	}{
+		{
+			Flags:  []string{},
+			ExpErr: "exactly one of -drain or -wait-ready must be set",
+		},
+		{
+			Flags:  []string{"-drain", "-wait-ready"},
+			ExpErr: "exactly one of -drain or -wait-ready must be set",
+		},
+		{
+			Flags:  []string{"-wait-ready", "-ready-timeout=0s"},
+			ExpErr: "-ready-timeout must be positive",
+		},
+		{
+			Flags:  []string{"-drain", "-drain-time=-1s"},
+			ExpErr: "-drain-time must not be negative",
+		},
+		{
+			Flags:  []string{"-drain", "extra"},
+			ExpErr: "should have no non-flag arguments",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.ExpErr, func(t *testing.T) {
+			ui := cli.NewMockUi()
+			cmd := Command{UI: ui}
+			responseCode := cmd.Run(c.Flags)
+			require.Equal(t, 1, responseCode, ui.ErrorWriter.String())
+			require.Contains(t, ui.ErrorWriter.String(), c.ExpErr)
+		})
+	}
+}
+
+// Test that -drain drains Envoy's listeners and then waits for the drain time.
+func TestRun_Drain(t *testing.T) {
+	t.Parallel()
+	var requests []string
+	envoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+	}))
+	defer envoy.Close()
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	start := time.Now()
+	responseCode := cmd.Run([]string{"-drain", "-drain-time=100ms", "-admin-addr", strings.TrimPrefix(envoy.URL, "http://")})
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+	require.Equal(t, []string{"POST /drain_listeners?graceful"}, requests)
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+}
+
+// Test that the drain time is waited for even if Envoy can't be reached.
+func TestRun_DrainEnvoyUnreachable(t *testing.T) {
+	t.Parallel()
+	envoy := httptest.NewServer(http.NotFoundHandler())
+	envoy.Close()
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	start := time.Now()
+	responseCode := cmd.Run([]string{"-drain", "-drain-time=100ms", "-admin-addr", strings.TrimPrefix(envoy.URL, "http://")})
+	require.Equal(t, 0, responseCode)
+	require.Contains(t, ui.ErrorWriter.String(), "Unable to drain Envoy's listeners")
+	require.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+}
+
+// Test that -wait-ready polls Envoy until it's ready.
+func TestRun_WaitReady(t *testing.T) {
+	t.Parallel()
+	polls := 0
+	envoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/ready", r.URL.Path)
+		polls++
+		if polls < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer envoy.Close()
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	responseCode := cmd.Run([]string{"-wait-ready", "-ready-timeout=10s", "-admin-addr", strings.TrimPrefix(envoy.URL, "http://")})
+	require.Equal(t, 0, responseCode, ui.ErrorWriter.String())
+	require.Equal(t, 2, polls)
+}
+
+// Test that -wait-ready fails if Envoy isn't ready by the ready timeout.
+func TestRun_WaitReadyTimeout(t *testing.T) {
+	t.Parallel()
+	envoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer envoy.Close()
+
+	ui := cli.NewMockUi()
+	cmd := Command{UI: ui}
+	responseCode := cmd.Run([]string{"-wait-ready", "-ready-timeout=2s", "-admin-addr", strings.TrimPrefix(envoy.URL, "http://")})
+	require.Equal(t, 1, responseCode)
+	require.Contains(t, ui.ErrorWriter.String(), "Timed out after 2s waiting for Envoy to be ready")
+}
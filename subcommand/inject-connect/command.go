@@ -5,15 +5,19 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	connectinject "github.com/hashicorp/consul-k8s/connect-inject"
 	"github.com/hashicorp/consul-k8s/consul"
+	"github.com/hashicorp/consul-k8s/namespaces"
 	"github.com/hashicorp/consul-k8s/subcommand/common"
 	"github.com/hashicorp/consul-k8s/subcommand/flags"
 	"github.com/hashicorp/consul/api"
@@ -22,14 +26,17 @@ import (
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
@@ -40,28 +47,49 @@ type Command struct {
 	flagCertDir              string // Directory with TLS certs for listening (PEM)
 	flagDefaultInject        bool   // True to inject by default
 	flagConsulImage          string // Docker image for Consul
+	flagConsulCopyImage      string // Docker image the Consul binary is copied from
 	flagEnvoyImage           string // Docker image for Envoy
 	flagConsulK8sImage       string // Docker image for consul-k8s
 	flagACLAuthMethod        string // Auth Method to use for ACLs, if enabled
 	flagWriteServiceDefaults bool   // True to enable central config injection
 	flagDefaultProtocol      string // Default protocol for use with central config
 	flagConsulCACert         string // [Deprecated] Path to CA Certificate to use when communicating with Consul clients
+	flagConsulGRPCCAFile     string // Path to CA Certificate to use when only the gRPC port of Consul clients uses TLS
 	flagEnvoyExtraArgs       string // Extra envoy args when starting envoy
 	flagLogLevel             string
 
-	flagAllowK8sNamespacesList []string // K8s namespaces to explicitly inject
-	flagDenyK8sNamespacesList  []string // K8s namespaces to deny injection (has precedence)
+	// Flags to mount Consul's CA certificate from a Secret.
+	flagConsulCACertSecretName string
+	flagConsulCACertSecretKey  string
+
+	// Flags for the ports of Consul clients.
+	flagConsulHTTPPort  int
+	flagConsulHTTPSPort int
+	flagConsulGRPCPort  int
+
+	// Address to serve the injection preview endpoint on.
+	flagInjectionPreviewListen string
+
+	flagAllowK8sNamespacesList        []string // K8s namespaces to explicitly inject
+	flagAllowConsulNamespaceOverrides []string // Consul namespaces pods may override their namespace with
+	flagDenyK8sNamespacesList         []string // K8s namespaces to deny injection (has precedence)
+	flagWarnOnDeniedInjection         bool     // Warn pods that request injection in a denied namespace
+	flagRequireServicePort            bool     // Reject injected pods without a service port
+	flagAlwaysAllowK8sNamespacesList  []string // K8s namespaces whose pods are always admitted without injection
+	flagObjectSelector                string   // Label selector the webhook's objectSelector is set to
 
 	// Flags to support Consul namespaces
 	flagEnableNamespaces           bool   // Use namespacing on all components
 	flagConsulDestinationNamespace string // Consul namespace to register everything if not mirroring
 	flagEnableK8SNSMirroring       bool   // Enables mirroring of k8s namespaces into Consul
 	flagK8SNSMirroringPrefix       string // Prefix added to Consul namespaces created when mirroring
+	flagK8SNSMirroringSeparator    string // Separator added between the mirroring prefix and the k8s namespace
 	flagCrossNamespaceACLPolicy    string // The name of the ACL policy to add to every created namespace if ACLs are enabled
 
 	// Flags for endpoints controller.
 	flagReleaseName      string
 	flagReleaseNamespace string
+	flagClusterName      string
 
 	// Proxy resource settings.
 	flagDefaultSidecarProxyCPULimit      string
@@ -69,12 +97,16 @@ type Command struct {
 	flagDefaultSidecarProxyMemoryLimit   string
 	flagDefaultSidecarProxyMemoryRequest string
 
+	// Proxy public listener settings.
+	flagDefaultSidecarProxyPort int
+
 	// Metrics settings.
-	flagDefaultEnableMetrics        bool
-	flagDefaultEnableMetricsMerging bool
-	flagDefaultMergedMetricsPort    string
-	flagDefaultPrometheusScrapePort string
-	flagDefaultPrometheusScrapePath string
+	flagDefaultEnableMetrics          bool
+	flagDefaultEnableMetricsMerging   bool
+	flagDefaultMergedMetricsPort      string
+	flagDefaultPrometheusScrapePort   string
+	flagDefaultPrometheusScrapePath   string
+	flagDefaultPrometheusScrapeScheme string
 
 	// Consul sidecar resource settings.
 	flagConsulSidecarCPULimit      string
@@ -88,9 +120,51 @@ type Command struct {
 	flagInitContainerMemoryLimit   string
 	flagInitContainerMemoryRequest string
 
+	// Init container security flag(s).
+	flagInitContainerRunAsUser int64
+
 	// Transparent proxy flag(s).
 	flagEnableTransparentProxy bool
 
+	// Sidecar proxy lifecycle flag(s).
+	flagEnableProxyLifecycle   bool
+	flagEnableDependencyChecks bool
+	flagSkipExistingSidecars   bool
+
+	// Shared process namespace flag(s).
+	flagSharedProcessNamespacePolicy string
+
+	// Pod annotation limit flag(s).
+	flagMaxConsulAnnotations     int
+	flagMaxConsulAnnotationsSize int
+
+	// Windows pod flag(s).
+	flagWindowsPodPolicy string
+
+	// Mesh gateway flag(s).
+	flagMeshGatewayAddress string
+
+	// Envoy sidecar environment flag(s).
+	flagEnvoyEnvFromConfigMaps []string
+	flagEnvoyEnvFromSecrets    []string
+
+	// Endpoints controller flag(s).
+	flagProxyDriftCheckPeriod time.Duration
+	flagUseEndpointSlices     bool
+	flagRegistrationTimeout   time.Duration
+	flagReconcileOnPodChanges bool
+	flagConsistentReads       bool
+	flagAuditLogPath          string
+	flagPodLabelSelector      string
+
+	// Consul service name flag(s).
+	flagConsulServiceNamePrefix string
+	flagConsulServiceNameSuffix string
+
+	// Init container ACL login settings.
+	flagACLLoginRetries uint64
+	flagACLLoginTimeout time.Duration
+
 	flagSet *flag.FlagSet
 	http    *flags.HTTPFlags
 
@@ -121,6 +195,8 @@ func (c *Command) init() {
 		"Directory with PEM-encoded TLS certificate and key to serve.")
 	c.flagSet.StringVar(&c.flagConsulImage, "consul-image", "",
 		"Docker image for Consul.")
+	c.flagSet.StringVar(&c.flagConsulCopyImage, "consul-copy-image", "",
+		"Docker image the Consul binary is copied from into injected pods. Defaults to -consul-image.")
 	c.flagSet.StringVar(&c.flagEnvoyImage, "envoy-image", "",
 		"Docker image for Envoy.")
 	c.flagSet.StringVar(&c.flagConsulK8sImage, "consul-k8s-image", "",
@@ -129,18 +205,63 @@ func (c *Command) init() {
 		"Extra envoy command line args to be set when starting envoy (e.g \"--log-level debug --disable-hot-restart\").")
 	c.flagSet.StringVar(&c.flagACLAuthMethod, "acl-auth-method", "",
 		"The name of the Kubernetes Auth Method to use for connectInjection if ACLs are enabled.")
+	c.flagSet.Uint64Var(&c.flagACLLoginRetries, "acl-auth-method-login-retries", 3,
+		"Number of times the init container retries logging in with the Kubernetes Auth Method. Must be at least 1.")
+	c.flagSet.DurationVar(&c.flagACLLoginTimeout, "login-timeout", 0,
+		"How long the init container keeps retrying logging in with the Kubernetes Auth Method for. If 0, logging in is only "+
+			"limited by -acl-auth-method-login-retries.")
 	c.flagSet.BoolVar(&c.flagWriteServiceDefaults, "enable-central-config", false,
 		"Write a service-defaults config for every Connect service using protocol from -default-protocol or Pod annotation.")
 	c.flagSet.StringVar(&c.flagDefaultProtocol, "default-protocol", "",
 		"The default protocol to use in central config registrations.")
 	c.flagSet.StringVar(&c.flagConsulCACert, "consul-ca-cert", "",
 		"[Deprecated] Please use '-ca-file' flag instead. Path to CA certificate to use if communicating with Consul clients over HTTPS.")
+	c.flagSet.StringVar(&c.flagConsulCACertSecretName, "consul-ca-cert-secret-name", "",
+		"Name of a Secret holding the CA certificate to use if communicating with Consul clients over HTTPS. "+
+			"If set, the Secret is mounted into injected pods instead of writing the certificate into their init container's command. "+
+			"The Secret must exist in the namespace of every injected pod.")
+	c.flagSet.StringVar(&c.flagConsulCACertSecretKey, "consul-ca-cert-secret-key", "tls.crt",
+		"Key of the CA certificate in the '-consul-ca-cert-secret-name' Secret.")
+	c.flagSet.IntVar(&c.flagConsulHTTPPort, "consul-http-port", 8500,
+		"HTTP port of Consul clients that injected pods register with if they don't use TLS.")
+	c.flagSet.IntVar(&c.flagConsulHTTPSPort, "consul-https-port", 8501,
+		"HTTPS port of Consul clients that injected pods register with if a CA certificate is set.")
+	c.flagSet.IntVar(&c.flagConsulGRPCPort, "consul-grpc-port", 8502,
+		"gRPC port of Consul clients that Envoy sidecars connect to. It uses TLS if a CA certificate is set.")
+	c.flagSet.StringVar(&c.flagConsulGRPCCAFile, "consul-grpc-ca-file", "",
+		"Path to CA certificate to use if communicating with the gRPC port of Consul clients over TLS "+
+			"when their HTTP port doesn't use TLS. Not needed if the CA file for HTTPS is set.")
 	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagAllowK8sNamespacesList), "allow-k8s-namespace",
 		"K8s namespaces to explicitly allow. May be specified multiple times.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagAllowConsulNamespaceOverrides), "allow-consul-namespace-override",
+		"Consul namespaces that pods may register their service in with the consul.hashicorp.com/consul-namespace "+
+			"annotation, or \"*\" for any namespace. May be specified multiple times. Overrides are rejected if "+
+			"-acl-auth-method is set.")
 	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagDenyK8sNamespacesList), "deny-k8s-namespace",
 		"K8s namespaces to explicitly deny. Takes precedence over allow. May be specified multiple times.")
+	c.flagSet.BoolVar(&c.flagWarnOnDeniedInjection, "warn-on-denied-namespace-injection", false,
+		"Return an admission warning for pods that set the inject annotation to true in a namespace "+
+			"denied by -deny-k8s-namespace. They're admitted without injection either way.")
+	c.flagSet.BoolVar(&c.flagRequireServicePort, "require-service-port", false,
+		"Reject pods that would be injected but have neither the consul.hashicorp.com/connect-service-port annotation "+
+			"nor a port on their first container. By default they're registered without a port and only proxy outbound traffic.")
+	c.flagSet.StringVar(&c.flagInjectionPreviewListen, "injection-preview-listen", "",
+		"Address to serve the /preview endpoint on, e.g. 127.0.0.1:8081. The endpoint responds with the patch "+
+			"the webhook would apply to the pod in the JSON manifest POSTed to it without the pod being created. "+
+			"It's served over plain HTTP on its own listener and isn't authenticated, so anyone who can reach the "+
+			"address can see the webhook's configuration, e.g. its images and Consul addresses. Bind it to a loopback "+
+			"address or restrict access to it, e.g. with a NetworkPolicy. Not served if empty.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagAlwaysAllowK8sNamespacesList), "always-allow-k8s-namespace",
+		"K8s namespaces whose pods are always admitted by the webhook without being injected, even if "+
+			"the request can't be processed. May be specified multiple times.")
+	c.flagSet.StringVar(&c.flagObjectSelector, "object-selector", "",
+		"Label selector that the webhook configuration's objectSelector is set to, e.g. \"mesh=enabled\". "+
+			"Pods matching it are injected without the inject annotation and pods that don't match it are never injected. "+
+			"Namespace allow and deny lists still take precedence.")
 	c.flagSet.StringVar(&c.flagReleaseName, "release-name", "consul", "The Consul Helm installation release name, e.g 'helm install <RELEASE-NAME>'")
 	c.flagSet.StringVar(&c.flagReleaseNamespace, "release-namespace", "default", "The Consul Helm installation namespace, e.g 'helm install <RELEASE-NAME> --namespace <RELEASE-NAMESPACE>'")
+	c.flagSet.StringVar(&c.flagClusterName, "cluster-name", "",
+		"Name of the Kubernetes cluster, added to the metadata of every service instance registered with Consul.")
 	c.flagSet.BoolVar(&c.flagEnableNamespaces, "enable-namespaces", false,
 		"[Enterprise Only] Enables namespaces, in either a single Consul namespace or mirrored.")
 	c.flagSet.StringVar(&c.flagConsulDestinationNamespace, "consul-destination-namespace", "default",
@@ -150,11 +271,72 @@ func (c *Command) init() {
 		"k8s namespace mirroring.")
 	c.flagSet.StringVar(&c.flagK8SNSMirroringPrefix, "k8s-namespace-mirroring-prefix", "",
 		"[Enterprise Only] Prefix that will be added to all k8s namespaces mirrored into Consul if mirroring is enabled.")
+	c.flagSet.StringVar(&c.flagK8SNSMirroringSeparator, "k8s-namespace-mirroring-separator", "",
+		"[Enterprise Only] Separator added between '-k8s-namespace-mirroring-prefix' and the k8s namespace, "+
+			"so that k8s namespaces are mirrored into Consul namespaces named <prefix><separator><k8s namespace>. "+
+			"Ignored if the prefix is empty.")
 	c.flagSet.StringVar(&c.flagCrossNamespaceACLPolicy, "consul-cross-namespace-acl-policy", "",
 		"[Enterprise Only] Name of the ACL policy to attach to all created Consul namespaces to allow service "+
 			"discovery across Consul namespaces. Only necessary if ACLs are enabled.")
 	c.flagSet.BoolVar(&c.flagEnableTransparentProxy, "enable-transparent-proxy", true,
 		"Enable transparent proxy mode for all Consul service mesh applications.")
+	c.flagSet.BoolVar(&c.flagEnableProxyLifecycle, "enable-sidecar-proxy-lifecycle", false,
+		"Add a preStop hook to Envoy sidecars that drains their listeners before they're stopped. "+
+			"May be overridden per pod with the consul.hashicorp.com/enable-sidecar-proxy-lifecycle annotation.")
+	c.flagSet.BoolVar(&c.flagEnableDependencyChecks, "enable-dependency-checks", false,
+		"Hold application containers until the Envoy sidecar is ready. How long to wait for may be set per pod "+
+			"with the consul.hashicorp.com/consul-envoy-readiness-wait annotation.")
+	c.flagSet.BoolVar(&c.flagSkipExistingSidecars, "skip-existing-sidecars", false,
+		"Skip injecting the envoy-sidecar and consul-sidecar containers into pods that already have "+
+			"containers with those names. The init containers are still injected.")
+	c.flagSet.StringVar(&c.flagSharedProcessNamespacePolicy, "shared-process-namespace-policy", connectinject.SharedProcessNamespaceAllow,
+		fmt.Sprintf("How to handle pods with shareProcessNamespace set, whose containers can see the processes of "+
+			"the Envoy sidecar. One of %q, %q or %q.", connectinject.SharedProcessNamespaceAllow,
+			connectinject.SharedProcessNamespaceWarn, connectinject.SharedProcessNamespaceDeny))
+	c.flagSet.IntVar(&c.flagMaxConsulAnnotations, "max-pod-consul-annotations", 0,
+		"Maximum number of consul.hashicorp.com/ annotations of a pod. Pods with more are rejected. No limit if 0.")
+	c.flagSet.IntVar(&c.flagMaxConsulAnnotationsSize, "max-pod-consul-annotations-size", 0,
+		"Maximum total size in bytes of the keys and values of the consul.hashicorp.com/ annotations of a pod. "+
+			"Pods with larger annotations are rejected. No limit if 0.")
+	c.flagSet.StringVar(&c.flagWindowsPodPolicy, "windows-pod-policy", connectinject.WindowsPodSkip,
+		fmt.Sprintf("How to handle pods scheduled onto Windows nodes, which the Consul sidecars can't run on. "+
+			"%q admits them without injection, %q rejects them.", connectinject.WindowsPodSkip, connectinject.WindowsPodDeny))
+	c.flagSet.StringVar(&c.flagMeshGatewayAddress, "mesh-gateway-address", "",
+		"host:port of the mesh gateway used to reach services in other datacenters. If set, it's added to "+
+			"injected pods as an annotation and as the CONSUL_MESH_GATEWAY_ADDRESS environment variable of their containers.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagEnvoyEnvFromConfigMaps), "envoy-env-from-configmap",
+		"Name of a ConfigMap in the pod's namespace whose keys are added to the environment of the Envoy sidecar. "+
+			"May be specified multiple times.")
+	c.flagSet.Var((*flags.AppendSliceValue)(&c.flagEnvoyEnvFromSecrets), "envoy-env-from-secret",
+		"Name of a Secret in the pod's namespace whose keys are added to the environment of the Envoy sidecar. "+
+			"May be specified multiple times.")
+	c.flagSet.DurationVar(&c.flagProxyDriftCheckPeriod, "proxy-drift-check-period", 0,
+		"How often to check that the Consul registrations of sidecar proxies match the registrations the endpoints "+
+			"controller would create, re-registering those that don't. Disabled if 0.")
+	c.flagSet.BoolVar(&c.flagUseEndpointSlices, "use-endpoint-slices", false,
+		"Read the addresses of services from their EndpointSlices instead of their Endpoints. "+
+			"Requires permission to list and watch EndpointSlices and services.")
+	c.flagSet.DurationVar(&c.flagRegistrationTimeout, "registration-timeout", 0,
+		"How long the endpoints controller spends registering the instances of a service before requeuing it "+
+			"to register the remaining instances later. Disabled if 0.")
+	c.flagSet.BoolVar(&c.flagReconcileOnPodChanges, "reconcile-on-pod-changes", false,
+		"Also reconcile the service instances of injected pods when their labels or annotations change, "+
+			"rather than only when their Endpoints change.")
+	c.flagSet.StringVar(&c.flagAuditLogPath, "audit-log-path", "",
+		"File that the endpoints controller appends a JSON line to for every service registration, deregistration, "+
+			"check update and config entry write it makes with Consul, or \"-\" for stdout. Disabled if empty.")
+	c.flagSet.BoolVar(&c.flagConsistentReads, "consistent-reads", false,
+		"Make the endpoints controller's reads of the Consul catalog and config entries consistent so that "+
+			"they reflect registrations made just before, at the cost of more load on the Consul leader.")
+	c.flagSet.StringVar(&c.flagPodLabelSelector, "pod-label-selector", "",
+		"Label selector, e.g. \"mesh=enabled\", limiting the pods that are injected and whose service instances "+
+			"the endpoints controller registers. The instances of injected pods that stop matching it are "+
+			"deregistered. Applies on top of the namespace allow and deny lists.")
+	c.flagSet.StringVar(&c.flagConsulServiceNamePrefix, "consul-service-name-prefix", "",
+		"Prefix added to the Consul name of every service registered by the endpoints controller, e.g. to avoid "+
+			"collisions between clusters registering services into the same Consul datacenter. Not supported with ACLs.")
+	c.flagSet.StringVar(&c.flagConsulServiceNameSuffix, "consul-service-name-suffix", "",
+		"Suffix added to the Consul name of every service registered by the endpoints controller. Not supported with ACLs.")
 	c.flagSet.StringVar(&c.flagLogLevel, "log-level", zapcore.InfoLevel.String(),
 		fmt.Sprintf("Log verbosity level. Supported values (in order of detail) are "+
 			"%q, %q, %q, and %q.", zapcore.DebugLevel.String(), zapcore.InfoLevel.String(), zapcore.WarnLevel.String(), zapcore.ErrorLevel.String()))
@@ -164,6 +346,9 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagDefaultSidecarProxyCPULimit, "default-sidecar-proxy-cpu-limit", "", "Default sidecar proxy CPU limit.")
 	c.flagSet.StringVar(&c.flagDefaultSidecarProxyMemoryRequest, "default-sidecar-proxy-memory-request", "", "Default sidecar proxy memory request.")
 	c.flagSet.StringVar(&c.flagDefaultSidecarProxyMemoryLimit, "default-sidecar-proxy-memory-limit", "", "Default sidecar proxy memory limit.")
+	c.flagSet.IntVar(&c.flagDefaultSidecarProxyPort, "default-sidecar-proxy-port", 20000,
+		"Default port of the sidecar proxy's public listener. May be overridden per pod with the "+
+			"consul.hashicorp.com/sidecar-proxy-port annotation.")
 
 	// Metrics setting flags.
 	c.flagSet.BoolVar(&c.flagDefaultEnableMetrics, "default-enable-metrics", false, "Default for enabling connect service metrics.")
@@ -171,12 +356,17 @@ func (c *Command) init() {
 	c.flagSet.StringVar(&c.flagDefaultMergedMetricsPort, "default-merged-metrics-port", "20100", "Default port for merged metrics endpoint on the consul-sidecar.")
 	c.flagSet.StringVar(&c.flagDefaultPrometheusScrapePort, "default-prometheus-scrape-port", "20200", "Default port where Prometheus scrapes connect metrics from.")
 	c.flagSet.StringVar(&c.flagDefaultPrometheusScrapePath, "default-prometheus-scrape-path", "/metrics", "Default path where Prometheus scrapes connect metrics from.")
+	c.flagSet.StringVar(&c.flagDefaultPrometheusScrapeScheme, "default-prometheus-scrape-scheme", "",
+		"Default scheme, http or https, Prometheus scrapes connect metrics with. If not set, Prometheus uses http.")
 
 	// Init container resource setting flags.
 	c.flagSet.StringVar(&c.flagInitContainerCPURequest, "init-container-cpu-request", "50m", "Init container CPU request.")
 	c.flagSet.StringVar(&c.flagInitContainerCPULimit, "init-container-cpu-limit", "50m", "Init container CPU limit.")
 	c.flagSet.StringVar(&c.flagInitContainerMemoryRequest, "init-container-memory-request", "25Mi", "Init container memory request.")
 	c.flagSet.StringVar(&c.flagInitContainerMemoryLimit, "init-container-memory-limit", "150Mi", "Init container memory limit.")
+	c.flagSet.Int64Var(&c.flagInitContainerRunAsUser, "init-container-run-as-user", 0,
+		"Non-root user id the init container runs as if transparent proxy isn't enabled for the pod. "+
+			"If 0, the init container runs as the pod's user.")
 
 	// Consul sidecar resource setting flags.
 	c.flagSet.StringVar(&c.flagConsulSidecarCPURequest, "consul-sidecar-cpu-request", "20m", "Consul sidecar CPU request.")
@@ -213,6 +403,121 @@ func (c *Command) Run(args []string) int {
 		c.UI.Error("-envoy-image must be set")
 		return 1
 	}
+
+	// The wildcard namespace only matches namespaces, services can't be registered into it.
+	if c.flagEnableNamespaces && !c.flagEnableK8SNSMirroring && c.flagConsulDestinationNamespace == namespaces.WildcardNamespace {
+		c.UI.Error(fmt.Sprintf("-consul-destination-namespace cannot be the wildcard namespace %q", namespaces.WildcardNamespace))
+		return 1
+	}
+
+	if c.flagACLLoginRetries == 0 {
+		c.UI.Error("-acl-auth-method-login-retries must be at least 1")
+		return 1
+	}
+	if c.flagDefaultSidecarProxyPort < 1 || c.flagDefaultSidecarProxyPort > 65535 {
+		c.UI.Error("-default-sidecar-proxy-port must be in the valid port range 1-65535")
+		return 1
+	}
+	if c.flagInjectionPreviewListen != "" {
+		if _, _, err := net.SplitHostPort(c.flagInjectionPreviewListen); err != nil {
+			c.UI.Error(fmt.Sprintf("-injection-preview-listen is invalid: %s", err))
+			return 1
+		}
+	}
+	if c.flagDefaultPrometheusScrapeScheme != "" && c.flagDefaultPrometheusScrapeScheme != "http" && c.flagDefaultPrometheusScrapeScheme != "https" {
+		c.UI.Error("-default-prometheus-scrape-scheme must be http or https")
+		return 1
+	}
+	if c.flagACLAuthMethod != "" && (c.flagConsulServiceNamePrefix != "" || c.flagConsulServiceNameSuffix != "") {
+		c.UI.Error("-consul-service-name-prefix and -consul-service-name-suffix cannot be set when -acl-auth-method is set")
+		return 1
+	}
+	switch c.flagSharedProcessNamespacePolicy {
+	case connectinject.SharedProcessNamespaceAllow, connectinject.SharedProcessNamespaceWarn, connectinject.SharedProcessNamespaceDeny:
+	default:
+		c.UI.Error(fmt.Sprintf("-shared-process-namespace-policy must be one of %q, %q or %q",
+			connectinject.SharedProcessNamespaceAllow, connectinject.SharedProcessNamespaceWarn, connectinject.SharedProcessNamespaceDeny))
+		return 1
+	}
+	if c.flagInitContainerRunAsUser < 0 {
+		c.UI.Error("-init-container-run-as-user must not be negative")
+		return 1
+	}
+	if c.flagMaxConsulAnnotations < 0 {
+		c.UI.Error("-max-pod-consul-annotations must not be negative")
+		return 1
+	}
+	if c.flagMaxConsulAnnotationsSize < 0 {
+		c.UI.Error("-max-pod-consul-annotations-size must not be negative")
+		return 1
+	}
+	if c.flagWindowsPodPolicy != connectinject.WindowsPodSkip && c.flagWindowsPodPolicy != connectinject.WindowsPodDeny {
+		c.UI.Error(fmt.Sprintf("-windows-pod-policy must be %q or %q", connectinject.WindowsPodSkip, connectinject.WindowsPodDeny))
+		return 1
+	}
+	if c.flagMeshGatewayAddress != "" {
+		if _, _, err := net.SplitHostPort(c.flagMeshGatewayAddress); err != nil {
+			c.UI.Error(fmt.Sprintf("-mesh-gateway-address must be of the form host:port: %s", err))
+			return 1
+		}
+	}
+	for flag, port := range map[string]int{
+		"-consul-http-port":  c.flagConsulHTTPPort,
+		"-consul-https-port": c.flagConsulHTTPSPort,
+		"-consul-grpc-port":  c.flagConsulGRPCPort,
+	} {
+		if port < 1 || port > 65535 {
+			c.UI.Error(fmt.Sprintf("%s must be a valid port number", flag))
+			return 1
+		}
+	}
+	if c.flagConsulCACertSecretName != "" {
+		if errs := validation.IsDNS1123Subdomain(c.flagConsulCACertSecretName); len(errs) > 0 {
+			c.UI.Error(fmt.Sprintf("-consul-ca-cert-secret-name %q is not a valid Secret name: %s", c.flagConsulCACertSecretName, strings.Join(errs, ", ")))
+			return 1
+		}
+		if c.flagConsulCACertSecretKey == "" {
+			c.UI.Error("-consul-ca-cert-secret-key must be set if -consul-ca-cert-secret-name is set")
+			return 1
+		}
+	}
+	var envoyEnvFrom []corev1.EnvFromSource
+	for _, name := range c.flagEnvoyEnvFromConfigMaps {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			c.UI.Error(fmt.Sprintf("-envoy-env-from-configmap %q is not a valid ConfigMap name: %s", name, strings.Join(errs, ", ")))
+			return 1
+		}
+		envoyEnvFrom = append(envoyEnvFrom, corev1.EnvFromSource{
+			ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}},
+		})
+	}
+	for _, name := range c.flagEnvoyEnvFromSecrets {
+		if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+			c.UI.Error(fmt.Sprintf("-envoy-env-from-secret %q is not a valid Secret name: %s", name, strings.Join(errs, ", ")))
+			return 1
+		}
+		envoyEnvFrom = append(envoyEnvFrom, corev1.EnvFromSource{
+			SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: name}},
+		})
+	}
+	var objectSelector labels.Selector
+	if c.flagObjectSelector != "" {
+		var err error
+		objectSelector, err = labels.Parse(c.flagObjectSelector)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error parsing -object-selector %q: %s", c.flagObjectSelector, err))
+			return 1
+		}
+	}
+	var podLabelSelector labels.Selector
+	if c.flagPodLabelSelector != "" {
+		var err error
+		podLabelSelector, err = labels.Parse(c.flagPodLabelSelector)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error parsing -pod-label-selector %q: %s", c.flagPodLabelSelector, err))
+			return 1
+		}
+	}
 	if c.flagWriteServiceDefaults {
 		c.UI.Error("-enable-central-config is no longer supported")
 		return 1
@@ -328,6 +633,17 @@ func (c *Command) Run(args []string) int {
 		}
 	}
 
+	// load gRPC CA file contents
+	var consulGRPCCACert []byte
+	if c.flagConsulGRPCCAFile != "" {
+		var err error
+		consulGRPCCACert, err = ioutil.ReadFile(c.flagConsulGRPCCAFile)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("error reading Consul's gRPC CA cert file %q: %s", c.flagConsulGRPCCAFile, err))
+			return 1
+		}
+	}
+
 	// Set up Consul client
 	if c.consulClient == nil {
 		var err error
@@ -345,6 +661,8 @@ func (c *Command) Run(args []string) int {
 	// Convert allow/deny lists to sets
 	allowK8sNamespaces := flags.ToSet(c.flagAllowK8sNamespacesList)
 	denyK8sNamespaces := flags.ToSet(c.flagDenyK8sNamespacesList)
+	allowConsulNamespaceOverrides := flags.ToSet(c.flagAllowConsulNamespaceOverrides)
+	alwaysAllowK8sNamespaces := flags.ToSet(c.flagAlwaysAllowK8sNamespacesList)
 
 	var zapLevel zapcore.Level
 	if err := zapLevel.UnmarshalText([]byte(c.flagLogLevel)); err != nil {
@@ -382,33 +700,60 @@ func (c *Command) Run(args []string) int {
 	}
 
 	metricsConfig := connectinject.MetricsConfig{
-		DefaultEnableMetrics:        c.flagDefaultEnableMetrics,
-		DefaultEnableMetricsMerging: c.flagDefaultEnableMetricsMerging,
-		DefaultMergedMetricsPort:    c.flagDefaultMergedMetricsPort,
-		DefaultPrometheusScrapePort: c.flagDefaultPrometheusScrapePort,
-		DefaultPrometheusScrapePath: c.flagDefaultPrometheusScrapePath,
+		DefaultEnableMetrics:          c.flagDefaultEnableMetrics,
+		DefaultEnableMetricsMerging:   c.flagDefaultEnableMetricsMerging,
+		DefaultMergedMetricsPort:      c.flagDefaultMergedMetricsPort,
+		DefaultPrometheusScrapePort:   c.flagDefaultPrometheusScrapePort,
+		DefaultPrometheusScrapePath:   c.flagDefaultPrometheusScrapePath,
+		DefaultPrometheusScrapeScheme: c.flagDefaultPrometheusScrapeScheme,
+	}
+
+	var auditLog *connectinject.AuditLogger
+	if c.flagAuditLogPath == "-" {
+		auditLog = connectinject.NewAuditLogger(os.Stdout)
+	} else if c.flagAuditLogPath != "" {
+		auditFile, err := os.OpenFile(c.flagAuditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error opening -audit-log-path %q: %s", c.flagAuditLogPath, err))
+			return 1
+		}
+		defer auditFile.Close()
+		auditLog = connectinject.NewAuditLogger(auditFile)
 	}
 
 	if err = (&connectinject.EndpointsController{
-		Client:                     mgr.GetClient(),
-		ConsulClient:               c.consulClient,
-		ConsulScheme:               consulURL.Scheme,
-		ConsulPort:                 consulURL.Port(),
-		AllowK8sNamespacesSet:      allowK8sNamespaces,
-		DenyK8sNamespacesSet:       denyK8sNamespaces,
-		MetricsConfig:              metricsConfig,
-		ConsulClientCfg:            cfg,
-		EnableConsulNamespaces:     c.flagEnableNamespaces,
-		ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-		EnableNSMirroring:          c.flagEnableK8SNSMirroring,
-		NSMirroringPrefix:          c.flagK8SNSMirroringPrefix,
-		CrossNSACLPolicy:           c.flagCrossNamespaceACLPolicy,
-		EnableTransparentProxy:     c.flagEnableTransparentProxy,
-		Log:                        ctrl.Log.WithName("controller").WithName("endpoints"),
-		Scheme:                     mgr.GetScheme(),
-		ReleaseName:                c.flagReleaseName,
-		ReleaseNamespace:           c.flagReleaseNamespace,
-		Context:                    ctx,
+		Client:                           mgr.GetClient(),
+		ConsulClient:                     c.consulClient,
+		ConsulScheme:                     consulURL.Scheme,
+		ConsulPort:                       consulURL.Port(),
+		AllowK8sNamespacesSet:            allowK8sNamespaces,
+		AllowConsulNamespaceOverridesSet: allowConsulNamespaceOverrides,
+		DenyK8sNamespacesSet:             denyK8sNamespaces,
+		MetricsConfig:                    metricsConfig,
+		ConsulClientCfg:                  cfg,
+		EnableConsulNamespaces:           c.flagEnableNamespaces,
+		ConsulDestinationNamespace:       c.flagConsulDestinationNamespace,
+		EnableNSMirroring:                c.flagEnableK8SNSMirroring,
+		NSMirroringPrefix:                c.flagK8SNSMirroringPrefix,
+		NSMirroringSeparator:             c.flagK8SNSMirroringSeparator,
+		CrossNSACLPolicy:                 c.flagCrossNamespaceACLPolicy,
+		EnableTransparentProxy:           c.flagEnableTransparentProxy,
+		ProxyDriftCheckPeriod:            c.flagProxyDriftCheckPeriod,
+		Recorder:                         mgr.GetEventRecorderFor("endpoints-controller"),
+		Log:                              ctrl.Log.WithName("controller").WithName("endpoints"),
+		Scheme:                           mgr.GetScheme(),
+		ReleaseName:                      c.flagReleaseName,
+		ReleaseNamespace:                 c.flagReleaseNamespace,
+		ClusterName:                      c.flagClusterName,
+		UseEndpointSlices:                c.flagUseEndpointSlices,
+		RegistrationTimeout:              c.flagRegistrationTimeout,
+		ReconcileOnPodChanges:            c.flagReconcileOnPodChanges,
+		ConsistentReads:                  c.flagConsistentReads,
+		PodLabelSelector:                 podLabelSelector,
+		AuditLog:                         auditLog,
+		ConsulServiceNamePrefix:          c.flagConsulServiceNamePrefix,
+		ConsulServiceNameSuffix:          c.flagConsulServiceNameSuffix,
+		Context:                          ctx,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", connectinject.EndpointsController{})
 		return 1
@@ -416,33 +761,89 @@ func (c *Command) Run(args []string) int {
 
 	mgr.GetWebhookServer().CertDir = c.flagCertDir
 
-	mgr.GetWebhookServer().Register("/mutate",
-		&webhook.Admission{Handler: &connectinject.Handler{
-			ConsulClient:               c.consulClient,
-			ImageConsul:                c.flagConsulImage,
-			ImageEnvoy:                 c.flagEnvoyImage,
-			EnvoyExtraArgs:             c.flagEnvoyExtraArgs,
-			ImageConsulK8S:             c.flagConsulK8sImage,
-			RequireAnnotation:          !c.flagDefaultInject,
-			AuthMethod:                 c.flagACLAuthMethod,
-			ConsulCACert:               string(consulCACert),
-			DefaultProxyCPURequest:     sidecarProxyCPURequest,
-			DefaultProxyCPULimit:       sidecarProxyCPULimit,
-			DefaultProxyMemoryRequest:  sidecarProxyMemoryRequest,
-			DefaultProxyMemoryLimit:    sidecarProxyMemoryLimit,
-			MetricsConfig:              metricsConfig,
-			InitContainerResources:     initResources,
-			ConsulSidecarResources:     consulSidecarResources,
-			AllowK8sNamespacesSet:      allowK8sNamespaces,
-			DenyK8sNamespacesSet:       denyK8sNamespaces,
-			EnableNamespaces:           c.flagEnableNamespaces,
-			ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
-			EnableK8SNSMirroring:       c.flagEnableK8SNSMirroring,
-			K8SNSMirroringPrefix:       c.flagK8SNSMirroringPrefix,
-			CrossNamespaceACLPolicy:    c.flagCrossNamespaceACLPolicy,
-			EnableTransparentProxy:     c.flagEnableTransparentProxy,
-			Log:                        ctrl.Log.WithName("handler").WithName("connect"),
-		}})
+	injectHandler := &connectinject.Handler{
+		ConsulClient:                     c.consulClient,
+		ImageConsul:                      c.flagConsulImage,
+		ImageConsulCopy:                  c.flagConsulCopyImage,
+		ImageEnvoy:                       c.flagEnvoyImage,
+		EnvoyExtraArgs:                   c.flagEnvoyExtraArgs,
+		EnvoyExtraEnvFrom:                envoyEnvFrom,
+		ImageConsulK8S:                   c.flagConsulK8sImage,
+		RequireAnnotation:                !c.flagDefaultInject,
+		AuthMethod:                       c.flagACLAuthMethod,
+		ACLLoginRetries:                  c.flagACLLoginRetries,
+		ACLLoginTimeout:                  c.flagACLLoginTimeout,
+		ConsulCACert:                     string(consulCACert),
+		ConsulGRPCCACert:                 string(consulGRPCCACert),
+		ConsulCACertSecretName:           c.flagConsulCACertSecretName,
+		ConsulCACertSecretKey:            c.flagConsulCACertSecretKey,
+		ConsulHTTPPort:                   c.flagConsulHTTPPort,
+		ConsulHTTPSPort:                  c.flagConsulHTTPSPort,
+		ConsulGRPCPort:                   c.flagConsulGRPCPort,
+		DefaultProxyCPURequest:           sidecarProxyCPURequest,
+		DefaultProxyCPULimit:             sidecarProxyCPULimit,
+		DefaultProxyMemoryRequest:        sidecarProxyMemoryRequest,
+		DefaultProxyMemoryLimit:          sidecarProxyMemoryLimit,
+		DefaultProxyPublicListenerPort:   c.flagDefaultSidecarProxyPort,
+		MetricsConfig:                    metricsConfig,
+		InitContainerResources:           initResources,
+		InitContainerRunAsUser:           c.flagInitContainerRunAsUser,
+		ConsulSidecarResources:           consulSidecarResources,
+		AllowK8sNamespacesSet:            allowK8sNamespaces,
+		AllowConsulNamespaceOverridesSet: allowConsulNamespaceOverrides,
+		DenyK8sNamespacesSet:             denyK8sNamespaces,
+		WarnOnDeniedNamespaceInjection:   c.flagWarnOnDeniedInjection,
+		RequireServicePort:               c.flagRequireServicePort,
+		MaxConsulAnnotations:             c.flagMaxConsulAnnotations,
+		MaxConsulAnnotationsSize:         c.flagMaxConsulAnnotationsSize,
+		AlwaysAllowNamespacesSet:         alwaysAllowK8sNamespaces,
+		ObjectSelector:                   objectSelector,
+		PodLabelSelector:                 podLabelSelector,
+		EnableNamespaces:                 c.flagEnableNamespaces,
+		ConsulDestinationNamespace:       c.flagConsulDestinationNamespace,
+		EnableK8SNSMirroring:             c.flagEnableK8SNSMirroring,
+		K8SNSMirroringPrefix:             c.flagK8SNSMirroringPrefix,
+		K8SNSMirroringSeparator:          c.flagK8SNSMirroringSeparator,
+		CrossNamespaceACLPolicy:          c.flagCrossNamespaceACLPolicy,
+		EnableTransparentProxy:           c.flagEnableTransparentProxy,
+		EnableProxyLifecycle:             c.flagEnableProxyLifecycle,
+		EnableDependencyChecks:           c.flagEnableDependencyChecks,
+		SkipExistingSidecars:             c.flagSkipExistingSidecars,
+		SharedProcessNamespacePolicy:     c.flagSharedProcessNamespacePolicy,
+		WindowsPodPolicy:                 c.flagWindowsPodPolicy,
+		MeshGatewayAddress:               c.flagMeshGatewayAddress,
+		Clientset:                        c.clientset,
+		Log:                              ctrl.Log.WithName("handler").WithName("connect"),
+	}
+	mgr.GetWebhookServer().Register("/mutate", &webhook.Admission{Handler: injectHandler})
+	if c.flagInjectionPreviewListen != "" {
+		// The preview endpoint isn't registered with the webhook server since it isn't authenticated.
+		// It's served on its own listener so that it's only reachable where it's been explicitly bound.
+		mux := http.NewServeMux()
+		mux.HandleFunc("/preview", injectHandler.HandlePreview)
+		previewServer := &http.Server{Addr: c.flagInjectionPreviewListen, Handler: mux}
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			go func() {
+				<-ctx.Done()
+				_ = previewServer.Shutdown(context.Background())
+			}()
+			setupLog.Info("serving the injection preview endpoint", "addr", c.flagInjectionPreviewListen)
+			if err := previewServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		})); err != nil {
+			setupLog.Error(err, "unable to add the injection preview server")
+			return 1
+		}
+	}
+
+	// Serve liveness and readiness probes alongside the webhook. Readiness only
+	// passes once the manager's cache has synced.
+	health := &connectinject.HealthCheck{}
+	mgr.GetWebhookServer().Register("/health/ready", http.HandlerFunc(health.HandleReady))
+	mgr.GetWebhookServer().Register("/health/live", http.HandlerFunc(health.HandleLive))
+	go health.WaitForCacheSync(ctx, mgr.GetCache())
 
 	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
@@ -452,13 +853,6 @@ func (c *Command) Run(args []string) int {
 	return 0
 }
 
-func (c *Command) handleReady(rw http.ResponseWriter, req *http.Request) {
-	// Always ready at this point. The main readiness check is whether
-	// there is a TLS certificate. If we reached this point it means we
-	// served a TLS certificate.
-	rw.WriteHeader(204)
-}
-
 func (c *Command) parseAndValidateResourceFlags() (corev1.ResourceRequirements, corev1.ResourceRequirements, error) {
 	// Init container
 	var initContainerCPULimit, initContainerCPURequest, initContainerMemoryLimit, initContainerMemoryRequest resource.Quantity
@@ -27,6 +27,106 @@ func TestRun_FlagValidation(t *testing.T) {
 			flags:  []string{"-consul-k8s-image", "foo", "-consul-image", "foo"},
 			expErr: "-envoy-image must be set",
 		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-acl-auth-method-login-retries", "0"},
+			expErr: "-acl-auth-method-login-retries must be at least 1",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-object-selector", "mesh in enabled"},
+			expErr: "Error parsing -object-selector \"mesh in enabled\"",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-pod-label-selector", "mesh in enabled"},
+			expErr: "Error parsing -pod-label-selector \"mesh in enabled\"",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-default-sidecar-proxy-port", "0"},
+			expErr: "-default-sidecar-proxy-port must be in the valid port range 1-65535",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-injection-preview-listen", "8081"},
+			expErr: "-injection-preview-listen is invalid: address 8081: missing port in address",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-default-prometheus-scrape-scheme", "tcp"},
+			expErr: "-default-prometheus-scrape-scheme must be http or https",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-acl-auth-method", "consul-k8s-auth-method", "-consul-service-name-prefix", "east-"},
+			expErr: "-consul-service-name-prefix and -consul-service-name-suffix cannot be set when -acl-auth-method is set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-shared-process-namespace-policy", "ignore"},
+			expErr: `-shared-process-namespace-policy must be one of "allow", "warn" or "deny"`,
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-windows-pod-policy", "inject"},
+			expErr: `-windows-pod-policy must be "skip" or "deny"`,
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-mesh-gateway-address", "10.0.0.1"},
+			expErr: "-mesh-gateway-address must be of the form host:port",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-max-pod-consul-annotations", "-1"},
+			expErr: "-max-pod-consul-annotations must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-max-pod-consul-annotations-size", "-1"},
+			expErr: "-max-pod-consul-annotations-size must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-envoy-env-from-configmap", "Tracing_Config"},
+			expErr: `-envoy-env-from-configmap "Tracing_Config" is not a valid ConfigMap name`,
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-envoy-env-from-secret", "tracing/creds"},
+			expErr: `-envoy-env-from-secret "tracing/creds" is not a valid Secret name`,
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-consul-ca-cert-secret-name", "Consul_CA"},
+			expErr: `-consul-ca-cert-secret-name "Consul_CA" is not a valid Secret name`,
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-consul-ca-cert-secret-name", "consul-ca-cert", "-consul-ca-cert-secret-key", ""},
+			expErr: "-consul-ca-cert-secret-key must be set if -consul-ca-cert-secret-name is set",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-consul-grpc-port", "0"},
+			expErr: "-consul-grpc-port must be a valid port number",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-consul-https-port", "65536"},
+			expErr: "-consul-https-port must be a valid port number",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-init-container-run-as-user", "-1"},
+			expErr: "-init-container-run-as-user must not be negative",
+		},
+		{
+			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
+				"-enable-namespaces", "-consul-destination-namespace", "*"},
+			expErr: `-consul-destination-namespace cannot be the wildcard namespace "*"`,
+		},
 		{
 			flags: []string{"-consul-k8s-image", "foo", "-consul-image", "foo", "-envoy-image", "envoy:1.16.0",
 				"-log-level", "invalid"},
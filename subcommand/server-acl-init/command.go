@@ -73,9 +73,11 @@ type Command struct {
 	flagConsulSyncDestinationNamespace   string // Consul namespace to register all catalog sync services into if not mirroring
 	flagEnableSyncK8SNSMirroring         bool   // Enables mirroring of k8s namespaces into Consul for catalog sync
 	flagSyncK8SNSMirroringPrefix         string // Prefix added to Consul namespaces created when mirroring catalog sync services
+	flagSyncK8SNSMirroringSeparator      string // Separator added between the catalog sync mirroring prefix and the k8s namespace
 	flagConsulInjectDestinationNamespace string // Consul namespace to register all injected services into if not mirroring
 	flagEnableInjectK8SNSMirroring       bool   // Enables mirroring of k8s namespaces into Consul for Connect inject
 	flagInjectK8SNSMirroringPrefix       string // Prefix added to Consul namespaces created when mirroring injected services
+	flagInjectK8SNSMirroringSeparator    string // Separator added between the Connect inject mirroring prefix and the k8s namespace
 
 	// Flag to support a custom bootstrap token
 	flagBootstrapTokenFile string
@@ -174,6 +176,9 @@ func (c *Command) init() {
 	c.flags.StringVar(&c.flagSyncK8SNSMirroringPrefix, "sync-k8s-namespace-mirroring-prefix", "",
 		"[Enterprise Only] Prefix that will be added to all k8s namespaces mirrored into Consul by catalog sync "+
 			"if mirroring is enabled.")
+	c.flags.StringVar(&c.flagSyncK8SNSMirroringSeparator, "sync-k8s-namespace-mirroring-separator", "",
+		"[Enterprise Only] Separator added between '-sync-k8s-namespace-mirroring-prefix' and the k8s namespace "+
+			"by catalog sync. Ignored if the prefix is empty.")
 	c.flags.StringVar(&c.flagConsulInjectDestinationNamespace, "consul-inject-destination-namespace", consulDefaultNamespace,
 		"[Enterprise Only] Indicates which Consul namespace that the Connect injector will register services into. If "+
 			"'-enable-inject-k8s-namespace-mirroring' is true, this is not used.")
@@ -182,6 +187,9 @@ func (c *Command) init() {
 	c.flags.StringVar(&c.flagInjectK8SNSMirroringPrefix, "inject-k8s-namespace-mirroring-prefix", "",
 		"[Enterprise Only] Prefix that will be added to all k8s namespaces mirrored into Consul by Connect inject "+
 			"if mirroring is enabled.")
+	c.flags.StringVar(&c.flagInjectK8SNSMirroringSeparator, "inject-k8s-namespace-mirroring-separator", "",
+		"[Enterprise Only] Separator added between '-inject-k8s-namespace-mirroring-prefix' and the k8s namespace "+
+			"by Connect inject. Ignored if the prefix is empty.")
 
 	c.flags.BoolVar(&c.flagCreateACLReplicationToken, "create-acl-replication-token", false,
 		"Toggle for creating a token for ACL replication between datacenters.")
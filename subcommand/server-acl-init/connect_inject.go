@@ -201,7 +201,7 @@ func (c *Command) createAuthMethodTmpl(authMethodName string) (api.ACLAuthMethod
 	// Add options for mirroring namespaces
 	if c.flagEnableNamespaces && c.flagEnableInjectK8SNSMirroring {
 		authMethodTmpl.Config["MapNamespaces"] = true
-		authMethodTmpl.Config["ConsulNamespacePrefix"] = c.flagInjectK8SNSMirroringPrefix
+		authMethodTmpl.Config["ConsulNamespacePrefix"] = namespaces.MirroringPrefix(c.flagInjectK8SNSMirroringPrefix, c.flagInjectK8SNSMirroringSeparator)
 	}
 
 	return authMethodTmpl, nil
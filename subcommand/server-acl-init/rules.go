@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"strings"
 	"text/template"
+
+	"github.com/hashicorp/consul-k8s/namespaces"
 )
 
 type rulesData struct {
@@ -282,10 +284,10 @@ func (c *Command) rulesData() rulesData {
 		EnableNamespaces:        c.flagEnableNamespaces,
 		SyncConsulDestNS:        c.flagConsulSyncDestinationNamespace,
 		SyncEnableNSMirroring:   c.flagEnableSyncK8SNSMirroring,
-		SyncNSMirroringPrefix:   c.flagSyncK8SNSMirroringPrefix,
+		SyncNSMirroringPrefix:   namespaces.MirroringPrefix(c.flagSyncK8SNSMirroringPrefix, c.flagSyncK8SNSMirroringSeparator),
 		InjectConsulDestNS:      c.flagConsulInjectDestinationNamespace,
 		InjectEnableNSMirroring: c.flagEnableInjectK8SNSMirroring,
-		InjectNSMirroringPrefix: c.flagInjectK8SNSMirroringPrefix,
+		InjectNSMirroringPrefix: namespaces.MirroringPrefix(c.flagInjectK8SNSMirroringPrefix, c.flagInjectK8SNSMirroringSeparator),
 		SyncConsulNodeName:      c.flagSyncConsulNodeName,
 	}
 }
@@ -599,12 +599,13 @@ namespace_prefix "" {
 
 func TestControllerRules(t *testing.T) {
 	cases := []struct {
-		Name             string
-		EnableNamespaces bool
-		DestConsulNS     string
-		Mirroring        bool
-		MirroringPrefix  string
-		Expected         string
+		Name               string
+		EnableNamespaces   bool
+		DestConsulNS       string
+		Mirroring          bool
+		MirroringPrefix    string
+		MirroringSeparator string
+		Expected           string
 	}{
 		{
 			Name:             "namespaces=disabled",
@@ -650,6 +651,20 @@ namespace_prefix "prefix-" {
     policy = "write"
     intentions = "write"
   }
+}`,
+		},
+		{
+			Name:               "namespaces=enabled, mirroring=true, mirroringPrefix=prefix, mirroringSeparator=-",
+			EnableNamespaces:   true,
+			Mirroring:          true,
+			MirroringPrefix:    "prefix",
+			MirroringSeparator: "-",
+			Expected: `operator = "write"
+namespace_prefix "prefix-" {
+  service_prefix "" {
+    policy = "write"
+    intentions = "write"
+  }
 }`,
 		},
 	}
@@ -663,6 +678,7 @@ namespace_prefix "prefix-" {
 				flagConsulInjectDestinationNamespace: tt.DestConsulNS,
 				flagEnableInjectK8SNSMirroring:       tt.Mirroring,
 				flagInjectK8SNSMirroringPrefix:       tt.MirroringPrefix,
+				flagInjectK8SNSMirroringSeparator:    tt.MirroringSeparator,
 			}
 
 			rules, err := cmd.controllerRules()
@@ -16,6 +16,7 @@ import (
 	catalogtoconsul "github.com/hashicorp/consul-k8s/catalog/to-consul"
 	catalogtok8s "github.com/hashicorp/consul-k8s/catalog/to-k8s"
 	"github.com/hashicorp/consul-k8s/helper/controller"
+	"github.com/hashicorp/consul-k8s/namespaces"
 	"github.com/hashicorp/consul-k8s/subcommand"
 	"github.com/hashicorp/consul-k8s/subcommand/common"
 	"github.com/hashicorp/consul-k8s/subcommand/flags"
@@ -60,6 +61,7 @@ type Command struct {
 	flagDenyK8sNamespacesList      []string // K8s namespaces to deny injection (has precedence)
 	flagEnableK8SNSMirroring       bool     // Enables mirroring of k8s namespaces into Consul
 	flagK8SNSMirroringPrefix       string   // Prefix added to Consul namespaces created when mirroring
+	flagK8SNSMirroringSeparator    string   // Separator added between the mirroring prefix and the k8s namespace
 	flagCrossNamespaceACLPolicy    string   // The name of the ACL policy to add to every created namespace if ACLs are enabled
 
 	consulClient *api.Client
@@ -136,6 +138,10 @@ func (c *Command) init() {
 		"namespace mirroring.")
 	c.flags.StringVar(&c.flagK8SNSMirroringPrefix, "k8s-namespace-mirroring-prefix", "",
 		"[Enterprise Only] Prefix that will be added to all k8s namespaces mirrored into Consul if mirroring is enabled.")
+	c.flags.StringVar(&c.flagK8SNSMirroringSeparator, "k8s-namespace-mirroring-separator", "",
+		"[Enterprise Only] Separator added between '-k8s-namespace-mirroring-prefix' and the k8s namespace, "+
+			"so that k8s namespaces are mirrored into Consul namespaces named <prefix><separator><k8s namespace>. "+
+			"Ignored if the prefix is empty.")
 	c.flags.StringVar(&c.flagCrossNamespaceACLPolicy, "consul-cross-namespace-acl-policy", "",
 		"[Enterprise Only] Name of the ACL policy to attach to all created Consul namespaces to allow service "+
 			"discovery across Consul namespaces. Only necessary if ACLs are enabled.")
@@ -271,7 +277,7 @@ func (c *Command) Run(args []string) int {
 				EnableNamespaces:           c.flagEnableNamespaces,
 				ConsulDestinationNamespace: c.flagConsulDestinationNamespace,
 				EnableK8SNSMirroring:       c.flagEnableK8SNSMirroring,
-				K8SNSMirroringPrefix:       c.flagK8SNSMirroringPrefix,
+				K8SNSMirroringPrefix:       namespaces.MirroringPrefix(c.flagK8SNSMirroringPrefix, c.flagK8SNSMirroringSeparator),
 				ConsulNodeName:             c.flagConsulNodeName,
 			},
 		}